@@ -0,0 +1,200 @@
+package unixfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	proto "github.com/gogo/protobuf/proto"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// auditMode is set (to 1) when the encoding audit is enabled.
+var auditMode int32
+
+func init() {
+	if os.Getenv("GO_UNIXFS_AUDIT") != "" {
+		SetAuditMode(true)
+	}
+}
+
+// SetAuditMode enables or disables the encoding audit. In audit mode every
+// unixfs `Data` message this package encodes is decoded back and compared
+// field by field (including the presence of optional fields) with the
+// original, and then re-encoded to check the bytes are stable. Any
+// difference would silently change CIDs between versions of the package (or
+// of the protobuf library), so it is reported as an `*EncodingDriftError`.
+//
+// The mode can also be enabled for a whole test run with the
+// `GO_UNIXFS_AUDIT` environment variable (e.g. `GO_UNIXFS_AUDIT=1 go test
+// ./...`), which is what releases should be gated on.
+func SetAuditMode(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&auditMode, v)
+}
+
+// AuditMode returns whether the encoding audit is enabled.
+func AuditMode() bool {
+	return atomic.LoadInt32(&auditMode) == 1
+}
+
+// EncodingDriftError reports a unixfs message that doesn't survive an
+// encode/decode round trip unchanged.
+type EncodingDriftError struct {
+	// Field is the name of the first mismatching field, or "bytes" if the
+	// re-encoded message differs.
+	Field string
+}
+
+func (e *EncodingDriftError) Error() string {
+	return fmt.Sprintf("unixfs encoding drift in field %s", e.Field)
+}
+
+// marshalData encodes a `Data` message, auditing it in audit mode.
+func marshalData(pbd *pb.Data) ([]byte, error) {
+	out, err := proto.Marshal(pbd)
+	if err != nil {
+		return nil, err
+	}
+	if AuditMode() {
+		if err := auditData(pbd, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// canonicalData returns a copy of `pbd` in canonical form (see
+// `FSNode.CanonicalBytes`), sharing its byte slices.
+func canonicalData(pbd *pb.Data) *pb.Data {
+	typ := pbd.GetType()
+	c := &pb.Data{Type: &typ, XXX_unrecognized: pbd.XXX_unrecognized}
+	if len(pbd.Data) != 0 {
+		c.Data = pbd.Data
+	}
+	switch typ {
+	case pb.Data_Directory, pb.Data_Symlink, pb.Data_HAMTShard:
+		if pbd.GetFilesize() != 0 {
+			c.Filesize = proto.Uint64(pbd.GetFilesize())
+		}
+	default:
+		c.Filesize = proto.Uint64(pbd.GetFilesize())
+	}
+	if len(pbd.Blocksizes) != 0 {
+		c.Blocksizes = pbd.Blocksizes
+	}
+	if typ == pb.Data_HAMTShard || pbd.GetHashType() != 0 {
+		c.HashType = proto.Uint64(pbd.GetHashType())
+	}
+	if typ == pb.Data_HAMTShard || pbd.GetFanout() != 0 {
+		c.Fanout = proto.Uint64(pbd.GetFanout())
+	}
+	if pbd.GetMode() != 0 {
+		c.Mode = proto.Uint32(pbd.GetMode())
+	}
+	if mtime := pbd.GetMtime(); mtime != nil {
+		c.Mtime = &pb.UnixTime{Seconds: proto.Int64(mtime.GetSeconds()), XXX_unrecognized: mtime.XXX_unrecognized}
+		if nsec := mtime.GetFractionalNanoseconds(); nsec != 0 {
+			c.Mtime.FractionalNanoseconds = proto.Uint32(nsec)
+		}
+	}
+
+	// Sorted by name and without duplicates, the value of a name being the
+	// first one (the one `FSNode.Xattr` returns).
+	xattrs := append([]*pb.Xattr(nil), pbd.Xattrs...)
+	sort.SliceStable(xattrs, func(i, j int) bool { return xattrs[i].GetName() < xattrs[j].GetName() })
+	for i, xattr := range xattrs {
+		if i > 0 && xattr.GetName() == xattrs[i-1].GetName() {
+			continue
+		}
+		cx := &pb.Xattr{Name: proto.String(xattr.GetName()), XXX_unrecognized: xattr.XXX_unrecognized}
+		if len(xattr.Value) != 0 {
+			cx.Value = xattr.Value
+		}
+		c.Xattrs = append(c.Xattrs, cx)
+	}
+	return c
+}
+
+// auditData checks that `encoded` decodes to `orig` and encodes back to the
+// same bytes.
+func auditData(orig *pb.Data, encoded []byte) error {
+	dec := new(pb.Data)
+	if err := proto.Unmarshal(encoded, dec); err != nil {
+		return err
+	}
+
+	switch {
+	case (orig.Type == nil) != (dec.Type == nil) || orig.GetType() != dec.GetType():
+		return &EncodingDriftError{"Type"}
+	case (orig.Data == nil) != (dec.Data == nil) || !bytes.Equal(orig.Data, dec.Data):
+		return &EncodingDriftError{"Data"}
+	case (orig.Filesize == nil) != (dec.Filesize == nil) || orig.GetFilesize() != dec.GetFilesize():
+		return &EncodingDriftError{"filesize"}
+	case !equalUint64s(orig.Blocksizes, dec.Blocksizes):
+		return &EncodingDriftError{"blocksizes"}
+	case (orig.HashType == nil) != (dec.HashType == nil) || orig.GetHashType() != dec.GetHashType():
+		return &EncodingDriftError{"hashType"}
+	case (orig.Fanout == nil) != (dec.Fanout == nil) || orig.GetFanout() != dec.GetFanout():
+		return &EncodingDriftError{"fanout"}
+	case (orig.Mode == nil) != (dec.Mode == nil) || orig.GetMode() != dec.GetMode():
+		return &EncodingDriftError{"mode"}
+	case !equalUnixTimes(orig.Mtime, dec.Mtime):
+		return &EncodingDriftError{"mtime"}
+	case !equalXattrs(orig.Xattrs, dec.Xattrs):
+		return &EncodingDriftError{"xattrs"}
+	case !bytes.Equal(orig.XXX_unrecognized, dec.XXX_unrecognized):
+		return &EncodingDriftError{"unrecognized"}
+	}
+
+	reencoded, err := proto.Marshal(dec)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(reencoded, encoded) {
+		return &EncodingDriftError{"bytes"}
+	}
+	return nil
+}
+
+func equalUint64s(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalUnixTimes(a, b *pb.UnixTime) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return (a.Seconds == nil) == (b.Seconds == nil) && a.GetSeconds() == b.GetSeconds() &&
+		(a.FractionalNanoseconds == nil) == (b.FractionalNanoseconds == nil) &&
+		a.GetFractionalNanoseconds() == b.GetFractionalNanoseconds() &&
+		bytes.Equal(a.XXX_unrecognized, b.XXX_unrecognized)
+}
+
+func equalXattrs(a, b []*pb.Xattr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if (a[i].Name == nil) != (b[i].Name == nil) || a[i].GetName() != b[i].GetName() ||
+			(a[i].Value == nil) != (b[i].Value == nil) || !bytes.Equal(a[i].Value, b[i].Value) ||
+			!bytes.Equal(a[i].XXX_unrecognized, b[i].XXX_unrecognized) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package unixfs
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// TestEncodingAudit pins the encoding of every kind of message this package
+// produces, any change here changes CIDs.
+func TestEncodingAudit(t *testing.T) {
+	SetAuditMode(true)
+	defer SetAuditMode(false)
+
+	file := NewFSNode(TFile)
+	file.AddBlockSize(262144)
+	file.AddBlockSize(1000)
+
+	must := func(b []byte, err error) []byte {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for _, tc := range []struct {
+		name     string
+		encoded  []byte
+		expected string
+	}{
+		{"EmptyFile", FilePBData(nil, 0), "08021800"},
+		{"File", FilePBData([]byte("hello"), 5), "0802120568656c6c6f1805"},
+		{"Directory", FolderPBData(), "0801"},
+		{"Raw", WrapData([]byte("raw")), "080012037261771803"},
+		{"EmptyRaw", WrapData(nil), "08001800"},
+		{"FileWithChildren", must(file.GetBytes()), "080218e887102080801020e807"},
+		{"Symlink", must(SymlinkData("/foo/bar")), "080412082f666f6f2f626172"},
+		{"HAMTShard", must(HAMTShardData([]byte{0xff, 0x01}, 256, 0x22)), "08051202ff012822308002"},
+		{"Metadata", must(BytesForMetadata(&Metadata{MimeType: "text/plain", Size: 42})), "0803120c0a0a746578742f706c61696e182a"},
+	} {
+		if actual := hex.EncodeToString(tc.encoded); actual != tc.expected {
+			t.Errorf("%s: encoding drifted: expected %s, got %s", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestAuditDetectsDrift(t *testing.T) {
+	typ := pb.Data_File
+	orig := &pb.Data{Type: &typ, Filesize: proto.Uint64(0)}
+	encoded, err := proto.Marshal(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auditData(orig, encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// An encoder dropping the (present but zero) filesize would change CIDs.
+	dropped, err := proto.Marshal(&pb.Data{Type: &typ})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var drift *EncodingDriftError
+	if err := auditData(orig, dropped); !errors.As(err, &drift) || drift.Field != "filesize" {
+		t.Fatalf("expected filesize drift, got %v", err)
+	}
+
+	// Nor dropping an empty extended attribute value.
+	orig.Xattrs = []*pb.Xattr{{Name: proto.String("user.a"), Value: []byte{}}}
+	dropped, err = proto.Marshal(&pb.Data{Type: &typ, Filesize: proto.Uint64(0), Xattrs: []*pb.Xattr{{Name: proto.String("user.a")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auditData(orig, dropped); !errors.As(err, &drift) || drift.Field != "xattrs" {
+		t.Fatalf("expected xattrs drift, got %v", err)
+	}
+}
+
+func TestCanonicalBytes(t *testing.T) {
+	SetAuditMode(true)
+	defer SetAuditMode(false)
+
+	canonical := func(n *FSNode) string {
+		b, err := n.CanonicalBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hex.EncodeToString(b)
+	}
+	must := func(b []byte, err error) []byte {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// The messages built by this package already are in canonical form.
+	file := NewFSNode(TFile)
+	file.AddBlockSize(262144)
+	file.AddBlockSize(1000)
+	for _, b := range [][]byte{
+		FilePBData(nil, 0),
+		FilePBData([]byte("hello"), 5),
+		FolderPBData(),
+		WrapData([]byte("raw")),
+		must(file.GetBytes()),
+		must(SymlinkData("/foo/bar")),
+		must(HAMTShardData([]byte{0xff, 0x01}, 256, 0x22)),
+		must(BytesForMetadata(&Metadata{MimeType: "text/plain", Size: 42})),
+	} {
+		n, err := FSNodeFromBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := canonical(n); actual != hex.EncodeToString(b) {
+			t.Errorf("expected canonical encoding %x, got %s", b, actual)
+		}
+	}
+
+	typ := TFile
+	zero := proto.Uint32(0)
+	variants := []*FSNode{
+		{format: pb.Data{Type: &typ, Data: []byte{}}},
+		{format: pb.Data{Type: &typ, Filesize: proto.Uint64(0), Blocksizes: []uint64{}, Mode: zero}},
+		{format: pb.Data{Type: &typ, HashType: proto.Uint64(0), Fanout: proto.Uint64(0)}},
+	}
+	for i, n := range variants {
+		if actual := canonical(n); actual != "08021800" {
+			t.Errorf("variant %d: expected canonical encoding 08021800, got %s", i, actual)
+		}
+	}
+
+	// The same attributes, however they were set.
+	a := NewFSNode(TFile)
+	a.SetData([]byte("hi"))
+	a.SetMode(0644)
+	a.SetModTime(time.Unix(1000, 0))
+	a.SetXattr("user.b", []byte("2"))
+	a.SetXattr("user.a", nil)
+	b := &FSNode{format: pb.Data{
+		Type:     &typ,
+		Data:     []byte("hi"),
+		Filesize: proto.Uint64(2),
+		Mode:     proto.Uint32(0644),
+		Mtime:    &pb.UnixTime{Seconds: proto.Int64(1000), FractionalNanoseconds: zero},
+		Xattrs: []*pb.Xattr{
+			{Name: proto.String("user.b"), Value: []byte("2")},
+			{Name: proto.String("user.a"), Value: []byte{}},
+			{Name: proto.String("user.b"), Value: []byte("ignored")},
+		},
+	}}
+	const expected = "080212026869180238a403420308e8074a080a06757365722e614a0b0a06757365722e62120132"
+	if actual := canonical(a); actual != expected {
+		t.Errorf("expected canonical encoding %s, got %s", expected, actual)
+	}
+	if actual := canonical(b); actual != expected {
+		t.Errorf("expected canonical encoding %s, got %s", expected, actual)
+	}
+}
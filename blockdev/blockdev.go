@@ -0,0 +1,245 @@
+// Package blockdev exposes a unixfs file as a fixed-size, random-access
+// block device (ReadAt/WriteAt in sector multiples, Flush and Trim), which
+// is what NBD or qemu-style block servers need to be backed by
+// content-addressed storage.
+package blockdev
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	help "github.com/TRON-US/go-unixfs/importer/helpers"
+	"github.com/TRON-US/go-unixfs/mod"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// DefaultSectorSize is the sector size used when none is given.
+const DefaultSectorSize = 512
+
+// Common errors
+var (
+	ErrUnaligned   = errors.New("blockdev: offset or length is not a multiple of the sector size")
+	ErrOutOfRange  = errors.New("blockdev: access beyond the end of the device")
+	ErrSectorSize  = errors.New("blockdev: invalid sector size")
+	ErrDeviceSize  = errors.New("blockdev: device size is not a multiple of the sector size")
+	ErrDeviceClose = errors.New("blockdev: device is closed")
+)
+
+// Device is a block device backed by a unixfs file. Its size is fixed at
+// creation, writes never grow the file. It is safe for concurrent use.
+type Device struct {
+	lk sync.Mutex
+
+	ctx        context.Context
+	ds         ipld.DAGService
+	spl        chunker.SplitterGen
+	dm         *mod.DagModifier
+	size       int64
+	sectorSize int64
+	closed     bool
+
+	// Trimmed ranges not applied to the DAG yet, see `Trim`.
+	trims spans
+}
+
+// New opens the unixfs file `nd` as a block device of `sectorSize` (or
+// `DefaultSectorSize` if zero) sectors. The file size must be a multiple of
+// the sector size. Written data is chunked with `spl`.
+func New(ctx context.Context, nd ipld.Node, ds ipld.DAGService, sectorSize int64, spl chunker.SplitterGen) (*Device, error) {
+	dm, err := mod.NewDagModifierBalanced(ctx, nd, ds, spl, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return newDevice(ctx, dm, ds, spl, sectorSize)
+}
+
+// Create builds a new, zeroed, device of `size` bytes stored in leaves of
+// `blockSize` (see `mod.CreatePreallocated`), the leaf and CID options are
+// taken from `dbp`. A `blockSize` that is a multiple of the sector size
+// keeps the sectors of a leaf together.
+func Create(ctx context.Context, dbp *help.DagBuilderParams, size, sectorSize, blockSize int64) (*Device, error) {
+	spl := chunker.SizeSplitterGen(blockSize)
+	dm, err := mod.CreatePreallocated(ctx, dbp, size, blockSize, spl)
+	if err != nil {
+		return nil, err
+	}
+	return newDevice(ctx, dm, dbp.Dagserv, spl, sectorSize)
+}
+
+func newDevice(ctx context.Context, dm *mod.DagModifier, ds ipld.DAGService, spl chunker.SplitterGen, sectorSize int64) (*Device, error) {
+	if sectorSize == 0 {
+		sectorSize = DefaultSectorSize
+	}
+	if sectorSize < 0 {
+		return nil, ErrSectorSize
+	}
+	size, err := dm.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size%sectorSize != 0 {
+		return nil, ErrDeviceSize
+	}
+	return &Device{
+		ctx:        ctx,
+		ds:         ds,
+		spl:        spl,
+		dm:         dm,
+		size:       size,
+		sectorSize: sectorSize,
+	}, nil
+}
+
+// Size returns the size of the device in bytes.
+func (d *Device) Size() int64 {
+	return d.size
+}
+
+// SectorSize returns the size of a sector in bytes.
+func (d *Device) SectorSize() int64 {
+	return d.sectorSize
+}
+
+// check validates an access of `length` bytes at `off`.
+func (d *Device) check(off, length int64) error {
+	if d.closed {
+		return ErrDeviceClose
+	}
+	if off%d.sectorSize != 0 || length%d.sectorSize != 0 {
+		return ErrUnaligned
+	}
+	if off < 0 || off+length > d.size {
+		return ErrOutOfRange
+	}
+	return nil
+}
+
+// ReadAt implements `io.ReaderAt` for whole sectors.
+func (d *Device) ReadAt(p []byte, off int64) (int, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if err := d.check(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return d.readAt(p, off)
+}
+
+func (d *Device) readAt(p []byte, off int64) (int, error) {
+	if _, err := d.dm.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := d.dm.CtxReadFull(d.ctx, p)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	// Pending trims read back as zeros.
+	for _, s := range d.trims.overlap(off, off+int64(n)) {
+		zero(p[s.off-off : s.end-off])
+	}
+	return n, err
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// WriteAt implements `io.WriterAt` for whole sectors. Writes are buffered
+// until `Flush` (or the flush policy of the underlying modifier).
+func (d *Device) WriteAt(p []byte, off int64) (int, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if err := d.check(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	d.trims = d.trims.remove(off, off+int64(len(p)))
+	return d.dm.WriteAt(p, off)
+}
+
+// Trim discards the content of the given sectors, which read back as
+// zeros afterwards. Trims are batched: the ranges are accumulated and only
+// applied at `Flush`, where the leaves they fully cover are replaced by
+// shared zero leaves (without rewriting the rest of the tree), and just the
+// partially covered leaves are zeroed through the write path.
+func (d *Device) Trim(off, length int64) error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if err := d.check(off, length); err != nil {
+		return err
+	}
+	if length > 0 {
+		d.trims = d.trims.add(off, off+length)
+	}
+	return nil
+}
+
+// applyTrims replaces the trimmed leaves of the synced DAG and reopens the
+// modifier on the resulting root.
+func (d *Device) applyTrims() error {
+	if len(d.trims) == 0 {
+		return nil
+	}
+	root, err := d.dm.GetNode()
+	if err != nil {
+		return err
+	}
+	nroot, partial, err := trimDag(d.ctx, d.ds, root, d.trims)
+	if err != nil {
+		return err
+	}
+
+	dm, err := mod.NewDagModifierBalanced(d.ctx, nroot, d.ds, d.spl, d.dm.Maxlinks, false)
+	if err != nil {
+		return err
+	}
+	dm.Prefix = d.dm.Prefix
+	dm.RawLeaves = d.dm.RawLeaves
+	dm.FlushPolicy = d.dm.FlushPolicy
+	d.dm = dm
+	d.trims = nil
+
+	for _, s := range partial {
+		if _, err := d.dm.WriteAt(make([]byte, s.end-s.off), s.off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes all the buffered changes to the DAG and returns the new
+// root of the file.
+func (d *Device) Flush() (ipld.Node, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.closed {
+		return nil, ErrDeviceClose
+	}
+	return d.flush()
+}
+
+func (d *Device) flush() (ipld.Node, error) {
+	if err := d.applyTrims(); err != nil {
+		return nil, err
+	}
+	return d.dm.GetNode()
+}
+
+// Close flushes the device and releases it, returning the final root.
+func (d *Device) Close() (ipld.Node, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.closed {
+		return nil, ErrDeviceClose
+	}
+	nd, err := d.flush()
+	if err != nil {
+		return nil, err
+	}
+	d.closed = true
+	return nd, nil
+}
@@ -0,0 +1,272 @@
+package blockdev
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	ft "github.com/TRON-US/go-unixfs"
+	help "github.com/TRON-US/go-unixfs/importer/helpers"
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func TestDevice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+
+	size := int64(256 * 1024)
+	dev, err := Create(ctx, &help.DagBuilderParams{Dagserv: dserv}, size, 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Size() != size || dev.SectorSize() != DefaultSectorSize {
+		t.Fatalf("unexpected geometry %d/%d", dev.Size(), dev.SectorSize())
+	}
+
+	expected := make([]byte, size)
+	data := make([]byte, 3*DefaultSectorSize)
+	u.NewTimeSeededRand().Read(data)
+	for _, off := range []int64{0, 10 * DefaultSectorSize, size - int64(len(data))} {
+		if _, err := dev.WriteAt(data, off); err != nil {
+			t.Fatal(err)
+		}
+		copy(expected[off:], data)
+	}
+
+	if _, err := dev.WriteAt(data[:100], 0); err != ErrUnaligned {
+		t.Fatalf("expected unaligned error, got %v", err)
+	}
+	if _, err := dev.WriteAt(data, size-DefaultSectorSize); err != ErrOutOfRange {
+		t.Fatalf("expected out of range error, got %v", err)
+	}
+
+	buf := make([]byte, len(data))
+	if _, err := dev.ReadAt(buf, 10*DefaultSectorSize); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("bad read")
+	}
+
+	if err := dev.Trim(11*DefaultSectorSize, DefaultSectorSize); err != nil {
+		t.Fatal(err)
+	}
+	copy(expected[11*DefaultSectorSize:], make([]byte, DefaultSectorSize))
+
+	nd, err := dev.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.ReadAt(buf, 0); err != ErrDeviceClose {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+
+	r, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatal("device contents don't match")
+	}
+
+	// Reopen
+	dev, err = New(ctx, nd, dserv, DefaultSectorSize, testu.SizeSplitterGen(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.ReadAt(buf, 10*DefaultSectorSize); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, expected[10*DefaultSectorSize:13*DefaultSectorSize]) {
+		t.Fatal("bad read after reopening")
+	}
+}
+
+func TestRewriteBufferedSectors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+
+	dev, err := Create(ctx, &help.DagBuilderParams{Dagserv: dserv}, 4096, DefaultSectorSize, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second write only covers the start of the buffered first one.
+	if _, err := dev.WriteAt(bytes.Repeat([]byte("a"), 1024), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.WriteAt(bytes.Repeat([]byte("b"), DefaultSectorSize), 0); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := dev.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]byte, 4096)
+	copy(expected, bytes.Repeat([]byte("b"), DefaultSectorSize))
+	copy(expected[DefaultSectorSize:], bytes.Repeat([]byte("a"), DefaultSectorSize))
+	r, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatal("device contents don't match")
+	}
+}
+
+func TestBatchedTrim(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+
+	size := int64(64 * 4096)
+	dev, err := Create(ctx, &help.DagBuilderParams{Dagserv: dserv, RawLeaves: true}, size, 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	u.NewTimeSeededRand().Read(data)
+	if _, err := dev.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append([]byte(nil), data...)
+	trim := func(off, length int64) {
+		if err := dev.Trim(off, length); err != nil {
+			t.Fatal(err)
+		}
+		copy(expected[off:], make([]byte, length))
+	}
+	// Fully covers leaves 2 to 9 (and part of the leaves around them).
+	trim(2*4096-DefaultSectorSize, 8*4096+2*DefaultSectorSize)
+	trim(20*4096, 4096)
+	trim(21*4096, 4096)
+	// Rewritten after being trimmed.
+	written := data[:DefaultSectorSize]
+	if _, err := dev.WriteAt(written, 5*4096); err != nil {
+		t.Fatal(err)
+	}
+	copy(expected[5*4096:], written)
+
+	buf := make([]byte, 4096)
+	if _, err := dev.ReadAt(buf, 20*4096); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, make([]byte, 4096)) {
+		t.Fatal("expected pending trim to read as zeros")
+	}
+
+	nd, err := dev.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dev.trims) != 0 {
+		t.Fatal("expected trims to be applied")
+	}
+
+	r, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatal("device contents don't match")
+	}
+
+	// Fully trimmed leaves share the same zero block.
+	zeroLeaf := nd.Links()[20].Cid
+	for _, i := range []int{2, 3, 9, 21} {
+		if !nd.Links()[i].Cid.Equals(zeroLeaf) {
+			t.Fatalf("expected leaf %d to be the zero block", i)
+		}
+	}
+}
+
+func TestTrimWrappedRoot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+
+	data, file := testu.GenerateFile(t, dserv, testu.FileShape{Size: 16 * 1024, LeafSize: 1024, Seed: 7})
+	wrapper, err := ft.WrapMetadata(file, &ft.Metadata{MimeType: "application/octet-stream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, wrapper); err != nil {
+		t.Fatal(err)
+	}
+	dev, err := New(ctx, wrapper, dserv, 0, testu.SizeSplitterGen(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append([]byte(nil), data...)
+	// Whole leaves and part of one.
+	for _, s := range []span{{1024, 3 * 1024}, {5 * 1024, 5*1024 + DefaultSectorSize}} {
+		if err := dev.Trim(s.off, s.end-s.off); err != nil {
+			t.Fatal(err)
+		}
+		copy(expected[s.off:s.end], make([]byte, s.end-s.off))
+	}
+	nd, err := dev.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := ft.ExtractFSNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != ft.TMetadata {
+		t.Fatalf("expected the root to stay wrapped, got %s", fsn.Type())
+	}
+	r, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatal("device contents don't match")
+	}
+}
+
+func TestSpans(t *testing.T) {
+	var ss spans
+	ss = ss.add(10, 20)
+	ss = ss.add(30, 40)
+	ss = ss.add(20, 25)
+	ss = ss.add(0, 5)
+	if len(ss) != 3 || ss[0] != (span{0, 5}) || ss[1] != (span{10, 25}) || ss[2] != (span{30, 40}) {
+		t.Fatalf("unexpected spans %v", ss)
+	}
+	ss = ss.remove(12, 35)
+	if len(ss) != 3 || ss[1] != (span{10, 12}) || ss[2] != (span{35, 40}) {
+		t.Fatalf("unexpected spans %v", ss)
+	}
+	if !ss.covers(36, 40) || ss.covers(11, 13) {
+		t.Fatal("bad coverage")
+	}
+}
@@ -0,0 +1,264 @@
+package blockdev
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/mod"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// span is the half-open byte range [off, end).
+type span struct {
+	off, end int64
+}
+
+// spans is a sorted list of disjoint, non-adjacent, ranges.
+type spans []span
+
+// add merges [off, end) into the list.
+func (ss spans) add(off, end int64) spans {
+	out := make(spans, 0, len(ss)+1)
+	for _, s := range ss {
+		if s.end < off || s.off > end {
+			out = append(out, s)
+			continue
+		}
+		if s.off < off {
+			off = s.off
+		}
+		if s.end > end {
+			end = s.end
+		}
+	}
+	out = append(out, span{off, end})
+	sort.Slice(out, func(i, j int) bool { return out[i].off < out[j].off })
+	return out
+}
+
+// remove subtracts [off, end) from the list.
+func (ss spans) remove(off, end int64) spans {
+	out := make(spans, 0, len(ss)+1)
+	for _, s := range ss {
+		if s.end <= off || s.off >= end {
+			out = append(out, s)
+			continue
+		}
+		if s.off < off {
+			out = append(out, span{s.off, off})
+		}
+		if s.end > end {
+			out = append(out, span{end, s.end})
+		}
+	}
+	return out
+}
+
+// overlap returns the parts of the list inside [off, end).
+func (ss spans) overlap(off, end int64) spans {
+	var out spans
+	for _, s := range ss {
+		if s.end <= off || s.off >= end {
+			continue
+		}
+		o := span{s.off, s.end}
+		if o.off < off {
+			o.off = off
+		}
+		if o.end > end {
+			o.end = end
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// covers reports whether [off, end) is entirely in the list.
+func (ss spans) covers(off, end int64) bool {
+	for _, s := range ss {
+		if s.off <= off && s.end >= end {
+			return true
+		}
+	}
+	return false
+}
+
+// trimmer rewrites a file DAG replacing the leaves entirely covered by the
+// trimmed ranges with shared zero leaves (of the same size and format), and
+// collects the partially covered parts that have to be zeroed by writing.
+type trimmer struct {
+	ctx     context.Context
+	ds      ipld.DAGService
+	trims   spans
+	zeros   map[string]ipld.Node
+	partial spans
+}
+
+// zeroLeaf returns the shared zero leaf with the size and format of `leaf`.
+func (t *trimmer) zeroLeaf(leaf ipld.Node, size uint64) (ipld.Node, error) {
+	var key string
+	var build func() (ipld.Node, error)
+	switch leaf := leaf.(type) {
+	case *mdag.RawNode:
+		prefix := leaf.Cid().Prefix()
+		key = string(prefix.Bytes())
+		build = func() (ipld.Node, error) {
+			return mdag.NewRawNodeWPrefix(make([]byte, size), prefix)
+		}
+	case *mdag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(leaf.Data())
+		if err != nil {
+			return nil, err
+		}
+		key = string(leaf.Cid().Prefix().Bytes()) + fsn.Type().String()
+		build = func() (ipld.Node, error) {
+			fsn.SetData(make([]byte, size))
+			b, err := fsn.GetBytes()
+			if err != nil {
+				return nil, err
+			}
+			nd := mdag.NodeWithData(b)
+			nd.SetCidBuilder(leaf.CidBuilder())
+			return nd, nil
+		}
+	default:
+		return nil, mod.ErrNotUnixfs
+	}
+
+	key = fmt.Sprintf("%s/%d", key, size)
+	if nd, ok := t.zeros[key]; ok {
+		return nd, nil
+	}
+	nd, err := build()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.ds.Add(t.ctx, nd); err != nil {
+		return nil, err
+	}
+	t.zeros[key] = nd
+	return nd, nil
+}
+
+// apply returns `nd` (that starts at the file offset `off`) with its fully
+// trimmed leaves replaced, or `nd` itself if nothing changed.
+func (t *trimmer) apply(nd ipld.Node, off int64) (ipld.Node, error) {
+	size, err := mod.FileSize(nd)
+	if err != nil {
+		return nil, err
+	}
+	end := off + int64(size)
+	if len(t.trims.overlap(off, end)) == 0 {
+		return nd, nil
+	}
+
+	if len(nd.Links()) == 0 {
+		if t.trims.covers(off, end) {
+			return t.zeroLeaf(nd, size)
+		}
+		for _, s := range t.trims.overlap(off, end) {
+			t.partial = t.partial.add(s.off, s.end)
+		}
+		return nd, nil
+	}
+
+	pn, ok := nd.(*mdag.ProtoNode)
+	if !ok {
+		return nil, mod.ErrNotUnixfs
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+
+	var out *mdag.ProtoNode
+	cur := off
+	for i, bs := range fsn.BlockSizes() {
+		childEnd := cur + int64(bs)
+		if len(t.trims.overlap(cur, childEnd)) > 0 {
+			child, err := pn.Links()[i].GetNode(t.ctx, t.ds)
+			if err != nil {
+				return nil, err
+			}
+			nchild, err := t.apply(child, cur)
+			if err != nil {
+				return nil, err
+			}
+			if !nchild.Cid().Equals(child.Cid()) {
+				if out == nil {
+					out = pn.Copy().(*mdag.ProtoNode)
+				}
+				lnk, err := ipld.MakeLink(nchild)
+				if err != nil {
+					return nil, err
+				}
+				// Links are shared with `pn` after the copy, replace them
+				// instead of modifying them.
+				lnk.Name = out.Links()[i].Name
+				links := append([]*ipld.Link(nil), out.Links()...)
+				links[i] = lnk
+				out.SetLinks(links)
+			}
+		}
+		cur = childEnd
+	}
+	if out == nil {
+		return nd, nil
+	}
+
+	return out, t.ds.Add(t.ctx, out)
+}
+
+// trimDag applies the trimmed ranges to the DAG under `root`, returning the
+// new root and the ranges that only cover part of a leaf. If `root` is a
+// metadata wrapper (see `mod.DagModifier.GetNode`) the file it wraps is
+// trimmed, and a copy of the wrapper pointing to the result is returned.
+func trimDag(ctx context.Context, ds ipld.DAGService, root ipld.Node, trims spans) (ipld.Node, spans, error) {
+	t := &trimmer{
+		ctx:   ctx,
+		ds:    ds,
+		trims: trims,
+		zeros: make(map[string]ipld.Node),
+	}
+	wrapper, ok := root.(*mdag.ProtoNode)
+	if ok {
+		fsn, err := ft.FSNodeFromBytes(wrapper.Data())
+		ok = err == nil && fsn.Type() == ft.TMetadata
+	}
+	if !ok {
+		nd, err := t.apply(root, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nd, t.partial, nil
+	}
+
+	if len(wrapper.Links()) == 0 {
+		return nil, nil, ft.ErrMalformedFileFormat
+	}
+	file, err := wrapper.Links()[0].GetNode(ctx, ds)
+	if err != nil {
+		return nil, nil, err
+	}
+	nfile, err := t.apply(file, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if nfile.Cid().Equals(file.Cid()) {
+		return root, t.partial, nil
+	}
+	out := wrapper.Copy().(*mdag.ProtoNode)
+	lnk, err := ipld.MakeLink(nfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	lnk.Name = out.Links()[0].Name
+	links := append([]*ipld.Link(nil), out.Links()...)
+	links[0] = lnk
+	out.SetLinks(links)
+	return out, t.partial, ds.Add(ctx, out)
+}
@@ -0,0 +1,96 @@
+package unixfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+// DefaultChecksumType is the hash function of the file checksums, the one
+// of the default CIDs.
+const DefaultChecksumType = mh.SHA2_256
+
+// ErrNoChecksum is returned verifying the checksum of a file without one.
+var ErrNoChecksum = errors.New("no file checksum")
+
+// ChecksumError is returned when the data of a file doesn't match the
+// checksum of its metadata.
+type ChecksumError struct {
+	Expected, Actual mh.Multihash
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("unixfs: file checksum mismatch: expected %s, got %s", e.Expected.B58String(), e.Actual.B58String())
+}
+
+// Checksummer computes the checksum of a file from its data written to it
+// in order, e.g., while it is imported.
+type Checksummer struct {
+	code uint64
+	h    hash.Hash
+}
+
+// NewChecksummer returns a `Checksummer` hashing with the multihash
+// function `code`.
+func NewChecksummer(code uint64) (*Checksummer, error) {
+	h, err := mh.GetHasher(code)
+	if err != nil {
+		return nil, err
+	}
+	return &Checksummer{code: code, h: h}, nil
+}
+
+// Write implements the `io.Writer` interface, it never fails.
+func (c *Checksummer) Write(p []byte) (int, error) {
+	return c.h.Write(p)
+}
+
+// Sum returns the checksum of the data written so far.
+func (c *Checksummer) Sum() mh.Multihash {
+	sum, err := mh.Encode(c.h.Sum(nil), c.code)
+	if err != nil {
+		// The code was accepted by `GetHasher`.
+		panic(err)
+	}
+	return sum
+}
+
+// FileChecksum returns the checksum of the file data read from `r` with
+// the multihash function `code`.
+func FileChecksum(r io.Reader, code uint64) (mh.Multihash, error) {
+	c, err := NewChecksummer(code)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(c, r); err != nil {
+		return nil, err
+	}
+	return c.Sum(), nil
+}
+
+// VerifyChecksum reads the file data from `r` and checks it matches the
+// checksum of `m`, returning a `*ChecksumError` otherwise and
+// `ErrNoChecksum` if `m` has none. The checksum covers the file as a whole,
+// so it holds however the file is chunked or converted, unlike the hashes
+// of its blocks.
+func (m *Metadata) VerifyChecksum(r io.Reader) error {
+	if len(m.Checksum) == 0 {
+		return ErrNoChecksum
+	}
+	decoded, err := mh.Decode(m.Checksum)
+	if err != nil {
+		return err
+	}
+	sum, err := FileChecksum(r, decoded.Code)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, m.Checksum) {
+		return &ChecksumError{Expected: m.Checksum, Actual: sum}
+	}
+	return nil
+}
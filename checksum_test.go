@@ -0,0 +1,61 @@
+package unixfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestChecksum(t *testing.T) {
+	data := []byte("the whole file data")
+	sum, err := FileChecksum(bytes.NewReader(data), DefaultChecksumType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := mh.Sum(data, DefaultChecksumType, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sum, expected) {
+		t.Fatalf("expected %s, got %s", expected.B58String(), sum.B58String())
+	}
+
+	// Written in pieces, as by the importers.
+	c, err := NewChecksummer(DefaultChecksumType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write(data[:5])
+	c.Write(data[5:])
+	if !bytes.Equal(c.Sum(), expected) {
+		t.Fatal("expected the same checksum written in pieces")
+	}
+	if _, err := NewChecksummer(0x9999); err == nil {
+		t.Fatal("expected an unknown hash function to fail")
+	}
+
+	b, err := BytesForMetadata(&Metadata{MimeType: "text/plain", Size: uint64(len(data)), Checksum: sum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := MetadataFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(md.Checksum, sum) || md.MimeType != "text/plain" {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+
+	if err := md.VerifyChecksum(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var ce *ChecksumError
+	if err := md.VerifyChecksum(bytes.NewReader(data[1:])); !errors.As(err, &ce) || !bytes.Equal(ce.Expected, sum) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if err := (&Metadata{}).VerifyChecksum(bytes.NewReader(data)); err != ErrNoChecksum {
+		t.Fatalf("expected %v, got %v", ErrNoChecksum, err)
+	}
+}
@@ -0,0 +1,178 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// ErrNotRawLeafable is returned when converting to a raw leaf a node that
+// holds more than its data (links or file attributes).
+var ErrNotRawLeafable = errors.New("node can't be converted to a raw leaf")
+
+// fileFSNode returns the unixfs node of a file node in any of its
+// representations: a raw leaf or a `TFile` or `TRaw` protobuf node.
+func fileFSNode(nd ipld.Node) (*FSNode, error) {
+	if IsRawLeaf(nd) {
+		fsn := NewFSNode(TRaw)
+		fsn.SetData(nd.RawData())
+		return fsn, nil
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, ErrUnrecognizedType
+	}
+	fsn, err := FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	switch fsn.Type() {
+	case TFile, TRaw:
+		// `size` of a `TRaw` node without file size (see `RawPBNode`).
+		if !fsn.HasFileSize() {
+			fsn.UpdateFilesize(int64(len(fsn.Data())))
+		}
+		return fsn, nil
+	default:
+		return nil, ErrUnrecognizedType
+	}
+}
+
+// protoBuilder returns the CID builder of the protobuf node converted from
+// `nd`: its own if it is a protobuf node, the prefix of its CID with the
+// protobuf codec otherwise.
+func protoBuilder(nd ipld.Node) cid.Builder {
+	if pn, ok := nd.(*dag.ProtoNode); ok {
+		return pn.CidBuilder()
+	}
+	prefix := nd.Cid().Prefix()
+	prefix.Codec = cid.DagProtobuf
+	return prefix
+}
+
+// convert returns a new protobuf node of type `t` with the unixfs fields
+// and links of the file node `nd`.
+func convert(nd ipld.Node, t pb.Data_DataType) (*dag.ProtoNode, error) {
+	fsn, err := fileFSNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	fsn.format.Type = &t
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	out := dag.NodeWithData(b)
+	out.SetCidBuilder(protoBuilder(nd))
+	if pn, ok := nd.(*dag.ProtoNode); ok {
+		out.SetLinks(append([]*ipld.Link(nil), pn.Links()...))
+	}
+	return out, nil
+}
+
+// ToFileNode returns a new `TFile` node with the data, sizes, attributes
+// and children of the file node `nd`, a raw leaf or a `TFile` or `TRaw`
+// protobuf node. The CID builder of `nd` is kept (with the protobuf codec
+// for a raw leaf).
+func ToFileNode(nd ipld.Node) (*dag.ProtoNode, error) {
+	return convert(nd, TFile)
+}
+
+// ToRawPBNode is `ToFileNode` returning a `TRaw` node instead.
+func ToRawPBNode(nd ipld.Node) (*dag.ProtoNode, error) {
+	return convert(nd, TRaw)
+}
+
+// ToRawLeaf returns a raw leaf holding the data of the file node `nd`. It
+// fails with `ErrNotRawLeafable` if `nd` has children or file attributes,
+// which a raw leaf can't hold. The CID of the leaf has the hash function of
+// the one of `nd` (and version 1, raw leaves have no version 0).
+func ToRawLeaf(nd ipld.Node) (*dag.RawNode, error) {
+	if raw, ok := nd.(*dag.RawNode); ok {
+		return raw, nil
+	}
+	fsn, err := fileFSNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	if len(nd.Links()) != 0 || fsn.NumChildren() != 0 ||
+		!fsn.ModTime().IsZero() || fsn.Mode() != 0 || len(fsn.Xattrs()) > 0 {
+		return nil, ErrNotRawLeafable
+	}
+	prefix := nd.Cid().Prefix()
+	prefix.Codec = cid.Raw
+	prefix.Version = 1
+	return dag.NewRawNodeWPrefix(fsn.Data(), prefix)
+}
+
+// WrapMetadata returns a new `TMetadata` node wrapping the file `nd` with
+// the metadata `md`, its `Size` replaced by the size of the file. If `nd`
+// already is a wrapper, the file it wraps is wrapped instead (keeping its
+// size), so the metadata is replaced. The CID builder of `nd` is kept.
+func WrapMetadata(nd ipld.Node, md *Metadata) (*dag.ProtoNode, error) {
+	m := *md
+	var file *ipld.Link
+	if pn, ok := nd.(*dag.ProtoNode); ok && isMetadataNode(pn) {
+		old, err := MetadataFromBytes(pn.Data())
+		if err != nil {
+			return nil, err
+		}
+		if len(pn.Links()) == 0 {
+			return nil, ErrMalformedFileFormat
+		}
+		m.Size = old.Size
+		file = pn.Links()[0]
+	} else {
+		fsn, err := fileFSNode(nd)
+		if err != nil {
+			return nil, err
+		}
+		m.Size = fsn.FileSize()
+		if file, err = ipld.MakeLink(nd); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := BytesForMetadata(&m)
+	if err != nil {
+		return nil, err
+	}
+	wrapper := dag.NodeWithData(b)
+	wrapper.SetCidBuilder(protoBuilder(nd))
+	if err := wrapper.AddRawLink("", file); err != nil {
+		return nil, err
+	}
+	return wrapper, nil
+}
+
+// UnwrapMetadata returns the file wrapped by the `TMetadata` node `nd`
+// (fetched from `ng`) and its metadata, or `nd` itself and nil metadata if
+// it isn't a wrapper.
+func UnwrapMetadata(ctx context.Context, nd ipld.Node, ng ipld.NodeGetter) (ipld.Node, *Metadata, error) {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok || !isMetadataNode(pn) {
+		return nd, nil, nil
+	}
+	md, err := MetadataFromBytes(pn.Data())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pn.Links()) == 0 {
+		return nil, nil, ErrMalformedFileFormat
+	}
+	file, err := pn.Links()[0].GetNode(ctx, ng)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, md, nil
+}
+
+func isMetadataNode(pn *dag.ProtoNode) bool {
+	t, err := GetFSType(pn)
+	return err == nil && t == TMetadata
+}
@@ -0,0 +1,117 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestConvertFileNodes(t *testing.T) {
+	raw := dag.NewRawNode([]byte("raw leaf"))
+	file, err := ToFileNode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := FSNodeFromBytes(file.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != TFile || !bytes.Equal(fsn.Data(), raw.RawData()) || fsn.FileSize() != uint64(len(raw.RawData())) {
+		t.Fatalf("unexpected conversion of a raw leaf: %s %q %d", fsn.Type(), fsn.Data(), fsn.FileSize())
+	}
+	if p := file.Cid().Prefix(); p.Codec != cid.DagProtobuf || p.MhType != raw.Cid().Prefix().MhType {
+		t.Fatalf("unexpected prefix %v", p)
+	}
+	back, err := ToRawLeaf(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !back.Cid().Equals(raw.Cid()) {
+		t.Fatalf("expected the raw leaf back, got %s", back.Cid())
+	}
+
+	// Internal nodes keep their children and sizes.
+	parent := NewFSNode(TFile)
+	parent.AddBlockSize(8)
+	b, err := parent.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal := dag.NodeWithData(b)
+	if err := internal.AddNodeLink("", file); err != nil {
+		t.Fatal(err)
+	}
+	rawPB, err := ToRawPBNode(internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn, err = FSNodeFromBytes(rawPB.Data()); err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != TRaw || !reflect.DeepEqual(fsn.BlockSizes(), []uint64{8}) || fsn.FileSize() != 8 {
+		t.Fatalf("unexpected conversion of an internal node: %s %v %d", fsn.Type(), fsn.BlockSizes(), fsn.FileSize())
+	}
+	if !reflect.DeepEqual(rawPB.Links(), internal.Links()) {
+		t.Fatal("expected the links to be kept")
+	}
+	if _, err := ToRawLeaf(internal); err != ErrNotRawLeafable {
+		t.Fatalf("expected %v, got %v", ErrNotRawLeafable, err)
+	}
+
+	data, err := DataWithModTime(FilePBData([]byte("dated"), 5), time.Unix(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ToRawLeaf(dag.NodeWithData(data)); err != ErrNotRawLeafable {
+		t.Fatalf("expected %v, got %v", ErrNotRawLeafable, err)
+	}
+	if _, err := ToFileNode(EmptyDirNode()); err != ErrUnrecognizedType {
+		t.Fatalf("expected %v, got %v", ErrUnrecognizedType, err)
+	}
+}
+
+func TestWrapMetadata(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	file := dag.NodeWithData(FilePBData([]byte("hello"), 5))
+	if err := ds.Add(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+
+	md := &Metadata{MimeType: "text/plain", Size: 42}
+	wrapper, err := WrapMetadata(file, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Size != 42 {
+		t.Fatal("expected the metadata passed not to change")
+	}
+	nd, got, err := UnwrapMetadata(ctx, wrapper, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(file.Cid()) || !reflect.DeepEqual(*got, Metadata{MimeType: "text/plain", Size: 5}) {
+		t.Fatalf("unexpected unwrapped file %s with %+v", nd.Cid(), got)
+	}
+
+	rewrapped, err := WrapMetadata(wrapper, &Metadata{MimeType: "text/html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd, got, err = UnwrapMetadata(ctx, rewrapped, ds); err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(file.Cid()) || !reflect.DeepEqual(*got, Metadata{MimeType: "text/html", Size: 5}) {
+		t.Fatalf("unexpected unwrapped file %s with %+v", nd.Cid(), got)
+	}
+
+	if nd, got, err = UnwrapMetadata(ctx, file, ds); err != nil || nd != file || got != nil {
+		t.Fatalf("expected a plain file to be returned as is, got %v %v %v", nd, got, err)
+	}
+}
@@ -0,0 +1,165 @@
+package unixfs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TRON-US/go-unixfs/events"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// DefaultCopyConcurrency is the number of nodes `CopyTree` copies at once
+// if `CopyOptions.Concurrency` is zero.
+const DefaultCopyConcurrency = 16
+
+// CopyStats are the totals of a `CopyTree`.
+type CopyStats struct {
+	// Nodes is the number of distinct nodes copied and Bytes the size of
+	// their blocks. The nodes inlined in their CID aren't stored, so they
+	// aren't counted.
+	Nodes int
+	Bytes uint64
+}
+
+// CopyOptions are the options of `CopyTree`.
+type CopyOptions struct {
+	// Concurrency is the number of nodes fetched and stored at once,
+	// `DefaultCopyConcurrency` if zero.
+	Concurrency int
+	// Progress, if set, is called with the totals so far after every node
+	// copied (never concurrently).
+	Progress func(CopyStats)
+	// Events, if set, receives an `events.OpCopy` event for every node
+	// copied, with the size of its block, and for every node that can't
+	// be, with the error.
+	Events events.Emitter
+}
+
+// CopyTree copies the DAG under `root` (a file, a directory or any other
+// DAG), fetching its nodes from `src`, to `dst`, for migrations or
+// replications between stores. The nodes are copied concurrently, up to
+// `opts.Concurrency` at once, and the subtrees linked several times are
+// copied once. It returns the totals copied, so far if a node can't be
+// fetched or stored (or `ctx` is done).
+func CopyTree(ctx context.Context, root ipld.Node, src ipld.NodeGetter, dst ipld.DAGService, opts CopyOptions) (CopyStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := &copier{
+		ctx:    ctx,
+		cancel: cancel,
+		src:    InlineGetter(src),
+		dst:    dst,
+		opts:   opts,
+		seen:   map[cid.Cid]struct{}{root.Cid(): {}},
+	}
+	c.cond = sync.NewCond(&c.mu)
+	if err := c.store(root); err != nil {
+		events.Emit(opts.Events, events.Event{Operation: events.OpCopy, Cid: root.Cid(), Err: err})
+		return c.stats, err
+	}
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultCopyConcurrency
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work()
+		}()
+	}
+	wg.Wait()
+	return c.stats, c.err
+}
+
+type copier struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	src    ipld.NodeGetter
+	dst    ipld.DAGService
+	opts   CopyOptions
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds the nodes to copy, pending counts them along with the
+	// ones being copied: the copy is over when it drops to zero.
+	queue   []cid.Cid
+	pending int
+	seen    map[cid.Cid]struct{}
+	stats   CopyStats
+	err     error
+}
+
+// store adds `nd` to the destination and queues its children not seen
+// yet.
+func (c *copier) store(nd ipld.Node) error {
+	inline := IsInline(nd.Cid())
+	if !inline {
+		if err := c.dst.Add(c.ctx, nd); err != nil {
+			return err
+		}
+		events.Emit(c.opts.Events, events.Event{
+			Operation: events.OpCopy,
+			Cid:       nd.Cid(),
+			Bytes:     uint64(len(nd.RawData())),
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range nd.Links() {
+		if _, ok := c.seen[l.Cid]; !ok {
+			c.seen[l.Cid] = struct{}{}
+			c.queue = append(c.queue, l.Cid)
+			c.pending++
+		}
+	}
+	if !inline {
+		c.stats.Nodes++
+		c.stats.Bytes += uint64(len(nd.RawData()))
+		if c.opts.Progress != nil {
+			c.opts.Progress(c.stats)
+		}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// work copies the queued nodes until the copy is over or fails.
+func (c *copier) work() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && c.pending > 0 && c.err == nil {
+			c.cond.Wait()
+		}
+		if c.pending == 0 || c.err != nil {
+			c.mu.Unlock()
+			return
+		}
+		k := c.queue[len(c.queue)-1]
+		c.queue = c.queue[:len(c.queue)-1]
+		c.mu.Unlock()
+
+		nd, err := c.src.Get(c.ctx, k)
+		if err == nil {
+			err = c.store(nd)
+		}
+		if err != nil && c.ctx.Err() == nil {
+			events.Emit(c.opts.Events, events.Event{Operation: events.OpCopy, Cid: k, Err: err})
+		}
+
+		c.mu.Lock()
+		c.pending--
+		if err != nil && c.err == nil {
+			// Stops the requests of the other workers too.
+			c.err = err
+			c.cancel()
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,108 @@
+package unixfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/events"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestCopyTree(t *testing.T) {
+	ctx := context.Background()
+	src := mdtest.Mock()
+	add := func(nd ipld.Node) ipld.Node {
+		if err := src.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	dir := func(entries map[string]ipld.Node) ipld.Node {
+		nd := EmptyDirNode()
+		for name, c := range entries {
+			if err := nd.AddNodeLink(name, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return add(nd)
+	}
+
+	shared := add(dag.NewRawNode([]byte("shared")))
+	entries := map[string]ipld.Node{"shared": shared}
+	for i := 0; i < 50; i++ {
+		entries[fmt.Sprintf("file-%d", i)] = add(dag.NodeWithData(FilePBData([]byte(fmt.Sprintf("file %d", i)), 6)))
+	}
+	inline, err := NewInlineLeaf([]byte("inline"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries["inline"] = inline
+	root := dir(map[string]ipld.Node{"a": dir(entries), "b": shared})
+	size, err := CumulativeSize(ctx, root, InlineGetter(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{0, 1} {
+		dst := mdtest.Mock()
+		var last CopyStats
+		calls := 0
+		evCh := make(chan events.Event, 100)
+		stats, err := CopyTree(ctx, root, src, dst, CopyOptions{
+			Concurrency: concurrency,
+			Events:      events.ChanEmitter(evCh),
+			Progress: func(s CopyStats) {
+				calls++
+				if s.Nodes != last.Nodes+1 || s.Bytes <= last.Bytes {
+					t.Errorf("unexpected progress %+v after %+v", s, last)
+				}
+				last = s
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// All the blocks but the inline one.
+		if stats.Nodes != size.Blocks-1 || stats.Bytes != size.Unique-uint64(len(inline.RawData())) || calls != stats.Nodes {
+			t.Fatalf("unexpected stats %+v (%d calls) for %+v", stats, calls, size)
+		}
+		copied, err := CumulativeSize(ctx, root, InlineGetter(dst))
+		if err != nil {
+			t.Fatalf("expected the whole DAG to be copied: %v", err)
+		}
+		if *copied != *size {
+			t.Fatalf("expected %+v, got %+v", size, copied)
+		}
+		close(evCh)
+		var evStats CopyStats
+		for e := range evCh {
+			if e.Operation != events.OpCopy || e.Err != nil {
+				t.Fatalf("unexpected event %+v", e)
+			}
+			evStats.Nodes++
+			evStats.Bytes += e.Bytes
+		}
+		if evStats != stats {
+			t.Fatalf("expected events adding up to %+v, got %+v", stats, evStats)
+		}
+	}
+
+	lost := dag.NewRawNode([]byte("lost"))
+	missing := dir(map[string]ipld.Node{"lost": lost})
+	evCh := make(chan events.Event, 10)
+	if _, err := CopyTree(ctx, missing, src, mdtest.Mock(), CopyOptions{Events: events.ChanEmitter(evCh)}); err == nil {
+		t.Fatal("expected missing nodes to fail the copy")
+	}
+	close(evCh)
+	var failed bool
+	for e := range evCh {
+		failed = failed || e.Err != nil && e.Cid.Equals(lost.Cid())
+	}
+	if !failed {
+		t.Fatal("expected an event for the missing node")
+	}
+}
@@ -0,0 +1,77 @@
+package unixfs
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// DagSize is the serialized size of a DAG (see `CumulativeSize`).
+type DagSize struct {
+	// Cumulative is the size of the blocks of the root and of all the
+	// nodes under it, the subtrees linked several times being counted
+	// each time: the `Tsize` a link to the root should declare.
+	Cumulative uint64
+	// Unique is the size of the distinct blocks of the DAG, what storing
+	// it takes.
+	Unique uint64
+	// Blocks is the number of distinct blocks of the DAG.
+	Blocks int
+}
+
+// CumulativeSize walks the DAG under `nd` (a file, a directory or any other
+// DAG), fetching its nodes from `ng`, and returns its serialized size. The
+// sizes come from the blocks, not from the sizes the links declare, and
+// the subtrees linked several times are only fetched and walked once.
+func CumulativeSize(ctx context.Context, nd ipld.Node, ng ipld.NodeGetter) (*DagSize, error) {
+	c := &sizeCounter{ctx: ctx, ng: ng, sizes: make(map[string]uint64)}
+	size, err := c.cumulative(nd)
+	if err != nil {
+		return nil, err
+	}
+	c.total.Cumulative = size
+	return &c.total, nil
+}
+
+type sizeCounter struct {
+	ctx context.Context
+	ng  ipld.NodeGetter
+	// Cumulative size of the nodes walked by key.
+	sizes map[string]uint64
+	total DagSize
+}
+
+func (c *sizeCounter) cumulative(nd ipld.Node) (uint64, error) {
+	size := uint64(len(nd.RawData()))
+	c.total.Unique += size
+	c.total.Blocks++
+
+	links := nd.Links()
+	var missing []cid.Cid
+	for _, l := range links {
+		if _, ok := c.sizes[l.Cid.KeyString()]; !ok {
+			missing = append(missing, l.Cid)
+		}
+	}
+	for _, promise := range ipld.GetNodes(c.ctx, c.ng, missing) {
+		child, err := promise.Get(c.ctx)
+		if err != nil {
+			return 0, err
+		}
+		// The same child may be linked more than once by this node.
+		if _, ok := c.sizes[child.Cid().KeyString()]; ok {
+			continue
+		}
+		childSize, err := c.cumulative(child)
+		if err != nil {
+			return 0, err
+		}
+		c.sizes[child.Cid().KeyString()] = childSize
+	}
+
+	for _, l := range links {
+		size += c.sizes[l.Cid.KeyString()]
+	}
+	return size, nil
+}
@@ -0,0 +1,60 @@
+package unixfs
+
+import (
+	"context"
+	"testing"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestCumulativeSize(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	add := func(nd ipld.Node) ipld.Node {
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	link := func(nd *dag.ProtoNode, name string, child ipld.Node) {
+		if err := nd.AddNodeLink(name, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	leaf := add(dag.NewRawNode([]byte("shared leaf")))
+	file := dag.NodeWithData(FilePBData(nil, 22))
+	link(file, "", leaf)
+	link(file, "", leaf)
+	add(file)
+	dir := EmptyDirNode()
+	link(dir, "a", file)
+	link(dir, "b", file)
+	add(dir)
+
+	size, err := CumulativeSize(ctx, dir, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafSize := uint64(len(leaf.RawData()))
+	fileSize := uint64(len(file.RawData()))
+	dirSize := uint64(len(dir.RawData()))
+	expected := DagSize{
+		Cumulative: dirSize + 2*(fileSize+2*leafSize),
+		Unique:     dirSize + fileSize + leafSize,
+		Blocks:     3,
+	}
+	if *size != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *size)
+	}
+	// The links built from the nodes declare the same cumulative size.
+	if declared, err := dir.Size(); err != nil || declared != size.Cumulative {
+		t.Fatalf("expected the declared size %d, got %d (%v)", size.Cumulative, declared, err)
+	}
+
+	if _, err := CumulativeSize(ctx, dir, mdtest.Mock()); err == nil {
+		t.Fatal("expected missing nodes to fail")
+	}
+}
@@ -0,0 +1,157 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	proto "github.com/gogo/protobuf/proto"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// Decode errors, the classes of corruption of the unixfs data of a node
+// (see `DecodeError`).
+var (
+	ErrNotUnixFS     = errors.New("not unixfs data")
+	ErrTruncatedData = errors.New("truncated unixfs data")
+	ErrUnknownType   = errors.New("unknown unixfs data type")
+)
+
+// DecodeError is returned when the unixfs data of a node can't be decoded.
+// It matches (with `errors.Is`) its class, `ErrNotUnixFS`,
+// `ErrTruncatedData` or `ErrUnknownType` (a type that is neither one of the
+// format nor a registered subtype, see `RegisterSubtype`).
+type DecodeError struct {
+	// Cid is the key of the node, undefined if the error comes from
+	// decoding bytes (`FSNodeFromBytes`) instead of a node.
+	Cid cid.Cid
+	// Err is the class of the error.
+	Err error
+	// Cause is the error of the protobuf decoder, if any.
+	Cause error
+}
+
+func (e *DecodeError) Error() string {
+	msg := e.Err.Error()
+	if e.Cause != nil {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Cause)
+	}
+	if e.Cid.Defined() {
+		return fmt.Sprintf("unixfs: node %s: %s", e.Cid, msg)
+	}
+	return "unixfs: " + msg
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeData unmarshals `b` onto `pbd`, classifying the failures as
+// `*DecodeError`s.
+func decodeData(b []byte, pbd *pb.Data) error {
+	err := proto.Unmarshal(b, pbd)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		return &DecodeError{Err: ErrTruncatedData, Cause: err}
+	case err != nil:
+		// Including a missing type, most likely not unixfs data at all.
+		return &DecodeError{Err: ErrNotUnixFS, Cause: err}
+	}
+	if !knownType(pbd.GetType()) {
+		return &DecodeError{Err: ErrUnknownType, Cause: fmt.Errorf("type %d", pbd.GetType())}
+	}
+	return nil
+}
+
+// withKey sets the key `c` of the node in `err` if it is a `*DecodeError`.
+func withKey(err error, c cid.Cid) error {
+	if de, ok := err.(*DecodeError); ok && !de.Cid.Defined() {
+		keyed := *de
+		keyed.Cid = c
+		return &keyed
+	}
+	return err
+}
+
+// DataType returns the type of the unixfs data `b` decoding only its
+// `Type` field: the other fields are skipped, not decoded or copied like
+// `FSNodeFromBytes` does, so probing the type of many nodes (listing a
+// directory, resolving a path) is cheap. It fails with the same
+// `*DecodeError`s, though of the other fields only the framing is checked.
+func DataType(b []byte) (pb.Data_DataType, error) {
+	truncated := &DecodeError{Err: ErrTruncatedData, Cause: io.ErrUnexpectedEOF}
+	var typ pb.Data_DataType
+	var hasType bool
+	for len(b) > 0 {
+		key, n := proto.DecodeVarint(b)
+		if n == 0 {
+			return 0, truncated
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&7
+		if field == 0 || field == 1 && wireType != proto.WireVarint {
+			return 0, &DecodeError{Err: ErrNotUnixFS, Cause: fmt.Errorf("field %d of wire type %d", field, wireType)}
+		}
+
+		switch wireType {
+		case proto.WireVarint:
+			v, n := proto.DecodeVarint(b)
+			if n == 0 {
+				return 0, truncated
+			}
+			b = b[n:]
+			// The last value wins, as for the full decoder.
+			if field == 1 {
+				typ, hasType = pb.Data_DataType(v), true
+			}
+		case proto.WireBytes:
+			l, n := proto.DecodeVarint(b)
+			if n == 0 || l > uint64(len(b)-n) {
+				return 0, truncated
+			}
+			b = b[n+int(l):]
+		case proto.WireFixed64:
+			if len(b) < 8 {
+				return 0, truncated
+			}
+			b = b[8:]
+		case proto.WireFixed32:
+			if len(b) < 4 {
+				return 0, truncated
+			}
+			b = b[4:]
+		default:
+			return 0, &DecodeError{Err: ErrNotUnixFS, Cause: fmt.Errorf("unknown wire type %d", wireType)}
+		}
+	}
+	if !hasType {
+		return 0, &DecodeError{Err: ErrNotUnixFS, Cause: errors.New("no type")}
+	}
+	if !knownType(typ) {
+		return 0, &DecodeError{Err: ErrUnknownType, Cause: fmt.Errorf("type %d", typ)}
+	}
+	return typ, nil
+}
+
+// NodeType returns the unixfs type of `nd` like `DataType`, `TRaw` for the
+// raw leaves. Decoding failures carry the key of `nd`, and nodes of other
+// codecs fail with `ErrUnrecognizedType`.
+func NodeType(nd ipld.Node) (pb.Data_DataType, error) {
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		typ, err := DataType(nd.Data())
+		if err != nil {
+			return 0, withKey(err, nd.Cid())
+		}
+		return typ, nil
+	default:
+		if IsRawLeaf(nd) {
+			return TRaw, nil
+		}
+		return 0, ErrUnrecognizedType
+	}
+}
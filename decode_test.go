@@ -0,0 +1,97 @@
+package unixfs
+
+import (
+	"errors"
+	"testing"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrNotUnixFS},
+		{"text", []byte("hello world"), ErrNotUnixFS},
+		{"truncated", FilePBData([]byte("some data"), 9)[:6], ErrTruncatedData},
+		{"unknown-type", []byte{0x08, 0x63}, ErrUnknownType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := FSNodeFromBytes(tc.data)
+			var de *DecodeError
+			if !errors.As(err, &de) || !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if de.Cid.Defined() {
+				t.Fatal("expected no key decoding bytes")
+			}
+			if _, err := FromBytes(tc.data); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if _, err := DataType(tc.data); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v probing the type, got %v", tc.err, err)
+			}
+
+			nd := dag.NodeWithData(tc.data)
+			for _, err := range []error{
+				func() error { _, err := ExtractFSNode(nd); return err }(),
+				func() error { _, err := FSNodeFromNode(nd); return err }(),
+				func() error { _, err := ReadUnixFSNodeData(nd); return err }(),
+				func() error { _, err := NodeType(nd); return err }(),
+			} {
+				if !errors.As(err, &de) || !errors.Is(err, tc.err) || !de.Cid.Equals(nd.Cid()) {
+					t.Fatalf("expected %v on %s, got %v", tc.err, nd.Cid(), err)
+				}
+			}
+		})
+	}
+}
+
+func TestDataType(t *testing.T) {
+	symlink, err := SymlinkData("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := BytesForMetadata(&Metadata{MimeType: "text/plain", Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hamt := NewFSNode(THAMTShard)
+	hamt.SetData([]byte{1, 2, 3})
+	hamtData, err := hamt.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := NewFSNode(TFile)
+	file.AddBlockSize(100)
+	file.SetXattr("user.a", []byte("b"))
+	fileData, err := file.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{
+		FolderPBData(), FilePBData([]byte("data"), 4), WrapData([]byte("raw")),
+		symlink, metadata, hamtData, fileData,
+		// The type set twice, the last one wins.
+		append(FilePBData(nil, 0), 0x08, byte(pb.Data_Directory)),
+	} {
+		fsn, err := FSNodeFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ, err := DataType(data); err != nil || typ != fsn.Type() {
+			t.Fatalf("expected %s, got %s (%v)", fsn.Type(), typ, err)
+		}
+	}
+
+	if typ, err := NodeType(dag.NewRawNode([]byte("leaf"))); err != nil || typ != TRaw {
+		t.Fatalf("expected %s, got %s (%v)", TRaw, typ, err)
+	}
+	if typ, err := NodeType(EmptyDirNode()); err != nil || typ != TDirectory {
+		t.Fatalf("expected %s, got %s (%v)", TDirectory, typ, err)
+	}
+}
@@ -0,0 +1,244 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// Equal returns whether the unixfs DAGs `a` and `b` have the same logical
+// content, whatever their CIDs: files with the same data (however they are
+// chunked and laid out, with raw or protobuf leaves, wrapped in a
+// `TMetadata` node or not), symlinks with the same target and directories
+// (sharded or not) with the same entries, recursively. The attributes of
+// the nodes (modification time, mode and extended attributes) and the
+// metadata of the files aren't compared. Nodes are fetched from `ng` as
+// needed, subtrees of the same CID aren't walked.
+func Equal(ctx context.Context, a, b ipld.Node, ng ipld.NodeGetter) (bool, error) {
+	c := &comparer{ctx: ctx, ng: InlineGetter(ng)}
+	return c.equal(a, b)
+}
+
+type comparer struct {
+	ctx context.Context
+	ng  ipld.NodeGetter
+}
+
+// logicalType returns the type of the content of `nd`: `TFile` for all the
+// nodes of file data, `TDirectory` for all the directories and `TSymlink`.
+func logicalType(nd ipld.Node) (pb.Data_DataType, *FSNode, error) {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		if IsRawLeaf(nd) {
+			return TFile, nil, nil
+		}
+		return 0, nil, ErrUnrecognizedType
+	}
+	fsn, err := fsNodeFromNode(pn)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch fsn.Type() {
+	case TFile, TRaw, TMetadata, TTokenMeta:
+		return TFile, fsn, nil
+	case TDirectory, THAMTShard:
+		return TDirectory, fsn, nil
+	case TSymlink:
+		return TSymlink, fsn, nil
+	default:
+		return 0, nil, fmt.Errorf("unixfs: node %s: %w: %s", nd.Cid(), ErrUnrecognizedType, fsn.Type())
+	}
+}
+
+func (c *comparer) equal(a, b ipld.Node) (bool, error) {
+	if a.Cid() == b.Cid() {
+		return true, nil
+	}
+	ta, fa, err := logicalType(a)
+	if err != nil {
+		return false, err
+	}
+	tb, fb, err := logicalType(b)
+	if err != nil {
+		return false, err
+	}
+	if ta != tb {
+		return false, nil
+	}
+	switch ta {
+	case TSymlink:
+		return bytes.Equal(fa.Data(), fb.Data()), nil
+	case TDirectory:
+		return c.equalDirs(a, fa, b, fb)
+	default:
+		return c.equalFiles(a, b)
+	}
+}
+
+func (c *comparer) equalDirs(a ipld.Node, fa *FSNode, b ipld.Node, fb *FSNode) (bool, error) {
+	ea := make(map[string]cid.Cid)
+	if err := c.entries(a, fa, ea); err != nil {
+		return false, err
+	}
+	eb := make(map[string]cid.Cid)
+	if err := c.entries(b, fb, eb); err != nil {
+		return false, err
+	}
+	if len(ea) != len(eb) {
+		return false, nil
+	}
+	for name, ca := range ea {
+		cb, ok := eb[name]
+		if !ok {
+			return false, nil
+		}
+		if ca == cb {
+			continue
+		}
+		na, err := c.ng.Get(c.ctx, ca)
+		if err != nil {
+			return false, err
+		}
+		nb, err := c.ng.Get(c.ctx, cb)
+		if err != nil {
+			return false, err
+		}
+		if eq, err := c.equal(na, nb); err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// entries adds the entries of the directory `nd` to `out`, walking the
+// shards of a `THAMTShard` directory.
+func (c *comparer) entries(nd ipld.Node, fsn *FSNode, out map[string]cid.Cid) error {
+	if fsn.Type() == TDirectory {
+		for _, l := range nd.Links() {
+			out[l.Name] = l.Cid
+		}
+		return nil
+	}
+	// The links of a shard are named by the hexadecimal index of their
+	// bucket, padded to the width of the largest one, and followed by the
+	// name of the entry for the entries (not for the sub-shards).
+	padLen := len(fmt.Sprintf("%X", fsn.Fanout()-1))
+	for _, l := range nd.Links() {
+		switch {
+		case len(l.Name) > padLen:
+			out[l.Name[padLen:]] = l.Cid
+		case len(l.Name) == padLen:
+			child, err := l.GetNode(c.ctx, c.ng)
+			if err != nil {
+				return err
+			}
+			pn, ok := child.(*dag.ProtoNode)
+			if !ok {
+				return dag.ErrNotProtobuf
+			}
+			shard, err := fsNodeFromNode(pn)
+			if err != nil {
+				return err
+			}
+			if shard.Type() != THAMTShard {
+				return fmt.Errorf("unixfs: node %s: unexpected %s node in a sharded directory", child.Cid(), shard.Type())
+			}
+			if err := c.entries(child, shard, out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unixfs: node %s: invalid shard link name %q", nd.Cid(), l.Name)
+		}
+	}
+	return nil
+}
+
+// equalFiles compares the data of the files `a` and `b`, reading both a
+// block at a time.
+func (c *comparer) equalFiles(a, b ipld.Node) (bool, error) {
+	fa := &fileCursor{c: c, root: a}
+	fb := &fileCursor{c: c, root: b}
+	for {
+		if err := fa.fill(); err != nil {
+			return false, err
+		}
+		if err := fb.fill(); err != nil {
+			return false, err
+		}
+		if len(fa.buf) == 0 || len(fb.buf) == 0 {
+			// At least one of the files ended, equal if both did.
+			return len(fa.buf) == len(fb.buf), nil
+		}
+		n := len(fa.buf)
+		if len(fb.buf) < n {
+			n = len(fb.buf)
+		}
+		if !bytes.Equal(fa.buf[:n], fb.buf[:n]) {
+			return false, nil
+		}
+		fa.buf, fb.buf = fa.buf[n:], fb.buf[n:]
+	}
+}
+
+// fileCursor walks the data of a file DAG in order, depth first.
+type fileCursor struct {
+	c    *comparer
+	root ipld.Node
+	// stack holds the links left to visit, the next one last.
+	stack []*ipld.Link
+	// buf is the data of the current node not compared yet.
+	buf []byte
+}
+
+// fill sets `buf` to the data of the next node holding some once it is
+// consumed, it stays empty at the end of the file.
+func (fc *fileCursor) fill() error {
+	for len(fc.buf) == 0 && (fc.root != nil || len(fc.stack) > 0) {
+		nd := fc.root
+		fc.root = nil
+		if nd == nil {
+			l := fc.stack[len(fc.stack)-1]
+			fc.stack = fc.stack[:len(fc.stack)-1]
+			var err error
+			if nd, err = l.GetNode(fc.c.ctx, fc.c.ng); err != nil {
+				return err
+			}
+		}
+
+		links := nd.Links()
+		switch nd := nd.(type) {
+		case *dag.ProtoNode:
+			fsn, err := fsNodeFromNode(nd)
+			if err != nil {
+				return err
+			}
+			switch fsn.Type() {
+			case TFile, TRaw, TTokenMeta:
+				fc.buf = fsn.Data()
+			case TMetadata:
+				// Only the wrapped file is file data.
+				if len(links) == 0 {
+					return fmt.Errorf("unixfs: node %s: %w", nd.Cid(), ErrMalformedFileFormat)
+				}
+				links = links[:1]
+			default:
+				return fmt.Errorf("unixfs: node %s: unexpected %s node in a file", nd.Cid(), fsn.Type())
+			}
+		default:
+			if !IsRawLeaf(nd) {
+				return ErrUnrecognizedType
+			}
+			fc.buf = nd.RawData()
+		}
+		for i := len(links) - 1; i >= 0; i-- {
+			fc.stack = append(fc.stack, links[i])
+		}
+	}
+	return nil
+}
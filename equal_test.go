@@ -0,0 +1,139 @@
+package unixfs
+
+import (
+	"context"
+	"testing"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestEqual(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	add := func(nd ipld.Node) ipld.Node {
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	link := func(data []byte, children ...ipld.Node) *dag.ProtoNode {
+		nd := dag.NodeWithData(data)
+		for _, c := range children {
+			if err := nd.AddNodeLink("", c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nd
+	}
+	file := func(children ...ipld.Node) ipld.Node {
+		fsn := NewFSNode(TFile)
+		for _, c := range children {
+			size := uint64(len(c.RawData()))
+			if pn, ok := c.(*dag.ProtoNode); ok {
+				cfsn, err := FSNodeFromBytes(pn.Data())
+				if err != nil {
+					t.Fatal(err)
+				}
+				size = cfsn.FileSize()
+			}
+			fsn.AddBlockSize(size)
+		}
+		b, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return add(link(b, children...))
+	}
+	dir := func(entries map[string]ipld.Node) ipld.Node {
+		nd := EmptyDirNode()
+		for name, c := range entries {
+			if err := nd.AddNodeLink(name, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return add(nd)
+	}
+	// shard returns a sharded directory of fanout 16 holding `entries`
+	// under a sub-shard, the bucket indexes don't matter to `Equal`.
+	shard := func(entries map[string]ipld.Node) ipld.Node {
+		// The murmur3 multihash code, the one of the shards of the `hamt`
+		// package.
+		b, err := HAMTShardData(nil, 16, 0x22)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := dag.NodeWithData(b)
+		for name, c := range entries {
+			if err := sub.AddNodeLink("3"+name, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root := dag.NodeWithData(b)
+		if err := root.AddNodeLink("A", add(sub)); err != nil {
+			t.Fatal(err)
+		}
+		return add(root)
+	}
+
+	hello := add(dag.NewRawNode([]byte("hello ")))
+	world := add(dag.NewRawNode([]byte("world!")))
+	helloWorld := add(dag.NodeWithData(FilePBData([]byte("hello world!"), 12)))
+	chunked := file(file(add(dag.NewRawNode([]byte("hel"))), add(dag.NewRawNode([]byte("lo")))), add(dag.NewRawNode([]byte(" world!"))))
+	md, err := WrapMetadata(helloWorld, &Metadata{MimeType: "text/plain", Size: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(md)
+	other := file(hello, add(dag.NewRawNode([]byte("world?"))))
+	longer := file(hello, world, add(dag.NewRawNode([]byte("!"))))
+	symlink := func(target string) ipld.Node {
+		b, err := SymlinkData(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return add(dag.NodeWithData(b))
+	}
+	link1 := symlink("a/b")
+	link2 := symlink("a/c")
+
+	for _, tc := range []struct {
+		name  string
+		a, b  ipld.Node
+		equal bool
+	}{
+		{"same", helloWorld, helloWorld, true},
+		{"leaves", file(hello, world), helloWorld, true},
+		{"chunking", file(hello, world), chunked, true},
+		{"metadata", md, chunked, true},
+		{"content", file(hello, world), other, false},
+		{"length", file(hello, world), longer, false},
+		{"prefix", longer, helloWorld, false},
+		{"symlinks", link1, link2, false},
+		{"types", link1, helloWorld, false},
+		{"dirs", dir(map[string]ipld.Node{"f": helloWorld, "l": link1}), dir(map[string]ipld.Node{"f": chunked, "l": link1}), true},
+		{"entries", dir(map[string]ipld.Node{"f": helloWorld}), dir(map[string]ipld.Node{"g": helloWorld}), false},
+		{"nested", dir(map[string]ipld.Node{"d": dir(map[string]ipld.Node{"f": other})}), dir(map[string]ipld.Node{"d": dir(map[string]ipld.Node{"f": helloWorld})}), false},
+		{"sharded", shard(map[string]ipld.Node{"f": helloWorld, "l": link1}), dir(map[string]ipld.Node{"f": chunked, "l": link1}), true},
+		{"sharded-entries", shard(map[string]ipld.Node{"f": helloWorld}), dir(map[string]ipld.Node{"f": helloWorld, "l": link1}), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, pair := range [][2]ipld.Node{{tc.a, tc.b}, {tc.b, tc.a}} {
+				equal, err := Equal(ctx, pair[0], pair[1], ds)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if equal != tc.equal {
+					t.Fatalf("expected %s and %s to be equal: %t", pair[0].Cid(), pair[1].Cid(), tc.equal)
+				}
+			}
+		})
+	}
+
+	missing := file(dag.NewRawNode([]byte("lost")))
+	if _, err := Equal(ctx, missing, helloWorld, ds); err == nil {
+		t.Fatal("expected missing nodes to fail the comparison")
+	}
+}
@@ -0,0 +1,118 @@
+// Package events defines the structured progress records emitted by the
+// long-running unixfs operations (import, export, copy, verify and repair)
+// so that embedding applications can render progress and produce
+// machine-readable logs in a single, consistent way.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// Operation identifies the kind of operation that emitted an Event.
+type Operation string
+
+// Operations emitting events.
+const (
+	OpImport Operation = "import"
+	OpExport Operation = "export"
+	OpCopy   Operation = "copy"
+	OpVerify Operation = "verify"
+	OpRepair Operation = "repair"
+)
+
+// Event is a single progress record. Bytes holds the amount of data
+// processed by the step being reported (not a running total), Path is
+// the path of the entry relative to the operation root (if known) and
+// Err is set when the step failed.
+type Event struct {
+	Operation Operation
+	Path      string
+	Cid       cid.Cid
+	Bytes     uint64
+	Err       error
+}
+
+// jsonEvent is the wire representation of an Event, one per line.
+type jsonEvent struct {
+	Operation Operation `json:"operation"`
+	Path      string    `json:"path,omitempty"`
+	Cid       string    `json:"cid,omitempty"`
+	Bytes     uint64    `json:"bytes"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the event with the CID in its string form and the
+// error as its message.
+func (e Event) MarshalJSON() ([]byte, error) {
+	je := jsonEvent{
+		Operation: e.Operation,
+		Path:      e.Path,
+		Bytes:     e.Bytes,
+	}
+	if e.Cid.Defined() {
+		je.Cid = e.Cid.String()
+	}
+	if e.Err != nil {
+		je.Error = e.Err.Error()
+	}
+	return json.Marshal(je)
+}
+
+// Emitter receives the events of an operation. Implementations must be
+// safe for concurrent use as operations may emit from several goroutines.
+type Emitter interface {
+	Emit(Event)
+}
+
+// Emit sends the event to `em`, it does nothing for a nil Emitter so
+// operations don't need to check whether events were requested.
+func Emit(em Emitter, e Event) {
+	if em == nil {
+		return
+	}
+	em.Emit(e)
+}
+
+// JSONEmitter writes every event as a line of JSON (NDJSON) to the
+// underlying writer.
+type JSONEmitter struct {
+	lk  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONEmitter returns an Emitter writing NDJSON to `w`.
+func NewJSONEmitter(w io.Writer) *JSONEmitter {
+	return &JSONEmitter{enc: json.NewEncoder(w)}
+}
+
+// Emit implements the `Emitter` interface. Once a write fails all the
+// following events are dropped, see `Err`.
+func (je *JSONEmitter) Emit(e Event) {
+	je.lk.Lock()
+	defer je.lk.Unlock()
+	if je.err != nil {
+		return
+	}
+	je.err = je.enc.Encode(e)
+}
+
+// Err returns the first error encountered writing events, if any.
+func (je *JSONEmitter) Err() error {
+	je.lk.Lock()
+	defer je.lk.Unlock()
+	return je.err
+}
+
+// ChanEmitter forwards the events to a channel. Sends block, so the
+// consumer must keep draining the channel while the operation runs.
+type ChanEmitter chan<- Event
+
+// Emit implements the `Emitter` interface.
+func (ce ChanEmitter) Emit(e Event) {
+	ce <- e
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+func TestJSONEmitter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	em := NewJSONEmitter(buf)
+
+	nd := mdag.NodeWithData([]byte("hello"))
+	Emit(em, Event{Operation: OpImport, Cid: nd.Cid(), Bytes: 5})
+	Emit(em, Event{Operation: OpExport, Path: "a/b", Err: errors.New("boom")})
+	if err := em.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["operation"] != "import" || first["cid"] != nd.Cid().String() || first["bytes"] != float64(5) {
+		t.Fatalf("unexpected first event: %s", lines[0])
+	}
+	if _, ok := first["error"]; ok {
+		t.Fatal("error field should be omitted when not set")
+	}
+
+	var second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second["path"] != "a/b" || second["error"] != "boom" {
+		t.Fatalf("unexpected second event: %s", lines[1])
+	}
+}
+
+func TestEmitNil(t *testing.T) {
+	// Must not panic.
+	Emit(nil, Event{Operation: OpCopy})
+}
+
+func TestChanEmitter(t *testing.T) {
+	ch := make(chan Event, 1)
+	Emit(ChanEmitter(ch), Event{Operation: OpVerify, Bytes: 7})
+	e := <-ch
+	if e.Operation != OpVerify || e.Bytes != 7 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
@@ -0,0 +1,122 @@
+// Command appender appends the lines read from the standard input to a
+// unixfs log file, flushing them in the background as it goes, and prints
+// the root of every checkpoint and of the final version.
+//
+//	appender [-store DIR] [-root CID] [-every N] < lines
+//
+// Without `-root` a new log is started.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	"github.com/TRON-US/go-unixfs/mod"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// run appends the lines of `r` to the log `root` (a new one if undefined),
+// starting a background flush every `every` lines and calling
+// `checkpoint` with the root of each one as it completes. It returns the
+// final root.
+func run(ctx context.Context, ds ipld.DAGService, root cid.Cid, r io.Reader, every int, checkpoint func(cid.Cid)) (ipld.Node, error) {
+	var nd ipld.Node = ft.EmptyFileNode()
+	if root.Defined() {
+		var err error
+		if nd, err = ds.Get(ctx, root); err != nil {
+			return nil, err
+		}
+	} else if err := ds.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+
+	dm, err := mod.NewDagModifier(ctx, nd, ds, chunker.SizeSplitterGen(chunker.DefaultBlockSize))
+	if err != nil {
+		return nil, err
+	}
+	// Only flush on the checkpoints.
+	dm.FlushPolicy = mod.ManualFlushPolicy{}
+	if _, err := dm.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+
+	// At most one flush is in progress, it is waited for before starting
+	// the next one while new lines keep being buffered.
+	var pending <-chan mod.FlushResult
+	wait := func() error {
+		if pending == nil {
+			return nil
+		}
+		res := <-pending
+		pending = nil
+		if res.Err != nil {
+			return res.Err
+		}
+		checkpoint(res.Root)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lines := 1; scanner.Scan(); lines++ {
+		if _, err := dm.Write(append(scanner.Bytes(), '\n')); err != nil {
+			return nil, err
+		}
+		if every > 0 && lines%every == 0 {
+			if err := wait(); err != nil {
+				return nil, err
+			}
+			pending = dm.FlushAsync()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := wait(); err != nil {
+		return nil, err
+	}
+	return dm.GetNode()
+}
+
+func main() {
+	storeDir := store.Flag()
+	rootArg := flag.String("root", "", "root of the log to append to (new log if not set)")
+	every := flag.Int("every", 100, "lines between background checkpoints (0 to disable)")
+	flag.Parse()
+
+	if err := appender(*storeDir, *rootArg, *every); err != nil {
+		fmt.Fprintln(os.Stderr, "appender:", err)
+		os.Exit(1)
+	}
+}
+
+func appender(storeDir, rootArg string, every int) error {
+	var root cid.Cid
+	if rootArg != "" {
+		var err error
+		if root, err = cid.Decode(rootArg); err != nil {
+			return err
+		}
+	}
+	ds, err := store.Open(storeDir)
+	if err != nil {
+		return err
+	}
+
+	nd, err := run(context.Background(), ds, root, os.Stdin, every, func(c cid.Cid) {
+		fmt.Println("checkpoint", c)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(nd.Cid())
+	return nil
+}
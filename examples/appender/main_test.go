@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestAppender(t *testing.T) {
+	ctx := context.Background()
+	ds, err := store.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&expected, "entry %d\n", i)
+	}
+	log := expected.String()
+
+	// Append the first 600 lines, then resume with the rest.
+	half := strings.Index(log, "entry 600\n")
+	var checkpoints []cid.Cid
+	nd, err := run(ctx, ds, cid.Undef, strings.NewReader(log[:half]), 64, func(c cid.Cid) {
+		checkpoints = append(checkpoints, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err = run(ctx, ds, nd.Cid(), strings.NewReader(log[half:]), 64, func(c cid.Cid) {
+		checkpoints = append(checkpoints, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 600/64 + 400/64; len(checkpoints) != expected {
+		t.Fatalf("expected %d checkpoints, got %d", expected, len(checkpoints))
+	}
+
+	read := func(nd ipld.Node) string {
+		r, err := uio.NewDagReader(ctx, nd, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	if out := read(nd); out != log {
+		t.Fatalf("log has %d bytes, expected %d", len(out), len(log))
+	}
+	// Every checkpoint is a prefix of the log, ending with a full line.
+	for _, c := range checkpoints {
+		cnd, err := ds.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := read(cnd)
+		if !strings.HasPrefix(log, out) || !strings.HasSuffix(out, "\n") {
+			t.Fatalf("checkpoint %s is not a prefix of the log", c)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Command dirsync synchronizes a unixfs directory tree with a local
+// directory, starting from its previous version so unchanged entries are
+// kept as they are, and prints the changes and the new root.
+//
+//	dirsync [-store DIR] [-root CID] LOCALDIR
+//
+// Changes are printed as "A path" (added), "M path" (modified) and
+// "D path" (deleted). Only regular files and directories are synchronized.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	"github.com/TRON-US/go-unixfs/importer"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// syncer holds the state of a synchronization.
+type syncer struct {
+	ctx    context.Context
+	ds     ipld.DAGService
+	report func(change byte, p string)
+}
+
+// run synchronizes the tree `root` (an empty one if undefined) with the
+// local directory `dir`, calling `report` with every change, and returns
+// the new root.
+func run(ctx context.Context, ds ipld.DAGService, root cid.Cid, dir string, report func(change byte, p string)) (ipld.Node, error) {
+	s := &syncer{ctx: ctx, ds: ds, report: report}
+	var prev ipld.Node
+	if root.Defined() {
+		var err error
+		if prev, err = ds.Get(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+	return s.syncDir(dir, "", prev)
+}
+
+// syncDir returns the directory node of the local directory `dir`, at the
+// path `p` of the tree, updating the previous version `prev` (if any).
+func (s *syncer) syncDir(dir, p string, prev ipld.Node) (ipld.Node, error) {
+	var udir uio.Directory
+	if prev != nil {
+		var err error
+		if udir, err = uio.NewDirectoryFromNode(s.ds, prev); err != nil {
+			return nil, err
+		}
+	} else {
+		udir = uio.NewDirectory(s.ds)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() && !e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		local[name] = true
+
+		old, err := udir.Find(s.ctx, name)
+		if err == os.ErrNotExist {
+			old = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var nd ipld.Node
+		if e.IsDir() {
+			// A previous file (or any other entry) isn't reused.
+			if old != nil {
+				if _, err := uio.NewDirectoryFromNode(s.ds, old); err == uio.ErrNotADir {
+					old = nil
+					s.report('D', path.Join(p, name))
+				}
+			}
+			nd, err = s.syncDir(filepath.Join(dir, name), path.Join(p, name), old)
+		} else {
+			nd, err = s.importFile(filepath.Join(dir, name))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case old == nil:
+			s.report('A', path.Join(p, name))
+		case !old.Cid().Equals(nd.Cid()):
+			if !e.IsDir() {
+				s.report('M', path.Join(p, name))
+			}
+		default:
+			continue
+		}
+		if err := udir.AddChild(s.ctx, name, nd); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remove the entries missing from the local directory.
+	links, err := udir.Links(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		if local[l.Name] {
+			continue
+		}
+		if err := udir.RemoveChild(s.ctx, l.Name); err != nil {
+			return nil, err
+		}
+		s.report('D', path.Join(p, l.Name))
+	}
+
+	nd, err := udir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ds.Add(s.ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+func (s *syncer) importFile(p string) (ipld.Node, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return importer.BuildDagFromReader(s.ds, chunker.DefaultSplitter(f))
+}
+
+func main() {
+	storeDir := store.Flag()
+	rootArg := flag.String("root", "", "root of the previous version of the tree (empty tree if not set)")
+	flag.Parse()
+
+	if err := dirsync(*storeDir, *rootArg, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "dirsync:", err)
+		os.Exit(1)
+	}
+}
+
+func dirsync(storeDir, rootArg string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a single local directory")
+	}
+	var root cid.Cid
+	if rootArg != "" {
+		var err error
+		if root, err = cid.Decode(rootArg); err != nil {
+			return err
+		}
+	}
+	ds, err := store.Open(storeDir)
+	if err != nil {
+		return err
+	}
+
+	nd, err := run(context.Background(), ds, root, args[0], func(change byte, p string) {
+		fmt.Printf("%c %s\n", change, p)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(nd.Cid())
+	return nil
+}
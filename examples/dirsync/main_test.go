@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestDirsync(t *testing.T) {
+	ctx := context.Background()
+	ds, err := store.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(p, content string) {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync := func(root cid.Cid, expected ...string) ipld.Node {
+		var changes []string
+		nd, err := run(ctx, ds, root, dir, func(change byte, p string) {
+			changes = append(changes, fmt.Sprintf("%c %s", change, p))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(changes)
+		sort.Strings(expected)
+		if (len(changes) != 0 || len(expected) != 0) && !reflect.DeepEqual(changes, expected) {
+			t.Fatalf("expected changes %v, got %v", expected, changes)
+		}
+		return nd
+	}
+
+	write("a", "a")
+	write("sub/b", "b")
+	write("sub/deep/c", "c")
+	v1 := sync(cid.Undef, "A a", "A sub", "A sub/b", "A sub/deep", "A sub/deep/c")
+	if v := sync(v1.Cid()); !v.Cid().Equals(v1.Cid()) {
+		t.Fatal("syncing an unchanged directory changed the root")
+	}
+
+	write("sub/b", "changed")
+	write("d", "d")
+	if err := os.RemoveAll(filepath.Join(dir, "sub", "deep")); err != nil {
+		t.Fatal(err)
+	}
+	v2 := sync(v1.Cid(), "M sub/b", "A d", "D sub/deep")
+
+	// Starting over from an empty tree gives the same result.
+	if v := sync(cid.Undef, "A a", "A d", "A sub", "A sub/b"); !v.Cid().Equals(v2.Cid()) {
+		t.Fatal("incremental sync differs from a full one")
+	}
+}
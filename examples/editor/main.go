@@ -0,0 +1,125 @@
+// Command editor applies random-access writes to a unixfs file with a
+// DagModifier and prints the root of the new version.
+//
+//	editor [-store DIR] [-root CID] [-cat] OFFSET:TEXT...
+//
+// Every argument writes TEXT at OFFSET (past the end of the file the gap is
+// filled with zeros). Without `-root` the edits start from an empty file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	uio "github.com/TRON-US/go-unixfs/io"
+	"github.com/TRON-US/go-unixfs/mod"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// edit is a single write of the command line.
+type edit struct {
+	offset int64
+	data   []byte
+}
+
+func parseEdit(arg string) (edit, error) {
+	i := strings.IndexByte(arg, ':')
+	if i < 0 {
+		return edit{}, fmt.Errorf("invalid edit %q, expected OFFSET:TEXT", arg)
+	}
+	offset, err := strconv.ParseInt(arg[:i], 10, 64)
+	if err != nil || offset < 0 {
+		return edit{}, fmt.Errorf("invalid offset in %q", arg)
+	}
+	return edit{offset: offset, data: []byte(arg[i+1:])}, nil
+}
+
+// run applies the edits to the file `root` (an empty file if undefined)
+// and returns the new root.
+func run(ctx context.Context, ds ipld.DAGService, root cid.Cid, edits []edit) (ipld.Node, error) {
+	var nd ipld.Node = ft.EmptyFileNode()
+	if root.Defined() {
+		var err error
+		if nd, err = ds.Get(ctx, root); err != nil {
+			return nil, err
+		}
+	} else if err := ds.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+
+	dm, err := mod.NewDagModifier(ctx, nd, ds, chunker.SizeSplitterGen(chunker.DefaultBlockSize))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range edits {
+		if _, err := dm.WriteAt(e.data, e.offset); err != nil {
+			return nil, err
+		}
+	}
+	return dm.GetNode()
+}
+
+func main() {
+	storeDir := store.Flag()
+	rootArg := flag.String("root", "", "root of the file to edit (empty file if not set)")
+	cat := flag.Bool("cat", false, "print the edited file")
+	flag.Parse()
+
+	if err := editor(*storeDir, *rootArg, *cat, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "editor:", err)
+		os.Exit(1)
+	}
+}
+
+func editor(storeDir, rootArg string, cat bool, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no edits")
+	}
+	edits := make([]edit, len(args))
+	for i, arg := range args {
+		var err error
+		if edits[i], err = parseEdit(arg); err != nil {
+			return err
+		}
+	}
+	var root cid.Cid
+	if rootArg != "" {
+		var err error
+		if root, err = cid.Decode(rootArg); err != nil {
+			return err
+		}
+	}
+
+	ds, err := store.Open(storeDir)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	nd, err := run(ctx, ds, root, edits)
+	if err != nil {
+		return err
+	}
+	fmt.Println(nd.Cid())
+
+	if cat {
+		r, err := uio.NewDagReader(ctx, nd, ds)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(os.Stdout, r)
+		return err
+	}
+	return nil
+}
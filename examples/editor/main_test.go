@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestEditor(t *testing.T) {
+	ctx := context.Background()
+	ds, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var edits []edit
+	for _, arg := range []string{"0:hello world", "6:there", "14:!"} {
+		e, err := parseEdit(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits = append(edits, e)
+	}
+	nd, err := run(ctx, ds, cid.Undef, edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Edit the new version again, from the store.
+	nd, err = run(ctx, ds, nd.Cid(), []edit{{offset: 0, data: []byte("H")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := uio.NewDagReader(ctx, nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte("Hello there\x00\x00\x00!"); !bytes.Equal(out, expected) {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	if _, err := parseEdit("10"); err == nil {
+		t.Fatal("expected an error for an edit without text")
+	}
+}
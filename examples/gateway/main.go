@@ -0,0 +1,133 @@
+// Command gateway serves the unixfs trees of a local blockstore over HTTP,
+// with range requests for files and listings for directories.
+//
+//	gateway [-store DIR] [-listen ADDR]
+//
+// Paths have the form /CID[/PATH], e.g. `curl localhost:8080/<cid>/a/b`.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// gateway is the HTTP handler serving the trees of a DAG service.
+type gateway struct {
+	ds ipld.DAGService
+}
+
+// resolve returns the node at the path `names` under `nd`.
+func (g *gateway) resolve(ctx context.Context, nd ipld.Node, names []string) (ipld.Node, error) {
+	for len(names) > 0 {
+		lnk, rest, err := uio.ResolveUnixfsOnce(ctx, g.ds, nd, names)
+		if err != nil {
+			return nil, err
+		}
+		if nd, err = lnk.GetNode(ctx, g.ds); err != nil {
+			return nil, err
+		}
+		names = rest
+	}
+	return nd, nil
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+
+	var names []string
+	for _, name := range strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		http.Error(w, "expected a path of the form /CID[/PATH]", http.StatusNotFound)
+		return
+	}
+	root, err := cid.Decode(names[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	nd, err := g.ds.Get(ctx, root)
+	if err == nil {
+		nd, err = g.resolve(ctx, nd, names[1:])
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Content addressed, the same URL is always the same content.
+	w.Header().Set("Etag", `"`+nd.Cid().String()+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+
+	content, err := uio.NewFileContent(ctx, nd, g.ds, time.Time{})
+	switch {
+	case err == nil:
+		defer content.Close()
+		http.ServeContent(w, r, names[len(names)-1], content.ModTime(), content)
+	case errors.Is(err, uio.ErrIsDir):
+		g.serveDirectory(w, r, nd)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (g *gateway) serveDirectory(w http.ResponseWriter, r *http.Request, nd ipld.Node) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	dir, err := uio.NewDirectoryFromNode(g.ds, nd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links, err := dir.Links(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><body><h1>%s</h1><ul>\n", html.EscapeString(r.URL.Path))
+	for _, l := range links {
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a> %d</li>\n",
+			html.EscapeString(l.Name), html.EscapeString(l.Name), l.Size)
+	}
+	fmt.Fprint(w, "</ul></body></html>\n")
+}
+
+func main() {
+	storeDir := store.Flag()
+	listen := flag.String("listen", "localhost:8080", "address to listen on")
+	flag.Parse()
+
+	ds, err := store.Open(*storeDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gateway:", err)
+		os.Exit(1)
+	}
+	log.Printf("serving on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, &gateway{ds: ds}))
+}
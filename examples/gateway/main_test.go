@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/examples/internal/store"
+	"github.com/TRON-US/go-unixfs/importer"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func TestGateway(t *testing.T) {
+	ctx := context.Background()
+	ds, err := store.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 1<<20)
+	u.NewSeededRand(1).Read(data)
+	file, err := importer.BuildDagFromReader(ds, chunker.NewSizeSplitter(bytes.NewReader(data), 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := uio.NewDirectory(ds)
+	if err := dir.AddChild(ctx, "data.bin", file); err != nil {
+		t.Fatal(err)
+	}
+	root, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(&gateway{ds: ds})
+	defer srv.Close()
+	get := func(p, rng string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	body := func(resp *http.Response) []byte {
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if resp := get("/"+root.Cid().String()+"/data.bin", ""); !bytes.Equal(body(resp), data) {
+		t.Fatal("wrong file content")
+	}
+	resp := get("/"+root.Cid().String()+"/data.bin", "bytes=100000-199999")
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected a partial response, got %s", resp.Status)
+	}
+	if !bytes.Equal(body(resp), data[100000:200000]) {
+		t.Fatal("wrong range content")
+	}
+
+	resp = get("/"+root.Cid().String()+"/", "")
+	if listing := string(body(resp)); !strings.Contains(listing, `href="data.bin"`) {
+		t.Fatalf("expected data.bin in the listing, got %q", listing)
+	}
+	resp = get("/"+root.Cid().String()+"/missing", "")
+	body(resp)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,35 @@
+// Package store opens the local blockstore shared by the example programs.
+package store
+
+import (
+	"flag"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	fsds "github.com/ipfs/go-datastore/examples"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// Flag registers the `-store` flag common to the example programs.
+func Flag() *string {
+	return flag.String("store", "", "directory of the local blockstore (in memory if empty)")
+}
+
+// Open returns a DAG service on top of a blockstore kept in the `dir`
+// directory, which must exist, or in memory if `dir` is empty.
+func Open(dir string) (ipld.DAGService, error) {
+	var d ds.Batching = ds.NewMapDatastore()
+	if dir != "" {
+		fs, err := fsds.NewDatastore(dir)
+		if err != nil {
+			return nil, err
+		}
+		d = fs.(ds.Batching)
+	}
+	bs := bstore.NewBlockstore(dssync.MutexWrap(d))
+	return mdag.NewDAGService(bserv.New(bs, offline.Exchange(bs))), nil
+}
@@ -0,0 +1,156 @@
+package unixfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// Features is a set of the features of the format a DAG may use beyond the
+// protobuf nodes of the original unixfs, which not every implementation
+// supports. Writers can be limited to a compatibility profile (see
+// `helpers.DagBuilderParams.Profile`) and `DagFeatures` reports the ones a
+// DAG uses.
+type Features uint32
+
+const (
+	// FeatureRawLeaves is the use of raw blocks (CIDv1, raw codec) as
+	// leaves instead of protobuf nodes.
+	FeatureRawLeaves Features = 1 << iota
+	// FeatureInlineBlocks is the use of blocks inlined in their CID (with
+	// the identity hash function).
+	FeatureInlineBlocks
+	// FeatureAttributes is the use of the mode and modification time
+	// fields of unixfs 1.5.
+	FeatureAttributes
+	// FeatureXattrs is the use of extended attributes.
+	FeatureXattrs
+	// FeatureTokenMetadata is the use of `TTokenMeta` nodes.
+	FeatureTokenMetadata
+)
+
+// Compatibility profiles, the features each generation of readers supports.
+const (
+	// CompatV1 is the unixfs 1.0 format, as read by any implementation
+	// supporting CIDv1.
+	CompatV1 = FeatureRawLeaves | FeatureInlineBlocks
+	// CompatV15 adds the mode and modification time of unixfs 1.5.
+	CompatV15 = CompatV1 | FeatureAttributes
+	// CompatAll is every feature this package implements.
+	CompatAll = CompatV15 | FeatureXattrs | FeatureTokenMetadata
+)
+
+var featureNames = []string{"raw-leaves", "inline-blocks", "attributes", "xattrs", "token-metadata"}
+
+func (f Features) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range featureNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+			f &^= 1 << i
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// FeatureError is returned when writing a DAG would use features out of
+// the target profile.
+type FeatureError struct {
+	// Features are the features out of the profile.
+	Features Features
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("unixfs: %s not in the target profile", e.Features)
+}
+
+// CheckProfile returns a `*FeatureError` if `used` has features out of the
+// `profile`. A zero profile targets no profile, all features are allowed.
+func CheckProfile(profile, used Features) error {
+	if profile == 0 {
+		return nil
+	}
+	if out := used &^ profile; out != 0 {
+		return &FeatureError{Features: out}
+	}
+	return nil
+}
+
+// NodeFeatures returns the features used by the node `nd` itself (not the
+// nodes under it), and by the CIDs of its links.
+func NodeFeatures(nd ipld.Node) Features {
+	f := cidFeatures(nd.Cid())
+	for _, l := range nd.Links() {
+		f |= cidFeatures(l.Cid)
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return f
+	}
+	fsn, err := fsNodeFromNode(pn)
+	if err != nil {
+		return f
+	}
+	if fsn.Mode() != 0 || !fsn.ModTime().IsZero() {
+		f |= FeatureAttributes
+	}
+	if len(fsn.Xattrs()) != 0 {
+		f |= FeatureXattrs
+	}
+	if fsn.Type() == TTokenMeta {
+		f |= FeatureTokenMetadata
+	}
+	return f
+}
+
+func cidFeatures(c cid.Cid) Features {
+	var f Features
+	if IsInline(c) {
+		f |= FeatureInlineBlocks
+	}
+	if c.Type() == cid.Raw {
+		f |= FeatureRawLeaves
+	}
+	return f
+}
+
+// DagFeatures walks the DAG under `nd`, fetching its nodes from `ng`, and
+// returns the features it uses, so readers can tell whether they support
+// it. Subtrees linked several times are only walked once.
+func DagFeatures(ctx context.Context, nd ipld.Node, ng ipld.NodeGetter) (Features, error) {
+	seen := make(map[string]struct{})
+	var walk func(nd ipld.Node) (Features, error)
+	walk = func(nd ipld.Node) (Features, error) {
+		f := NodeFeatures(nd)
+		var children []cid.Cid
+		for _, l := range nd.Links() {
+			if _, ok := seen[l.Cid.KeyString()]; !ok {
+				seen[l.Cid.KeyString()] = struct{}{}
+				children = append(children, l.Cid)
+			}
+		}
+		for _, promise := range ipld.GetNodes(ctx, ng, children) {
+			child, err := promise.Get(ctx)
+			if err != nil {
+				return 0, err
+			}
+			cf, err := walk(child)
+			if err != nil {
+				return 0, err
+			}
+			f |= cf
+		}
+		return f, nil
+	}
+	return walk(nd)
+}
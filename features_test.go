@@ -0,0 +1,68 @@
+package unixfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestFeatures(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	inline, err := dag.NewRawNodeWPrefix([]byte("tiny"), cid.V1Builder{Codec: cid.Raw, MhType: mh.IDENTITY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := dag.NewRawNode([]byte("leaf"))
+	fsn := NewFSNode(TFile)
+	fsn.AddBlockSize(4)
+	fsn.AddBlockSize(4)
+	fsn.SetModTime(time.Unix(1600000000, 0))
+	data, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := dag.NodeWithData(data)
+	for _, child := range []*dag.RawNode{inline, leaf} {
+		if err := file.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Add(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if f := NodeFeatures(EmptyFileNode()); f != 0 {
+		t.Fatalf("expected no features, got %s", f)
+	}
+	expected := FeatureRawLeaves | FeatureInlineBlocks | FeatureAttributes
+	if f := NodeFeatures(file); f != expected {
+		t.Fatalf("expected %s, got %s", expected, f)
+	}
+	if f, err := DagFeatures(ctx, file, ds); err != nil || f != expected {
+		t.Fatalf("expected %s, got %s (%v)", expected, f, err)
+	}
+	if _, err := DagFeatures(ctx, file, mdtest.Mock()); err == nil {
+		t.Fatal("expected missing nodes to fail")
+	}
+
+	if err := CheckProfile(CompatV15, expected); err != nil {
+		t.Fatal(err)
+	}
+	err = CheckProfile(CompatV1, expected|FeatureXattrs)
+	if fe, ok := err.(*FeatureError); !ok || fe.Features != FeatureAttributes|FeatureXattrs {
+		t.Fatalf("expected the attributes and xattrs out of the profile, got %v", err)
+	}
+	if err := CheckProfile(0, CompatAll); err != nil {
+		t.Fatal(err)
+	}
+	if s := (FeatureRawLeaves | 1<<10).String(); s != "raw-leaves|0x400" {
+		t.Fatalf("unexpected string %q", s)
+	}
+}
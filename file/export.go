@@ -0,0 +1,80 @@
+package unixfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	files "github.com/TRON-US/go-btfs-files"
+)
+
+// Attributed is implemented by the files and directories returned by
+// `NewUnixfsFile`, to expose the attributes stored in their root node.
+type Attributed interface {
+	// Mode returns the mode of the node (see `ft.FSNode.Mode`), zero if it
+	// has none.
+	Mode() os.FileMode
+	// ModTime returns the modification time of the node, the zero time if
+	// it has none.
+	ModTime() time.Time
+}
+
+var _ Attributed = (*ufsFile)(nil)
+var _ Attributed = (*ufsDirectory)(nil)
+
+// WriteTo writes the node `nd` to the local filesystem at `fpath` like
+// `files.WriteTo`, then applies the mode and the modification time of the
+// nodes implementing `Attributed` (directories after their entries, so a
+// read-only directory can still be filled). Nodes without a mode keep the
+// permissions `files.WriteTo` gives them.
+func WriteTo(nd files.Node, fpath string) error {
+	dir, ok := nd.(files.Directory)
+	if !ok {
+		if err := files.WriteTo(nd, fpath); err != nil {
+			return err
+		}
+		return applyAttributes(nd, fpath)
+	}
+
+	if _, err := os.Lstat(fpath); err == nil {
+		return files.ErrPathExistsOverwrite
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Mkdir(fpath, 0777); err != nil {
+		return err
+	}
+	entries := dir.Entries()
+	for entries.Next() {
+		name := entries.Name()
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return files.ErrInvalidDirectoryEntry
+		}
+		if err := WriteTo(entries.Node(), filepath.Join(fpath, name)); err != nil {
+			return err
+		}
+	}
+	if err := entries.Err(); err != nil {
+		return err
+	}
+	return applyAttributes(nd, fpath)
+}
+
+func applyAttributes(nd files.Node, fpath string) error {
+	an, ok := nd.(Attributed)
+	if !ok {
+		return nil
+	}
+	if mtime := an.ModTime(); !mtime.IsZero() {
+		if err := os.Chtimes(fpath, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	if mode := an.Mode(); mode != 0 {
+		if err := os.Chmod(fpath, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
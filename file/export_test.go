@@ -0,0 +1,90 @@
+package unixfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ft "github.com/TRON-US/go-unixfs"
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestWriteToAttributes(t *testing.T) {
+	ctx := context.Background()
+	dserv := testu.GetDAGServ()
+	mtime := time.Unix(1600000000, 0)
+
+	exe := dag.NodeWithData(ft.FilePBData([]byte("#!/bin/sh\n"), 10))
+	data, err := ft.DataWithMode(exe.Data(), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ft.DataWithModTime(data, mtime); err != nil {
+		t.Fatal(err)
+	}
+	exe.SetData(data)
+	plain := dag.NodeWithData(ft.FilePBData([]byte("plain"), 5))
+	for _, nd := range []*dag.ProtoNode{exe, plain} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := uio.NewDirectory(dserv)
+	if err := dir.AddChild(ctx, "run.sh", exe); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddChild(ctx, "plain", plain); err != nil {
+		t.Fatal(err)
+	}
+	// Read-only, it must be applied after writing the entries.
+	if err := dir.SetMode(0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.SetModTime(mtime); err != nil {
+		t.Fatal(err)
+	}
+	root, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := NewUnixfsFile(ctx, dserv, root, UnixfsFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := WriteTo(nd, dest); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dest, 0755)
+
+	check := func(name string, mode os.FileMode, mtime time.Time) {
+		fi, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Fatalf("%s: expected mode %v, got %v", name, mode, fi.Mode().Perm())
+		}
+		if !mtime.IsZero() && !fi.ModTime().Equal(mtime) {
+			t.Fatalf("%s: expected mtime %v, got %v", name, mtime, fi.ModTime())
+		}
+	}
+	check("run.sh", 0755, mtime)
+	check(".", 0555, mtime)
+
+	// Without a mode the defaults of `files.WriteTo` (and the umask) apply.
+	fi, err := os.Stat(filepath.Join(dest, "plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0111 != 0 {
+		t.Fatalf("plain file exported executable: %v", fi.Mode())
+	}
+}
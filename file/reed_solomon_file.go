@@ -10,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/events"
 	"github.com/TRON-US/go-unixfs/importer/balanced"
 	ihelper "github.com/TRON-US/go-unixfs/importer/helpers"
 	"github.com/TRON-US/go-unixfs/importer/trickle"
@@ -403,7 +405,7 @@ func checkAndRecoverShards(ctx context.Context, root ipld.Node, dserv ipld.DAGSe
 		}
 	}
 	if len(recovered) > 0 {
-		err := addRecoveredShards(ctx, root, dserv, recovered, rcids)
+		err := addRecoveredShards(ctx, root, dserv, recovered, rcids, opts.Events)
 		if err != nil {
 			return err
 		}
@@ -414,7 +416,7 @@ func checkAndRecoverShards(ctx context.Context, root ipld.Node, dserv ipld.DAGSe
 // addRecoveredShards mimics adding reed solomon shards anew according to the
 // original adder options.rootNode ipld.Node
 func addRecoveredShards(ctx context.Context, rootNode ipld.Node, ds ipld.DAGService,
-	recovered []io.Reader, rcids []cid.Cid) error {
+	recovered []io.Reader, rcids []cid.Cid, em events.Emitter) error {
 	b, err := uio.GetMetaDataFromDagRoot(ctx, rootNode, ds)
 	if err != nil {
 		return err
@@ -457,9 +459,21 @@ func addRecoveredShards(ctx context.Context, rootNode ipld.Node, ds ipld.DAGServ
 		}
 
 		if !rcids[i].Equals(sn.Cid()) {
-			return fmt.Errorf("recovered node [%s] does not match original [%s]",
+			err = fmt.Errorf("recovered node [%s] does not match original [%s]",
 				sn.Cid().String(), rcids[i].String())
+			events.Emit(em, events.Event{Operation: events.OpRepair, Cid: rcids[i], Err: err})
+			return err
+		}
+
+		// The size is only reported, a shard root it can't be read from
+		// (e.g., a raw leaf) doesn't fail the repair.
+		var size uint64
+		if fsn, err := ft.ExtractFSNode(sn); err == nil {
+			size = fsn.FileSize()
+		} else if ft.IsRawLeaf(sn) {
+			size = uint64(len(sn.RawData()))
 		}
+		events.Emit(em, events.Event{Operation: events.OpRepair, Cid: sn.Cid(), Bytes: size})
 	}
 
 	return nil
@@ -5,7 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
 	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/events"
 	uio "github.com/TRON-US/go-unixfs/io"
 	"github.com/TRON-US/go-unixfs/util"
 
@@ -30,12 +36,18 @@ type ufsDirectory struct {
 	dserv ipld.DAGService
 	dir   uio.Directory
 	size  int64
+
+	// Propagated to the entries for event reporting.
+	opts UnixfsFileOptions
+	path string
 }
 
 type ufsIterator struct {
 	ctx   context.Context
 	files chan *ipld.Link
 	dserv ipld.DAGService
+	opts  UnixfsFileOptions
+	path  string
 
 	curName string
 	curFile files.Node
@@ -90,7 +102,8 @@ func (it *ufsIterator) Next() bool {
 	if it.curName == uio.SmallestString {
 		return it.err == nil
 	}
-	it.curFile, it.err = NewUnixfsFile(it.ctx, it.dserv, nd, UnixfsFileOptions{})
+	opts := UnixfsFileOptions{Events: it.opts.Events}
+	it.curFile, it.err = newUnixfsFile(it.ctx, it.dserv, nd, opts, path.Join(it.path, it.curName))
 	return it.err == nil
 }
 
@@ -131,6 +144,8 @@ func (d *ufsDirectory) Entries() files.DirIterator {
 		files: fileCh,
 		errCh: errCh,
 		dserv: d.dserv,
+		opts:  d.opts,
+		path:  d.path,
 	}
 }
 
@@ -146,15 +161,72 @@ func (f *ufsDirectory) IsReedSolomon() bool {
 	return false
 }
 
+func (d *ufsDirectory) Mode() os.FileMode {
+	return d.dir.Mode()
+}
+
+func (d *ufsDirectory) ModTime() time.Time {
+	return d.dir.ModTime()
+}
+
 type ufsFile struct {
 	uio.DagReader
+
+	// Export events reporting, `events` may be nil.
+	events events.Emitter
+	path   string
+	cid    cid.Cid
+
+	// Attributes of the root node of the file.
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (f *ufsFile) Mode() os.FileMode {
+	return f.mode
+}
+
+func (f *ufsFile) ModTime() time.Time {
+	return f.modTime
 }
 
 func (f *ufsFile) Size() (int64, error) {
 	return int64(f.DagReader.Size()), nil
 }
 
-func newUnixfsDir(ctx context.Context, dserv ipld.DAGService, nd *dag.ProtoNode) (files.Directory, error) {
+// Read wraps the `DagReader` to report the bytes delivered.
+func (f *ufsFile) Read(b []byte) (int, error) {
+	n, err := f.DagReader.Read(b)
+	f.emit(uint64(n), err)
+	return n, err
+}
+
+// WriteTo wraps the `DagReader` to report the bytes delivered (it is
+// the method used by `io.Copy`, which would skip `Read`).
+func (f *ufsFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := f.DagReader.WriteTo(w)
+	f.emit(uint64(n), err)
+	return n, err
+}
+
+func (f *ufsFile) emit(n uint64, err error) {
+	if err == io.EOF {
+		err = nil
+	}
+	if n == 0 && err == nil {
+		return
+	}
+	events.Emit(f.events, events.Event{
+		Operation: events.OpExport,
+		Path:      f.path,
+		Cid:       f.cid,
+		Bytes:     n,
+		Err:       err,
+	})
+}
+
+func newUnixfsDir(ctx context.Context, dserv ipld.DAGService, nd *dag.ProtoNode,
+	opts UnixfsFileOptions, dirPath string) (files.Directory, error) {
 	dir, err := uio.NewDirectoryFromNode(dserv, nd)
 	if err != nil {
 		return nil, err
@@ -171,12 +243,19 @@ func newUnixfsDir(ctx context.Context, dserv ipld.DAGService, nd *dag.ProtoNode)
 
 		dir:  dir,
 		size: int64(size),
+
+		opts: opts,
+		path: dirPath,
 	}, nil
 }
 
 type UnixfsFileOptions struct {
 	Meta         bool
 	RepairShards []cid.Cid
+	// Events, if set, receives an `events.OpExport` event for every read
+	// of the returned file (or of the files under the returned directory)
+	// and an `events.OpRepair` event for every repaired shard.
+	Events events.Emitter
 }
 
 // NewUnixFsFile returns a DagReader for the 'nd' root node.
@@ -186,16 +265,26 @@ type UnixfsFileOptions struct {
 // the shards would be reconstructed and added on this node.
 func NewUnixfsFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node,
 	opts UnixfsFileOptions) (files.Node, error) {
+	return newUnixfsFile(ctx, dserv, nd, opts, "")
+}
+
+// newUnixfsFile implements `NewUnixfsFile` keeping track of the `filePath`
+// of the node relative to the root being exported, used only for events.
+func newUnixfsFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node,
+	opts UnixfsFileOptions, filePath string) (files.Node, error) {
 	rawNode := false
+	var mode os.FileMode
+	var modTime time.Time
 	switch dn := nd.(type) {
 	case *dag.ProtoNode:
 		fsn, err := ft.FSNodeFromBytes(dn.Data())
 		if err != nil {
 			return nil, err
 		}
+		mode, modTime = fsn.Mode(), fsn.ModTime()
 		if fsn.IsDir() {
 			if !opts.Meta {
-				return newUnixfsDir(ctx, dserv, dn)
+				return newUnixfsDir(ctx, dserv, dn, opts, filePath)
 			}
 			// Now the current case is when the dir node may contain metadata.
 		} else if fsn.Type() == ft.TSymlink {
@@ -258,6 +347,11 @@ func NewUnixfsFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node,
 
 	return &ufsFile{
 		DagReader: dr,
+		events:    opts.Events,
+		path:      filePath,
+		cid:       nd.Cid(),
+		mode:      mode,
+		modTime:   modTime,
 	}, nil
 }
 
@@ -0,0 +1,138 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"time"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// Modes of the nodes without one, the defaults of the unixfs 1.5
+// specification (symlinks have all the permissions, as in POSIX).
+const (
+	DefaultFileMode    os.FileMode = 0644
+	DefaultDirMode     os.FileMode = 0755
+	DefaultSymlinkMode os.FileMode = 0777
+)
+
+// ErrUnsupportedFileType is returned for the files unixfs can't represent:
+// devices, named pipes, sockets and irregular files.
+var ErrUnsupportedFileType = errors.New("file type not supported by unixfs")
+
+// FileInfoType returns the unixfs type of the node representing a file
+// described by `fi`: `TDirectory`, `TSymlink` or `TFile`, and
+// `ErrUnsupportedFileType` for the other types of files.
+func FileInfoType(fi os.FileInfo) (pb.Data_DataType, error) {
+	switch m := fi.Mode(); {
+	case m.IsDir():
+		return TDirectory, nil
+	case m&os.ModeSymlink != 0:
+		return TSymlink, nil
+	case m.IsRegular():
+		return TFile, nil
+	default:
+		return 0, fmt.Errorf("%s: %w", fi.Name(), ErrUnsupportedFileType)
+	}
+}
+
+// FileInfoAttributes returns the attributes of `fi` stored in unixfs
+// nodes: its mode as kept by `FSNode.SetMode` (without the type bits) and
+// its modification time.
+func FileInfoAttributes(fi os.FileInfo) (os.FileMode, time.Time) {
+	return fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky), fi.ModTime()
+}
+
+// SetFileInfo sets the mode and the modification time of the node to the
+// ones of `fi` (see `FileInfoAttributes`). Its type and size are given by
+// the contents of the node.
+func (n *FSNode) SetFileInfo(fi os.FileInfo) {
+	mode, mtime := FileInfoAttributes(fi)
+	n.SetMode(mode)
+	n.SetModTime(mtime)
+}
+
+// FileInfo returns the `os.FileInfo` of the unixfs node `nd` named `name`
+// (its base name is the one of the info), the reverse of `SetFileInfo`. The
+// nodes without a mode have the default one of their type, the size is
+// the file size of files (wrapped by `TMetadata` nodes or not), the length
+// of the target of symlinks (as `os.Lstat` reports it) and zero for
+// directories. `Sys` returns `nd`.
+func FileInfo(name string, nd ipld.Node) (os.FileInfo, error) {
+	fi := &nodeInfo{name: path.Base(name), node: nd}
+	if IsRawLeaf(nd) {
+		fi.size = uint64(len(nd.RawData()))
+		fi.mode = DefaultFileMode
+		return fi, nil
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, ErrUnrecognizedType
+	}
+	fsn, err := fsNodeFromNode(pn)
+	if err != nil {
+		return nil, err
+	}
+
+	var typeBits os.FileMode
+	switch fsn.Type() {
+	case TFile, TRaw, TTokenMeta:
+		fi.size = fsn.FileSize()
+		if !fsn.HasFileSize() {
+			fi.size = uint64(len(fsn.Data()))
+		}
+		fi.mode = DefaultFileMode
+	case TMetadata:
+		// The size of the wrapped file, `FileSize` doesn't know it.
+		fi.size = fsn.format.GetFilesize()
+		fi.mode = DefaultFileMode
+	case TDirectory, THAMTShard:
+		typeBits = os.ModeDir
+		fi.mode = DefaultDirMode
+	case TSymlink:
+		typeBits = os.ModeSymlink
+		fi.size = uint64(len(fsn.Data()))
+		fi.mode = DefaultSymlinkMode
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnrecognizedType, fsn.Type())
+	}
+	if m := fsn.Mode(); m != 0 {
+		fi.mode = m
+	}
+	fi.mode |= typeBits
+	fi.modTime = fsn.ModTime()
+	return fi, nil
+}
+
+type nodeInfo struct {
+	name    string
+	size    uint64
+	mode    os.FileMode
+	modTime time.Time
+	node    ipld.Node
+}
+
+var _ os.FileInfo = (*nodeInfo)(nil)
+
+func (fi *nodeInfo) Name() string { return fi.name }
+
+// Size returns the size of the file, saturated to the largest offset for
+// files over 8 EiB (see `SizeToOffset`).
+func (fi *nodeInfo) Size() int64 {
+	size, err := SizeToOffset(fi.size)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return size
+}
+
+func (fi *nodeInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *nodeInfo) ModTime() time.Time { return fi.modTime }
+func (fi *nodeInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *nodeInfo) Sys() interface{}   { return fi.node }
@@ -0,0 +1,101 @@
+package unixfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// pipeInfo is the info of a named pipe.
+type pipeInfo struct{ os.FileInfo }
+
+func (pipeInfo) Name() string      { return "fifo" }
+func (pipeInfo) Mode() os.FileMode { return os.ModeNamedPipe | 0600 }
+
+func TestFileInfo(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+	filePath := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(filePath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("run.sh", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filePath, dir} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"run.sh", "link", "."} {
+		local, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := FileInfoType(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsn := NewFSNode(typ)
+		switch typ {
+		case TFile:
+			fsn.SetData([]byte("#!/bin/sh\n"))
+		case TSymlink:
+			fsn.SetData([]byte("run.sh"))
+		}
+		fsn.SetFileInfo(local)
+		data, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd := dag.NodeWithData(data)
+
+		fi, err := FileInfo("some/path/"+local.Name(), nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Name() != local.Name() || fi.Mode() != local.Mode() || fi.IsDir() != local.IsDir() || fi.Sys() != nd {
+			t.Fatalf("%s: expected %v, got %v", name, local.Mode(), fi.Mode())
+		}
+		if typ != TSymlink && !fi.ModTime().Equal(local.ModTime()) {
+			t.Fatalf("%s: expected %v, got %v", name, local.ModTime(), fi.ModTime())
+		}
+		if !local.IsDir() && fi.Size() != local.Size() {
+			t.Fatalf("%s: expected %d bytes, got %d", name, local.Size(), fi.Size())
+		}
+	}
+
+	if _, err := FileInfoType(pipeInfo{}); !errors.Is(err, ErrUnsupportedFileType) {
+		t.Fatalf("expected %v, got %v", ErrUnsupportedFileType, err)
+	}
+
+	// The nodes without attributes.
+	md, err := BytesForMetadata(&Metadata{MimeType: "text/plain", Size: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		nd   ipld.Node
+		mode os.FileMode
+		size int64
+	}{
+		{dag.NewRawNode([]byte("leaf")), DefaultFileMode, 4},
+		{EmptyDirNode(), os.ModeDir | DefaultDirMode, 0},
+		{dag.NodeWithData(FilePBData(nil, 42)), DefaultFileMode, 42},
+		{dag.NodeWithData(md), DefaultFileMode, 42},
+	} {
+		fi, err := FileInfo("node", tc.nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != tc.mode || fi.Size() != tc.size || !fi.ModTime().IsZero() {
+			t.Fatalf("expected %v and %d bytes, got %v and %d", tc.mode, tc.size, fi.Mode(), fi.Size())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package unixfs
+
+import (
+	"container/list"
+	"sync"
+
+	proto "github.com/gogo/protobuf/proto"
+	dag "github.com/ipfs/go-merkledag"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+const (
+	// Nodes with unixfs data up to this size are kept decoded by
+	// `FSNodeFromNode`: the internal nodes of the importers and small
+	// leaves. Larger leaves are decoded every time.
+	maxCachedData = 4096
+	// Number of decoded nodes kept.
+	fsNodeCacheSize = 1024
+)
+
+// fsNodeCache is a least recently used cache of decoded nodes keyed by
+// their unixfs data.
+type fsNodeCache struct {
+	lk sync.Mutex
+	// Most recently used first, of `*fsNodeEntry`.
+	lru   *list.List
+	nodes map[string]*list.Element
+}
+
+type fsNodeEntry struct {
+	key string
+	fsn *FSNode
+}
+
+var decoded = &fsNodeCache{lru: list.New(), nodes: make(map[string]*list.Element)}
+
+// FSNodeFromNode returns the decoded unixfs data of `nd` like
+// `FSNodeFromBytes`, memoized so the code walking the same nodes over and
+// over (the `DagModifier` computing sizes and looking for offsets) only
+// decodes them once. The nodes are looked up by their data, so an edited
+// node is never taken for its previous version. The returned `FSNode` is a
+// copy of the memoized one, owned by the caller. Decoding failures are
+// `*DecodeError`s carrying the key of `nd`.
+func FSNodeFromNode(nd *dag.ProtoNode) (*FSNode, error) {
+	fsn, err := fsNodeFromNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.clone(), nil
+}
+
+// fsNodeFromNode is `FSNodeFromNode` without the copy, the returned
+// `FSNode` is shared and must not be modified.
+func fsNodeFromNode(nd *dag.ProtoNode) (*FSNode, error) {
+	data := nd.Data()
+	if len(data) > maxCachedData {
+		fsn, err := FSNodeFromBytes(data)
+		if err != nil {
+			return nil, withKey(err, nd.Cid())
+		}
+		return fsn, nil
+	}
+
+	decoded.lk.Lock()
+	// No allocation for the lookup, only when adding.
+	if e, ok := decoded.nodes[string(data)]; ok {
+		decoded.lru.MoveToFront(e)
+		fsn := e.Value.(*fsNodeEntry).fsn
+		decoded.lk.Unlock()
+		return fsn, nil
+	}
+	decoded.lk.Unlock()
+
+	fsn, err := FSNodeFromBytes(data)
+	if err != nil {
+		return nil, withKey(err, nd.Cid())
+	}
+	// Computed before the node is shared, `ChildAt` doesn't write it then.
+	fsn.blockStarts()
+	key := string(data)
+
+	decoded.lk.Lock()
+	defer decoded.lk.Unlock()
+	if e, ok := decoded.nodes[key]; ok {
+		decoded.lru.MoveToFront(e)
+		return e.Value.(*fsNodeEntry).fsn, nil
+	}
+	decoded.nodes[key] = decoded.lru.PushFront(&fsNodeEntry{key: key, fsn: fsn})
+	if decoded.lru.Len() > fsNodeCacheSize {
+		e := decoded.lru.Back()
+		decoded.lru.Remove(e)
+		delete(decoded.nodes, e.Value.(*fsNodeEntry).key)
+	}
+	return fsn, nil
+}
+
+// clone returns a deep copy of the node, along with its block offsets.
+func (n *FSNode) clone() *FSNode {
+	c := &FSNode{format: *proto.Clone(&n.format).(*pb.Data)}
+	if n.starts != nil {
+		c.starts = append([]uint64(nil), n.starts...)
+	}
+	return c
+}
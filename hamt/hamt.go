@@ -26,7 +26,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
@@ -44,6 +46,12 @@ const (
 	HashMurmur3 uint64 = 0x22
 )
 
+// EntryXattrPrefix prefixes the names of the extended attributes of a
+// shard node recording the attributes of the entries whose links the node
+// holds (see `Shard.SetEntryAttributes`), followed by the name of the
+// entry.
+const EntryXattrPrefix = "unixfs.entry."
+
 func init() {
 	internal.HAMTHashFunction = murmur3Hash
 }
@@ -64,6 +72,12 @@ type Shard struct {
 
 	builder  cid.Builder
 	hashFunc uint64
+	// File attributes of the directory (see `format.FSNode.CopyAttributes`),
+	// only set in the root shard, nil if it has none.
+	attrs *format.FSNode
+	// Attributes of the entries of the links not loaded yet, by name,
+	// read from the node of the shard (see `SetEntryAttributes`).
+	entries map[string][]byte
 
 	// String format with number of zeros that will be present in the hexadecimal
 	// encoding of the child index to always reach the fixed maxpadlen chars.
@@ -82,6 +96,8 @@ type Shard struct {
 	// leaf node
 	key string
 	val *ipld.Link
+	// Attributes of the entry of a leaf node, if any.
+	entry []byte
 }
 
 // NewShard creates a new, empty HAMT shard with the given size.
@@ -141,7 +157,7 @@ func NewHamtFromDag(dserv ipld.DAGService, nd ipld.Node) (*Shard, error) {
 	}
 
 	if fsn.Type() != format.THAMTShard {
-		return nil, fmt.Errorf("node was not a dir shard")
+		return nil, format.ErrNotShard
 	}
 
 	if fsn.HashType() != HashMurmur3 {
@@ -159,6 +175,19 @@ func NewHamtFromDag(dserv ipld.DAGService, nd ipld.Node) (*Shard, error) {
 
 	ds.hashFunc = fsn.HashType()
 	ds.builder = pbnd.CidBuilder()
+	for _, name := range fsn.Xattrs() {
+		if !strings.HasPrefix(name, EntryXattrPrefix) {
+			continue
+		}
+		if ds.entries == nil {
+			ds.entries = make(map[string][]byte)
+		}
+		ds.entries[strings.TrimPrefix(name, EntryXattrPrefix)], _ = fsn.Xattr(name)
+		fsn.RemoveXattr(name)
+	}
+	if hasAttributes(fsn) {
+		ds.attrs = fsn
+	}
 
 	return ds, nil
 }
@@ -173,10 +202,81 @@ func (ds *Shard) CidBuilder() cid.Builder {
 	return ds.builder
 }
 
+// hasAttributes returns whether the node has any file attribute.
+func hasAttributes(fsn *format.FSNode) bool {
+	return !fsn.ModTime().IsZero() || fsn.Mode() != 0 || len(fsn.Xattrs()) > 0
+}
+
+func (ds *Shard) attributes() *format.FSNode {
+	if ds.attrs == nil {
+		ds.attrs = format.NewFSNode(format.THAMTShard)
+	}
+	return ds.attrs
+}
+
+// SetModTime sets the modification time recorded in the node of the shard
+// (the zero time removes it), it is meant for the root shard of the
+// directory.
+func (ds *Shard) SetModTime(t time.Time) {
+	ds.attributes().SetModTime(t)
+}
+
+// ModTime returns the modification time of the shard, the zero time if it
+// has none.
+func (ds *Shard) ModTime() time.Time {
+	if ds.attrs == nil {
+		return time.Time{}
+	}
+	return ds.attrs.ModTime()
+}
+
+// SetMode sets the mode recorded in the node of the shard (zero removes
+// it), it is meant for the root shard of the directory.
+func (ds *Shard) SetMode(m os.FileMode) {
+	ds.attributes().SetMode(m)
+}
+
+// Mode returns the mode of the shard, zero if it has none.
+func (ds *Shard) Mode() os.FileMode {
+	if ds.attrs == nil {
+		return 0
+	}
+	return ds.attrs.Mode()
+}
+
+// SetXattr sets an extended attribute recorded in the node of the shard,
+// it is meant for the root shard of the directory.
+func (ds *Shard) SetXattr(name string, value []byte) {
+	ds.attributes().SetXattr(name, value)
+}
+
+// RemoveXattr removes an extended attribute of the shard, returning
+// whether it had it.
+func (ds *Shard) RemoveXattr(name string) bool {
+	return ds.attrs != nil && ds.attrs.RemoveXattr(name)
+}
+
+// Xattr returns the value of an extended attribute of the shard.
+func (ds *Shard) Xattr(name string) ([]byte, bool) {
+	if ds.attrs == nil {
+		return nil, false
+	}
+	return ds.attrs.Xattr(name)
+}
+
+// Xattrs returns the names of the extended attributes of the shard, sorted.
+func (ds *Shard) Xattrs() []string {
+	if ds.attrs == nil {
+		return nil
+	}
+	return ds.attrs.Xattrs()
+}
+
 // Node serializes the HAMT structure into a merkledag node with unixfs formatting
 func (ds *Shard) Node() (ipld.Node, error) {
 	out := new(dag.ProtoNode)
 	out.SetCidBuilder(ds.builder)
+	var entries []entryAttributes
 
 	sliceIndex := 0
 	// TODO: optimized 'for each set bit'
@@ -196,6 +296,9 @@ func (ds *Shard) Node() (ipld.Node, error) {
 			if err != nil {
 				return nil, err
 			}
+			if ch.isValueNode() && ch.entry != nil {
+				entries = append(entries, entryAttributes{ch.key, ch.entry})
+			}
 		} else {
 			// child unloaded, just copy in link with updated name
 			lnk := ds.childer.link(sliceIndex)
@@ -205,6 +308,9 @@ func (ds *Shard) Node() (ipld.Node, error) {
 			if err != nil {
 				return nil, err
 			}
+			if value, ok := ds.entries[label]; ok {
+				entries = append(entries, entryAttributes{label, value})
+			}
 		}
 		sliceIndex++
 	}
@@ -213,6 +319,21 @@ func (ds *Shard) Node() (ipld.Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	if ds.attrs != nil && hasAttributes(ds.attrs) || len(entries) > 0 {
+		fsn, err := format.FSNodeFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if ds.attrs != nil {
+			fsn.CopyAttributes(ds.attrs)
+		}
+		for _, e := range entries {
+			fsn.SetXattr(EntryXattrPrefix+e.name, e.value)
+		}
+		if data, err = fsn.GetBytes(); err != nil {
+			return nil, err
+		}
+	}
 
 	out.SetData(data)
 
@@ -233,10 +354,57 @@ func (ds *Shard) makeShardValue(lnk *ipld.Link) (*Shard, error) {
 
 	s.key = lnk.Name[ds.maxpadlen:]
 	s.val = &lnk2
+	s.entry = ds.entries[s.key]
 
 	return s, nil
 }
 
+// entryAttributes are the attributes of an entry written to the node of
+// the shard holding its link.
+type entryAttributes struct {
+	name  string
+	value []byte
+}
+
+// SetEntryAttributes records `value` as the attributes of the entry
+// `name`, replacing the previous ones (nil removes them). They are stored
+// in the node of the shard holding the link of the entry, as its extended
+// attribute `EntryXattrPrefix` + `name`, so each shard node only holds the
+// attributes of its own entries, and they move with the link when the
+// trie is reshaped. The attributes are opaque to the shard, they are
+// dropped when the entry is removed or replaced. It returns
+// `os.ErrNotExist` if there is no entry `name`.
+func (ds *Shard) SetEntryAttributes(ctx context.Context, name string, value []byte) error {
+	return ds.getValue(ctx, newHashBits(name), name, func(sv *Shard) error {
+		sv.entry = value
+		return nil
+	})
+}
+
+// EntryAttributes returns the attributes recorded for the entry `name`
+// (see `SetEntryAttributes`), nil if it has none, and `os.ErrNotExist` if
+// there is no entry `name`.
+func (ds *Shard) EntryAttributes(ctx context.Context, name string) ([]byte, error) {
+	var value []byte
+	err := ds.getValue(ctx, newHashBits(name), name, func(sv *Shard) error {
+		value = sv.entry
+		return nil
+	})
+	return value, err
+}
+
+// ForEachEntryAttributes calls `f` with the name and the attributes of
+// every entry that has some (see `SetEntryAttributes`), walking the whole
+// trie.
+func (ds *Shard) ForEachEntryAttributes(ctx context.Context, f func(name string, value []byte) error) error {
+	return ds.walkTrie(ctx, func(sv *Shard) error {
+		if sv.entry == nil {
+			return nil
+		}
+		return f(sv.key, sv.entry)
+	})
+}
+
 // Set sets 'name' = nd in the HAMT
 func (ds *Shard) Set(ctx context.Context, name string, nd ipld.Node) error {
 	_, err := ds.Swap(ctx, name, nd)
@@ -657,6 +825,7 @@ func (ds *Shard) swapValue(ctx context.Context, hv *hashBits, key string, value
 			}
 
 			child.val = value // Overwrite entry.
+			child.entry = nil
 			return oldValue, nil
 		}
 
@@ -680,6 +849,7 @@ func (ds *Shard) swapValue(ctx context.Context, hv *hashBits, key string, value
 		}
 		child.builder = ds.builder
 		chhv := newConsumedHashBits(grandChild.key, hv.consumed)
+		gchv := newConsumedHashBits(grandChild.key, hv.consumed)
 
 		// We explicitly ignore the oldValue returned by the next two insertions
 		// (which will be nil) to highlight there is no overwrite here: they are
@@ -693,6 +863,16 @@ func (ds *Shard) swapValue(ctx context.Context, hv *hashBits, key string, value
 		if err != nil {
 			return nil, err
 		}
+		if grandChild.entry != nil {
+			// The old entry keeps its attributes in its new shard.
+			err = child.getValue(ctx, gchv, grandChild.key, func(sv *Shard) error {
+				sv.entry = grandChild.entry
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
 
 		// Replace this leaf node with the new Shard node.
 		ds.childer.set(child, i)
@@ -738,7 +918,17 @@ func (ds *Shard) swapValue(ctx context.Context, hv *hashBits, key string, value
 				}
 				if lnkType == shardValueLink {
 					// sub-shard with a single value element, collapse it
+					// along with the attributes of its entry.
 					ds.childer.setLink(slnk, i)
+					label := slnk.Name[child.maxpadlen:]
+					if value, ok := child.entries[label]; ok {
+						if ds.entries == nil {
+							ds.entries = make(map[string][]byte)
+						}
+						ds.entries[label] = value
+					} else {
+						delete(ds.entries, label)
+					}
 				}
 				return oldValue, nil
 			}
@@ -228,6 +228,101 @@ func TestShardReload(t *testing.T) {
 	}
 }
 
+func TestEntryAttributes(t *testing.T) {
+	ds := mdtest.Mock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A narrow trie, so it has a few levels.
+	dirs, s, err := makeDirWidth(ds, 300, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dirs {
+		if err := s.SetEntryAttributes(ctx, d, []byte("attrs-"+d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetEntryAttributes(ctx, "missing", []byte("attrs")); err != os.ErrNotExist {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	check := func(s *Shard, removed map[string]bool) {
+		t.Helper()
+		found := 0
+		err := s.ForEachEntryAttributes(ctx, func(name string, value []byte) error {
+			if removed[name] || string(value) != "attrs-"+name {
+				t.Errorf("unexpected attributes %q for %s", value, name)
+			}
+			found++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != len(dirs)-len(removed) {
+			t.Fatalf("expected %d entries with attributes, got %d", len(dirs)-len(removed), found)
+		}
+	}
+
+	nd, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each shard node holds the attributes of its own links only.
+	fsn, err := ft.FSNodeFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := 0
+	for _, l := range nd.Links() {
+		if len(l.Name) > s.maxpadlen {
+			values++
+		}
+	}
+	if n := len(fsn.Xattrs()); n != values || n >= len(dirs) {
+		t.Fatalf("expected the root to hold the attributes of its %d value links, got %d", values, n)
+	}
+
+	s, err = NewHamtFromDag(ds, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(s, nil)
+	value, err := s.EntryAttributes(ctx, dirs[0])
+	if err != nil || string(value) != "attrs-"+dirs[0] {
+		t.Fatalf("unexpected attributes %q (%v)", value, err)
+	}
+
+	// Removals reshape the trie, the remaining entries keep their
+	// attributes.
+	removed := make(map[string]bool)
+	for _, d := range dirs[:250] {
+		if err := s.Remove(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		removed[d] = true
+	}
+	check(s, removed)
+	nd, err = s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewHamtFromDag(ds, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(s, removed)
+
+	// Replaced entries lose them.
+	if err := s.Set(ctx, dirs[299], ft.EmptyDirNode()); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.EntryAttributes(ctx, dirs[299]); err != nil || value != nil {
+		t.Fatalf("expected no attributes, got %q (%v)", value, err)
+	}
+}
+
 func TestRemoveElems(t *testing.T) {
 	ds := mdtest.Mock()
 	dirs, s, err := makeDir(ds, 500)
@@ -493,3 +493,50 @@ func TestNoUserdataWithTokenMetadataRead(t *testing.T) {
 	b := []byte(`{"nodeid":"QmURnhjU6b2Si4rqwfpD4FDGTzJH3hGRAWSQmXtagywwdz","Price":12.4}`)
 	testUserDataWithTokenMetadataRead(t, 0, 2, b, 512)
 }
+
+func TestPreallocateMatchesLayout(t *testing.T) {
+	for _, size := range []uint64{0, 1, 512, 513, 4 * 512, 17*512 + 3, 64 * 512} {
+		for _, raw := range []bool{false, true} {
+			ds := mdtest.Mock()
+			dbp := h.DagBuilderParams{
+				Dagserv:   ds,
+				Maxlinks:  4,
+				RawLeaves: raw,
+			}
+
+			db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(make([]byte, size)), 512))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := Layout(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = dbp.New(chunker.NewSizeSplitter(bytes.NewReader(nil), 512))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nd, err := Preallocate(db, size, 512)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !nd.Cid().Equals(expected.Cid()) {
+				t.Fatalf("size %d (raw leaves %t): expected %s, got %s", size, raw, expected.Cid(), nd.Cid())
+			}
+
+			// Every node must have been added.
+			r, err := uio.NewDagReader(context.Background(), nd, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, make([]byte, size)) {
+				t.Fatalf("size %d: bad read", size)
+			}
+		}
+	}
+}
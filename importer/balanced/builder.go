@@ -184,6 +184,10 @@ func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
 			return nil, err
 		}
 	}
+	root, err = db.SetRootAttributes(root)
+	if err != nil {
+		return nil, err
+	}
 	return root, db.Add(root)
 }
 
@@ -204,6 +208,10 @@ func layout(db *h.DagBuilderHelper, addMetaDag bool) (ipld.Node, error) {
 				return nil, err
 			}
 		}
+		root, err = db.SetRootAttributes(root)
+		if err != nil {
+			return nil, err
+		}
 		return root, db.Add(root)
 	}
 
@@ -245,6 +253,10 @@ func layout(db *h.DagBuilderHelper, addMetaDag bool) (ipld.Node, error) {
 		}
 	}
 
+	root, err = db.SetRootAttributes(root)
+	if err != nil {
+		return nil, err
+	}
 	return root, db.Add(root)
 }
 
@@ -0,0 +1,112 @@
+package balanced
+
+import (
+	"errors"
+
+	ft "github.com/TRON-US/go-unixfs"
+	h "github.com/TRON-US/go-unixfs/importer/helpers"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ErrInvalidBlockSize is returned by `Preallocate` for a block size that
+// is zero or above `helpers.BlockSizeLimit`.
+var ErrInvalidBlockSize = errors.New("invalid preallocation block size")
+
+// Preallocate builds a balanced file DAG holding `size` zero bytes split
+// in `blockSize` leaves, with the same shape `Layout` would produce for that
+// data. It doesn't go through the splitter of `db`: every full leaf and
+// every full sub-DAG of a given depth is identical, so each one is built
+// (and added to the DAGService) only once and then shared, which makes the
+// cost proportional to the depth (times the fan-out) of the DAG instead
+// of the file size.
+func Preallocate(db *h.DagBuilderHelper, size, blockSize uint64) (ipld.Node, error) {
+	if blockSize == 0 || blockSize > uint64(h.BlockSizeLimit) {
+		return nil, ErrInvalidBlockSize
+	}
+	if size == 0 {
+		root, err := db.NewLeafNode(nil, ft.TFile)
+		if err != nil {
+			return nil, err
+		}
+		return root, db.Add(root)
+	}
+
+	leaves := (size + blockSize - 1) / blockSize
+	depth := 0
+	for capacity := uint64(1); capacity < leaves; capacity *= uint64(db.Maxlinks()) {
+		depth++
+	}
+
+	p := &preallocator{
+		db:        db,
+		blockSize: blockSize,
+		full:      make(map[int]ipld.Node),
+	}
+	return p.build(depth, size)
+}
+
+// preallocator keeps the full (shared) sub-DAGs already built per depth.
+type preallocator struct {
+	db        *h.DagBuilderHelper
+	blockSize uint64
+	full      map[int]ipld.Node
+}
+
+// capacity returns the amount of data a full sub-DAG of `depth` holds.
+func (p *preallocator) capacity(depth int) uint64 {
+	c := p.blockSize
+	for i := 0; i < depth; i++ {
+		c *= uint64(p.db.Maxlinks())
+	}
+	return c
+}
+
+// build returns the (already added) sub-DAG of `depth` holding `size`
+// zero bytes.
+func (p *preallocator) build(depth int, size uint64) (ipld.Node, error) {
+	isFull := size == p.capacity(depth)
+	if isFull {
+		if nd, ok := p.full[depth]; ok {
+			return nd, nil
+		}
+	}
+
+	var nd ipld.Node
+	var err error
+	if depth == 0 {
+		nd, err = p.db.NewLeafNode(make([]byte, size), ft.TFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		node := p.db.NewFSNodeOverDag(ft.TFile)
+		childCap := p.capacity(depth - 1)
+		for remaining := size; remaining > 0; {
+			childSize := childCap
+			if remaining < childSize {
+				childSize = remaining
+			}
+			child, err := p.build(depth-1, childSize)
+			if err != nil {
+				return nil, err
+			}
+			if err := node.AddChildDag(child, childSize, p.db); err != nil {
+				return nil, err
+			}
+			remaining -= childSize
+		}
+		nd, err = node.Commit()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.db.Add(nd); err != nil {
+		return nil, err
+	}
+	if isFull {
+		p.full[depth] = nd
+	}
+	return nd, nil
+}
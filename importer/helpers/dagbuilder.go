@@ -7,10 +7,12 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	dag "github.com/ipfs/go-merkledag"
 
 	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/events"
 	pb "github.com/TRON-US/go-unixfs/pb"
 
 	chunker "github.com/TRON-US/go-btfs-chunker"
@@ -18,6 +20,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	pi "github.com/ipfs/go-ipfs-posinfo"
 	ipld "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
 )
 
 var (
@@ -50,6 +53,11 @@ type dagBuilderHelper struct {
 	nextData   []byte // the next item to return.
 	maxlinks   int
 	cidBuilder cid.Builder
+	events     events.Emitter
+	modTime    time.Time
+	mode       os.FileMode
+	xattrs     map[string][]byte
+	checksum   *ft.Checksummer
 
 	metaDb       *MetaDagBuilderHelper
 	metaDagBuilt bool
@@ -110,6 +118,38 @@ type DagBuilderParams struct {
 	// TrickleFormat indicates the client requested trickle tree format
 	TrickleFormat bool
 
+	// Events, if set, receives an `events.OpImport` event for every
+	// leaf added to the DAG.
+	Events events.Emitter
+
+	// ModTime, if not zero, is stored as the modification time of the
+	// root of the file (see `SetRootAttributes`).
+	ModTime time.Time
+
+	// Mode, if not zero, is stored as the mode of the root of the file
+	// (see `ft.FSNode.SetMode`), so exporting the file restores its
+	// permissions.
+	Mode os.FileMode
+
+	// Xattrs are stored as the extended attributes of the root of the
+	// file.
+	Xattrs map[string][]byte
+
+	// InlineLimit, if positive, is the size up to which blocks are
+	// inlined in their CID (with the identity hash function) instead of
+	// being stored on their own (see `ft.DefaultInlineLimit`).
+	InlineLimit int
+
+	// ChecksumType, if not zero, is the multihash function the checksum
+	// of the file data is computed with while it is imported (see
+	// `DagBuilderHelper.Checksum`).
+	ChecksumType uint64
+
+	// Profile, if not zero, is the compatibility profile the DAG must
+	// conform to (see `ft.CompatV1`): `New` fails with a
+	// `*ft.FeatureError` if the other params use features out of it.
+	Profile ft.Features
+
 	// Internal mutex for guaranteeing goroutine safety within multi-dagbuilder case
 	dMutex sync.Mutex
 }
@@ -119,6 +159,9 @@ type DagBuilderParams struct {
 // If chunker.Splitter is a chunker.MultiSplitter, then DagBuilderHelper
 // will contain underlying DagBuilderHelpers.
 func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error) {
+	if err := ft.CheckProfile(dbp.Profile, dbp.Features()); err != nil {
+		return nil, err
+	}
 	db := dagBuilderHelper{
 		dmutex:     &dbp.dMutex,
 		dserv:      dbp.Dagserv,
@@ -126,6 +169,19 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 		rawLeaves:  dbp.RawLeaves,
 		cidBuilder: dbp.CidBuilder,
 		maxlinks:   dbp.Maxlinks,
+		events:     dbp.Events,
+		modTime:    dbp.ModTime,
+		mode:       dbp.Mode,
+		xattrs:     dbp.Xattrs,
+	}
+	if dbp.InlineLimit > 0 {
+		db.cidBuilder = ft.NewInlineBuilder(dbp.CidBuilder, dbp.InlineLimit)
+	}
+	if dbp.ChecksumType != 0 {
+		var err error
+		if db.checksum, err = ft.NewChecksummer(dbp.ChecksumType); err != nil {
+			return nil, err
+		}
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
@@ -155,6 +211,10 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 			if err != nil {
 				return nil, err
 			}
+			// The attributes belong to the root of the whole file only.
+			dbc.modTime = time.Time{}
+			dbc.mode = 0
+			dbc.xattrs = nil
 			dbs = append(dbs, dbc)
 		}
 		return &DagBuilderHelper{dagBuilderHelper: db, dbs: dbs}, nil
@@ -164,6 +224,34 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 	return &DagBuilderHelper{dagBuilderHelper: db}, nil
 }
 
+// SetFileInfo sets the ModTime and Mode params to the attributes of the
+// file `fi` being imported (see `ft.FileInfoAttributes`).
+func (dbp *DagBuilderParams) SetFileInfo(fi os.FileInfo) {
+	dbp.Mode, dbp.ModTime = ft.FileInfoAttributes(fi)
+}
+
+// Features returns the format features the DAG built with these params
+// would use.
+func (dbp *DagBuilderParams) Features() ft.Features {
+	var f ft.Features
+	if dbp.RawLeaves {
+		f |= ft.FeatureRawLeaves
+	}
+	if dbp.InlineLimit > 0 {
+		f |= ft.FeatureInlineBlocks
+	}
+	if !dbp.ModTime.IsZero() || dbp.Mode != 0 {
+		f |= ft.FeatureAttributes
+	}
+	if len(dbp.Xattrs) != 0 {
+		f |= ft.FeatureXattrs
+	}
+	if dbp.TokenMetadata != nil {
+		f |= ft.FeatureTokenMetadata
+	}
+	return f
+}
+
 // IsMultiDagBuilder checks if this helper contains multiple dagbuilders.
 func (db *DagBuilderHelper) IsMultiDagBuilder() bool {
 	return db.dbs != nil
@@ -220,9 +308,24 @@ func (db *DagBuilderHelper) Next() ([]byte, error) {
 	if db.recvdErr != nil {
 		return nil, db.recvdErr
 	}
+	if db.checksum != nil {
+		db.checksum.Write(d)
+	}
 	return d, nil
 }
 
+// Checksum returns the checksum of the data consumed so far (the whole
+// file once the DAG is built), nil unless `DagBuilderParams.ChecksumType`
+// is set. It is meant for the `ft.Metadata` of the file. The helpers
+// contained by a multi-dagbuilder each have the checksum of their own
+// data.
+func (db *DagBuilderHelper) Checksum() mh.Multihash {
+	if db.checksum == nil {
+		return nil
+	}
+	return db.checksum.Sum()
+}
+
 // GetDagServ returns the dagservice object this Helper is using
 func (db *DagBuilderHelper) GetDagServ() ipld.DAGService {
 	return db.dserv
@@ -268,16 +371,14 @@ func (db *DagBuilderHelper) NewLeafNode(data []byte, fsNodeType pb.Data_DataType
 		return rawnode, nil
 	}
 
-	// Encapsulate the data in UnixFS node (instead of a raw node).
-	fsNodeOverDag := db.NewFSNodeOverDag(fsNodeType)
-	fsNodeOverDag.SetFileData(data)
-	node, err := fsNodeOverDag.Commit()
+	// Encapsulate the data in UnixFS node (instead of a raw node), encoded
+	// with a pooled message instead of going through `FSNodeOverDag`.
+	fileData, err := ft.LeafPBData(fsNodeType, data)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: Encapsulate this sequence of calls into a function that
-	// just returns the final `ipld.Node` avoiding going through
-	// `FSNodeOverDag`.
+	node := dag.NodeWithData(fileData)
+	node.SetCidBuilder(db.GetCidBuilder())
 
 	return node, nil
 }
@@ -329,6 +430,12 @@ func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node i
 	// Convert this leaf to a `FilestoreNode` if needed.
 	node = db.ProcessFileStore(node, dataSize)
 
+	events.Emit(db.events, events.Event{
+		Operation: events.OpImport,
+		Cid:       node.Cid(),
+		Bytes:     dataSize,
+	})
+
 	return node, dataSize, nil
 }
 
@@ -373,6 +480,43 @@ func (db *DagBuilderHelper) Add(node ipld.Node) error {
 	return db.dserv.Add(context.TODO(), node)
 }
 
+// SetRootAttributes returns the root of the file `root` with the attributes
+// of the file (the modification time, the mode and the extended attributes)
+// set, or `root` itself if there are none. A root that isn't a `dag.ProtoNode` (a single raw leaf) can't hold
+// them, so it is added to the DAG and wrapped in a new file node.
+func (db *DagBuilderHelper) SetRootAttributes(root ipld.Node) (ipld.Node, error) {
+	if db.modTime.IsZero() && db.mode == 0 && len(db.xattrs) == 0 {
+		return root, nil
+	}
+	pn, ok := root.(*dag.ProtoNode)
+	if !ok {
+		newRoot := db.NewFSNodeOverDag(ft.TFile)
+		if err := newRoot.AddChild(root, uint64(len(root.RawData())), db); err != nil {
+			return nil, err
+		}
+		committed, err := newRoot.Commit()
+		if err != nil {
+			return nil, err
+		}
+		pn = committed.(*dag.ProtoNode)
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	fsn.SetModTime(db.modTime)
+	fsn.SetMode(db.mode)
+	for name, value := range db.xattrs {
+		fsn.SetXattr(name, value)
+	}
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	pn.SetData(data)
+	return pn, nil
+}
+
 // Maxlinks returns the configured maximum number for links
 // for nodes built with this helper.
 func (db *DagBuilderHelper) Maxlinks() int {
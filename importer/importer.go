@@ -3,14 +3,26 @@
 package importer
 
 import (
+	"bytes"
+	"errors"
+
+	ft "github.com/TRON-US/go-unixfs"
 	bal "github.com/TRON-US/go-unixfs/importer/balanced"
 	h "github.com/TRON-US/go-unixfs/importer/helpers"
 	trickle "github.com/TRON-US/go-unixfs/importer/trickle"
 
 	chunker "github.com/TRON-US/go-btfs-chunker"
 	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
 )
 
+// ErrWrappedTokenMetadata is returned by `BuildWrappedFile` for params with
+// token metadata, whose DAGs can't be wrapped.
+var ErrWrappedTokenMetadata = errors.New("files with token metadata can't be wrapped in a metadata node")
+
+// ErrNotLeaf is returned by `SplitLeaf` for nodes with children.
+var ErrNotLeaf = errors.New("node isn't a file leaf")
+
 // BuildDagFromReader creates a DAG given a DAGService and a Splitter
 // implementation (Splitters are io.Readers), using a Balanced layout.
 func BuildDagFromReader(ds ipld.DAGService, spl chunker.Splitter) (ipld.Node, error) {
@@ -45,3 +57,118 @@ func BuildTrickleDagFromReader(ds ipld.DAGService, spl chunker.Splitter) (ipld.N
 	}
 	return trickle.Layout(db)
 }
+
+// BuildWrappedFile builds the DAG of the file read from `spl` with the
+// params `dbp` (in a trickle layout if `dbp.TrickleFormat` is set) and its
+// `TMetadata` root wrapping it with the metadata `md` (may be nil), adding
+// both to `dbp.Dagserv`. The size of the metadata is the one of the file
+// and, if `dbp.ChecksumType` is set, its checksum is the one computed while
+// importing. The attributes of `dbp` (ModTime, Mode and Xattrs) are set on
+// both the file and the wrapper, so they are read from either root.
+func BuildWrappedFile(dbp *h.DagBuilderParams, spl chunker.Splitter, md *ft.Metadata) (*dag.ProtoNode, error) {
+	if dbp.TokenMetadata != nil {
+		return nil, ErrWrappedTokenMetadata
+	}
+	db, err := dbp.New(spl)
+	if err != nil {
+		return nil, err
+	}
+	var file ipld.Node
+	if dbp.TrickleFormat {
+		file, err = trickle.Layout(db)
+	} else {
+		file, err = bal.Layout(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m ft.Metadata
+	if md != nil {
+		m = *md
+	}
+	if sum := db.Checksum(); sum != nil {
+		m.Checksum = sum
+	}
+	wrapper, err := ft.WrapMetadata(file, &m)
+	if err != nil {
+		return nil, err
+	}
+	root, err := db.SetRootAttributes(wrapper)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Add(root); err != nil {
+		return nil, err
+	}
+	return root.(*dag.ProtoNode), nil
+}
+
+// SplitLeaf splits the file leaf `nd` (a raw leaf or a `TFile` or `TRaw`
+// node without children) whose data exceeds `dbp.ChunkSize` (the default
+// block size of the chunker if zero) into chunks of that size, laid out
+// with the params `dbp` like an imported file and added to `dbp.Dagserv`,
+// e.g., to normalize nodes built by hand or converted from other formats.
+// The root of the new DAG keeps the attributes of the leaf unless `dbp`
+// has its own. A leaf within the size is returned as is.
+func SplitLeaf(dbp *h.DagBuilderParams, nd ipld.Node) (ipld.Node, error) {
+	var data []byte
+	var leaf *ft.FSNode
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromNode(nd)
+		if err != nil {
+			return nil, err
+		}
+		if typ := fsn.Type(); typ != ft.TFile && typ != ft.TRaw || len(nd.Links()) != 0 {
+			return nil, ErrNotLeaf
+		}
+		data, leaf = fsn.Data(), fsn
+	default:
+		if !ft.IsRawLeaf(nd) {
+			return nil, ft.ErrUnrecognizedType
+		}
+		data = nd.RawData()
+	}
+	size := int64(dbp.ChunkSize)
+	if size == 0 {
+		size = chunker.DefaultBlockSize
+	}
+	if int64(len(data)) <= size {
+		return nd, nil
+	}
+
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), size))
+	if err != nil {
+		return nil, err
+	}
+	var root ipld.Node
+	if dbp.TrickleFormat {
+		root, err = trickle.Layout(db)
+	} else {
+		root, err = bal.Layout(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if leaf == nil || !dbp.ModTime.IsZero() || dbp.Mode != 0 || len(dbp.Xattrs) != 0 {
+		return root, nil
+	}
+
+	// Several chunks, so the root is an internal node.
+	pn := root.(*dag.ProtoNode)
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	fsn.CopyAttributes(leaf)
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	pn.SetData(b)
+	if err := db.Add(pn); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
@@ -3,35 +3,42 @@ package importer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"os"
 	"testing"
+	"time"
 
+	ft "github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/events"
+	bal "github.com/TRON-US/go-unixfs/importer/balanced"
+	h "github.com/TRON-US/go-unixfs/importer/helpers"
+	"github.com/TRON-US/go-unixfs/importer/trickle"
 	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
 
 	chunker "github.com/TRON-US/go-btfs-chunker"
 	cid "github.com/ipfs/go-cid"
 	u "github.com/ipfs/go-ipfs-util"
 	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
 	mdtest "github.com/ipfs/go-merkledag/test"
+	mh "github.com/multiformats/go-multihash"
 )
 
+// Benchmark trees are generated from a fixed seed so results can be
+// compared across versions.
+const benchSeed = 0xdeadbeef
+
 func getBalancedDag(t testing.TB, size int64, blksize int64) (ipld.Node, ipld.DAGService) {
 	ds := mdtest.Mock()
-	r := io.LimitReader(u.NewTimeSeededRand(), size)
-	nd, err := BuildDagFromReader(ds, chunker.NewSizeSplitter(r, blksize))
-	if err != nil {
-		t.Fatal(err)
-	}
+	_, nd := testu.GenerateFile(t, ds, testu.FileShape{Size: size, LeafSize: blksize, Seed: benchSeed})
 	return nd, ds
 }
 
 func getTrickleDag(t testing.TB, size int64, blksize int64) (ipld.Node, ipld.DAGService) {
 	ds := mdtest.Mock()
-	r := io.LimitReader(u.NewTimeSeededRand(), size)
-	nd, err := BuildTrickleDagFromReader(ds, chunker.NewSizeSplitter(r, blksize))
-	if err != nil {
-		t.Fatal(err)
-	}
+	_, nd := testu.GenerateFile(t, ds, testu.FileShape{Size: size, LeafSize: blksize, Seed: benchSeed, Trickle: true})
 	return nd, ds
 }
 
@@ -69,6 +76,47 @@ func TestStableCid(t *testing.T) {
 	}
 }
 
+func TestGeneratedDags(t *testing.T) {
+	shape := testu.FileShape{Depth: 2, LeafSize: 100, Fanout: 3, Seed: 42}
+	data, nd := testu.GenerateFile(t, mdtest.Mock(), shape)
+	if len(data) != 900 {
+		t.Fatalf("expected a full tree of 900 bytes, got %d", len(data))
+	}
+	ds := mdtest.Mock()
+	data2, nd2 := testu.GenerateFile(t, ds, shape)
+	if !nd.Cid().Equals(nd2.Cid()) || !bytes.Equal(data, data2) {
+		t.Fatal("generated files differ")
+	}
+	if len(nd2.Links()) != 3 {
+		t.Fatalf("expected 3 links, got %d", len(nd2.Links()))
+	}
+	dr, err := uio.NewDagReader(context.Background(), nd2, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("bad read")
+	}
+
+	dirShape := testu.DirShape{Depth: 2, Fanout: 2, Files: 3, File: testu.FileShape{Size: 1000, LeafSize: 256}}
+	root, files := testu.GenerateDirectory(t, mdtest.Mock(), dirShape)
+	root2, _ := testu.GenerateDirectory(t, mdtest.Mock(), dirShape)
+	if !root.Cid().Equals(root2.Cid()) {
+		t.Fatal("generated directories differ")
+	}
+	// 1 + 2 + 4 directories of 3 files.
+	if len(files) != 21 {
+		t.Fatalf("expected 21 files, got %d", len(files))
+	}
+	if bytes.Equal(files["file-0"], files["dir-1/dir-0/file-2"]) {
+		t.Fatal("files should have different content")
+	}
+}
+
 func TestBalancedDag(t *testing.T) {
 	ds := mdtest.Mock()
 	buf := make([]byte, 10000)
@@ -95,6 +143,383 @@ func TestBalancedDag(t *testing.T) {
 	}
 }
 
+func TestImportEvents(t *testing.T) {
+	ds := mdtest.Mock()
+	buf := make([]byte, 10000)
+	u.NewTimeSeededRand().Read(buf)
+
+	evCh := make(chan events.Event, 100)
+	dbp := h.DagBuilderParams{
+		Dagserv:  ds,
+		Maxlinks: h.DefaultLinksPerBlock,
+		Events:   events.ChanEmitter(evCh),
+	}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(buf), 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bal.Layout(db); err != nil {
+		t.Fatal(err)
+	}
+	close(evCh)
+
+	var total uint64
+	var count int
+	for e := range evCh {
+		if e.Operation != events.OpImport || !e.Cid.Defined() {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		total += e.Bytes
+		count++
+	}
+	if count != 10 || total != uint64(len(buf)) {
+		t.Fatalf("expected 10 events totalling %d bytes, got %d events totalling %d", len(buf), count, total)
+	}
+}
+
+func TestImportAttributes(t *testing.T) {
+	mtime := time.Unix(1600000000, 42)
+	mode := os.FileMode(0755)
+	for _, tc := range []struct {
+		name      string
+		size      int
+		rawLeaves bool
+		trickle   bool
+	}{
+		{"balanced", 10000, false, false},
+		{"trickle", 10000, false, true},
+		{"single-raw-leaf", 500, true, false},
+		{"empty-raw", 0, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := mdtest.Mock()
+			buf := make([]byte, tc.size)
+			u.NewTimeSeededRand().Read(buf)
+			dbp := h.DagBuilderParams{
+				Dagserv:   ds,
+				Maxlinks:  h.DefaultLinksPerBlock,
+				RawLeaves: tc.rawLeaves,
+				ModTime:   mtime,
+				Mode:      mode,
+				Xattrs:    map[string][]byte{"user.origin": []byte("test")},
+			}
+			db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(buf), 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var nd ipld.Node
+			if tc.trickle {
+				nd, err = trickle.Layout(db)
+			} else {
+				nd, err = bal.Layout(db)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fsn, err := ft.ExtractFSNode(nd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !fsn.ModTime().Equal(mtime) {
+				t.Fatalf("expected %v, got %v", mtime, fsn.ModTime())
+			}
+			if fsn.Mode() != mode {
+				t.Fatalf("expected %v, got %v", mode, fsn.Mode())
+			}
+			if value, ok := fsn.Xattr("user.origin"); !ok || string(value) != "test" {
+				t.Fatalf("expected the extended attribute, got %q", value)
+			}
+			r, err := uio.NewDagReader(context.Background(), nd, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, buf) {
+				t.Fatal("read the wrong data")
+			}
+		})
+	}
+}
+
+func TestImportProfile(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	spl := func(buf []byte) chunker.Splitter {
+		return chunker.NewSizeSplitter(bytes.NewReader(buf), 100)
+	}
+
+	dbp := h.DagBuilderParams{
+		Dagserv:  ds,
+		Maxlinks: h.DefaultLinksPerBlock,
+		Mode:     0644,
+		Profile:  ft.CompatV1,
+	}
+	_, err := dbp.New(spl(nil))
+	if fe, ok := err.(*ft.FeatureError); !ok || fe.Features != ft.FeatureAttributes {
+		t.Fatalf("expected the attributes out of the profile, got %v", err)
+	}
+
+	// The last leaf is small enough to be inlined.
+	buf := make([]byte, 1020)
+	u.NewTimeSeededRand().Read(buf)
+	dbp = h.DagBuilderParams{
+		Dagserv:     ds,
+		Maxlinks:    h.DefaultLinksPerBlock,
+		RawLeaves:   true,
+		InlineLimit: 32,
+		Profile:     ft.CompatV1,
+	}
+	db, err := dbp.New(spl(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := bal.Layout(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid().Prefix().MhType == mh.IDENTITY {
+		t.Fatal("expected the root not to be inlined")
+	}
+	features, err := ft.DagFeatures(ctx, nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if features != ft.FeatureRawLeaves|ft.FeatureInlineBlocks {
+		t.Fatalf("expected raw leaves and inline blocks, got %s", features)
+	}
+	r, err := uio.NewDagReader(ctx, nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Fatal("read the wrong data")
+	}
+}
+
+func TestImportChecksum(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	buf := make([]byte, 10000)
+	u.NewTimeSeededRand().Read(buf)
+
+	// The checksum holds however the file is chunked.
+	var roots []ipld.Node
+	for _, chunkSize := range []int64{1000, 4096} {
+		dbp := h.DagBuilderParams{
+			Dagserv:      ds,
+			Maxlinks:     h.DefaultLinksPerBlock,
+			ChecksumType: ft.DefaultChecksumType,
+		}
+		db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(buf), chunkSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := bal.Layout(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := ft.FileChecksum(bytes.NewReader(buf), ft.DefaultChecksumType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(db.Checksum(), expected) {
+			t.Fatalf("expected %s, got %s", expected.B58String(), db.Checksum().B58String())
+		}
+		root, err := ft.WrapMetadata(nd, &ft.Metadata{Checksum: db.Checksum()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	if roots[0].Cid().Equals(roots[1].Cid()) {
+		t.Fatal("expected different DAGs")
+	}
+	for _, root := range roots {
+		if err := uio.VerifyChecksum(ctx, root, ds); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The checksum of another file.
+	other, err := ft.FileChecksum(bytes.NewReader(buf[1:]), ft.DefaultChecksumType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := ft.WrapMetadata(roots[0], &ft.Metadata{Checksum: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce *ft.ChecksumError
+	if err := uio.VerifyChecksum(ctx, wrong, ds); !errors.As(err, &ce) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	noChecksum, err := ft.WrapMetadata(roots[0], &ft.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uio.VerifyChecksum(ctx, noChecksum, ds); err != ft.ErrNoChecksum {
+		t.Fatalf("expected %v, got %v", ft.ErrNoChecksum, err)
+	}
+}
+
+func TestBuildWrappedFile(t *testing.T) {
+	ctx := context.Background()
+	mtime := time.Unix(1600000000, 0)
+	mode := os.FileMode(0640)
+	for _, tc := range []struct {
+		name      string
+		size      int
+		rawLeaves bool
+		trickle   bool
+	}{
+		{"balanced", 10000, false, false},
+		{"trickle", 10000, false, true},
+		{"single-raw-leaf", 500, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := mdtest.Mock()
+			buf := make([]byte, tc.size)
+			u.NewTimeSeededRand().Read(buf)
+			dbp := &h.DagBuilderParams{
+				Dagserv:       ds,
+				Maxlinks:      h.DefaultLinksPerBlock,
+				RawLeaves:     tc.rawLeaves,
+				TrickleFormat: tc.trickle,
+				ModTime:       mtime,
+				Mode:          mode,
+				ChecksumType:  ft.DefaultChecksumType,
+			}
+			root, err := BuildWrappedFile(dbp, chunker.NewSizeSplitter(bytes.NewReader(buf), 1000), &ft.Metadata{MimeType: "application/octet-stream", Size: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ds.Get(ctx, root.Cid()); err != nil {
+				t.Fatalf("expected the root to be stored: %v", err)
+			}
+
+			file, md, err := ft.UnwrapMetadata(ctx, root, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md == nil || md.MimeType != "application/octet-stream" || md.Size != uint64(tc.size) {
+				t.Fatalf("unexpected metadata %+v", md)
+			}
+			for _, nd := range []ipld.Node{root, file} {
+				fsn, err := ft.ExtractFSNode(nd)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !fsn.ModTime().Equal(mtime) || fsn.Mode() != mode {
+					t.Fatalf("expected the attributes on %s, got %v and %v", nd.Cid(), fsn.ModTime(), fsn.Mode())
+				}
+			}
+			if err := uio.VerifyChecksum(ctx, root, ds); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := uio.NewDagReader(ctx, root, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, buf) {
+				t.Fatal("read the wrong data")
+			}
+		})
+	}
+
+	dbp := &h.DagBuilderParams{Dagserv: mdtest.Mock(), Maxlinks: h.DefaultLinksPerBlock, TokenMetadata: []byte("{}")}
+	if _, err := BuildWrappedFile(dbp, chunker.NewSizeSplitter(bytes.NewReader(nil), 1000), nil); err != ErrWrappedTokenMetadata {
+		t.Fatalf("expected %v, got %v", ErrWrappedTokenMetadata, err)
+	}
+}
+
+func TestSplitLeaf(t *testing.T) {
+	ctx := context.Background()
+	mtime := time.Unix(1600000000, 0)
+	buf := make([]byte, 10000)
+	u.NewTimeSeededRand().Read(buf)
+
+	fsn := ft.NewFSNode(ft.TFile)
+	fsn.SetData(buf)
+	fsn.SetModTime(mtime)
+	b, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		leaf    ipld.Node
+		trickle bool
+	}{
+		{"balanced", dag.NodeWithData(b), false},
+		{"trickle", dag.NodeWithData(b), true},
+		{"raw", dag.NewRawNode(buf), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := mdtest.Mock()
+			dbp := &h.DagBuilderParams{
+				Dagserv:       ds,
+				Maxlinks:      4,
+				RawLeaves:     true,
+				TrickleFormat: tc.trickle,
+				ChunkSize:     1000,
+			}
+			root, err := SplitLeaf(dbp, tc.leaf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(root.Links()) == 0 {
+				t.Fatal("expected the leaf to be split")
+			}
+			if findings, err := ft.Validate(ctx, root, ds); err != nil || len(findings) != 0 {
+				t.Fatalf("expected a consistent DAG, got %v (%v)", findings, err)
+			}
+			if _, ok := tc.leaf.(*dag.ProtoNode); ok {
+				fsn, err := ft.ExtractFSNode(root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !fsn.ModTime().Equal(mtime) {
+					t.Fatalf("expected the attributes of the leaf, got %v", fsn.ModTime())
+				}
+			}
+
+			r, err := uio.NewDagReader(ctx, root, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, buf) {
+				t.Fatal("read the wrong data")
+			}
+		})
+	}
+
+	dbp := &h.DagBuilderParams{Dagserv: mdtest.Mock(), Maxlinks: h.DefaultLinksPerBlock}
+	small := dag.NewRawNode([]byte("small"))
+	if root, err := SplitLeaf(dbp, small); err != nil || root != small {
+		t.Fatalf("expected a small leaf to be kept, got %v (%v)", root, err)
+	}
+	if _, err := SplitLeaf(dbp, ft.EmptyDirNode()); err != ErrNotLeaf {
+		t.Fatalf("expected %v, got %v", ErrNotLeaf, err)
+	}
+}
+
 func BenchmarkBalancedReadSmallBlock(b *testing.B) {
 	b.StopTimer()
 	nbytes := int64(10000000)
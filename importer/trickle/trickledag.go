@@ -56,6 +56,10 @@ func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
 			return nil, err
 		}
 	}
+	root, err = db.SetRootAttributes(root)
+	if err != nil {
+		return nil, err
+	}
 	return root, db.Add(root)
 }
 
@@ -0,0 +1,152 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// DefaultInlineLimit is the usual size up to which blocks are worth
+// inlining in their CID (see `NewInlineBuilder`): about the size of the
+// hash they replace, so the links of the parents don't grow much.
+const DefaultInlineLimit = 32
+
+// ErrNotInline is returned by `InlineNode` for CIDs hashing their block
+// instead of inlining it.
+var ErrNotInline = errors.New("cid doesn't inline its block")
+
+// IsInline returns whether the block of `c` is inlined in it (with the
+// identity hash function), so it can be decoded without fetching it.
+func IsInline(c cid.Cid) bool {
+	return c.Defined() && c.Prefix().MhType == mh.IDENTITY
+}
+
+// inlineBuilder is a `cid.Builder` inlining the blocks up to `limit` bytes
+// in their CID, and building the CIDs of the others with `base`.
+type inlineBuilder struct {
+	base  cid.Builder
+	limit int
+}
+
+// NewInlineBuilder returns a `cid.Builder` inlining the blocks up to
+// `limit` bytes in their CID (a CIDv1 with the identity hash function),
+// and building the CIDs of the larger ones with `base`, the CIDv0 prefix
+// of the importers if nil.
+func NewInlineBuilder(base cid.Builder, limit int) cid.Builder {
+	if base == nil {
+		base = dag.V0CidPrefix()
+	}
+	return inlineBuilder{base: base, limit: limit}
+}
+
+func (b inlineBuilder) Sum(data []byte) (cid.Cid, error) {
+	if len(data) <= b.limit {
+		return cid.V1Builder{Codec: b.base.GetCodec(), MhType: mh.IDENTITY}.Sum(data)
+	}
+	return b.base.Sum(data)
+}
+
+func (b inlineBuilder) GetCodec() uint64 {
+	return b.base.GetCodec()
+}
+
+func (b inlineBuilder) WithCodec(c uint64) cid.Builder {
+	return inlineBuilder{base: b.base.WithCodec(c), limit: b.limit}
+}
+
+// NewInlineLeaf returns a raw leaf holding `data` inlined in its CID,
+// whatever its size: callers decide what is small enough.
+func NewInlineLeaf(data []byte) (*dag.RawNode, error) {
+	return dag.NewRawNodeWPrefix(data, cid.V1Builder{Codec: cid.Raw, MhType: mh.IDENTITY})
+}
+
+// InlineProtoNode returns a copy of `nd` with its block inlined in its
+// CID, e.g., for a small file of a single protobuf leaf or directory.
+func InlineProtoNode(nd *dag.ProtoNode) *dag.ProtoNode {
+	inlined := nd.Copy().(*dag.ProtoNode)
+	inlined.SetCidBuilder(cid.V1Builder{Codec: cid.DagProtobuf, MhType: mh.IDENTITY})
+	return inlined
+}
+
+// InlineNode decodes the node whose block is inlined in `c`, of the
+// protobuf (unixfs) or raw codec. It returns `ErrNotInline` if `c`
+// doesn't inline its block.
+func InlineNode(c cid.Cid) (ipld.Node, error) {
+	if !IsInline(c) {
+		return nil, ErrNotInline
+	}
+	decoded, err := mh.Decode(c.Hash())
+	if err != nil {
+		return nil, err
+	}
+	b, err := blocks.NewBlockWithCid(decoded.Digest, c)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Type() {
+	case cid.DagProtobuf:
+		return dag.DecodeProtobufBlock(b)
+	case cid.Raw:
+		return dag.DecodeRawBlock(b)
+	default:
+		return nil, fmt.Errorf("unixfs: inline block of unsupported codec %d: %w", c.Type(), ErrUnrecognizedType)
+	}
+}
+
+// inlineGetter decodes the inline nodes itself, fetching only the others
+// from the wrapped getter.
+type inlineGetter struct {
+	ipld.NodeGetter
+}
+
+var _ ipld.NodeGetter = inlineGetter{}
+
+// InlineGetter wraps `ng` so the nodes inlined in their CID are decoded
+// from it instead of being fetched, they don't need to be stored.
+func InlineGetter(ng ipld.NodeGetter) ipld.NodeGetter {
+	if _, ok := ng.(inlineGetter); ok {
+		return ng
+	}
+	return inlineGetter{NodeGetter: ng}
+}
+
+// Get implements the `ipld.NodeGetter` interface.
+func (g inlineGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if IsInline(c) {
+		return InlineNode(c)
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+// GetMany implements the `ipld.NodeGetter` interface.
+func (g inlineGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	// Buffered for all the nodes, so sending never blocks.
+	out := make(chan *ipld.NodeOption, len(keys))
+	var fetch []cid.Cid
+	for _, c := range keys {
+		if !IsInline(c) {
+			fetch = append(fetch, c)
+			continue
+		}
+		nd, err := InlineNode(c)
+		out <- &ipld.NodeOption{Node: nd, Err: err}
+	}
+	if len(fetch) == 0 {
+		close(out)
+		return out
+	}
+	results := g.NodeGetter.GetMany(ctx, fetch)
+	go func() {
+		defer close(out)
+		for opt := range results {
+			out <- opt
+		}
+	}()
+	return out
+}
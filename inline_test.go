@@ -0,0 +1,66 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestInline(t *testing.T) {
+	ctx := context.Background()
+
+	leaf, err := NewInlineLeaf([]byte("tiny"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := dag.NodeWithData(FilePBData(nil, 4))
+	if err := file.AddNodeLink("", leaf); err != nil {
+		t.Fatal(err)
+	}
+	inlined := InlineProtoNode(file)
+	if !IsInline(leaf.Cid()) || !IsInline(inlined.Cid()) || IsInline(file.Cid()) {
+		t.Fatal("expected the leaf and the copy of the file to be inlined")
+	}
+	if !bytes.Equal(inlined.RawData(), file.RawData()) {
+		t.Fatal("expected the same block")
+	}
+
+	for _, nd := range []ipld.Node{leaf, inlined} {
+		decoded, err := InlineNode(nd.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Cid().Equals(nd.Cid()) || !bytes.Equal(decoded.RawData(), nd.RawData()) {
+			t.Fatalf("decoded %s as %s", nd.Cid(), decoded.Cid())
+		}
+	}
+	if _, err := InlineNode(file.Cid()); err != ErrNotInline {
+		t.Fatalf("expected %v, got %v", ErrNotInline, err)
+	}
+
+	// Nothing stored, only the inline nodes can be got.
+	ng := InlineGetter(mdtest.Mock())
+	nd, err := ng.Get(ctx, inlined.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := NodeType(nd); err != nil || typ != TFile {
+		t.Fatalf("expected a file, got %s (%v)", typ, err)
+	}
+	promises := ipld.GetNodes(ctx, ng, []cid.Cid{nd.Links()[0].Cid, file.Cid()})
+	if child, err := promises[0].Get(ctx); err != nil || !bytes.Equal(child.RawData(), []byte("tiny")) {
+		t.Fatalf("expected the inline leaf, got %v", err)
+	}
+	if _, err := promises[1].Get(ctx); err == nil {
+		t.Fatal("expected the stored node to be missing")
+	}
+	if _, err := ng.Get(ctx, file.Cid()); !errors.Is(err, ipld.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ipld.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,146 @@
+package io
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// BlockCache is a least recently used cache of the nodes fetched by the
+// readers attached to it (see `DagReaderOptions.Cache`), so repeated reads
+// of hot files (small images, manifests) are served from memory instead of
+// the DAGService. It is safe to share between readers of different
+// goroutines.
+type BlockCache struct {
+	lk       sync.Mutex
+	maxBytes int
+	bytes    int
+	// Most recently used first, of `*cacheEntry`.
+	lru   *list.List
+	nodes map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	node ipld.Node
+	size int
+}
+
+// NewBlockCache returns a cache holding up to `maxBytes` bytes of blocks
+// (blocks larger than that aren't cached).
+func NewBlockCache(maxBytes int) *BlockCache {
+	return &BlockCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		nodes:    make(map[string]*list.Element),
+	}
+}
+
+// Len returns the number of blocks in the cache.
+func (bc *BlockCache) Len() int {
+	bc.lk.Lock()
+	defer bc.lk.Unlock()
+	return bc.lru.Len()
+}
+
+// Bytes returns the total size of the blocks in the cache.
+func (bc *BlockCache) Bytes() int {
+	bc.lk.Lock()
+	defer bc.lk.Unlock()
+	return bc.bytes
+}
+
+func (bc *BlockCache) get(c cid.Cid) (ipld.Node, bool) {
+	bc.lk.Lock()
+	defer bc.lk.Unlock()
+	e, ok := bc.nodes[c.KeyString()]
+	if !ok {
+		return nil, false
+	}
+	bc.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).node, true
+}
+
+func (bc *BlockCache) add(nd ipld.Node) {
+	// Nodes are shared by the readers, encode them (if needed) and compute
+	// their CID before, so only reads happen concurrently.
+	size := len(nd.RawData())
+	key := nd.Cid().KeyString()
+	if size > bc.maxBytes {
+		return
+	}
+
+	bc.lk.Lock()
+	defer bc.lk.Unlock()
+	if e, ok := bc.nodes[key]; ok {
+		bc.lru.MoveToFront(e)
+		return
+	}
+	bc.nodes[key] = bc.lru.PushFront(&cacheEntry{key: key, node: nd, size: size})
+	bc.bytes += size
+	for bc.bytes > bc.maxBytes {
+		e := bc.lru.Back()
+		entry := e.Value.(*cacheEntry)
+		bc.lru.Remove(e)
+		delete(bc.nodes, entry.key)
+		bc.bytes -= entry.size
+	}
+}
+
+// cachedGetter is a node getter going through a `BlockCache`.
+type cachedGetter struct {
+	ipld.NodeGetter
+	cache *BlockCache
+	stats *readerStats
+}
+
+var _ ipld.NodeGetter = (*cachedGetter)(nil)
+
+// Get implements the `ipld.NodeGetter` interface.
+func (cg *cachedGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if nd, ok := cg.cache.get(c); ok {
+		atomic.AddUint64(&cg.stats.cacheHits, 1)
+		return nd, nil
+	}
+	nd, err := cg.NodeGetter.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	cg.cache.add(nd)
+	return nd, nil
+}
+
+// GetMany implements the `ipld.NodeGetter` interface, only the nodes
+// missing from the cache are requested.
+func (cg *cachedGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	// Buffered for all the nodes, so sending never blocks.
+	out := make(chan *ipld.NodeOption, len(keys))
+	var missing []cid.Cid
+	for _, c := range keys {
+		if nd, ok := cg.cache.get(c); ok {
+			atomic.AddUint64(&cg.stats.cacheHits, 1)
+			out <- &ipld.NodeOption{Node: nd}
+		} else {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) == 0 {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		for opt := range cg.NodeGetter.GetMany(ctx, missing) {
+			if opt.Err == nil {
+				cg.cache.add(opt.Node)
+			}
+			out <- opt
+		}
+	}()
+	return out
+}
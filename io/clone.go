@@ -0,0 +1,80 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ErrCloneNotSupported is returned when cloning a reader not implemented
+// by this package.
+var ErrCloneNotSupported = errors.New("reader can't be cloned")
+
+// CloneDagReader returns a new reader of the file of `r` at `offset`, for
+// instance to download segments of the same file in parallel. The clone
+// has its own position and context (derived from the one `r` was created
+// with, closing either reader doesn't close the other) but shares the
+// internal nodes fetched so far (and the ones fetched later) with `r` and
+// its other clones, so seeking to a segment only fetches the nodes none of
+// them visited yet. Clones keep the options of `r`, its `Progress`
+// function may then be called concurrently. No block is fetched until the
+// clone is read.
+func CloneDagReader(r DagReader, offset int64) (DagReader, error) {
+	switch r := r.(type) {
+	case *dagReader:
+		return r.clone(offset)
+	case *sectionReader:
+		dr, err := r.dr.clone(r.base + offset)
+		if err != nil {
+			return nil, err
+		}
+		dr.ahead.limit = r.dr.ahead.limit
+		return &sectionReader{dr: dr, base: r.base, size: r.size, pos: offset}, nil
+	case *FileContent:
+		dr, err := CloneDagReader(r.DagReader, offset)
+		if err != nil {
+			return nil, err
+		}
+		return &FileContent{DagReader: dr, modTime: r.modTime}, nil
+	case *File:
+		fc, err := CloneDagReader(r.FileContent, offset)
+		if err != nil {
+			return nil, err
+		}
+		return &File{FileContent: fc.(*FileContent), info: r.info}, nil
+	default:
+		return nil, ErrCloneNotSupported
+	}
+}
+
+func (dr *dagReader) clone(offset int64) (*dagReader, error) {
+	ctx, cancel := context.WithCancel(dr.parent)
+	ahead := &readAhead{
+		ctx:         ctx,
+		prefetch:    dr.ahead.prefetch,
+		maxPrefetch: dr.ahead.maxPrefetch,
+		onProgress:  dr.ahead.onProgress,
+		verify:      dr.ahead.verify,
+	}
+	index := dr.index
+	clone := &dagReader{
+		parent:    dr.parent,
+		stats:     dr.stats,
+		metadata:  dr.metadata,
+		ctx:       ctx,
+		cancel:    cancel,
+		serv:      dr.serv,
+		size:      dr.size,
+		rootNode:  dr.rootNode,
+		ahead:     ahead,
+		index:     index,
+		dagWalker: ipld.NewWalker(ctx, newNavigableNode(dr.rootNode, 0, dr.serv, ahead, index)),
+	}
+	if _, err := clone.Seek(offset, io.SeekStart); err != nil {
+		cancel()
+		return nil, err
+	}
+	return clone, nil
+}
@@ -0,0 +1,38 @@
+package io
+
+import (
+	"context"
+	"math"
+	"time"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// FileContent adapts a unixfs file to `http.ServeContent`, which handles
+// the range and conditional requests from the size and modification time
+// of the content. Seeking (e.g., to the end to find the size, or to the
+// start of a range) never fetches blocks, only reading at the new
+// position does (set the Content-Type header beforehand to avoid reading
+// the start of the file to detect it).
+type FileContent struct {
+	DagReader
+	modTime time.Time
+}
+
+// NewFileContent returns the content of the file `n`. Unixfs nodes don't
+// record a modification time, `modTime` is the one to serve (e.g., from a
+// `sidecar`), the zero time if unknown (then `http.ServeContent` doesn't
+// set the Last-Modified header nor handle If-Modified-Since).
+func NewFileContent(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, modTime time.Time) (*FileContent, error) {
+	// A section reader of the whole file, for its lazy seeking.
+	dr, err := NewDagReaderSection(ctx, n, serv, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	return &FileContent{DagReader: dr, modTime: modTime}, nil
+}
+
+// ModTime returns the modification time of the file.
+func (fc *FileContent) ModTime() time.Time {
+	return fc.modTime
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sync/atomic"
+	"time"
 
 	"github.com/TRON-US/go-unixfs"
+	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	mdag "github.com/ipfs/go-merkledag"
 )
@@ -26,12 +29,45 @@ var (
 // A DagReader provides read-only read and seek acess to a unixfs file.
 // Different implementations of readers are used for the different
 // types of unixfs/protobuf-encoded nodes.
+//
+// Unlike most `io.Reader`s, `Read` (like `CtxReadFull`) fills the whole
+// buffer unless the end of the file is reached or an error occurs, large
+// buffers are the most efficient way to read a file in bulk.
 type DagReader interface {
 	ReadSeekCloser
 	Size() uint64
 	CtxReadFull(context.Context, []byte) (int, error)
 }
 
+// The readers of this package also implement `io.ReaderAt` (reading at an
+// offset without using or moving the reader position, safe to call
+// concurrently along with the other methods) and the optional interfaces
+// below, other implementations of `DagReader` may not, check them with a
+// type assertion.
+
+// An OffsetReader returns its current read position in the file.
+type OffsetReader interface {
+	Offset() int64
+}
+
+// A Peeker returns the next `n` bytes without moving the read position
+// (fewer along with `io.EOF` at the end of the file), e.g., for content
+// sniffers handing the reader over to another consumer.
+type Peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// A PositionSaver returns with `Save` an opaque token of the read
+// position, which `Restore` moves a reader of the same file back to
+// (e.g., after a restart, to resume an interrupted download), fetching
+// the internal nodes down to it in a single batch instead of walking down
+// from the root. `Restore` fails with `ErrInvalidPosition` for tokens of
+// another file.
+type PositionSaver interface {
+	Save() ([]byte, error)
+	Restore(token []byte) error
+}
+
 // A ReadSeekCloser implements interfaces to read, copy, seek and close.
 type ReadSeekCloser interface {
 	io.Reader
@@ -40,9 +76,124 @@ type ReadSeekCloser interface {
 	io.WriterTo
 }
 
+// DagReaderOptions configure the readers created by
+// `NewDagReaderWithOptions`.
+type DagReaderOptions struct {
+	// Prefetch is the number of blocks requested (concurrently, in a
+	// single batch) ahead of the read position, so sequential reads over a
+	// high-latency DAGService don't wait for a round-trip per block. A
+	// request is issued again once half of them are consumed. If zero, 10
+	// blocks are prefetched (as `ipld.NavigableIPLDNode` does).
+	Prefetch int
+	// MaxPrefetch, if above Prefetch, makes the number of blocks
+	// prefetched adapt to the access pattern: it doubles (up to
+	// MaxPrefetch) with every read continuing the previous one, so large
+	// sequential copies keep the DAGService busy, and falls back to a
+	// single block with the first read after a seek, so random reads
+	// don't fetch blocks they won't read.
+	MaxPrefetch int
+	// Progress, if set, is called every time data is delivered by `Read`,
+	// `CtxReadFull` or `WriteTo` (`ReadAt` doesn't report progress) and
+	// every time the reader gets a fetched block, from the goroutine
+	// reading.
+	Progress func(ReadProgress)
+	// Verify makes the reader check that the data of every node matches
+	// the size declared by its parent (and its own file size), returning
+	// a `*CorruptionError` with the offending node otherwise.
+	Verify bool
+	// Cache, if set, is the block cache the reader fetches the nodes
+	// through, it is usually shared by many readers. The root node is
+	// given, so it isn't cached (unless fetched by `OpenDagReader`).
+	Cache *BlockCache
+	// Scheduler, if set, is the fetch scheduler the reader requests the
+	// blocks missing from the cache through, shared by the readers of a
+	// DAGService to fetch blocks for them in turn.
+	Scheduler *FetchScheduler
+	// BlockTimeout, if set, is how long the reader waits for a block
+	// before giving up on its request (and retrying it, see `Retries`),
+	// so an unavailable block doesn't hang the stream until the context
+	// of the read is done. A `*FetchError` is returned once the attempts
+	// are exhausted.
+	BlockTimeout time.Duration
+	// Retries is the number of times a failed (or timed out) block request
+	// is retried, waiting RetryBackoff before the first retry and twice as
+	// long before every following one.
+	Retries      int
+	RetryBackoff time.Duration
+	// TypedErrors makes the reader fail on the nodes that aren't files with
+	// a `*NodeTypeError` carrying their type (a `*SymlinkError` carrying
+	// the target for symlinks), which matches the sentinel error of the
+	// type with `errors.Is`, instead of the sentinel error itself
+	// (`ErrIsDir`, `ErrCantReadSymlinks` or `unixfs.ErrUnrecognizedType`).
+	TypedErrors bool
+
+	// Counters of the reader, set along with the getter wrapping `serv`.
+	stats *readerStats
+	// Metadata of the root, if it wraps the file (see `FileMetadata`).
+	metadata *unixfs.Metadata
+}
+
+// ReadProgress are the running totals of a reader reported to
+// `DagReaderOptions.Progress`.
+type ReadProgress struct {
+	// Delivered is the number of bytes of file data delivered.
+	Delivered uint64
+	// Blocks is the number of blocks fetched and BlockBytes their total
+	// (encoded) size, including the internal nodes.
+	Blocks     uint64
+	BlockBytes uint64
+}
+
 // NewDagReader creates a new reader object that reads the data represented by
-// the given node, using the passed in DAGService for data retrieval.
+// the given node, using the passed in DAGService for data retrieval. If the
+// node is a `TMetadata` node, the reader reads the file it wraps (see
+// `FileMetadata`).
 func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (DagReader, error) {
+	return NewDagReaderWithOptions(ctx, n, serv, DagReaderOptions{})
+}
+
+// OpenDagReader fetches the root `c` (with the fetch policy and the cache
+// of the options) and returns a reader of the unixfs file it is the root
+// of. It fails with a `FetchError` if the root can't be fetched and with
+// the errors of `NewDagReader` (e.g., `ErrIsDir`, or a `NodeTypeError`
+// with `TypedErrors`) if it isn't a file.
+func OpenDagReader(ctx context.Context, c cid.Cid, serv ipld.NodeGetter, opts DagReaderOptions) (DagReader, error) {
+	serv = opts.wrap(serv)
+	nd, err := serv.Get(ctx, c)
+	if err != nil {
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) && ctx.Err() == nil {
+			err = &FetchError{Cid: c, Attempts: 1, Err: err}
+		}
+		return nil, err
+	}
+	return NewDagReaderWithOptions(ctx, nd, serv, opts)
+}
+
+// wrap returns `serv` wrapped in the getters implementing the options and
+// counting the stats of the reader, only the first time (e.g., not again
+// for a metadata root).
+func (opts *DagReaderOptions) wrap(serv ipld.NodeGetter) ipld.NodeGetter {
+	if opts.stats != nil {
+		return serv
+	}
+	opts.stats = new(readerStats)
+	if opts.BlockTimeout > 0 || opts.Retries > 0 {
+		serv = &retryGetter{NodeGetter: serv, timeout: opts.BlockTimeout, retries: opts.Retries, backoff: opts.RetryBackoff, stats: opts.stats}
+	}
+	if opts.Scheduler != nil {
+		serv = newScheduledGetter(serv, opts.Scheduler)
+	}
+	if opts.Cache != nil {
+		serv = &cachedGetter{NodeGetter: serv, cache: opts.Cache, stats: opts.stats}
+	}
+	// The inline nodes are decoded from their CID, not fetched nor counted.
+	return unixfs.InlineGetter(&statsGetter{NodeGetter: serv, stats: opts.stats})
+}
+
+// NewDagReaderWithOptions is like `NewDagReader` with the given options.
+func NewDagReaderWithOptions(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, opts DagReaderOptions) (DagReader, error) {
+	serv = opts.wrap(serv)
 	var size uint64
 
 	switch n := n.(type) {
@@ -58,43 +209,90 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (DagRe
 		switch fsNode.Type() {
 		case unixfs.TFile, unixfs.TRaw, unixfs.TTokenMeta:
 			size = fsNode.FileSize()
+			if len(n.Links()) == 0 {
+				// Some importers don't set the size of leaves.
+				size = uint64(len(fsNode.Data()))
+			}
 
 		case unixfs.TDirectory, unixfs.THAMTShard:
 			// Dont allow reading directories
+			if opts.TypedErrors {
+				return nil, &NodeTypeError{Type: fsNode.Type()}
+			}
 			return nil, ErrIsDir
 
 		case unixfs.TMetadata:
 			if len(n.Links()) == 0 {
 				return nil, errors.New("incorrectly formatted metadata object")
 			}
+			// Read the wrapped file, keeping the outermost metadata.
+			if opts.metadata == nil {
+				md, err := unixfs.MetadataFromBytes(n.Data())
+				if err != nil {
+					return nil, err
+				}
+				opts.metadata = md
+			}
 			child, err := n.Links()[0].GetNode(ctx, serv)
 			if err != nil {
 				return nil, err
 			}
 
-			childpb, ok := child.(*mdag.ProtoNode)
-			if !ok {
+			switch child.(type) {
+			case *mdag.ProtoNode, *mdag.RawNode:
+				return NewDagReaderWithOptions(ctx, child, serv, opts)
+			default:
 				return nil, mdag.ErrNotProtobuf
 			}
-			return NewDagReader(ctx, childpb, serv)
 		case unixfs.TSymlink:
+			if opts.TypedErrors {
+				return nil, &SymlinkError{Target: string(fsNode.Data())}
+			}
 			return nil, ErrCantReadSymlinks
 		default:
+			if opts.TypedErrors {
+				return nil, &NodeTypeError{Type: fsNode.Type()}
+			}
 			return nil, unixfs.ErrUnrecognizedType
 		}
 	default:
-		return nil, ErrUnkownNodeType
+		if !unixfs.IsRawLeaf(n) {
+			return nil, ErrUnkownNodeType
+		}
+		// A single raw leaf decoded by another implementation.
+		size = uint64(len(n.RawData()))
+	}
+
+	if opts.Verify {
+		// The file size of leaves isn't checked (some importers don't set
+		// it), `dataSize` checks the one of internal nodes.
+		if _, err := dataSize(n); err != nil {
+			return nil, err
+		}
 	}
 
 	ctxWithCancel, cancel := context.WithCancel(ctx)
 
+	ahead := &readAhead{ctx: ctxWithCancel, prefetch: opts.Prefetch, onProgress: opts.Progress, verify: opts.Verify}
+	if ahead.prefetch <= 0 {
+		ahead.prefetch = minPreload
+	}
+	if opts.MaxPrefetch > ahead.prefetch {
+		ahead.maxPrefetch = opts.MaxPrefetch
+	}
+	index := newOffsetIndex()
 	return &dagReader{
+		parent:    ctx,
+		stats:     opts.stats,
+		metadata:  opts.metadata,
 		ctx:       ctxWithCancel,
 		cancel:    cancel,
 		serv:      serv,
 		size:      size,
 		rootNode:  n,
-		dagWalker: ipld.NewWalker(ctxWithCancel, ipld.NewNavigableIPLDNode(n, serv)),
+		ahead:     ahead,
+		index:     index,
+		dagWalker: ipld.NewWalker(ctxWithCancel, newNavigableNode(n, 0, serv, ahead, index)),
 	}, nil
 }
 
@@ -111,12 +309,18 @@ type dagReader struct {
 	// (or read after seek) the node's data is fully extracted in a single
 	// `readNodeDataBuffer` operation.
 	currentNodeData *bytes.Reader
+	// Reused by `currentNodeData` for every node.
+	nodeData bytes.Reader
 
 	// Implements the `Size()` API.
 	size uint64
 
 	// Current offset for the read head within the DAG file.
 	offset int64
+	// Set when the `dagWalker` isn't at `offset` yet, it is only moved
+	// there (fetching the nodes down to it) by the next read after a
+	// `Seek`.
+	seekPending bool
 
 	// Root node of the DAG, stored to re-create the `dagWalker` (effectively
 	// re-setting the position of the reader, used during `Seek`).
@@ -127,17 +331,44 @@ type dagReader struct {
 	// see `ipld.NavigableIPLDNode.FetchChild` for details).
 	ctx    context.Context
 	cancel func()
+	// Context the reader was created with, for its clones.
+	parent   context.Context
+	stats    *readerStats
+	metadata *unixfs.Metadata
+	// Set once the state of the reader is released after being closed.
+	released bool
 
 	// Passed to the `dagWalker` that will use it to request nodes.
 	// TODO: Revisit name.
 	serv ipld.NodeGetter
+
+	// Shared with the nodes of the `dagWalker` to size their fetch
+	// batches after the data wanted by the read in progress.
+	ahead *readAhead
+
+	// Internal nodes visited so far, kept across the walkers created by
+	// `resetPosition` so seeks don't fetch them again.
+	index *offsetIndex
 }
 
+var (
+	_ DagReader     = (*dagReader)(nil)
+	_ io.ReaderAt   = (*dagReader)(nil)
+	_ OffsetReader  = (*dagReader)(nil)
+	_ Peeker        = (*dagReader)(nil)
+	_ PositionSaver = (*dagReader)(nil)
+)
+
 // Size returns the total size of the data from the DAG structured file.
 func (dr *dagReader) Size() uint64 {
 	return dr.size
 }
 
+// Offset returns the current read position in the file.
+func (dr *dagReader) Offset() int64 {
+	return dr.offset
+}
+
 // Read implements the `io.Reader` interface through the `CtxReadFull`
 // method using the DAG reader's internal context.
 func (dr *dagReader) Read(b []byte) (int, error) {
@@ -145,13 +376,26 @@ func (dr *dagReader) Read(b []byte) (int, error) {
 }
 
 // CtxReadFull reads data from the DAG structured file. It always
-// attempts a full read of the DAG until the `out` buffer is full.
-// It uses the `Walker` structure to iterate the file DAG and read
-// every node's data into the `out` buffer.
+// attempts a full read of the DAG until the `out` buffer is full, so a
+// single call with a large buffer fills it from as many leaves as needed
+// in one traversal: the children covering the buffer are requested in
+// batches (see `navigableNode`) and the data of the leaves that fit is
+// copied straight into `out`. It only returns less than `len(out)` bytes
+// at the end of the file (with `io.EOF`) or on error.
 func (dr *dagReader) CtxReadFull(ctx context.Context, out []byte) (n int, err error) {
+	if err := dr.checkClosed(); err != nil {
+		return 0, err
+	}
+	dr.ahead.access()
 	// Set the `dagWalker`'s context to the `ctx` argument, it will be used
 	// to fetch the child node promises (see
 	// `ipld.NavigableIPLDNode.FetchChild` for details).
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := dr.finishSeek(ctx); err != nil {
+		return 0, err
+	}
 	dr.dagWalker.SetContext(ctx)
 
 	// If there was a partially read buffer from the last visited
@@ -166,30 +410,43 @@ func (dr *dagReader) CtxReadFull(ctx context.Context, out []byte) (n int, err er
 		}
 	}
 
+	dr.ahead.want = uint64(len(out) - n)
+	defer func() { dr.ahead.want = 0 }()
+
 	// Iterate the DAG calling the passed `Visitor` function on every node
 	// to read its data into the `out` buffer, stop if there is an error or
 	// if the entire DAG is traversed (`EndOfDag`).
 	err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
-		node := ipld.ExtractIPLDNode(visitedNode)
+		node := extractNode(visitedNode)
 
 		// Skip internal nodes, they shouldn't have any file data
 		// (see the `balanced` package for more details).
 		if len(node.Links()) > 0 {
 			return nil
 		}
+		// Preloaded children may be available without waiting, stop
+		// before copying any more data once the read is canceled.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		err = dr.saveNodeData(node)
+		data, err := leafData(node)
 		if err != nil {
 			return err
 		}
-		// Save the leaf node file data in a buffer in case it is only
-		// partially read now and future `CtxReadFull` calls reclaim the
-		// rest (as each node is visited only once during `Iterate`).
-		//
-		// TODO: We could check if the entire node's data can fit in the
-		// remaining `out` buffer free space to skip this intermediary step.
-
-		n += dr.readNodeDataBuffer(out[n:])
+		if len(data) <= len(out)-n {
+			// The whole node fits, skip the intermediate buffer.
+			copy(out[n:], data)
+			n += len(data)
+			dr.advance(len(data))
+		} else {
+			// Save the rest of the leaf node file data in a buffer for
+			// future `CtxReadFull` calls to reclaim it (as each node is
+			// visited only once during `Iterate`).
+			dr.currentNodeData = dr.reuseNodeData(data)
+			n += dr.readNodeDataBuffer(out[n:])
+		}
+		dr.ahead.want = uint64(len(out) - n)
 
 		if n == len(out) {
 			// Output buffer full, no need to keep traversing the DAG,
@@ -211,18 +468,55 @@ func (dr *dagReader) CtxReadFull(ctx context.Context, out []byte) (n int, err er
 	return n, nil
 }
 
+// CtxReadFull reads exactly `len(buf)` bytes from `r` into `buf` like
+// `io.ReadFull`, but giving up as soon as `ctx` is done (e.g., when the
+// HTTP request being served is canceled). Readers with a `CtxReadFull`
+// method of their own (like every `DagReader`) are read with it, so the
+// fetch of the blocks in progress is canceled too, other readers are only
+// checked between calls to `Read`.
+func CtxReadFull(ctx context.Context, r io.Reader, buf []byte) (n int, err error) {
+	if cr, ok := r.(interface {
+		CtxReadFull(context.Context, []byte) (int, error)
+	}); ok {
+		n, err = cr.CtxReadFull(ctx, buf)
+	} else {
+		for n < len(buf) && err == nil {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			var read int
+			read, err = r.Read(buf[n:])
+			n += read
+		}
+	}
+	switch {
+	case n == len(buf):
+		err = nil
+	case err == io.EOF && n > 0:
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
 // Save the UnixFS `node`'s data into the internal `currentNodeData` buffer to
 // later move it to the output buffer (`Read`) or seek into it (`Seek`).
 func (dr *dagReader) saveNodeData(node ipld.Node) error {
-	extractedNodeData, err := unixfs.ReadUnixFSNodeData(node)
+	extractedNodeData, err := leafData(node)
 	if err != nil {
 		return err
 	}
 
-	dr.currentNodeData = bytes.NewReader(extractedNodeData)
+	dr.currentNodeData = dr.reuseNodeData(extractedNodeData)
 	return nil
 }
 
+// reuseNodeData resets the reader reused for the `currentNodeData` of
+// every node to read `data`.
+func (dr *dagReader) reuseNodeData(data []byte) *bytes.Reader {
+	dr.nodeData.Reset(data)
+	return &dr.nodeData
+}
+
 // Read the `currentNodeData` buffer into `out`. This function can't have
 // any errors as it's always reading from a `bytes.Reader` and asking only
 // the available data in it.
@@ -240,13 +534,23 @@ func (dr *dagReader) readNodeDataBuffer(out []byte) int {
 		// single node's data, not the entire DAG.
 	}
 
-	dr.offset += int64(n)
+	dr.advance(n)
 	// TODO: Should `offset` be incremented here or in the calling function?
 	// (Doing it here saves LoC but may be confusing as it's more hidden).
 
 	return n
 }
 
+// advance moves the offset after `n` bytes were delivered to the caller,
+// reporting the progress.
+func (dr *dagReader) advance(n int) {
+	dr.offset += int64(n)
+	if n > 0 {
+		dr.ahead.delivered(uint64(n))
+		atomic.AddUint64(&dr.stats.delivered, uint64(n))
+	}
+}
+
 // Similar to `readNodeDataBuffer` but it writes the contents to
 // an `io.Writer` argument.
 //
@@ -266,7 +570,7 @@ func (dr *dagReader) writeNodeDataBuffer(w io.Writer) (int64, error) {
 		// single node's data, not the entire DAG.
 	}
 
-	dr.offset += int64(n)
+	dr.advance(int(n))
 	return n, nil
 }
 
@@ -275,11 +579,20 @@ func (dr *dagReader) writeNodeDataBuffer(w io.Writer) (int64, error) {
 // where it starts from the internal index that may have
 // been modified by other `Read` calls.
 //
-// TODO: This implementation is very similar to `CtxReadFull`,
-// the common parts should be abstracted away.
+// The data of every leaf is written straight to `w` (without the
+// intermediate buffer of `Read`) and, as the whole rest of the file is
+// wanted, the children are requested in batches as large as the nodes
+// allow (see `navigableNode`), this is the path to stream whole files.
 func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 	// Use the internal reader's context to fetch the child node promises
 	// (see `ipld.NavigableIPLDNode.FetchChild` for details).
+	if err := dr.checkClosed(); err != nil {
+		return 0, err
+	}
+	dr.ahead.access()
+	if err := dr.finishSeek(dr.ctx); err != nil {
+		return 0, err
+	}
 	dr.dagWalker.SetContext(dr.ctx)
 
 	// If there was a partially read buffer from the last visited
@@ -291,32 +604,46 @@ func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 		}
 	}
 
+	if uint64(dr.offset) < dr.size {
+		dr.ahead.want = dr.size - uint64(dr.offset)
+	}
+	defer func() { dr.ahead.want = 0 }()
+
 	// Iterate the DAG calling the passed `Visitor` function on every node
-	// to read its data into the `out` buffer, stop if there is an error or
-	// if the entire DAG is traversed (`EndOfDag`).
+	// to write its data to `w`, stop if there is an error or if the entire
+	// DAG is traversed (`EndOfDag`).
 	err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
-		node := ipld.ExtractIPLDNode(visitedNode)
+		node := extractNode(visitedNode)
 
 		// Skip internal nodes, they shouldn't have any file data
 		// (see the `balanced` package for more details).
 		if len(node.Links()) > 0 {
 			return nil
 		}
+		if err := dr.ctx.Err(); err != nil {
+			return err
+		}
 
-		err = dr.saveNodeData(node)
+		data, err := leafData(node)
 		if err != nil {
 			return err
 		}
-		// Save the leaf node file data in a buffer in case it is only
-		// partially read now and future `CtxReadFull` calls reclaim the
-		// rest (as each node is visited only once during `Iterate`).
-
-		written, err := dr.writeNodeDataBuffer(w)
-		n += written
+		written, err := w.Write(data)
+		n += int64(written)
+		dr.advance(written)
+		if err == nil && written < len(data) {
+			err = io.ErrShortWrite
+		}
 		if err != nil {
+			// Save the rest of the leaf node file data for future
+			// calls to reclaim it (as each node is visited only once
+			// during `Iterate`).
+			dr.currentNodeData = dr.reuseNodeData(data[written:])
 			return err
 		}
-
+		if uint64(dr.offset) < dr.size {
+			dr.ahead.want = dr.size - uint64(dr.offset)
+		}
 		return nil
 	})
 
@@ -327,18 +654,202 @@ func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 	return n, err
 }
 
-// Close the reader (cancelling fetch node operations requested with
-// the internal context, that is, `Read` calls but not `CtxReadFull`
-// with user-supplied contexts).
+// readFileAt reads `p` at `off` in the file of `r` with its `ReadAt` if it
+// implements `io.ReaderAt`. Otherwise it seeks to `off` and back to the
+// read position afterwards, which isn't safe to do concurrently.
+func readFileAt(r DagReader, p []byte, off int64) (int, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra.ReadAt(p, off)
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if _, serr := r.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+// ReadAt implements the `io.ReaderAt` interface. Instead of the walker it
+// uses its own traversal of the DAG from the root, guided by the block
+// sizes, so concurrent calls (e.g., from several HTTP range requests) don't
+// serialize on the reader position.
+func (dr *dagReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+	if uint64(off) >= dr.size {
+		return 0, io.EOF
+	}
+	want := p
+	if uint64(off)+uint64(len(p)) > dr.size {
+		want = p[:dr.size-uint64(off)]
+	}
+
+	n, err := readAt(dr.ctx, dr.serv, dr.rootNode, want, uint64(off), dr.ahead.verify)
+	atomic.AddUint64(&dr.stats.delivered, uint64(n))
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Peek implements the `Peeker` interface, taking the data from what is
+// left of the current leaf first and reading the rest like `ReadAt`.
+func (dr *dagReader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("invalid count")
+	}
+	if err := dr.checkClosed(); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	k, err := dr.peek(buf, dr.offset)
+	return buf[:k], err
+}
+
+// peek reads the data at `off` into `p` like `ReadAt` (without counting
+// it as delivered), starting with the current leaf if `off` is the reader
+// position.
+func (dr *dagReader) peek(p []byte, off int64) (int, error) {
+	if off < 0 || uint64(off) >= dr.size {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	want := p
+	if uint64(off)+uint64(len(p)) > dr.size {
+		want = p[:dr.size-uint64(off)]
+	}
+
+	var n int
+	if off == dr.offset && dr.currentNodeData != nil && !dr.seekPending {
+		pos := dr.currentNodeData.Size() - int64(dr.currentNodeData.Len())
+		n, _ = dr.currentNodeData.ReadAt(want, pos)
+	}
+	if n < len(want) {
+		k, err := readAt(dr.ctx, dr.serv, dr.rootNode, want[n:], uint64(off)+uint64(n), dr.ahead.verify)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readAt reads the data of the file DAG under `node` at `off` into `p`,
+// which must fit in it, fetching the children `p` spans in one batch (and
+// verifying them if `verify` is set).
+func readAt(ctx context.Context, serv ipld.NodeGetter, node ipld.Node, p []byte, off uint64, verify bool) (int, error) {
+	if len(node.Links()) == 0 {
+		data, err := leafData(node)
+		if err != nil {
+			return 0, err
+		}
+		if off >= uint64(len(data)) {
+			return 0, nil
+		}
+		return copy(p, data[off:]), nil
+	}
+
+	fsNode, err := unixfs.ExtractFSNode(node)
+	if err != nil {
+		return 0, err
+	}
+	if fsNode.NumChildren() != len(node.Links()) {
+		return 0, ErrSeekNotSupported
+	}
+
+	// Find the children covering [off, off+len(p)).
+	first, firstOff, ok := fsNode.ChildAt(off)
+	if !ok {
+		return 0, nil
+	}
+	end := off + uint64(len(p))
+	var cids []cid.Cid
+	var starts, sizes []uint64
+	cur := off - firstOff
+	for i := first; i < fsNode.NumChildren() && cur < end; i++ {
+		bs := fsNode.BlockSize(i)
+		cids = append(cids, node.Links()[i].Cid)
+		starts = append(starts, cur)
+		sizes = append(sizes, bs)
+		cur += bs
+	}
+
+	var n int
+	for i, promise := range ipld.GetNodes(ctx, serv, cids) {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		child, err := promise.Get(ctx)
+		if err != nil {
+			return n, err
+		}
+		if verify {
+			if err := verifyNode(child, sizes[i]); err != nil {
+				return n, err
+			}
+		}
+		var childOff uint64
+		if starts[i] < off {
+			childOff = off - starts[i]
+		}
+		read, err := readAt(ctx, serv, child, p[n:], childOff, verify)
+		n += read
+		if err != nil {
+			return n, err
+		}
+		if n == len(p) {
+			break
+		}
+	}
+	return n, nil
+}
+
+// Close the reader, cancelling its internal context: the requests of
+// nodes in flight (every read makes them with it, see `readAhead`) are
+// aborted, reads in progress (in other goroutines) return and the
+// following ones fail. The buffered data and the walker are released by
+// the next read, `Close` doesn't touch them to be safe to call along with
+// a read.
 func (dr *dagReader) Close() error {
 	dr.cancel()
 	return nil
 }
 
+// checkClosed returns the error of the internal context once the reader is
+// closed (or its parent context is done), releasing its state.
+func (dr *dagReader) checkClosed() error {
+	err := dr.ctx.Err()
+	if err != nil && !dr.released {
+		dr.released = true
+		dr.currentNodeData = nil
+		dr.nodeData.Reset(nil)
+		// Other clones may still use the index.
+		dr.index = newOffsetIndex()
+		dr.dagWalker = ipld.NewWalker(dr.ctx, newNavigableNode(dr.rootNode, 0, dr.serv, dr.ahead, dr.index))
+	}
+	return err
+}
+
 // Seek implements `io.Seeker` seeking to a given offset in the DAG file,
-// it matches the standard unix `seek`. It moves the position of the internal
-// `dagWalker` and may also leave a `currentNodeData` buffer loaded in case
-// the seek is performed to the middle of the data in a node.
+// it matches the standard unix `seek`. Seeking inside the data left of the
+// current leaf just moves in its `currentNodeData` buffer, otherwise the
+// internal `dagWalker` is moved to the new offset by the next read (see
+// `walkTo`), fetching only the nodes on the path down to it.
 //
 // TODO: Support seeking from the current position (relative seek)
 // through the `dagWalker` in `io.SeekCurrent`.
@@ -354,135 +865,193 @@ func (dr *dagReader) Seek(offset int64, whence int) (int64, error) {
 			// Already at the requested `offset`, nothing to do.
 		}
 
-		left := offset
-		// Amount left to seek.
+		// Not sequential anymore (see `DagReaderOptions.MaxPrefetch`).
+		dr.ahead.seeked = true
+
+		// Within the data left of the current leaf, move in its buffer.
+		if dr.currentNodeData != nil && !dr.seekPending {
+			pos := dr.currentNodeData.Size() - int64(dr.currentNodeData.Len()) + offset - dr.offset
+			if pos >= 0 && pos < dr.currentNodeData.Size() {
+				dr.currentNodeData.Seek(pos, io.SeekStart)
+				dr.offset = offset
+				return offset, nil
+			}
+		}
+
+		// Check the root now, the nodes below it (if missing size hints)
+		// fail the next read.
+		if offset > 0 && !hasSizeHints(dr.rootNode) {
+			return dr.offset, ErrSeekNotSupported
+		}
 
-		// Seek from the beginning of the DAG.
-		dr.resetPosition()
+		// Don't fetch anything until the data at `offset` is read, the
+		// reader may be moved again before (e.g., to the end to find its
+		// size, like `http.ServeContent` does) and only the path down to
+		// the leaf at `offset` is needed, not the leaves on the way.
+		dr.currentNodeData = nil
+		dr.offset = offset
+		dr.seekPending = true
+		return offset, nil
 
-		// Shortcut seeking to the beginning, we're already there.
+	case io.SeekCurrent:
 		if offset == 0 {
-			return 0, nil
+			return dr.offset, nil
 		}
 
-		// Use the internal reader's context to fetch the child node promises
-		// (see `ipld.NavigableIPLDNode.FetchChild` for details).
-		dr.dagWalker.SetContext(dr.ctx)
-		// TODO: Performance: we could adjust here `preloadSize` of
-		// `ipld.NavigableIPLDNode` also, when seeking we only want
-		// to fetch one child at a time.
-
-		// Seek the DAG by calling the provided `Visitor` function on every
-		// node the `dagWalker` descends to while searching which can be
-		// either an internal or leaf node. In the internal node case, check
-		// the child node sizes and set the corresponding child index to go
-		// down to next. In the leaf case (last visit of the search), if there
-		// is still an amount `left` to seek do it inside the node's data
-		// saved in the `currentNodeData` buffer, leaving it ready for a `Read`
-		// call.
-		err := dr.dagWalker.Seek(func(visitedNode ipld.NavigableNode) error {
-			node := ipld.ExtractIPLDNode(visitedNode)
-
-			if len(node.Links()) > 0 {
-				// Internal node, should be a `mdag.ProtoNode` containing a
-				// `unixfs.FSNode` (see the `balanced` package for more details).
-				fsNode, err := unixfs.ExtractFSNode(node)
-				if err != nil {
-					return err
-				}
+		pos, err := unixfs.AddOffset(uint64(dr.offset), offset)
+		if err != nil {
+			return dr.offset, err
+		}
+		return dr.seekTo(pos)
+		// TODO: Performance. This can be improved supporting relative
+		// searches in the `Walker` (see `Walker.Seek`).
 
-				// If there aren't enough size hints don't seek
-				// (see the `io.EOF` handling error comment below).
-				if fsNode.NumChildren() != len(node.Links()) {
-					return ErrSeekNotSupported
-				}
+	case io.SeekEnd:
+		pos, err := unixfs.AddOffset(dr.Size(), offset)
+		if err != nil {
+			return dr.offset, err
+		}
+		return dr.seekTo(pos)
 
-				// Internal nodes have no data, so just iterate through the
-				// sizes of its children (advancing the child index of the
-				// `dagWalker`) to find where we need to go down to next in
-				// the search.
-				for {
-					childSize := fsNode.BlockSize(int(dr.dagWalker.ActiveChildIndex()))
-
-					if childSize > uint64(left) {
-						// This child's data contains the position requested
-						// in `offset`, go down this child.
-						return nil
-					}
-
-					// Else, skip this child.
-					left -= int64(childSize)
-					err := dr.dagWalker.NextChild()
-					if err == ipld.ErrNextNoChild {
-						// No more child nodes available, nothing to do,
-						// the `Seek` will stop on its own.
-						return nil
-					} else if err != nil {
-						return err
-						// Pass along any other errors (that may in future
-						// implementations be returned by `Next`) to stop
-						// the search.
-					}
-				}
+	default:
+		return 0, errors.New("invalid whence")
+	}
+}
 
-			} else {
-				// Leaf node, seek inside its data.
-				err := dr.saveNodeData(node)
-				if err != nil {
+// seekTo seeks to the position `pos`, checking it fits in an offset.
+func (dr *dagReader) seekTo(pos uint64) (int64, error) {
+	offset, err := unixfs.SizeToOffset(pos)
+	if err != nil {
+		return dr.offset, err
+	}
+	return dr.Seek(offset, io.SeekStart)
+}
+
+// finishSeek moves the `dagWalker` to the offset of the last `Seek` if it
+// isn't there yet.
+func (dr *dagReader) finishSeek(ctx context.Context) error {
+	if !dr.seekPending {
+		return nil
+	}
+	if err := dr.walkTo(ctx, dr.offset); err != nil {
+		return err
+	}
+	dr.seekPending = false
+	return nil
+}
+
+// walkTo moves the `dagWalker` to `offset` from the root of the DAG,
+// descending to the child containing it at every level (from the size
+// hints) and leaving the data of the leaf from `offset` in the
+// `currentNodeData` buffer.
+func (dr *dagReader) walkTo(ctx context.Context, offset int64) error {
+	left := offset
+	// Amount left to seek.
+
+	// Seek from the beginning of the DAG.
+	dr.resetPosition()
+	defer func() { dr.offset = offset }()
+
+	// Shortcut seeking to the beginning, we're already there.
+	if offset == 0 {
+		return nil
+	}
+
+	dr.dagWalker.SetContext(ctx)
+	// Only fetch the path down to `offset`: the siblings of its nodes
+	// may never be read, and in trickle DAGs the ones following a
+	// node are mostly the roots of (ever deeper) subtrees. The
+	// reading from the new position requests its own batches.
+	dr.ahead.seeking = true
+	defer func() { dr.ahead.seeking = false }()
+
+	// Seek the DAG by calling the provided `Visitor` function on every
+	// node the `dagWalker` descends to while searching which can be
+	// either an internal or leaf node. In the internal node case, check
+	// the child node sizes and set the corresponding child index to go
+	// down to next. In the leaf case (last visit of the search), if there
+	// is still an amount `left` to seek do it inside the node's data
+	// saved in the `currentNodeData` buffer, leaving it ready for a `Read`
+	// call.
+	err := dr.dagWalker.Seek(func(visitedNode ipld.NavigableNode) error {
+		node := extractNode(visitedNode)
+
+		if len(node.Links()) > 0 {
+			// Internal node, should be a `mdag.ProtoNode` containing a
+			// `unixfs.FSNode` (see the `balanced` package for more details)
+			// with the sizes of its children (decoded and indexed by
+			// `newNavigableNode`).
+			nn := visitedNode.(*navigableNode)
+			if nn.sizes == nil {
+				if _, err := unixfs.ExtractFSNode(node); err != nil {
 					return err
 				}
+				// If there aren't enough size hints don't seek
+				// (see the `io.EOF` handling error comment below).
+				return ErrSeekNotSupported
+			}
 
-				_, err = dr.currentNodeData.Seek(left, io.SeekStart)
-				if err != nil {
+			// Internal nodes have no data, so just find the child
+			// containing the position requested in `offset` from the
+			// offsets of the children, and advance the child index of
+			// the `dagWalker` up to it to go down this child next in
+			// the search.
+			child, childOffset := nn.childAt(uint64(left))
+			for dr.dagWalker.ActiveChildIndex() < uint(child) {
+				if err := dr.dagWalker.NextChild(); err != nil {
 					return err
 				}
-				// The corner case of a DAG consisting only of a single (leaf)
-				// node should make no difference here. In that case, where the
-				// node doesn't have a parent UnixFS node with size hints, this
-				// implementation would allow this `Seek` to be called with an
-				// argument larger than the buffer size which normally wouldn't
-				// happen (because we would skip the node based on the size
-				// hint) but that would just mean that a future `CtxReadFull`
-				// call would read no data from the `currentNodeData` buffer.
-				// TODO: Re-check this reasoning.
-
-				return nil
-				// In the leaf node case the search will stop here.
 			}
-		})
+			left = int64(childOffset)
+			return nil
 
-		if err != nil {
-			return 0, err
-		}
+		} else {
+			// Leaf node, seek inside its data.
+			err := dr.saveNodeData(node)
+			if err != nil {
+				return err
+			}
 
-		dr.offset = offset
-		return dr.offset, nil
+			_, err = dr.currentNodeData.Seek(left, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			// The corner case of a DAG consisting only of a single (leaf)
+			// node should make no difference here. In that case, where the
+			// node doesn't have a parent UnixFS node with size hints, this
+			// implementation would allow this `Seek` to be called with an
+			// argument larger than the buffer size which normally wouldn't
+			// happen (because we would skip the node based on the size
+			// hint) but that would just mean that a future `CtxReadFull`
+			// call would read no data from the `currentNodeData` buffer.
+			// TODO: Re-check this reasoning.
 
-	case io.SeekCurrent:
-		if offset == 0 {
-			return dr.offset, nil
+			return nil
+			// In the leaf node case the search will stop here.
 		}
+	})
 
-		return dr.Seek(dr.offset+offset, io.SeekStart)
-		// TODO: Performance. This can be improved supporting relative
-		// searches in the `Walker` (see `Walker.Seek`).
-
-	case io.SeekEnd:
-		return dr.Seek(int64(dr.Size())+offset, io.SeekStart)
+	return err
+}
 
-	default:
-		return 0, errors.New("invalid whence")
+// hasSizeHints returns whether the (internal) node `nd` has the block sizes
+// of all its children, needed to seek.
+func hasSizeHints(nd ipld.Node) bool {
+	if len(nd.Links()) == 0 {
+		return true
 	}
+	fsNode, err := unixfs.ExtractFSNode(nd)
+	return err == nil && fsNode.NumChildren() == len(nd.Links())
 }
 
 // Reset the reader position by resetting the `dagWalker` and discarding
 // any partially used node's data in the `currentNodeData` buffer, used
-// in the `SeekStart` case.
+// by `walkTo`.
 func (dr *dagReader) resetPosition() {
 	dr.currentNodeData = nil
 	dr.offset = 0
 
-	dr.dagWalker = ipld.NewWalker(dr.ctx, ipld.NewNavigableIPLDNode(dr.rootNode, dr.serv))
+	dr.dagWalker = ipld.NewWalker(dr.ctx, newNavigableNode(dr.rootNode, 0, dr.serv, dr.ahead, dr.index))
 	// TODO: This could be avoided (along with storing the `dr.rootNode` and
 	// `dr.serv` just for this call) if `Reset` is supported in the `Walker`.
 }
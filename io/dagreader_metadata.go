@@ -2,6 +2,8 @@ package io
 
 import (
 	"context"
+	"io"
+	"net/http"
 
 	ft "github.com/TRON-US/go-unixfs"
 
@@ -39,3 +41,82 @@ func GetMetaDataFromDagRoot(ctx context.Context, root ipld.Node, ds ipld.DAGServ
 
 	return b, nil
 }
+
+// FileMetadata returns the metadata of the file of a reader of this package
+// whose root is a `TMetadata` node wrapping the file (the reader reads the
+// wrapped file), nil otherwise.
+func FileMetadata(r DagReader) *ft.Metadata {
+	switch r := r.(type) {
+	case *dagReader:
+		return r.metadata
+	case *sectionReader:
+		return r.dr.metadata
+	case *FileContent:
+		return FileMetadata(r.DagReader)
+	case *File:
+		return FileMetadata(r.DagReader)
+	default:
+		return nil
+	}
+}
+
+// sniffLen is the number of bytes `http.DetectContentType` considers.
+const sniffLen = 512
+
+// DetectMimeType returns the mime type of the file `n` sniffed from its
+// first bytes with `http.DetectContentType` ("application/octet-stream" if
+// unknown), reading only the leaves holding them.
+func DetectMimeType(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (string, error) {
+	r, err := NewDagReader(ctx, n, serv)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	buf := make([]byte, sniffLen)
+	read, err := r.CtxReadFull(ctx, buf)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:read]), nil
+}
+
+// WrapWithMimeType adds to `ds` and returns a `TMetadata` node wrapping the
+// file `n` with the mime type `mimeType`, or the one sniffed from its
+// content (see `DetectMimeType`) if empty. If `n` already is a wrapper, the
+// file it wraps is wrapped again instead, with the new mime type. The file
+// itself must be in `ds` already.
+func WrapWithMimeType(ctx context.Context, n ipld.Node, ds ipld.DAGService, mimeType string) (*dag.ProtoNode, error) {
+	r, err := NewDagReader(ctx, n, ds)
+	if err != nil {
+		return nil, err
+	}
+	size := r.Size()
+	r.Close()
+	if FileMetadata(r) != nil {
+		// `NewDagReader` checked the wrapper has the file as first link.
+		if n, err = n.Links()[0].GetNode(ctx, ds); err != nil {
+			return nil, err
+		}
+	}
+	if mimeType == "" {
+		if mimeType, err = DetectMimeType(ctx, n, ds); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ft.BytesForMetadata(&ft.Metadata{MimeType: mimeType, Size: size})
+	if err != nil {
+		return nil, err
+	}
+	wrapper := dag.NodeWithData(data)
+	if pn, ok := n.(*dag.ProtoNode); ok {
+		wrapper.SetCidBuilder(pn.CidBuilder())
+	}
+	if err := wrapper.AddNodeLink("", n); err != nil {
+		return nil, err
+	}
+	if err := ds.Add(ctx, wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper, nil
+}
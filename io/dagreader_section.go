@@ -0,0 +1,214 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/TRON-US/go-unixfs"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// sectionReader is a `DagReader` of a section of a file, see
+// `NewDagReaderSection`.
+type sectionReader struct {
+	dr *dagReader
+	// The section is [base, base+size) in the file.
+	base int64
+	size int64
+	// Position in the section, the underlying reader is only moved to it
+	// when reading so seeking never fetches blocks outside the section.
+	pos int64
+}
+
+var (
+	_ DagReader     = (*sectionReader)(nil)
+	_ io.ReaderAt   = (*sectionReader)(nil)
+	_ OffsetReader  = (*sectionReader)(nil)
+	_ Peeker        = (*sectionReader)(nil)
+	_ PositionSaver = (*sectionReader)(nil)
+)
+
+// NewDagReaderSection returns a reader of the `length` bytes of the file
+// `n` starting at `offset` (like `io.SectionReader`, offsets are relative
+// to the section and its end is the end of the data). It only ever
+// fetches the blocks overlapping the section, so video seeking or HTTP
+// range requests on large files don't download more than necessary. The
+// section is truncated to the end of the file.
+func NewDagReaderSection(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, offset, length int64) (DagReader, error) {
+	if offset < 0 || length < 0 {
+		return nil, errors.New("invalid section")
+	}
+	r, err := NewDagReader(ctx, n, serv)
+	if err != nil {
+		return nil, err
+	}
+	dr := r.(*dagReader)
+
+	size, err := unixfs.SizeToOffset(dr.Size())
+	if err != nil {
+		return nil, err
+	}
+	if offset > size {
+		offset = size
+	}
+	if length > size-offset {
+		length = size - offset
+	}
+	dr.ahead.limit = uint64(offset + length)
+	return &sectionReader{dr: dr, base: offset, size: length}, nil
+}
+
+// Size implements the `DagReader` interface.
+func (sr *sectionReader) Size() uint64 {
+	return uint64(sr.size)
+}
+
+// Offset implements the `OffsetReader` interface, relative to the section.
+func (sr *sectionReader) Offset() int64 {
+	return sr.pos
+}
+
+// Read implements the `io.Reader` interface.
+func (sr *sectionReader) Read(b []byte) (int, error) {
+	return sr.CtxReadFull(sr.dr.ctx, b)
+}
+
+// CtxReadFull implements the `DagReader` interface, reading up to the end
+// of the section.
+func (sr *sectionReader) CtxReadFull(ctx context.Context, out []byte) (int, error) {
+	if sr.pos >= sr.size {
+		return 0, io.EOF
+	}
+	limited := false
+	if rest := sr.size - sr.pos; int64(len(out)) > rest {
+		out = out[:rest]
+		limited = true
+	}
+	if sr.dr.offset != sr.base+sr.pos {
+		if _, err := sr.dr.Seek(sr.base+sr.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := sr.dr.CtxReadFull(ctx, out)
+	sr.pos += int64(n)
+	if err == nil && limited {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ReadAt implements the `io.ReaderAt` interface, `off` is relative to the
+// section.
+func (sr *sectionReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+	if off >= sr.size {
+		return 0, io.EOF
+	}
+	limited := false
+	if rest := sr.size - off; int64(len(p)) > rest {
+		p = p[:rest]
+		limited = true
+	}
+	n, err := sr.dr.ReadAt(p, sr.base+off)
+	if err == nil && limited {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Peek implements the `Peeker` interface, up to the end of the section.
+func (sr *sectionReader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("invalid count")
+	}
+	if err := sr.dr.checkClosed(); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	want, limited := buf, false
+	if rest := sr.size - sr.pos; int64(n) > rest {
+		if rest < 0 {
+			rest = 0
+		}
+		want, limited = buf[:rest], true
+	}
+	k, err := sr.dr.peek(want, sr.base+sr.pos)
+	if err == nil && limited {
+		err = io.EOF
+	}
+	return buf[:k], err
+}
+
+// WriteTo implements the `io.WriterTo` interface, writing the rest of the
+// section.
+func (sr *sectionReader) WriteTo(w io.Writer) (int64, error) {
+	// `Seek` allows positions past the end of the section.
+	if sr.pos >= sr.size {
+		return 0, nil
+	}
+	// The underlying `WriteTo` would write past the section, go through
+	// `Read` with buffers large enough to fetch many blocks in a batch.
+	buf := make([]byte, 1<<20)
+	if rest := sr.size - sr.pos; rest < int64(len(buf)) {
+		buf = buf[:rest]
+	}
+	var written int64
+	for {
+		n, err := sr.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr == nil && m < n {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				// Rewind to what was actually written.
+				sr.pos -= int64(n - m)
+				return written, werr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Seek implements the `io.Seeker` interface, offsets are relative to the
+// section.
+func (sr *sectionReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent, io.SeekEnd:
+		base := sr.pos
+		if whence == io.SeekEnd {
+			base = sr.size
+		}
+		pos, err := unixfs.AddOffset(uint64(base), offset)
+		if err != nil {
+			return sr.pos, err
+		}
+		if offset, err = unixfs.SizeToOffset(pos); err != nil {
+			return sr.pos, err
+		}
+	default:
+		return sr.pos, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return sr.pos, errors.New("invalid offset")
+	}
+	sr.pos = offset
+	return offset, nil
+}
+
+// Close implements the `io.Closer` interface.
+func (sr *sectionReader) Close() error {
+	return sr.dr.Close()
+}
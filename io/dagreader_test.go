@@ -2,13 +2,25 @@ package io
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"github.com/TRON-US/go-unixfs/importer/helpers"
 	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/hamt"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
 	mdag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
 
 	"context"
 
@@ -188,6 +200,14 @@ func TestRelativeSeek(t *testing.T) {
 		reader.Seek(-5, io.SeekCurrent) // seek 4 bytes but we read one byte every time so 5 bytes
 	}
 
+	// Relative seeks are checked instead of wrapping around.
+	var overflow *unixfs.SizeOverflowError
+	if _, err := reader.Seek(math.MaxInt64, io.SeekEnd); !errors.As(err, &overflow) {
+		t.Fatalf("expected a size overflow, got %v", err)
+	}
+	if _, err := reader.Seek(-2000, io.SeekCurrent); err != unixfs.ErrNegativeOffset {
+		t.Fatalf("expected %v, got %v", unixfs.ErrNegativeOffset, err)
+	}
 }
 
 func TestTypeFailures(t *testing.T) {
@@ -211,6 +231,67 @@ func TestTypeFailures(t *testing.T) {
 	}
 }
 
+func TestTypedErrors(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+	opts := DagReaderOptions{TypedErrors: true}
+
+	_, err := NewDagReaderWithOptions(ctx, unixfs.EmptyDirNode(), dserv, opts)
+	if !errors.Is(err, ErrIsDir) {
+		t.Fatalf("excepted to get %v, got %v", ErrIsDir, err)
+	}
+	var typeErr *NodeTypeError
+	if !errors.As(err, &typeErr) || typeErr.Type != unixfs.TDirectory {
+		t.Fatalf("expected the node type in the error, got %v", err)
+	}
+
+	shard, err := unixfs.HAMTShardData(nil, 256, hamt.HashMurmur3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDagReaderWithOptions(ctx, mdag.NodeWithData(shard), dserv, opts)
+	if !errors.Is(err, ErrIsDir) || !errors.As(err, &typeErr) || typeErr.Type != unixfs.THAMTShard {
+		t.Fatalf("expected a HAMT shard error, got %v", err)
+	}
+
+	data, err := unixfs.SymlinkData("/somelink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDagReaderWithOptions(ctx, mdag.NodeWithData(data), dserv, opts)
+	if !errors.Is(err, ErrCantReadSymlinks) {
+		t.Fatalf("excepted to get %v, got %v", ErrCantReadSymlinks, err)
+	}
+	var symlinkErr *SymlinkError
+	if !errors.As(err, &symlinkErr) || symlinkErr.Target != "/somelink" {
+		t.Fatalf("expected the link target in the error, got %v", err)
+	}
+	if !errors.As(err, &typeErr) || typeErr.Type != unixfs.TSymlink {
+		t.Fatalf("expected the node type in the error, got %v", err)
+	}
+}
+
+func TestReadSymlink(t *testing.T) {
+	data, err := unixfs.SymlinkData("../target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := ReadSymlink(mdag.NodeWithData(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../target" {
+		t.Fatalf("expected ../target, got %s", target)
+	}
+
+	for _, nd := range []ipld.Node{unixfs.EmptyDirNode(), unixfs.EmptyFileNode(), mdag.NewRawNode([]byte("raw"))} {
+		if _, err := ReadSymlink(nd); err != ErrNotSymlink {
+			t.Fatalf("expected ErrNotSymlink, got %v", err)
+		}
+	}
+}
+
 func TestBadPBData(t *testing.T) {
 	dserv := testu.GetDAGServ()
 	ctx, closer := context.WithCancel(context.Background())
@@ -264,6 +345,87 @@ func TestMetadataNode(t *testing.T) {
 	if err := testu.ArrComp(rdata, readdata); err != nil {
 		t.Fatal(err)
 	}
+	if md := FileMetadata(reader); md == nil || md.MimeType != "text" || md.Size != 125 {
+		t.Fatalf("expected the metadata of the wrapper, got %+v", md)
+	}
+
+	// Also wrapping a raw leaf.
+	raw := mdag.NewRawNode([]byte("raw data"))
+	if err := dserv.Add(ctx, raw); err != nil {
+		t.Fatal(err)
+	}
+	node = mdag.NodeWithData(data)
+	node.AddNodeLink("", raw)
+	reader, err = NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readdata, err = io.ReadAll(reader)
+	if err != nil || string(readdata) != "raw data" {
+		t.Fatalf("read wrong data (%v)", err)
+	}
+	if md := FileMetadata(reader); md == nil || md.MimeType != "text" {
+		t.Fatalf("expected the metadata of the wrapper, got %+v", md)
+	}
+
+	reader, err = NewDagReader(ctx, rnode, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := FileMetadata(reader); md != nil {
+		t.Fatalf("expected no metadata, got %+v", md)
+	}
+}
+
+func TestWrapWithMimeType(t *testing.T) {
+	ctx := context.Background()
+	dserv := testu.GetDAGServ()
+	png := append([]byte("\x89PNG\x0d\x0a\x1a\x0a"), testu.SeededData(1, 3000)...)
+	nd := testu.GetNode(t, dserv, png, testu.UseProtoBufLeaves)
+
+	mimeType, err := DetectMimeType(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mimeType != "image/png" {
+		t.Fatalf("expected image/png, got %q", mimeType)
+	}
+
+	wrapper, err := WrapWithMimeType(ctx, nd, dserv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewDagReader(ctx, wrapper, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := FileMetadata(r)
+	if md == nil || md.MimeType != "image/png" || md.Size != uint64(len(png)) {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, png) {
+		t.Fatal("read the wrong data")
+	}
+
+	// Wrapping a wrapper replaces it.
+	rewrapped, err := WrapWithMimeType(ctx, wrapper, dserv, "application/x-custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rewrapped.Links()[0].Cid.Equals(nd.Cid()) {
+		t.Fatal("expected the file to be wrapped directly")
+	}
+	r, err = NewDagReader(ctx, rewrapped, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := FileMetadata(r); md == nil || md.MimeType != "application/x-custom" {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
 }
 
 func TestWriteTo(t *testing.T) {
@@ -302,6 +464,20 @@ func TestReaderSzie(t *testing.T) {
 	if reader.Size() != uint64(size) {
 		t.Fatal("wrong reader size")
 	}
+
+	// The offset follows reads and seeks, the size doesn't change.
+	if _, err := reader.Read(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if reader.(OffsetReader).Offset() != 100 {
+		t.Fatalf("expected offset 100, got %d", reader.(OffsetReader).Offset())
+	}
+	if _, err := reader.Seek(-24, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if reader.(OffsetReader).Offset() != 1000 || reader.Size() != uint64(size) {
+		t.Fatalf("expected offset 1000 and size %d, got %d and %d", size, reader.(OffsetReader).Offset(), reader.Size())
+	}
 }
 
 func TestMetadataRead(t *testing.T) {
@@ -373,3 +549,2018 @@ func getOffset(reader DagReader) int64 {
 	}
 	return offset
 }
+
+func TestReadOnlyDAGService(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GetRandomNode(t, dserv, 1024, testu.UseProtoBufLeaves)
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	ro := NewReadOnlyDAGService(dserv)
+	var roErr *ReadOnlyError
+	if err := ro.Add(ctx, node); !errors.As(err, &roErr) || roErr.Op != "Add" {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if err := ro.Remove(ctx, node.Cid()); !errors.Is(err, mdag.ErrReadOnly) {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+
+	reader, err := NewDagReader(ctx, node, ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbuf, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(outbuf, inbuf) {
+		t.Fatal("incorrect read")
+	}
+}
+
+// batchRecorder records the size of every batch of nodes requested.
+type batchRecorder struct {
+	ipld.NodeGetter
+	lk      sync.Mutex
+	batches []int
+}
+
+func (br *batchRecorder) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	br.lk.Lock()
+	br.batches = append(br.batches, len(keys))
+	br.lk.Unlock()
+	return br.NodeGetter.GetMany(ctx, keys)
+}
+
+func TestBulkRead(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Seed: 1})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &batchRecorder{NodeGetter: dserv}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single read fills the whole buffer, fetching all the leaves it
+	// covers in one batch (the following ones may be prefetched in the
+	// background once the last of them is reached).
+	out := make([]byte, 60500)
+	n, err := reader.Read(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(out) {
+		t.Fatalf("expected a full read of %d bytes, got %d", len(out), n)
+	}
+	getter.lk.Lock()
+	first := getter.batches[0]
+	getter.lk.Unlock()
+	if first != 61 {
+		t.Fatalf("expected a first batch of 61 leaves, got %d", first)
+	}
+
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(append(out, rest...), inbuf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentReadAt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GetRandomNode(t, dserv, 20000, testu.UseProtoBufLeaves)
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := [][2]int64{{0, 1}, {0, 20000}, {499, 502}, {1234, 5678}, {19990, 20000}, {10000, 15000}}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ranges)*4)
+	for i := 0; i < 4; i++ {
+		for _, r := range ranges {
+			wg.Add(1)
+			go func(beg, end int64) {
+				defer wg.Done()
+				out := make([]byte, end-beg)
+				n, err := reader.(io.ReaderAt).ReadAt(out, beg)
+				if err != nil && !(err == io.EOF && end == 20000) {
+					errs <- err
+					return
+				}
+				if n != len(out) || !bytes.Equal(out, inbuf[beg:end]) {
+					errs <- errors.New("read wrong data")
+				}
+			}(r[0], r[1])
+		}
+	}
+	// The reader position isn't affected.
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, inbuf) {
+		t.Fatal("sequential read returned wrong data")
+	}
+
+	// Short reads at the end return io.EOF.
+	out = make([]byte, 100)
+	if n, err := reader.(io.ReaderAt).ReadAt(out, 19950); n != 50 || err != io.EOF {
+		t.Fatalf("expected 50 bytes and io.EOF, got %d and %v", n, err)
+	}
+	if _, err := reader.(io.ReaderAt).ReadAt(out, 20000); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+// limitedWriter fails once it has written `n` bytes.
+type limitedWriter struct {
+	bytes.Buffer
+	n int
+}
+
+var errWriterFull = errors.New("writer full")
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.n-lw.Len() {
+		written, _ := lw.Buffer.Write(p[:lw.n-lw.Len()])
+		return written, errWriterFull
+	}
+	return lw.Buffer.Write(p)
+}
+
+func TestWriteToFastPath(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Seed: 2})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &batchRecorder{NodeGetter: dserv}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start in the middle of a leaf.
+	if _, err := reader.Read(make([]byte, 1500)); err != nil {
+		t.Fatal(err)
+	}
+
+	// All the leaves not requested by the read (the minimum batch of 10)
+	// are requested in a single batch.
+	w := &limitedWriter{n: 50250}
+	n, err := reader.WriteTo(w)
+	if err != errWriterFull || n != 50250 {
+		t.Fatalf("expected a write of 50250 bytes failing, got %d and %v", n, err)
+	}
+	getter.lk.Lock()
+	second := getter.batches[1]
+	getter.lk.Unlock()
+	if second != 90 {
+		t.Fatalf("expected a batch of the 90 remaining leaves, got %d", second)
+	}
+
+	// The reader resumes after the data that was written.
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append(inbuf[:1500:1500], w.Bytes()...)
+	if err := testu.ArrComp(append(out, rest...), inbuf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Seed: 3})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &batchRecorder{NodeGetter: dserv}
+	reader, err := NewDagReaderWithOptions(ctx, node, getter, DagReaderOptions{Prefetch: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Small sequential reads, the leaves are requested 25 at a time.
+	var out []byte
+	buf := make([]byte, 100)
+	for {
+		n, err := reader.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testu.ArrComp(out, inbuf); err != nil {
+		t.Fatal(err)
+	}
+
+	getter.lk.Lock()
+	defer getter.lk.Unlock()
+	if len(getter.batches) != 4 {
+		t.Fatalf("expected 4 batches, got %v", getter.batches)
+	}
+	for _, b := range getter.batches {
+		if b != 25 {
+			t.Fatalf("expected batches of 25 leaves, got %v", getter.batches)
+		}
+	}
+}
+
+// fetchCounter counts the times every node is requested.
+type fetchCounter struct {
+	ipld.NodeGetter
+	lk      sync.Mutex
+	fetches map[cid.Cid]int
+}
+
+func (fc *fetchCounter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	fc.lk.Lock()
+	for _, k := range keys {
+		fc.fetches[k]++
+	}
+	fc.lk.Unlock()
+	return fc.NodeGetter.GetMany(ctx, keys)
+}
+
+func TestBackwardSeekIndex(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Depth: 3, LeafSize: 100, Fanout: 4, Seed: 4})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Visit all the nodes once.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatal(err)
+	}
+	getter.lk.Lock()
+	getter.fetches = make(map[cid.Cid]int)
+	getter.lk.Unlock()
+
+	out := make([]byte, 50)
+	for _, off := range []int64{6000, 5000, 3210, 6399, 1, 4444, 0, 2500, 6350} {
+		if _, err := reader.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.ReadFull(reader, out)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[:n], inbuf[off:off+int64(n)]) {
+			t.Fatalf("wrong data at offset %d", off)
+		}
+	}
+
+	// The seeks don't fetch any of the internal nodes again.
+	internal := make(map[cid.Cid]bool)
+	var walk func(nd ipld.Node)
+	walk = func(nd ipld.Node) {
+		if len(nd.Links()) == 0 {
+			return
+		}
+		internal[nd.Cid()] = true
+		for _, l := range nd.Links() {
+			child, err := l.GetNode(ctx, dserv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walk(child)
+		}
+	}
+	walk(node)
+	if len(internal) != 21 {
+		t.Fatalf("expected 21 internal nodes, got %d", len(internal))
+	}
+	getter.lk.Lock()
+	defer getter.lk.Unlock()
+	for c := range internal {
+		if getter.fetches[c] > 0 {
+			t.Fatalf("internal node %s fetched again %d times", c, getter.fetches[c])
+		}
+	}
+}
+
+func TestDagReaderSection(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Fanout: 10, Seed: 5})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	// The nodes overlapping [12345, 32345), by offset in the file.
+	const beg, end = 12345, 32345
+	overlapping := make(map[cid.Cid]bool)
+	var walk func(nd ipld.Node, off uint64)
+	walk = func(nd ipld.Node, off uint64) {
+		fsn, err := unixfs.ExtractFSNode(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off >= end || off+fsn.FileSize() <= beg {
+			return
+		}
+		overlapping[nd.Cid()] = true
+		for i, l := range nd.Links() {
+			child, err := l.GetNode(ctx, dserv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walk(child, off)
+			off += fsn.BlockSize(i)
+		}
+	}
+	walk(node, 0)
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	sr, err := NewDagReaderSection(ctx, node, getter, beg, end-beg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.Size() != end-beg {
+		t.Fatalf("expected a section of %d bytes, got %d", end-beg, sr.Size())
+	}
+	section := inbuf[beg:end]
+
+	if _, err := sr.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, section[len(section)-100:]) {
+		t.Fatal("wrong data at the end of the section")
+	}
+
+	if _, err := sr.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := sr.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), section) {
+		t.Fatal("wrong section data")
+	}
+
+	// Past the end of the section.
+	if _, err := sr.Seek(2*int64(len(section)), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if n, err := sr.WriteTo(buf); n != 0 || err != nil {
+		t.Fatalf("expected nothing written past the section, got %d and %v", n, err)
+	}
+
+	out = make([]byte, 1000)
+	if n, err := sr.(io.ReaderAt).ReadAt(out, int64(len(section)-500)); n != 500 || err != io.EOF {
+		t.Fatalf("expected 500 bytes and io.EOF, got %d and %v", n, err)
+	}
+	if !bytes.Equal(out[:500], section[len(section)-500:]) {
+		t.Fatal("wrong data read at the end of the section")
+	}
+
+	getter.lk.Lock()
+	defer getter.lk.Unlock()
+	for c := range getter.fetches {
+		if !overlapping[c] {
+			t.Fatalf("fetched %s outside of the section", c)
+		}
+	}
+}
+
+// foreignRawNode is a raw block decoded by another implementation than
+// merkledag.
+type foreignRawNode struct {
+	*mdag.RawNode
+}
+
+// foreignRawGetter returns raw blocks as `foreignRawNode`s.
+type foreignRawGetter struct {
+	ipld.NodeGetter
+}
+
+func (g foreignRawGetter) wrap(nd ipld.Node) ipld.Node {
+	if raw, ok := nd.(*mdag.RawNode); ok {
+		return foreignRawNode{raw}
+	}
+	return nd
+}
+
+func (g foreignRawGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := g.NodeGetter.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return g.wrap(nd), nil
+}
+
+func (g foreignRawGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(keys))
+	go func() {
+		defer close(out)
+		for opt := range g.NodeGetter.GetMany(ctx, keys) {
+			if opt.Err == nil {
+				opt = &ipld.NodeOption{Node: g.wrap(opt.Node)}
+			}
+			out <- opt
+		}
+	}()
+	return out
+}
+
+func TestRawLeaves(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 20000, LeafSize: 1000, Fanout: 4, Seed: 6, RawLeaves: true})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	for _, getter := range []ipld.NodeGetter{dserv, foreignRawGetter{dserv}} {
+		reader, err := NewDagReader(ctx, node, getter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.Seek(12345, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, inbuf[12345:]) {
+			t.Fatal("wrong data")
+		}
+		out = make([]byte, 3000)
+		if _, err := reader.(io.ReaderAt).ReadAt(out, 999); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, inbuf[999:3999]) {
+			t.Fatal("wrong data read at offset")
+		}
+	}
+
+	// A single raw leaf (from another implementation) as the root.
+	leaf, err := node.Links()[0].GetNode(ctx, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(leaf.Links()) > 0 {
+		if leaf, err = leaf.Links()[0].GetNode(ctx, dserv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := NewDagReader(ctx, foreignRawNode{leaf.(*mdag.RawNode)}, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Size() != 1000 || !bytes.Equal(out, inbuf[:1000]) {
+		t.Fatal("wrong data in a single raw leaf")
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 7})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	var reports []ReadProgress
+	reader, err := NewDagReaderWithOptions(ctx, node, dserv, DagReaderOptions{
+		Progress: func(p ReadProgress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 2500)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.WriteTo(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// All the nodes but the root are fetched.
+	var blocks, blockBytes uint64
+	var walk func(nd ipld.Node)
+	walk = func(nd ipld.Node) {
+		for _, l := range nd.Links() {
+			child, err := l.GetNode(ctx, dserv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks++
+			blockBytes += uint64(len(child.RawData()))
+			walk(child)
+		}
+	}
+	walk(node)
+
+	var last ReadProgress
+	for _, p := range reports {
+		if p.Delivered < last.Delivered || p.Blocks < last.Blocks || p.BlockBytes < last.BlockBytes {
+			t.Fatalf("progress went backwards: %+v after %+v", p, last)
+		}
+		last = p
+	}
+	expected := ReadProgress{Delivered: uint64(len(inbuf)), Blocks: blocks, BlockBytes: blockBytes}
+	if last != expected {
+		t.Fatalf("expected a final progress of %+v, got %+v", expected, last)
+	}
+}
+
+func TestVerifiedRead(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	_, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 8})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	// replaceLink returns a copy of `nd` with the link `i` pointing to
+	// `child`, leaving the block sizes alone.
+	replaceLink := func(nd ipld.Node, i int, child ipld.Node) *mdag.ProtoNode {
+		pn := nd.(*mdag.ProtoNode).Copy().(*mdag.ProtoNode)
+		links := pn.Links()
+		links[i] = &ipld.Link{Cid: child.Cid()}
+		pn.SetLinks(links)
+		if err := dserv.Add(ctx, pn); err != nil {
+			t.Fatal(err)
+		}
+		return pn
+	}
+
+	// Replace a leaf with a shorter one.
+	parent, err := node.Links()[1].GetNode(ctx, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := mdag.NodeWithData(unixfs.FilePBData(make([]byte, 999), 999))
+	if err := dserv.Add(ctx, short); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := replaceLink(node, 1, replaceLink(parent, 2, short))
+
+	expected := &CorruptionError{Cid: short.Cid(), Declared: 1000, Actual: 999}
+	checkCorruption := func(err error) {
+		var cerr *CorruptionError
+		if !errors.As(err, &cerr) || *cerr != *expected {
+			t.Fatalf("expected %v, got %v", expected, err)
+		}
+	}
+
+	// Without verification the data is just shorter.
+	reader, err := NewDagReader(ctx, corrupted, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := io.ReadAll(reader); err != nil || len(out) != 9999 {
+		t.Fatalf("expected an unverified read of 9999 bytes, got %d and %v", len(out), err)
+	}
+
+	reader, err = NewDagReaderWithOptions(ctx, corrupted, dserv, DagReaderOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(reader)
+	checkCorruption(err)
+	_, err = reader.(io.ReaderAt).ReadAt(make([]byte, 100), 6500)
+	checkCorruption(err)
+	// Other parts of the file can be read.
+	if _, err := reader.(io.ReaderAt).ReadAt(make([]byte, 100), 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// An internal node without block sizes.
+	fsNode, err := unixfs.ExtractFSNode(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsNode.RemoveAllBlockSizes()
+	fsNode.UpdateFilesize(4000)
+	data, err := fsNode.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsized := parent.(*mdag.ProtoNode).Copy().(*mdag.ProtoNode)
+	unsized.SetData(data)
+	if err := dserv.Add(ctx, unsized); err != nil {
+		t.Fatal(err)
+	}
+	expected = &CorruptionError{Cid: unsized.Cid(), Declared: 4000, Actual: 0}
+	reader, err = NewDagReaderWithOptions(ctx, replaceLink(node, 1, unsized), dserv, DagReaderOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(reader)
+	checkCorruption(err)
+	_, err = NewDagReaderWithOptions(ctx, unsized, dserv, DagReaderOptions{Verify: true})
+	checkCorruption(err)
+
+	// A root file size not matching its block sizes.
+	fsNode, err = unixfs.ExtractFSNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsNode.UpdateFilesize(2345)
+	data, err = fsNode.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := node.(*mdag.ProtoNode).Copy().(*mdag.ProtoNode)
+	root.SetData(data)
+	expected = &CorruptionError{Cid: root.Cid(), Declared: 12345, Actual: 10000}
+	_, err = NewDagReaderWithOptions(ctx, root, dserv, DagReaderOptions{Verify: true})
+	checkCorruption(err)
+}
+
+func TestLeafData(t *testing.T) {
+	internal := unixfs.NewFSNode(unixfs.TFile)
+	internal.SetData([]byte("some data"))
+	internal.AddBlockSize(100)
+	internal.AddBlockSize(200)
+	internalData, err := internal.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	symlink, err := unixfs.SymlinkData("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last `Data` field wins.
+	repeated := append(unixfs.FilePBData([]byte("first"), 5), unixfs.FilePBData([]byte("last"), 4)...)
+
+	nodes := []ipld.Node{
+		mdag.NodeWithData(unixfs.FilePBData([]byte("file leaf"), 9)),
+		mdag.NodeWithData(unixfs.WrapData([]byte("raw leaf"))),
+		unixfs.EmptyFileNode(),
+		mdag.NodeWithData(internalData),
+		mdag.NodeWithData(repeated),
+		mdag.NewRawNode([]byte("raw node")),
+		unixfs.EmptyDirNode(),
+		mdag.NodeWithData(symlink),
+		mdag.NodeWithData([]byte{42}),
+		mdag.NodeWithData(unixfs.FilePBData([]byte("truncated"), 9)[:5]),
+	}
+	for i, nd := range nodes {
+		expected, expectedErr := unixfs.ReadUnixFSNodeData(nd)
+		data, err := leafData(nd)
+		if (err == nil) != (expectedErr == nil) || !bytes.Equal(data, expected) {
+			t.Fatalf("node %d: expected %q (%v), got %q (%v)", i, expected, expectedErr, data, err)
+		}
+	}
+
+	nd := nodes[0]
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := leafData(nd); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestReadCancel(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 20000, LeafSize: 1000, Fanout: 30, Seed: 9})
+
+	// Cancel the read in the middle of the first batch, the rest of its
+	// children are available but must not be read.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := NewDagReaderWithOptions(context.Background(), node, dserv, DagReaderOptions{
+		Progress: func(p ReadProgress) {
+			if p.Delivered >= 1000 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(inbuf))
+	n, err := CtxReadFull(ctx, reader, out)
+	if err != context.Canceled || n != 1000 {
+		t.Fatalf("expected to read 1000 bytes and be canceled, got %d bytes (%v)", n, err)
+	}
+	if n, err := reader.CtxReadFull(ctx, out[n:]); err != context.Canceled || n != 0 {
+		t.Fatalf("expected a canceled read, got %d bytes (%v)", n, err)
+	}
+
+	// The rest can be read with another context.
+	n, err = CtxReadFull(context.Background(), reader, out[1000:])
+	if err != nil || n != len(inbuf)-1000 {
+		t.Fatalf("expected to read the rest of the file, got %d bytes (%v)", n, err)
+	}
+	if !bytes.Equal(out, inbuf) {
+		t.Fatal("read wrong data")
+	}
+
+	// Closing the reader stops `WriteTo`.
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	if _, err := reader.WriteTo(io.Discard); err != context.Canceled {
+		t.Fatalf("expected a canceled write, got %v", err)
+	}
+
+	// Other readers are checked between reads.
+	n, err = CtxReadFull(ctx, struct{ io.Reader }{bytes.NewReader(inbuf)}, out)
+	if err != context.Canceled || n != 0 {
+		t.Fatalf("expected a canceled read, got %d bytes (%v)", n, err)
+	}
+	n, err = CtxReadFull(context.Background(), struct{ io.Reader }{bytes.NewReader(inbuf[:10])}, out)
+	if err != io.ErrUnexpectedEOF || n != 10 {
+		t.Fatalf("expected to read 10 bytes before the end, got %d bytes (%v)", n, err)
+	}
+}
+
+func TestFileContent(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 10})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	serve := func(getter ipld.NodeGetter, header http.Header) *httptest.ResponseRecorder {
+		content, err := NewFileContent(ctx, node, getter, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer content.Close()
+		if content.Size() != uint64(len(inbuf)) || !content.ModTime().Equal(modTime) {
+			t.Fatalf("wrong size (%d) or modification time (%s)", content.Size(), content.ModTime())
+		}
+		req := httptest.NewRequest("GET", "/file", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		// Otherwise the start of the file is read to detect it.
+		rec.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(rec, req, "file", content.ModTime(), content)
+		return rec
+	}
+
+	// A range request only fetches the blocks of the range.
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	rec := serve(getter, http.Header{"Range": {"bytes=9500-9599"}})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected a partial content, got %d", rec.Code)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes 9500-9599/10000" {
+		t.Fatalf("wrong content range %q", cr)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), inbuf[9500:9600]) {
+		t.Fatal("served wrong data")
+	}
+	for _, l := range node.Links()[:2] {
+		if getter.fetches[l.Cid] != 0 {
+			t.Fatalf("fetched %s outside of the range", l.Cid)
+		}
+	}
+
+	rec = serve(dserv, http.Header{})
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), inbuf) {
+		t.Fatalf("expected the whole file, got %d (%d bytes)", rec.Code, rec.Body.Len())
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != modTime.Format(http.TimeFormat) {
+		t.Fatalf("wrong last modification time %q", lm)
+	}
+
+	rec = serve(dserv, http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}})
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected not modified, got %d", rec.Code)
+	}
+}
+
+func TestBlockCache(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 11})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	cache := NewBlockCache(1 << 20)
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	read := func() {
+		reader, err := NewDagReaderWithOptions(ctx, node, getter, DagReaderOptions{Cache: cache})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		outbuf, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(outbuf, inbuf) {
+			t.Fatal("read wrong data")
+		}
+	}
+
+	read()
+	getter.lk.Lock()
+	fetched := len(getter.fetches)
+	getter.fetches = make(map[cid.Cid]int)
+	getter.lk.Unlock()
+	if cache.Len() != fetched {
+		t.Fatalf("expected the %d nodes fetched in the cache, got %d", fetched, cache.Len())
+	}
+	// The second read is served from the cache.
+	read()
+	if len(getter.fetches) != 0 {
+		t.Fatalf("expected no fetches, got %d", len(getter.fetches))
+	}
+
+	// The least recently used blocks are evicted.
+	a := mdag.NewRawNode(bytes.Repeat([]byte{'a'}, 100))
+	b := mdag.NewRawNode(bytes.Repeat([]byte{'b'}, 100))
+	c := mdag.NewRawNode(bytes.Repeat([]byte{'c'}, 100))
+	cache = NewBlockCache(250)
+	cache.add(a)
+	cache.add(b)
+	if _, ok := cache.get(a.Cid()); !ok {
+		t.Fatal("expected a cached block")
+	}
+	cache.add(c)
+	if _, ok := cache.get(b.Cid()); ok {
+		t.Fatal("expected the least recently used block to be evicted")
+	}
+	if cache.Len() != 2 || cache.Bytes() != 200 {
+		t.Fatalf("expected 2 blocks of 200 bytes, got %d of %d", cache.Len(), cache.Bytes())
+	}
+	cache.add(mdag.NewRawNode(make([]byte, 300)))
+	if cache.Len() != 2 {
+		t.Fatal("expected a block larger than the cache not to be cached")
+	}
+}
+
+func TestReadRanges(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 100, Fanout: 4, Seed: 12})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	ranges := []Range{
+		{Offset: 0, Length: 100},
+		{Offset: 50, Length: 150},
+		{Offset: 3210, Length: 1000},
+		{Offset: 9950, Length: 100},
+		{Offset: 20000, Length: 10},
+		{Offset: 5000, Length: 0},
+	}
+	expected := [][]byte{inbuf[0:100], inbuf[50:200], inbuf[3210:4210], inbuf[9950:], {}, {}}
+	check := func(r DagReader) {
+		out, err := ReadRanges(ctx, r, ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(expected) {
+			t.Fatalf("expected %d ranges, got %d", len(expected), len(out))
+		}
+		for i := range out {
+			if !bytes.Equal(out[i], expected[i]) {
+				t.Fatalf("range %d: read wrong data", i)
+			}
+		}
+	}
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reader)
+	// Every node is fetched once, shared or not.
+	for c, n := range getter.fetches {
+		if n != 1 {
+			t.Fatalf("fetched %s %d times", c, n)
+		}
+	}
+	// Only the leaves of the ranges (and the nodes above them) are fetched.
+	leaves := 0
+	for c := range getter.fetches {
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nd.Links()) == 0 {
+			leaves++
+		}
+	}
+	if leaves != 2+11+1 {
+		t.Fatalf("expected to fetch 14 leaves, got %d", leaves)
+	}
+	if reader.(OffsetReader).Offset() != 0 {
+		t.Fatal("the reader position moved")
+	}
+
+	// Through other readers.
+	section, err := NewDagReaderSection(ctx, node, dserv, 0, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(section)
+	// Without `io.ReaderAt`, by seeking back to the position.
+	if _, err := reader.Seek(123, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	check(struct{ DagReader }{reader})
+	if reader.(OffsetReader).Offset() != 123 {
+		t.Fatal("the reader position moved")
+	}
+	section, err = NewDagReaderSection(ctx, node, dserv, 1000, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ReadRanges(ctx, section, []Range{{Offset: 0, Length: 100}, {Offset: 400, Length: 200}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[0], inbuf[1000:1100]) || !bytes.Equal(out[1], inbuf[1400:1500]) {
+		t.Fatal("read wrong data from the section")
+	}
+
+	if _, err := ReadRanges(ctx, reader, []Range{{Offset: -1, Length: 10}}); err == nil {
+		t.Fatal("expected an invalid range error")
+	}
+}
+
+func TestTrickleSeek(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 200000, LeafSize: 100, Fanout: 8, Seed: 13, Trickle: true})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	// pathLength returns the number of nodes below the root down to the
+	// leaf holding `off`.
+	pathLength := func(off uint64) int {
+		var n int
+		nd := node
+		for len(nd.Links()) > 0 {
+			fsn, err := unixfs.ExtractFSNode(nd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := 0
+			for ; off >= fsn.BlockSize(i); i++ {
+				off -= fsn.BlockSize(i)
+			}
+			if nd, err = nd.Links()[i].GetNode(ctx, dserv); err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+		return n
+	}
+
+	out := make([]byte, 10)
+	for _, off := range []int64{1, 5000, 123456, 199995, 77777} {
+		getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+		reader, err := NewDagReader(ctx, node, getter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(reader, out[:5]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[:5], inbuf[off:off+5]) {
+			t.Fatalf("read wrong data at %d", off)
+		}
+		// Seeking only fetches the path to the offset.
+		getter.lk.Lock()
+		fetched := len(getter.fetches)
+		getter.lk.Unlock()
+		if expected := pathLength(uint64(off)); fetched != expected {
+			t.Fatalf("seeking to %d: expected %d fetches, got %d", off, expected, fetched)
+		}
+		reader.Close()
+	}
+}
+
+func TestLazySeek(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Depth: 2, LeafSize: 1000, Fanout: 10, Seed: 14})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched := func() int {
+		getter.lk.Lock()
+		defer getter.lk.Unlock()
+		return len(getter.fetches)
+	}
+	checkRead := func(off int64) {
+		out := make([]byte, 10)
+		if _, err := io.ReadFull(reader, out); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, inbuf[off:off+10]) {
+			t.Fatalf("read wrong data at %d", off)
+		}
+	}
+
+	// Seeking doesn't fetch anything.
+	if _, err := reader.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(56000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if off, err := reader.Seek(500, io.SeekCurrent); err != nil || off != 56500 {
+		t.Fatalf("expected to seek to 56500, got %d (%v)", off, err)
+	}
+	if fetched() != 0 {
+		t.Fatalf("expected no fetches, got %d", fetched())
+	}
+
+	// Reading fetches the path to the leaf, skipping the ones before.
+	checkRead(56500)
+	if fetched() != 2 {
+		t.Fatalf("expected 2 fetches, got %d", fetched())
+	}
+
+	// Seeking inside the leaf, forwards or backwards, fetches nothing.
+	if _, err := reader.Seek(56900, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	checkRead(56900)
+	if _, err := reader.Seek(56100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	checkRead(56100)
+	if fetched() != 2 {
+		t.Fatalf("expected 2 fetches, got %d", fetched())
+	}
+}
+
+func TestHashingReader(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 15})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr, err := NewHashingReader(reader, "sha2-256", "blake2b-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read, write until a short write and write the rest.
+	var out bytes.Buffer
+	if _, err := io.CopyN(&out, struct{ io.Reader }{hr}, 1500); err != nil {
+		t.Fatal(err)
+	}
+	lw := &limitedWriter{n: 4321}
+	if _, err := hr.WriteTo(lw); err != errWriterFull {
+		t.Fatalf("expected errWriterFull, got %v", err)
+	}
+	out.Write(lw.Bytes())
+	if _, err := hr.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), inbuf) {
+		t.Fatal("read wrong data")
+	}
+
+	sums := hr.Sum()
+	sha := sha256.Sum256(inbuf)
+	if !bytes.Equal(sums["sha2-256"], sha[:]) {
+		t.Fatal("wrong sha2-256 digest")
+	}
+	encoded, err := mh.Sum(inbuf, mh.BLAKE2B_MIN+31, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blake, err := mh.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sums["blake2b-256"], blake.Digest) {
+		t.Fatal("wrong blake2b-256 digest")
+	}
+
+	if _, err := NewHashingReader(reader, "sha2-256", "nope"); err == nil {
+		t.Fatal("expected an unknown hash function error")
+	}
+}
+
+// blockingGetter never returns the nodes requested, until the request is
+// canceled.
+type blockingGetter struct {
+	ipld.NodeGetter
+	inFlight sync.WaitGroup
+	started  chan struct{}
+}
+
+func (bg *blockingGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption)
+	bg.inFlight.Add(1)
+	go func() {
+		defer bg.inFlight.Done()
+		defer close(out)
+		bg.started <- struct{}{}
+		<-ctx.Done()
+	}()
+	return out
+}
+
+func TestCloseAbortsFetches(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	_, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 16})
+
+	getter := &blockingGetter{NodeGetter: dserv, started: make(chan struct{}, 100)}
+	reader, err := NewDagReader(context.Background(), node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		// A context of its own, never canceled.
+		_, err := reader.CtxReadFull(context.Background(), make([]byte, 10000))
+		done <- err
+	}()
+	<-getter.started
+
+	reader.Close()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected the read to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read in progress wasn't aborted")
+	}
+	// The requests in flight are aborted.
+	getter.inFlight.Wait()
+
+	if _, err := reader.Read(make([]byte, 10)); err != context.Canceled {
+		t.Fatalf("expected reads to fail after closing, got %v", err)
+	}
+}
+
+func TestLeafIterator(t *testing.T) {
+	for _, rawLeaves := range []bool{false, true} {
+		dserv := testu.GetDAGServ()
+		inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10500, LeafSize: 1000, Fanout: 4, Seed: 17, RawLeaves: rawLeaves})
+		ctx, closer := context.WithCancel(context.Background())
+		defer closer()
+
+		it, err := NewLeafIterator(ctx, node, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var leaves int
+		var offset uint64
+		for it.Next() {
+			leaf := it.Leaf()
+			if leaf.Offset != offset || leaf.Length != uint64(len(leaf.Data)) {
+				t.Fatalf("leaf %d: wrong offset %d or length %d", leaves, leaf.Offset, leaf.Length)
+			}
+			if !bytes.Equal(leaf.Data, inbuf[offset:offset+leaf.Length]) {
+				t.Fatalf("leaf %d: wrong data", leaves)
+			}
+			if len(leaf.Node.Links()) != 0 {
+				t.Fatalf("leaf %d: not a leaf", leaves)
+			}
+			offset += leaf.Length
+			leaves++
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if leaves != 11 || offset != uint64(len(inbuf)) {
+			t.Fatalf("expected 11 leaves covering the file, got %d covering %d bytes", leaves, offset)
+		}
+		if it.Next() {
+			t.Fatal("expected the iteration to be over")
+		}
+	}
+
+	if _, err := NewLeafIterator(context.Background(), unixfs.EmptyDirNode(), testu.GetDAGServ()); err != ErrIsDir {
+		t.Fatalf("expected ErrIsDir, got %v", err)
+	}
+}
+
+func TestCloneDagReader(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Depth: 3, LeafSize: 100, Fanout: 4, Seed: 18})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatal(err)
+	}
+	getter.lk.Lock()
+	getter.fetches = make(map[cid.Cid]int)
+	getter.lk.Unlock()
+
+	// Download segments in parallel from clones, they don't fetch the
+	// internal nodes visited by the original reader again.
+	const segment = 800
+	out := make([]byte, len(inbuf))
+	var wg sync.WaitGroup
+	errs := make(chan error, len(inbuf)/segment)
+	for off := 0; off < len(inbuf); off += segment {
+		clone, err := CloneDagReader(reader, int64(off))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clone.(OffsetReader).Offset() != int64(off) {
+			t.Fatalf("expected a clone at %d, got %d", off, clone.(OffsetReader).Offset())
+		}
+		wg.Add(1)
+		go func(clone DagReader, off int) {
+			defer wg.Done()
+			defer clone.Close()
+			if _, err := io.ReadFull(clone, out[off:off+segment]); err != nil {
+				errs <- err
+			}
+		}(clone, off)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, inbuf) {
+		t.Fatal("read wrong data")
+	}
+	for c := range getter.fetches {
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nd.Links()) > 0 {
+			t.Fatalf("internal node %s fetched again", c)
+		}
+	}
+
+	// Closing the original doesn't close its clones.
+	clone, err := CloneDagReader(reader, 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	rest, err := io.ReadAll(clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, inbuf[6000:]) {
+		t.Fatal("read wrong data from the clone")
+	}
+
+	// Clones of sections stay in the section.
+	section, err := NewDagReaderSection(ctx, node, dserv, 1000, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err = CloneDagReader(section, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err = io.ReadAll(clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, inbuf[1100:1500]) {
+		t.Fatal("read wrong data from the section clone")
+	}
+}
+
+// stallingGetter never delivers the node `stall` to the first `stalls`
+// requests including it (the other nodes are delivered).
+type stallingGetter struct {
+	ipld.NodeGetter
+	stall  cid.Cid
+	lk     sync.Mutex
+	stalls int
+}
+
+func (sg *stallingGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	var rest []cid.Cid
+	for _, k := range keys {
+		if !k.Equals(sg.stall) {
+			rest = append(rest, k)
+		}
+	}
+	sg.lk.Lock()
+	stalled := len(rest) < len(keys) && sg.stalls != 0
+	if stalled {
+		sg.stalls--
+	}
+	sg.lk.Unlock()
+	if !stalled {
+		return sg.NodeGetter.GetMany(ctx, keys)
+	}
+
+	out := make(chan *ipld.NodeOption)
+	go func() {
+		defer close(out)
+		for opt := range sg.NodeGetter.GetMany(ctx, rest) {
+			select {
+			case out <- opt:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return out
+}
+
+func TestFetchRetries(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 19})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+	stall := node.Links()[1].Cid
+	opts := DagReaderOptions{BlockTimeout: 20 * time.Millisecond, Retries: 2, RetryBackoff: time.Millisecond}
+
+	// Recovers from a couple of stalled requests.
+	getter := &stallingGetter{NodeGetter: dserv, stall: stall, stalls: 2}
+	reader, err := NewDagReaderWithOptions(ctx, node, getter, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbuf, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(outbuf, inbuf) {
+		t.Fatal("read wrong data")
+	}
+
+	// Gives up on a block that never arrives.
+	getter = &stallingGetter{NodeGetter: dserv, stall: stall, stalls: -1}
+	reader, err = NewDagReaderWithOptions(ctx, node, getter, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(reader)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || !fetchErr.Cid.Equals(stall) || fetchErr.Attempts != 3 {
+		t.Fatalf("expected a fetch error of %s after 3 attempts, got %v", stall, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// Also when reading at an offset.
+	reader, err = NewDagReaderWithOptions(ctx, node, getter, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.(io.ReaderAt).ReadAt(make([]byte, 100), 4000); !errors.As(err, &fetchErr) {
+		t.Fatalf("expected a fetch error, got %v", err)
+	}
+}
+
+func TestReaderStats(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 20})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+	getter := &stallingGetter{NodeGetter: dserv, stall: node.Links()[1].Cid, stalls: 2}
+	opts := DagReaderOptions{
+		Cache:        NewBlockCache(1 << 20),
+		BlockTimeout: 20 * time.Millisecond,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	}
+
+	reader, err := NewDagReaderWithOptions(ctx, node, getter, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := Stats(reader); stats != (ReaderStats{}) {
+		t.Fatalf("expected no stats yet, got %+v", stats)
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	}
+	// 3 internal nodes and 10 leaves.
+	stats := Stats(reader)
+	if stats.Blocks != 13 || stats.CacheHits != 0 || stats.Retries != 2 || stats.Delivered != uint64(len(inbuf)) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.BlockBytes <= uint64(len(inbuf)) {
+		t.Fatalf("expected more block bytes than data, got %d", stats.BlockBytes)
+	}
+
+	// Read again from the cache, clones share the stats.
+	reader, err = NewDagReaderWithOptions(ctx, node, dserv, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err := CloneDagReader(reader, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(clone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.(io.ReaderAt).ReadAt(make([]byte, 1000), 0); err != nil {
+		t.Fatal(err)
+	}
+	stats = Stats(reader)
+	if stats.Blocks != stats.CacheHits || stats.Retries != 0 || stats.Delivered != 6000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 21})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	reader, err := NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := func() int {
+		getter.lk.Lock()
+		defer getter.lk.Unlock()
+		total := 0
+		for _, n := range getter.fetches {
+			total += n
+		}
+		return total
+	}
+	if _, err := io.ReadFull(reader, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the current leaf nothing is fetched.
+	before := fetches()
+	out, err := reader.(Peeker).Peek(100)
+	if err != nil || !bytes.Equal(out, inbuf[10:110]) {
+		t.Fatalf("peeked wrong data (%v)", err)
+	}
+	if fetches() != before {
+		t.Fatalf("expected no fetches, got %d", fetches()-before)
+	}
+
+	// Across leaves, the position doesn't move.
+	out, err = reader.(Peeker).Peek(1500)
+	if err != nil || !bytes.Equal(out, inbuf[10:1510]) {
+		t.Fatalf("peeked wrong data (%v)", err)
+	}
+	if reader.(OffsetReader).Offset() != 10 {
+		t.Fatalf("expected to stay at 10, got %d", reader.(OffsetReader).Offset())
+	}
+	rest, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(rest, inbuf[10:]) {
+		t.Fatalf("read wrong data (%v)", err)
+	}
+
+	// Past the end of the file or of a section.
+	if _, err := reader.Seek(9900, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err = reader.(Peeker).Peek(200)
+	if err != io.EOF || !bytes.Equal(out, inbuf[9900:]) {
+		t.Fatalf("expected the last 100 bytes and EOF, got %d bytes (%v)", len(out), err)
+	}
+	section, err := NewDagReaderSection(ctx, node, dserv, 2000, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := section.Seek(400, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err = section.(Peeker).Peek(200)
+	if err != io.EOF || !bytes.Equal(out, inbuf[2400:2500]) {
+		t.Fatalf("expected the last 100 bytes of the section and EOF, got %d bytes (%v)", len(out), err)
+	}
+}
+
+func TestOpenDagReader(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 5000, LeafSize: 1000, Seed: 22})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader, err := OpenDagReader(ctx, node.Cid(), dserv, DagReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbuf, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(outbuf, inbuf) {
+		t.Fatal("read wrong data")
+	}
+	if stats := Stats(reader); stats.Blocks != 6 {
+		t.Fatalf("expected the root and 5 leaves, got %d blocks", stats.Blocks)
+	}
+
+	dir := unixfs.EmptyDirNode()
+	if err := dserv.Add(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenDagReader(ctx, dir.Cid(), dserv, DagReaderOptions{TypedErrors: true})
+	var typeErr *NodeTypeError
+	if !errors.Is(err, ErrIsDir) || !errors.As(err, &typeErr) || typeErr.Type != unixfs.TDirectory {
+		t.Fatalf("expected a directory error, got %v", err)
+	}
+
+	missing := mdag.NodeWithData([]byte("missing")).Cid()
+	_, err = OpenDagReader(ctx, missing, dserv, DagReaderOptions{})
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || !fetchErr.Cid.Equals(missing) || !errors.Is(err, ipld.ErrNotFound) {
+		t.Fatalf("expected a fetch error of %s, got %v", missing, err)
+	}
+	_, err = OpenDagReader(ctx, missing, dserv, DagReaderOptions{Retries: 1})
+	if !errors.As(err, &fetchErr) || fetchErr.Attempts != 2 {
+		t.Fatalf("expected a fetch error after 2 attempts, got %v", err)
+	}
+}
+
+func TestAdaptivePrefetch(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Seed: 23})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &batchRecorder{NodeGetter: dserv}
+	reader, err := NewDagReaderWithOptions(ctx, node, getter, DagReaderOptions{Prefetch: 2, MaxPrefetch: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sequential reads grow the batches up to the maximum.
+	out := make([]byte, 500)
+	for off := 0; off < 50000; off += len(out) {
+		if _, err := io.ReadFull(reader, out); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, inbuf[off:off+len(out)]) {
+			t.Fatalf("read wrong data at %d", off)
+		}
+	}
+	getter.lk.Lock()
+	batches := getter.batches
+	getter.lk.Unlock()
+	if batches[0] != 4 || batches[len(batches)-1] != 32 {
+		t.Fatalf("expected batches growing from 4 to 32 blocks, got %v", batches)
+	}
+
+	// Random reads fetch only the leaves they read (with another reader,
+	// the batches of the first one may still be requested).
+	getter = &batchRecorder{NodeGetter: dserv}
+	reader, err = NewDagReaderWithOptions(ctx, node, getter, DagReaderOptions{Prefetch: 2, MaxPrefetch: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int64{90000, 10000, 70500, 30000} {
+		if _, err := reader.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(reader, out[:10]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[:10], inbuf[off:off+10]) {
+			t.Fatalf("read wrong data at %d", off)
+		}
+	}
+	getter.lk.Lock()
+	defer getter.lk.Unlock()
+	for _, b := range getter.batches {
+		if b != 1 {
+			t.Fatalf("expected single block batches, got %v", getter.batches)
+		}
+	}
+}
+
+// fileFS is an `fs.FS` opening the unixfs file `node` under every name.
+type fileFS struct {
+	ctx  context.Context
+	node ipld.Node
+	serv ipld.NodeGetter
+}
+
+func (fsys *fileFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return NewFile(fsys.ctx, fsys.node, fsys.serv, name, time.Time{})
+}
+
+func TestFile(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 24})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	f, err := NewFile(ctx, node, dserv, "dir/data.txt", modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "data.txt" || fi.Size() != int64(len(inbuf)) || !fi.ModTime().Equal(modTime) || fi.IsDir() || fi.Mode() != 0444 {
+		t.Fatalf("unexpected file info %s %d %s %s", fi.Name(), fi.Size(), fi.ModTime(), fi.Mode())
+	}
+	if nd, ok := fi.Sys().(ipld.Node); !ok || !nd.Cid().Equals(node.Cid()) {
+		t.Fatal("expected the root node from Sys")
+	}
+	clone, err := CloneDagReader(f, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := clone.(*File).Stat(); err != nil || fi.Name() != "data.txt" {
+		t.Fatalf("expected the clone to keep the file info (%v)", err)
+	}
+
+	fsys := &fileFS{ctx: ctx, node: node, serv: dserv}
+	outbuf, err := fs.ReadFile(fsys, "data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(outbuf, inbuf) {
+		t.Fatal("read wrong data")
+	}
+
+	req := httptest.NewRequest("GET", "/data.txt", nil)
+	req.Header.Set("Range", "bytes=5000-5099")
+	rec := httptest.NewRecorder()
+	http.FileServer(http.FS(fsys)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), inbuf[5000:5100]) {
+		t.Fatalf("expected the range, got %d (%d bytes)", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestPipe(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 2000000, LeafSize: 40000, Seed: 25})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	getter := &fetchCounter{NodeGetter: dserv, fetches: make(map[cid.Cid]int)}
+	r, err := Pipe(ctx, node, getter, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched := func() int {
+		getter.lk.Lock()
+		defer getter.lk.Unlock()
+		return len(getter.fetches)
+	}
+
+	// A slow consumer holds back the fetching.
+	start := make([]byte, 10)
+	if _, err := io.ReadFull(r, start); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := fetched(); n > 8 {
+		t.Fatalf("expected a few blocks fetched ahead of the consumer, got %d", n)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(start, rest...), inbuf) {
+		t.Fatal("read wrong data")
+	}
+	if n := fetched(); n != 50 {
+		t.Fatalf("expected the 50 leaves fetched, got %d", n)
+	}
+
+	// Closing the read end stops the stream.
+	r, err = Pipe(ctx, node, dserv, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := r.Read(start); err != io.ErrClosedPipe {
+		t.Fatalf("expected a closed pipe, got %v", err)
+	}
+
+	// Read errors reach the consumer.
+	pipeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	r, err = Pipe(pipeCtx, node, &stallingGetter{NodeGetter: dserv, stall: node.Links()[10].Cid, stalls: -1}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout, got %v", err)
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Depth: 2, LeafSize: 1000, Fanout: 10, Seed: 26})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(reader, make([]byte, 56500)); err != nil {
+		t.Fatal(err)
+	}
+	token, err := reader.(PositionSaver).Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another reader resumes there, fetching the internal node down to
+	// the leaf in one batch and then the leaf.
+	getter := &batchRecorder{NodeGetter: dserv}
+	reader, err = NewDagReader(ctx, node, getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.(PositionSaver).Restore(token); err != nil {
+		t.Fatal(err)
+	}
+	if reader.(OffsetReader).Offset() != 56500 {
+		t.Fatalf("expected to restore 56500, got %d", reader.(OffsetReader).Offset())
+	}
+	out := make([]byte, 10)
+	if _, err := io.ReadFull(reader, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, inbuf[56500:56510]) {
+		t.Fatal("read wrong data")
+	}
+	getter.lk.Lock()
+	if len(getter.batches) != 2 || getter.batches[0] != 1 || getter.batches[1] != 1 {
+		t.Fatalf("expected the internal node and the leaf fetched, got %v", getter.batches)
+	}
+	getter.lk.Unlock()
+
+	// Sections take the tokens of positions inside them.
+	section, err := NewDagReaderSection(ctx, node, dserv, 50000, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := section.(PositionSaver).Restore(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(section, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, inbuf[56500:56510]) {
+		t.Fatal("read wrong data")
+	}
+	if token, err = section.(PositionSaver).Save(); err != nil {
+		t.Fatal(err)
+	}
+	section, err = NewDagReaderSection(ctx, node, dserv, 0, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := section.(PositionSaver).Restore(token); err != ErrInvalidPosition {
+		t.Fatalf("expected an invalid position outside of the section, got %v", err)
+	}
+
+	// Tokens of other files and garbage are rejected.
+	_, other := testu.GenerateFile(t, dserv, testu.FileShape{Size: 100000, LeafSize: 1000, Seed: 27})
+	reader, err = NewDagReader(ctx, other, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.(PositionSaver).Restore(token); err != ErrInvalidPosition {
+		t.Fatalf("expected an invalid position of another file, got %v", err)
+	}
+	reader, err = NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range [][]byte{nil, token[:len(token)-1], append(token, 0)} {
+		if err := reader.(PositionSaver).Restore(token); err != ErrInvalidPosition {
+			t.Fatalf("expected an invalid position, got %v", err)
+		}
+	}
+}
+
+// gatedGetter blocks the first `Get` until `release` is closed, recording
+// the order of the requests.
+type gatedGetter struct {
+	ipld.NodeGetter
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	lk      sync.Mutex
+	order   []cid.Cid
+}
+
+func (gg *gatedGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	gg.lk.Lock()
+	gg.order = append(gg.order, c)
+	gg.lk.Unlock()
+	gg.once.Do(func() {
+		close(gg.started)
+		<-gg.release
+	})
+	return gg.NodeGetter.Get(ctx, c)
+}
+
+func TestFetchScheduler(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	_, big := testu.GenerateFile(t, dserv, testu.FileShape{Size: 50000, LeafSize: 1000, Seed: 28})
+	small := mdag.NewRawNode([]byte("small"))
+	if err := dserv.Add(context.Background(), small); err != nil {
+		t.Fatal(err)
+	}
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	// A small request waits for a single block of the big one.
+	getter := &gatedGetter{NodeGetter: dserv, started: make(chan struct{}), release: make(chan struct{})}
+	sched := NewFetchScheduler(1)
+	bigGetter := newScheduledGetter(getter, sched)
+	smallGetter := newScheduledGetter(getter, sched)
+	var keys []cid.Cid
+	for _, l := range big.Links() {
+		keys = append(keys, l.Cid)
+	}
+	bigResults := bigGetter.GetMany(ctx, keys)
+	<-getter.started
+	smallResults := smallGetter.GetMany(ctx, []cid.Cid{small.Cid()})
+	close(getter.release)
+	if opt := <-smallResults; opt.Err != nil || !opt.Node.Cid().Equals(small.Cid()) {
+		t.Fatalf("expected the small block, got %v", opt.Err)
+	}
+	n := 0
+	for opt := range bigResults {
+		if opt.Err != nil {
+			t.Fatal(opt.Err)
+		}
+		n++
+	}
+	if n != len(keys) {
+		t.Fatalf("expected %d blocks, got %d", len(keys), n)
+	}
+	getter.lk.Lock()
+	if len(getter.order) != len(keys)+1 || !getter.order[2].Equals(small.Cid()) {
+		t.Fatalf("expected the small block requested third, got %d requests", len(getter.order))
+	}
+	getter.lk.Unlock()
+
+	// Readers read through it.
+	opts := DagReaderOptions{Scheduler: NewFetchScheduler(4)}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 20000, LeafSize: 1000, Seed: int64(29 + i)})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := NewDagReaderWithOptions(ctx, node, dserv, opts)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			outbuf, err := io.ReadAll(reader)
+			if err != nil || !bytes.Equal(outbuf, inbuf) {
+				t.Errorf("read wrong data (%v)", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestViewAt(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GenerateFile(t, dserv, testu.FileShape{Size: 10000, LeafSize: 1000, Fanout: 4, Seed: 33, RawLeaves: true})
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader, err := NewDagReaderWithOptions(ctx, node, dserv, DagReaderOptions{Cache: NewBlockCache(1 << 20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := func(r DagReader, off int64, n int, expected []byte, expectedErr error) *View {
+		v, err := ViewAt(ctx, r, off, n)
+		if err != expectedErr {
+			t.Fatalf("expected %v viewing %d bytes at %d, got %v", expectedErr, n, off, err)
+		}
+		if !bytes.Equal(v.Bytes(), expected) {
+			t.Fatalf("wrong view of %d bytes at %d", n, off)
+		}
+		return v
+	}
+
+	// Views within a leaf are the data of the (cached) leaf.
+	v1 := view(reader, 4100, 100, inbuf[4100:4200], nil)
+	v2 := view(reader, 4150, 10, inbuf[4150:4160], nil)
+	if &v1.Bytes()[50] != &v2.Bytes()[0] {
+		t.Fatal("expected views of the same leaf data")
+	}
+	v1.Release()
+	v2.Release()
+	if v1.Bytes() != nil {
+		t.Fatal("expected no data after release")
+	}
+
+	// Across leaves, up to the end of the file.
+	view(reader, 3500, 2000, inbuf[3500:5500], nil).Release()
+	view(reader, 9900, 200, inbuf[9900:], io.EOF).Release()
+	view(reader, 10000, 10, nil, io.EOF).Release()
+	if reader.(OffsetReader).Offset() != 0 {
+		t.Fatal("expected the position not to move")
+	}
+
+	section, err := NewDagReaderSection(ctx, node, dserv, 2000, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view(section, 500, 1000, inbuf[2500:3500], nil).Release()
+	view(section, 2900, 200, inbuf[4900:5000], io.EOF).Release()
+}
+
+func TestInlineLeaves(t *testing.T) {
+	ctx := context.Background()
+	dserv := testu.GetDAGServ()
+
+	// The leaves are inlined in the links of the root, only the root is
+	// stored.
+	root := unixfs.NewFSNode(unixfs.TFile)
+	var expected []byte
+	var links []ipld.Node
+	for _, chunk := range []string{"inline ", "leaves ", "only"} {
+		leaf, err := unixfs.NewInlineLeaf([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, leaf)
+		root.AddBlockSize(uint64(len(chunk)))
+		expected = append(expected, chunk...)
+	}
+	data, err := root.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := mdag.NodeWithData(data)
+	for _, leaf := range links {
+		if err := nd.AddNodeLink("", leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenDagReader(ctx, nd.Cid(), dserv, DagReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+	if stats := Stats(r); stats.Blocks != 1 {
+		t.Fatalf("expected only the root to be fetched, got %d blocks", stats.Blocks)
+	}
+}
@@ -0,0 +1,140 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ChangeType is the kind of a `Change`.
+type ChangeType int
+
+const (
+	// Add is an entry only in the new tree.
+	Add ChangeType = iota
+	// Remove is an entry only in the old tree.
+	Remove
+	// Modify is an entry of different contents in both trees, files or
+	// an entry changing between a file and a directory.
+	Modify
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Add:
+		return "add"
+	case Remove:
+		return "remove"
+	case Modify:
+		return "modify"
+	default:
+		return fmt.Sprintf("ChangeType(%d)", int(t))
+	}
+}
+
+// Change is a difference between two directory trees found by `Diff`.
+type Change struct {
+	Type ChangeType
+	// Path is the path of the entry from the roots of the trees.
+	Path string
+	// Before and After are the entry in the old and the new tree, undefined
+	// for an added and a removed entry respectively.
+	Before cid.Cid
+	After  cid.Cid
+}
+
+// Diff calls `f` with the changes from the directory tree `before` to
+// `after`, basic or sharded, fetching their nodes from `ng`: the entries
+// added and removed (a whole directory as a single change) and the ones
+// modified, recursing into the directories on both sides. The subtrees of
+// the same CID on both sides are skipped without being fetched. The changes
+// of a directory are reported in the order of their names. The walk stops
+// at the first error of `f`, which is returned.
+func Diff(ctx context.Context, ng ipld.NodeGetter, before, after ipld.Node, f func(Change) error) error {
+	d := &differ{ctx: ctx, ng: NewReadOnlyDAGService(ng), f: f}
+	return d.diff(before, after, "")
+}
+
+type differ struct {
+	ctx context.Context
+	ng  ipld.DAGService
+	f   func(Change) error
+}
+
+func (d *differ) entries(nd ipld.Node) (map[string]cid.Cid, error) {
+	dir, err := NewDirectoryFromNode(d.ng, nd)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]cid.Cid)
+	err = dir.ForEachLink(d.ctx, func(l *ipld.Link) error {
+		entries[l.Name] = l.Cid
+		return nil
+	})
+	return entries, err
+}
+
+// diff reports the changes between the directories `before` and `after`
+// at the path `p`.
+func (d *differ) diff(before, after ipld.Node, p string) error {
+	if before.Cid() == after.Cid() {
+		return nil
+	}
+	old, err := d.entries(before)
+	if err != nil {
+		return err
+	}
+	cur, err := d.entries(after)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(old)+len(cur))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, inOld := old[name]
+		a, inCur := cur[name]
+		change := Change{Path: path.Join(p, name), Before: b, After: a}
+		switch {
+		case !inCur:
+			change.Type = Remove
+		case !inOld:
+			change.Type = Add
+		case a == b:
+			continue
+		default:
+			oldNd, err := d.ng.Get(d.ctx, b)
+			if err != nil {
+				return err
+			}
+			newNd, err := d.ng.Get(d.ctx, a)
+			if err != nil {
+				return err
+			}
+			if isDirNode(oldNd) && isDirNode(newNd) {
+				if err := d.diff(oldNd, newNd, change.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			change.Type = Modify
+		}
+		if err := d.f(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/TRON-US/go-unixfs/private/linksize"
 
@@ -82,6 +84,35 @@ type Directory interface {
 
 	// GetCidBuilder returns the CID Builder used.
 	GetCidBuilder() cid.Builder
+
+	// SetModTime sets the modification time recorded in the root node (the
+	// zero time removes it).
+	SetModTime(time.Time) error
+
+	// ModTime returns the modification time of the directory, the zero
+	// time if it has none.
+	ModTime() time.Time
+
+	// SetMode sets the mode recorded in the root node (zero removes it).
+	SetMode(os.FileMode) error
+
+	// Mode returns the mode of the directory, zero if it has none.
+	Mode() os.FileMode
+
+	// SetXattr sets an extended attribute recorded in the root node.
+	SetXattr(name string, value []byte) error
+
+	// RemoveXattr removes an extended attribute of the directory,
+	// `format.ErrNoXattr` if it has none of that name.
+	RemoveXattr(name string) error
+
+	// Xattr returns the value of an extended attribute of the directory,
+	// `format.ErrNoXattr` if it has none of that name.
+	Xattr(name string) ([]byte, error)
+
+	// Xattrs returns the names of the extended attributes of the
+	// directory, sorted.
+	Xattrs() []string
 }
 
 // TODO: Evaluate removing `dserv` from this layer and providing it in MFS.
@@ -98,13 +129,17 @@ func init() {
 }
 
 // BasicDirectory is the basic implementation of `Directory`. All the entries
-// are stored in a single node.
+// are stored in a single node, sorted by name (bytewise, the merkledag
+// encoding sorts the links): the same entries always give the same CID,
+// whatever the order they were added in. (The layout of a `HAMTDirectory`
+// only depends on its entries too.)
 type BasicDirectory struct {
 	node  *mdag.ProtoNode
 	dserv ipld.DAGService
 
 	// Internal variable used to cache the estimated size of the basic directory:
-	// for each link, aggregate link name + link CID. DO NOT CHANGE THIS
+	// for each link, aggregate link name + link CID, plus the attributes
+	// recorded for the entries (see `SetEntryAttributes`). DO NOT CHANGE THIS
 	// as it will affect the HAMT transition behavior in HAMTShardingSize.
 	// (We maintain this value up to date even if the HAMTShardingSize is off
 	// since potentially the option could be activated on the fly.)
@@ -154,12 +189,12 @@ func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, err
 		return nil, ErrNotADir
 	}
 
-	fsNode, err := format.FSNodeFromBytes(protoBufNode.Data())
+	typ, err := format.DataType(protoBufNode.Data())
 	if err != nil {
 		return nil, err
 	}
 
-	switch fsNode.Type() {
+	switch typ {
 	case format.TDirectory:
 		return &DynamicDirectory{newBasicDirectoryFromNode(dserv, protoBufNode.Copy().(*mdag.ProtoNode))}, nil
 	case format.THAMTShard:
@@ -173,6 +208,193 @@ func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, err
 	return nil, ErrNotADir
 }
 
+// Mkdir adds an empty directory named `name` to `dir` (with the CID builder
+// of `dir`), storing it in `dserv`, and returns it. It returns
+// `os.ErrExist` if `dir` already has an entry of that name. Editing the
+// returned directory doesn't change `dir`: its new root (see `GetNode`)
+// must be added again with `AddChild`, as for any child.
+func Mkdir(ctx context.Context, dserv ipld.DAGService, dir Directory, name string) (Directory, error) {
+	_, err := dir.Find(ctx, name)
+	switch {
+	case err == nil:
+		return nil, os.ErrExist
+	case err != os.ErrNotExist:
+		return nil, err
+	}
+
+	child := NewDirectory(dserv)
+	child.SetCidBuilder(dir.GetCidBuilder())
+	nd, err := child.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	if err := dir.AddChild(ctx, name, nd); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// EnsurePath creates the directories of the path `p` (slash separated)
+// missing under the directory `root`, basic or sharded, as `mkdir -p` does,
+// and returns the new root, adding the directories edited (and created,
+// with the CID builder of their parent) to `dserv`. Empty and "." segments
+// are skipped, ".." isn't supported. It returns `root` itself if the whole
+// path exists already, and fails with `ErrNotADir` if an entry of the path
+// is not a directory (symlinks aren't followed).
+func EnsurePath(ctx context.Context, dserv ipld.DAGService, root ipld.Node, p string) (ipld.Node, error) {
+	var names []string
+	for _, name := range strings.Split(p, "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			return nil, fmt.Errorf("%s: unsupported \"..\" segment", p)
+		}
+		names = append(names, name)
+	}
+
+	dir, err := NewDirectoryFromNode(dserv, root)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := ensurePath(ctx, dserv, dir, names, nil)
+	if err != nil || !changed {
+		return root, err
+	}
+	nd, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// ensurePath creates the directories `names` missing under `dir`, reached
+// by the path `parents`, and reports whether it was edited.
+func ensurePath(ctx context.Context, dserv ipld.DAGService, dir Directory, names, parents []string) (bool, error) {
+	if len(names) == 0 {
+		return false, nil
+	}
+	parents = append(parents, names[0])
+
+	var sub Directory
+	child, err := dir.Find(ctx, names[0])
+	switch {
+	case err == os.ErrNotExist:
+		sub = NewDirectory(dserv)
+		sub.SetCidBuilder(dir.GetCidBuilder())
+	case err != nil:
+		return false, err
+	default:
+		sub, err = NewDirectoryFromNode(dserv, child)
+		if err == ErrNotADir {
+			return false, fmt.Errorf("/%s: %w", strings.Join(parents, "/"), err)
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	changed, err := ensurePath(ctx, dserv, sub, names[1:], parents)
+	if err != nil || (child != nil && !changed) {
+		return false, err
+	}
+	nd, err := sub.GetNode()
+	if err != nil {
+		return false, err
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		return false, err
+	}
+	return true, dir.AddChild(ctx, names[0], nd)
+}
+
+// Rename moves the entry `oldName` of `dir` to `newName`, replacing the
+// entry of that name if there is one (as `os.Rename` does). It returns
+// `os.ErrNotExist` if `dir` has no entry `oldName`. In a sharded directory
+// the entry moves to the bucket of its new name. The attributes recorded for
+// the entry (see `SetEntryAttributes`) move with it.
+func Rename(ctx context.Context, dir Directory, oldName, newName string) error {
+	nd, err := dir.Find(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+	attrs, err := GetEntryAttributes(ctx, dir, oldName)
+	hasAttrs := err == nil
+	if err != nil && err != ErrNoEntryAttributes {
+		return err
+	}
+	// Added first so a failure doesn't lose the entry.
+	if err := dir.AddChild(ctx, newName, nd); err != nil {
+		return err
+	}
+	if err := dir.RemoveChild(ctx, oldName); err != nil {
+		return err
+	}
+	if hasAttrs {
+		return setEntryAttributes(ctx, dir, newName, attrs)
+	}
+	return nil
+}
+
+// RemoveRecursive removes the entry `name` of `dir` and returns the keys of
+// the subtree it was the root of that the other entries of `dir` don't
+// reference (all of them are walked), fetching the nodes from `dserv`: the
+// blocks the caller can unpin or collect, unless they are referenced from
+// outside of `dir`. The keys inlining their block (see `unixfs.IsInline`)
+// aren't returned, nor is the previous root of `dir`. It returns
+// `os.ErrNotExist` if `dir` has no entry `name`.
+func RemoveRecursive(ctx context.Context, dserv ipld.DAGService, dir Directory, name string) (*cid.Set, error) {
+	child, err := dir.Find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	getLinks := mdag.GetLinksWithDAG(format.InlineGetter(dserv))
+	orphans := cid.NewSet()
+	if err := mdag.Walk(ctx, getLinks, child.Cid(), orphans.Visit); err != nil {
+		return nil, err
+	}
+	if err := dir.RemoveChild(ctx, name); err != nil {
+		return nil, err
+	}
+
+	// The keys still referenced, under the other entries.
+	root, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	referenced := cid.NewSet()
+	for _, l := range root.Links() {
+		if orphans.Len() == 0 {
+			break
+		}
+		err := mdag.Walk(ctx, getLinks, l.Cid, func(c cid.Cid) bool {
+			if !referenced.Visit(c) {
+				return false
+			}
+			orphans.Remove(c)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	_ = orphans.ForEach(func(c cid.Cid) error {
+		if format.IsInline(c) {
+			orphans.Remove(c)
+		}
+		return nil
+	})
+	return orphans, nil
+}
+
 func (d *BasicDirectory) computeEstimatedSize() {
 	d.estimatedSize = 0
 	// err is just breaking the iteration and we always return nil
@@ -182,6 +404,10 @@ func (d *BasicDirectory) computeEstimatedSize() {
 	})
 	// ForEachLink will never fail traversing the BasicDirectory
 	// and neither the inner callback `addToEstimatedSize`.
+	_ = d.forEachEntryAttributes(context.TODO(), func(name string, value []byte) error {
+		d.estimatedSize += entryAttributesSize(name, value)
+		return nil
+	})
 }
 
 func (d *BasicDirectory) addToEstimatedSize(name string, linkCid cid.Cid) {
@@ -204,7 +430,8 @@ func (d *BasicDirectory) SetCidBuilder(builder cid.Builder) {
 }
 
 // AddChild implements the `Directory` interface. It adds (or replaces)
-// a link to the given `node` under `name`.
+// a link to the given `node` under `name`, dropping the attributes recorded
+// for a replaced entry (see `SetEntryAttributes`).
 func (d *BasicDirectory) AddChild(ctx context.Context, name string, node ipld.Node) error {
 	link, err := ipld.MakeLink(node)
 	if err != nil {
@@ -317,6 +544,9 @@ func (d *BasicDirectory) RemoveChild(ctx context.Context, name string) error {
 
 	// The name actually existed so we should update the estimated size.
 	d.removeFromEstimatedSize(link.Name, link.Cid)
+	if err := d.setEntryAttributes(ctx, name, nil); err != nil {
+		return err
+	}
 
 	return d.node.RemoveNodeLink(name)
 	// GetNodeLink didn't return ErrLinkNotFound so this won't fail with that
@@ -333,6 +563,93 @@ func (d *BasicDirectory) GetCidBuilder() cid.Builder {
 	return d.node.CidBuilder()
 }
 
+// SetModTime implements the `Directory` interface.
+func (d *BasicDirectory) SetModTime(t time.Time) error {
+	if t.Equal(d.ModTime()) {
+		return nil
+	}
+	data, err := format.DataWithModTime(d.node.Data(), t)
+	if err != nil {
+		return err
+	}
+	d.node.SetData(data)
+	return nil
+}
+
+// ModTime implements the `Directory` interface.
+func (d *BasicDirectory) ModTime() time.Time {
+	fsn, err := format.FSNodeFromBytes(d.node.Data())
+	if err != nil {
+		return time.Time{}
+	}
+	return fsn.ModTime()
+}
+
+// SetMode implements the `Directory` interface.
+func (d *BasicDirectory) SetMode(m os.FileMode) error {
+	if m == d.Mode() {
+		return nil
+	}
+	data, err := format.DataWithMode(d.node.Data(), m)
+	if err != nil {
+		return err
+	}
+	d.node.SetData(data)
+	return nil
+}
+
+// Mode implements the `Directory` interface.
+func (d *BasicDirectory) Mode() os.FileMode {
+	fsn, err := format.FSNodeFromBytes(d.node.Data())
+	if err != nil {
+		return 0
+	}
+	return fsn.Mode()
+}
+
+// SetXattr implements the `Directory` interface.
+func (d *BasicDirectory) SetXattr(name string, value []byte) error {
+	return format.SetXattr(d.node, name, value)
+}
+
+// RemoveXattr implements the `Directory` interface.
+func (d *BasicDirectory) RemoveXattr(name string) error {
+	return format.RemoveXattr(d.node, name)
+}
+
+// Xattr implements the `Directory` interface.
+func (d *BasicDirectory) Xattr(name string) ([]byte, error) {
+	return format.GetXattr(d.node, name)
+}
+
+// Xattrs implements the `Directory` interface.
+func (d *BasicDirectory) Xattrs() []string {
+	names, err := format.ListXattrs(d.node)
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// copyXattrs sets the extended attributes of `from` on `to`, when switching
+// implementations.
+func copyXattrs(from, to Directory) error {
+	for _, name := range from.Xattrs() {
+		if strings.HasPrefix(name, EntryXattrPrefix) {
+			// Moved along with the links, see `copyEntryAttributes`.
+			continue
+		}
+		value, err := from.Xattr(name)
+		if err != nil {
+			return err
+		}
+		if err := to.SetXattr(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // switchToSharding returns a HAMT implementation of this directory.
 func (d *BasicDirectory) switchToSharding(ctx context.Context) (*HAMTDirectory, error) {
 	hamtDir := new(HAMTDirectory)
@@ -343,7 +660,12 @@ func (d *BasicDirectory) switchToSharding(ctx context.Context) (*HAMTDirectory,
 		return nil, err
 	}
 	shard.SetCidBuilder(d.node.CidBuilder())
+	shard.SetModTime(d.ModTime())
+	shard.SetMode(d.Mode())
 	hamtDir.shard = shard
+	if err := copyXattrs(d, hamtDir); err != nil {
+		return nil, err
+	}
 
 	for _, lnk := range d.node.Links() {
 		err = hamtDir.shard.SetLink(ctx, lnk.Name, lnk)
@@ -351,6 +673,9 @@ func (d *BasicDirectory) switchToSharding(ctx context.Context) (*HAMTDirectory,
 			return nil, err
 		}
 	}
+	if err := copyEntryAttributes(ctx, d, hamtDir); err != nil {
+		return nil, err
+	}
 
 	return hamtDir, nil
 }
@@ -360,8 +685,13 @@ func (d *HAMTDirectory) SetCidBuilder(builder cid.Builder) {
 	d.shard.SetCidBuilder(builder)
 }
 
-// AddChild implements the `Directory` interface.
+// AddChild implements the `Directory` interface. The attributes recorded
+// for a replaced entry are dropped (see `SetEntryAttributes`).
 func (d *HAMTDirectory) AddChild(ctx context.Context, name string, nd ipld.Node) error {
+	oldAttrs, err := d.shard.EntryAttributes(ctx, name)
+	if err != nil && err != os.ErrNotExist {
+		return err
+	}
 	oldChild, err := d.shard.Swap(ctx, name, nd)
 	if err != nil {
 		return err
@@ -369,6 +699,7 @@ func (d *HAMTDirectory) AddChild(ctx context.Context, name string, nd ipld.Node)
 
 	if oldChild != nil {
 		d.removeFromSizeChange(oldChild.Name, oldChild.Cid)
+		d.sizeChange -= entryAttributesSize(name, oldAttrs)
 	}
 	d.addToSizeChange(name, nd.Cid())
 	return nil
@@ -402,6 +733,10 @@ func (d *HAMTDirectory) Find(ctx context.Context, name string) (ipld.Node, error
 
 // RemoveChild implements the `Directory` interface.
 func (d *HAMTDirectory) RemoveChild(ctx context.Context, name string) error {
+	oldAttrs, err := d.shard.EntryAttributes(ctx, name)
+	if err != nil {
+		return err
+	}
 	oldChild, err := d.shard.Take(ctx, name)
 	if err != nil {
 		return err
@@ -409,6 +744,7 @@ func (d *HAMTDirectory) RemoveChild(ctx context.Context, name string) error {
 
 	if oldChild != nil {
 		d.removeFromSizeChange(oldChild.Name, oldChild.Cid)
+		d.sizeChange -= entryAttributesSize(name, oldAttrs)
 	}
 
 	return nil
@@ -424,10 +760,69 @@ func (d *HAMTDirectory) GetCidBuilder() cid.Builder {
 	return d.shard.CidBuilder()
 }
 
+// SetModTime implements the `Directory` interface.
+func (d *HAMTDirectory) SetModTime(t time.Time) error {
+	d.shard.SetModTime(t)
+	return nil
+}
+
+// ModTime implements the `Directory` interface.
+func (d *HAMTDirectory) ModTime() time.Time {
+	return d.shard.ModTime()
+}
+
+// SetMode implements the `Directory` interface.
+func (d *HAMTDirectory) SetMode(m os.FileMode) error {
+	d.shard.SetMode(m)
+	return nil
+}
+
+// Mode implements the `Directory` interface.
+func (d *HAMTDirectory) Mode() os.FileMode {
+	return d.shard.Mode()
+}
+
+// SetXattr implements the `Directory` interface.
+func (d *HAMTDirectory) SetXattr(name string, value []byte) error {
+	d.shard.SetXattr(name, value)
+	return nil
+}
+
+// RemoveXattr implements the `Directory` interface.
+func (d *HAMTDirectory) RemoveXattr(name string) error {
+	if !d.shard.RemoveXattr(name) {
+		return format.ErrNoXattr
+	}
+	return nil
+}
+
+// Xattr implements the `Directory` interface.
+func (d *HAMTDirectory) Xattr(name string) ([]byte, error) {
+	value, ok := d.shard.Xattr(name)
+	if !ok {
+		return nil, format.ErrNoXattr
+	}
+	return value, nil
+}
+
+// Xattrs implements the `Directory` interface.
+func (d *HAMTDirectory) Xattrs() []string {
+	return d.shard.Xattrs()
+}
+
 // switchToBasic returns a BasicDirectory implementation of this directory.
 func (d *HAMTDirectory) switchToBasic(ctx context.Context) (*BasicDirectory, error) {
 	basicDir := newEmptyBasicDirectory(d.dserv)
 	basicDir.SetCidBuilder(d.GetCidBuilder())
+	if err := basicDir.SetModTime(d.ModTime()); err != nil {
+		return nil, err
+	}
+	if err := basicDir.SetMode(d.Mode()); err != nil {
+		return nil, err
+	}
+	if err := copyXattrs(d, basicDir); err != nil {
+		return nil, err
+	}
 
 	err := d.ForEachLink(ctx, func(lnk *ipld.Link) error {
 		err := basicDir.addLinkChild(ctx, lnk.Name, lnk)
@@ -445,6 +840,9 @@ func (d *HAMTDirectory) switchToBasic(ctx context.Context) (*BasicDirectory, err
 	if err != nil {
 		return nil, err
 	}
+	if err := copyEntryAttributes(ctx, d, basicDir); err != nil {
+		return nil, err
+	}
 
 	return basicDir, nil
 }
@@ -510,11 +908,17 @@ func (d *HAMTDirectory) sizeBelowThreshold(ctx context.Context, sizeChange int)
 	// end early if we already know we're above the threshold or run out of time.
 	partialSize := 0
 
-	// We stop the enumeration once we have enough information and exit this function.
+	// We stop the enumeration once we have enough information and exit this
+	// function, waiting for it to end as the shard is modified afterwards.
 	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	linkResults := d.EnumLinksAsync(ctx)
+	defer func() {
+		cancel()
+		for range linkResults {
+		}
+	}()
 
-	for linkResult := range d.EnumLinksAsync(ctx) {
+	for linkResult := range linkResults {
 		if linkResult.Err != nil {
 			return false, linkResult.Err
 		}
@@ -527,8 +931,16 @@ func (d *HAMTDirectory) sizeBelowThreshold(ctx context.Context, sizeChange int)
 		}
 	}
 
-	// We enumerated *all* links in all shards and didn't reach the threshold.
-	return true, nil
+	// We enumerated *all* links in all shards, count the attributes of the
+	// entries too (see `SetEntryAttributes`).
+	err = d.forEachEntryAttributes(ctx, func(name string, value []byte) error {
+		partialSize += entryAttributesSize(name, value)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return partialSize+sizeChange < HAMTShardingSize, nil
 }
 
 // DynamicDirectory wraps a Directory interface and provides extra logic
@@ -2,8 +2,12 @@ package io
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,6 +29,7 @@ import (
 	ft "github.com/TRON-US/go-unixfs"
 	"github.com/TRON-US/go-unixfs/hamt"
 	"github.com/TRON-US/go-unixfs/internal"
+	pb "github.com/TRON-US/go-unixfs/pb"
 	"github.com/TRON-US/go-unixfs/private/linksize"
 
 	"github.com/stretchr/testify/assert"
@@ -316,6 +321,426 @@ func TestIntegrityOfDirectorySwitch(t *testing.T) {
 	compareDirectoryEntries(t, hamtDir, hamtDirFromSwitch)
 }
 
+func TestDirectoryAttributes(t *testing.T) {
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	child := ft.EmptyDirNode()
+	err := ds.Add(ctx, child)
+	assert.NoError(t, err)
+	mtime := time.Unix(1600000000, 500)
+	mode := os.FileMode(0750) | os.ModeSetgid
+
+	basicDir := newEmptyBasicDirectory(ds)
+	assert.NoError(t, basicDir.AddChild(ctx, "child", child))
+	assert.NoError(t, basicDir.SetModTime(mtime))
+	assert.NoError(t, basicDir.SetMode(mode))
+	assert.NoError(t, basicDir.SetXattr("user.tag", []byte("value")))
+	assert.True(t, basicDir.ModTime().Equal(mtime))
+	assert.Equal(t, mode, basicDir.Mode())
+	checkXattrs := func(dir Directory) {
+		t.Helper()
+		assert.Equal(t, []string{"user.tag"}, dir.Xattrs())
+		value, err := dir.Xattr("user.tag")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("value"), value)
+	}
+	checkXattrs(basicDir)
+
+	// The attributes survive the switches and reloading the nodes.
+	hamtDir, err := basicDir.switchToSharding(ctx)
+	assert.NoError(t, err)
+	assert.True(t, hamtDir.ModTime().Equal(mtime))
+	assert.Equal(t, mode, hamtDir.Mode())
+	checkXattrs(hamtDir)
+	nd, err := hamtDir.GetNode()
+	assert.NoError(t, err)
+	dir, err := NewDirectoryFromNode(ds, nd)
+	assert.NoError(t, err)
+	assert.True(t, dir.ModTime().Equal(mtime))
+	assert.Equal(t, mode, dir.Mode())
+	checkXattrs(dir)
+
+	basicDir, err = hamtDir.switchToBasic(ctx)
+	assert.NoError(t, err)
+	nd, err = basicDir.GetNode()
+	assert.NoError(t, err)
+	dir, err = NewDirectoryFromNode(ds, nd)
+	assert.NoError(t, err)
+	assert.True(t, dir.ModTime().Equal(mtime))
+	assert.Equal(t, mode, dir.Mode())
+	checkXattrs(dir)
+
+	assert.NoError(t, dir.SetModTime(time.Time{}))
+	assert.NoError(t, dir.SetMode(0))
+	assert.NoError(t, dir.RemoveXattr("user.tag"))
+	assert.Equal(t, ft.ErrNoXattr, dir.RemoveXattr("user.tag"))
+	assert.True(t, dir.ModTime().IsZero())
+	assert.Zero(t, dir.Mode())
+	assert.Empty(t, dir.Xattrs())
+}
+
+func TestDirectoryInsertionOrder(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+	assert.NoError(t, ds.Add(ctx, file))
+	// Names whose bytewise order differs from the insertion one.
+	names := []string{"b", "a", "B", "\u00e9", "e", "a0", "_", "10", "9"}
+	for i := 0; i < 30; i++ {
+		names = append(names, fmt.Sprintf("entry %d", 29-i))
+	}
+
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		var expected cid.Cid
+		for try := 0; try < 3; try++ {
+			dir := NewDirectory(ds)
+			for _, i := range rand.Perm(len(names)) {
+				assert.NoError(t, dir.AddChild(ctx, names[i], file))
+			}
+			nd, err := dir.GetNode()
+			assert.NoError(t, err)
+			if !expected.Defined() {
+				expected = nd.Cid()
+			}
+			assert.Equal(t, expected, nd.Cid())
+
+			if !sharded {
+				decoded, err := mdag.DecodeProtobuf(nd.RawData())
+				assert.NoError(t, err)
+				stored := make([]string, 0, len(names))
+				for _, l := range decoded.Links() {
+					stored = append(stored, l.Name)
+				}
+				assert.True(t, sort.StringsAreSorted(stored), "expected the links sorted: %q", stored)
+			}
+		}
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+	assert.NoError(t, ds.Add(ctx, file))
+
+	basicDir := newEmptyBasicDirectory(ds)
+	basicDir.SetCidBuilder(mdag.V1CidPrefix())
+	hamtDir, err := newEmptyBasicDirectory(ds).switchToSharding(ctx)
+	assert.NoError(t, err)
+	for _, dir := range []Directory{basicDir, hamtDir} {
+		sub, err := Mkdir(ctx, ds, dir, "sub")
+		assert.NoError(t, err)
+		assert.Equal(t, dir.GetCidBuilder(), sub.GetCidBuilder())
+		_, err = Mkdir(ctx, ds, dir, "sub")
+		assert.Equal(t, os.ErrExist, err)
+
+		// The edits of the child are added back to the parent.
+		assert.NoError(t, sub.AddChild(ctx, "file", file))
+		subNode, err := sub.GetNode()
+		assert.NoError(t, err)
+		assert.NoError(t, ds.Add(ctx, subNode))
+		assert.NoError(t, dir.AddChild(ctx, "sub", subNode))
+
+		found, err := dir.Find(ctx, "sub")
+		assert.NoError(t, err)
+		reloaded, err := NewDirectoryFromNode(ds, found)
+		assert.NoError(t, err)
+		_, err = reloaded.Find(ctx, "file")
+		assert.NoError(t, err)
+
+		assert.NoError(t, dir.RemoveChild(ctx, "sub"))
+		_, err = dir.Find(ctx, "sub")
+		assert.Equal(t, os.ErrNotExist, err)
+	}
+}
+
+func TestEnsurePath(t *testing.T) {
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+	assert.NoError(t, ds.Add(ctx, file))
+
+	basicDir := newEmptyBasicDirectory(ds)
+	basicDir.SetCidBuilder(mdag.V1CidPrefix())
+	hamtDir, err := newEmptyBasicDirectory(ds).switchToSharding(ctx)
+	assert.NoError(t, err)
+	for _, dir := range []Directory{basicDir, hamtDir} {
+		assert.NoError(t, dir.AddChild(ctx, "file", file))
+		root, err := dir.GetNode()
+		assert.NoError(t, err)
+		assert.NoError(t, ds.Add(ctx, root))
+
+		root, err = EnsurePath(ctx, ds, root, "/a/b/./c/")
+		assert.NoError(t, err)
+		nd, err := Resolve(ctx, ds, root, "a/b/c")
+		assert.NoError(t, err)
+		assert.Equal(t, root.Cid().Version(), nd.Cid().Version())
+		_, err = NewDirectoryFromNode(ds, nd)
+		assert.NoError(t, err)
+		_, err = Resolve(ctx, ds, root, "file")
+		assert.NoError(t, err)
+
+		// Existing paths are kept, the missing parts added.
+		same, err := EnsurePath(ctx, ds, root, "a/b")
+		assert.NoError(t, err)
+		assert.Equal(t, root.Cid(), same.Cid())
+		root, err = EnsurePath(ctx, ds, root, "a/d")
+		assert.NoError(t, err)
+		_, err = Resolve(ctx, ds, root, "a/b/c")
+		assert.NoError(t, err)
+		_, err = Resolve(ctx, ds, root, "a/d")
+		assert.NoError(t, err)
+
+		_, err = EnsurePath(ctx, ds, root, "file/a")
+		assert.True(t, errors.Is(err, ErrNotADir))
+		_, err = EnsurePath(ctx, ds, root, "a/../b")
+		assert.Error(t, err)
+	}
+}
+
+func TestEntryAttributes(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	mtime := time.Unix(1600000000, 42)
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+		assert.NoError(t, ds.Add(ctx, file))
+		dir := NewDirectory(ds)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, dir.AddChild(ctx, fmt.Sprintf("file-%d", i), file))
+		}
+		sub, err := Mkdir(ctx, ds, dir, "sub")
+		assert.NoError(t, err)
+		if sharded {
+			checkHAMTDirectory(t, dir, "expected a sharded directory")
+		}
+
+		assert.NoError(t, SetEntryAttributes(ctx, dir, "file-0", 0644, mtime))
+		assert.NoError(t, SetEntryAttributes(ctx, dir, "file-1", 0600|os.ModeSetuid, time.Time{}))
+		assert.NoError(t, SetEntryAttributes(ctx, dir, "sub", os.ModePerm, mtime))
+		assert.Equal(t, os.ErrNotExist, SetEntryAttributes(ctx, dir, "missing", 0644, mtime))
+		expected := map[string]EntryAttributes{
+			"file-0": {Type: ft.TFile, Size: 4, Mode: 0644, ModTime: mtime},
+			"file-1": {Type: ft.TFile, Size: 4, Mode: 0600 | os.ModeSetuid},
+			"sub":    {Type: ft.TDirectory, Mode: os.ModePerm, ModTime: mtime},
+		}
+		attrs, err := GetEntryAttributes(ctx, dir, "sub")
+		assert.NoError(t, err)
+		assert.Equal(t, expected["sub"], attrs)
+		_, err = GetEntryAttributes(ctx, dir, "file-2")
+		assert.Equal(t, ErrNoEntryAttributes, err)
+		// The attributes of the children aren't changed.
+		assert.Equal(t, os.FileMode(0), sub.Mode())
+
+		// The listing only needs the nodes of the directory, not the
+		// entries.
+		nd, err := dir.GetNode()
+		assert.NoError(t, err)
+		nodes := mdtest.Mock()
+		var copyShards func(nd ipld.Node)
+		copyShards = func(nd ipld.Node) {
+			assert.NoError(t, nodes.Add(ctx, nd))
+			for _, l := range nd.Links() {
+				child, err := ds.Get(ctx, l.Cid)
+				assert.NoError(t, err)
+				if typ, _ := ft.NodeType(child); typ == ft.THAMTShard {
+					copyShards(child)
+				}
+			}
+		}
+		copyShards(nd)
+		reloaded, err := NewDirectoryFromNode(nodes, nd)
+		assert.NoError(t, err)
+		listed, err := ListEntryAttributes(ctx, reloaded)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, listed)
+
+		// Renamed entries keep their attributes, replaced and removed ones
+		// lose them.
+		assert.NoError(t, Rename(ctx, dir, "file-0", "renamed"))
+		assert.NoError(t, dir.AddChild(ctx, "file-1", file))
+		assert.NoError(t, dir.RemoveChild(ctx, "sub"))
+		listed, err = ListEntryAttributes(ctx, dir)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]EntryAttributes{"renamed": expected["file-0"]}, listed)
+	}
+}
+
+func TestEntryAttributesSharding(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+	linksize.LinkSizeFunction = mockLinkSizeFunc(1)
+	defer func() { linksize.LinkSizeFunction = productionLinkSize }()
+
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+	assert.NoError(t, ds.Add(ctx, file))
+	mtime := time.Unix(1600000000, 0)
+
+	// The attributes count towards the sharding threshold.
+	HAMTShardingSize = 1000
+	dir := NewDirectory(ds)
+	const entries = 2000
+	for i := 0; i < entries; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		if i < 100 {
+			assert.NoError(t, dir.AddChild(ctx, name, file))
+			assert.NoError(t, SetEntryAttributes(ctx, dir, name, 0644, mtime))
+			continue
+		}
+		if i == 100 {
+			checkHAMTDirectory(t, dir, "expected the attributes to shard the directory")
+		}
+		assert.NoError(t, dir.AddChild(ctx, name, file))
+		assert.NoError(t, SetEntryAttributes(ctx, dir, name, 0644, mtime))
+	}
+
+	// The root shard only holds the attributes of its own links.
+	nd, err := dir.GetNode()
+	assert.NoError(t, err)
+	fsn, err := ft.FSNodeFromBytes(nd.(*mdag.ProtoNode).Data())
+	assert.NoError(t, err)
+	assert.Less(t, len(fsn.Xattrs()), entries/10)
+
+	reloaded, err := NewDirectoryFromNode(ds, nd)
+	assert.NoError(t, err)
+	listed, err := ListEntryAttributes(ctx, reloaded)
+	assert.NoError(t, err)
+	assert.Equal(t, entries, len(listed))
+	assert.Equal(t, EntryAttributes{Type: ft.TFile, Size: 4, Mode: 0644, ModTime: mtime}, listed["file-1234"])
+
+	// Switching back keeps them.
+	for i := 10; i < entries; i++ {
+		assert.NoError(t, reloaded.RemoveChild(ctx, fmt.Sprintf("file-%d", i)))
+	}
+	checkBasicDirectory(t, reloaded, "expected the directory to be switched back")
+	listed, err = ListEntryAttributes(ctx, reloaded)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(listed))
+}
+
+func TestRename(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		dir := NewDirectory(ds)
+		expected := NewDirectory(ds)
+		var files []ipld.Node
+		for i := 0; i < 50; i++ {
+			file := mdag.NodeWithData(ft.FilePBData([]byte(fmt.Sprintf("file %d", i)), 6))
+			assert.NoError(t, ds.Add(ctx, file))
+			files = append(files, file)
+			assert.NoError(t, dir.AddChild(ctx, fmt.Sprintf("old-%d", i), file))
+			assert.NoError(t, expected.AddChild(ctx, fmt.Sprintf("new-%d", i), file))
+		}
+		if sharded {
+			checkHAMTDirectory(t, dir, "expected a sharded directory")
+		}
+
+		for i := range files {
+			assert.NoError(t, Rename(ctx, dir, fmt.Sprintf("old-%d", i), fmt.Sprintf("new-%d", i)))
+		}
+		nd, err := dir.GetNode()
+		assert.NoError(t, err)
+		expectedNd, err := expected.GetNode()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedNd.Cid(), nd.Cid())
+
+		// Renaming over an entry replaces it.
+		assert.NoError(t, Rename(ctx, dir, "new-0", "new-1"))
+		found, err := dir.Find(ctx, "new-1")
+		assert.NoError(t, err)
+		assert.Equal(t, files[0].Cid(), found.Cid())
+		_, err = dir.Find(ctx, "new-0")
+		assert.Equal(t, os.ErrNotExist, err)
+
+		assert.NoError(t, Rename(ctx, dir, "new-2", "new-2"))
+		assert.Equal(t, os.ErrNotExist, Rename(ctx, dir, "missing", "other"))
+	}
+}
+
+func TestRemoveRecursive(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		add := func(nd ipld.Node) ipld.Node {
+			assert.NoError(t, ds.Add(ctx, nd))
+			return nd
+		}
+
+		shared := add(mdag.NewRawNode([]byte("shared")))
+		inline, err := ft.NewInlineLeaf([]byte("inline"))
+		assert.NoError(t, err)
+		exclusive := cid.NewSet()
+		sub := NewDirectory(ds)
+		for i := 0; i < 10; i++ {
+			file := add(mdag.NodeWithData(ft.FilePBData([]byte(fmt.Sprintf("file %d", i)), 6)))
+			exclusive.Add(file.Cid())
+			assert.NoError(t, sub.AddChild(ctx, fmt.Sprintf("file-%d", i), file))
+		}
+		assert.NoError(t, sub.AddChild(ctx, "shared", shared))
+		assert.NoError(t, sub.AddChild(ctx, "inline", inline))
+		subNd, err := sub.GetNode()
+		assert.NoError(t, err)
+		add(subNd)
+		exclusive.Add(subNd.Cid())
+
+		dir := NewDirectory(ds)
+		assert.NoError(t, dir.AddChild(ctx, "sub", subNd))
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, dir.AddChild(ctx, fmt.Sprintf("other-%d", i), shared))
+		}
+		if sharded {
+			checkHAMTDirectory(t, dir, "expected a sharded directory")
+		}
+		root, err := dir.GetNode()
+		assert.NoError(t, err)
+		add(root)
+
+		orphans, err := RemoveRecursive(ctx, ds, dir, "sub")
+		assert.NoError(t, err)
+		assert.Equal(t, exclusive.Len(), orphans.Len())
+		assert.NoError(t, exclusive.ForEach(func(c cid.Cid) error {
+			assert.True(t, orphans.Has(c), "expected %s to be orphaned", c)
+			return nil
+		}))
+		_, err = dir.Find(ctx, "sub")
+		assert.Equal(t, os.ErrNotExist, err)
+
+		_, err = RemoveRecursive(ctx, ds, dir, "sub")
+		assert.Equal(t, os.ErrNotExist, err)
+	}
+}
+
 // This is the value of concurrent fetches during dag.Walk. Used in
 // test to better predict how many nodes will be fetched.
 var defaultConcurrentFetch = 32
@@ -636,3 +1061,382 @@ func (d *countGetsDS) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
 	}
 	return d.Blockstore.AllKeysChan(ctx)
 }
+
+func TestDirectoryReader(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		dir := NewDirectory(ds)
+		child := ft.EmptyDirNode()
+		assert.NoError(t, ds.Add(ctx, child))
+		expected := make([]string, 100)
+		for i := range expected {
+			expected[i] = fmt.Sprintf("entry-%03d", i)
+			assert.NoError(t, dir.AddChild(ctx, expected[i], child))
+		}
+		if sharded {
+			checkHAMTDirectory(t, dir, "expected a sharded directory")
+		}
+
+		// Page through the entries.
+		r := NewDirectoryReader(ctx, dir)
+		var names []string
+		for {
+			links, err := r.ReadLinks(30)
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(links), 30)
+			for _, l := range links {
+				names = append(names, l.Name)
+			}
+		}
+		sort.Strings(names)
+		assert.Equal(t, expected, names)
+
+		// Stop halfway.
+		r = NewDirectoryReader(ctx, dir)
+		for i := 0; i < 50; i++ {
+			assert.True(t, r.Next())
+			assert.NotNil(t, r.Link())
+		}
+		assert.NoError(t, r.Close())
+		assert.NoError(t, r.Err())
+	}
+}
+
+func TestForEachEntry(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		dir := NewDirectory(ds)
+		subdir := ft.EmptyDirNode()
+		file := mdag.NodeWithData(ft.FilePBData([]byte("data"), 4))
+		raw := mdag.NewRawNode([]byte("raw"))
+		for _, nd := range []ipld.Node{subdir, file, raw} {
+			assert.NoError(t, ds.Add(ctx, nd))
+		}
+		expected := make(map[string]pb.Data_DataType)
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("entry-%03d", i)
+			nd, typ := ipld.Node(file), ft.TFile
+			switch i % 3 {
+			case 1:
+				nd, typ = subdir, ft.TDirectory
+			case 2:
+				nd, typ = raw, ft.TRaw
+			}
+			assert.NoError(t, dir.AddChild(ctx, name, nd))
+			expected[name] = typ
+		}
+
+		entries := make(map[string]pb.Data_DataType)
+		err := ForEachEntry(ctx, dir, ds, func(e DirEntry) error {
+			assert.NotZero(t, e.Size)
+			entries[e.Name] = e.Type
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, entries)
+
+		stop := errors.New("stop")
+		count := 0
+		err = ForEachEntry(ctx, dir, ds, func(DirEntry) error {
+			count++
+			if count == 40 {
+				return stop
+			}
+			return nil
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 40, count)
+	}
+}
+
+func TestListStat(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	mtime := time.Unix(1600000000, 0)
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		// Only the roots of the entries are stored in `roots`, the leaves of
+		// `file` aren't needed.
+		roots := mdtest.Mock()
+		leaf := mdag.NewRawNode([]byte("leaf data"))
+		fsn := ft.NewFSNode(ft.TFile)
+		fsn.AddBlockSize(9)
+		fsn.AddBlockSize(9)
+		fsn.SetModTime(mtime)
+		data, err := fsn.GetBytes()
+		assert.NoError(t, err)
+		file := mdag.NodeWithData(data)
+		assert.NoError(t, file.AddNodeLink("", leaf))
+		assert.NoError(t, file.AddNodeLink("", leaf))
+		symlinkData, err := ft.SymlinkData("../target")
+		assert.NoError(t, err)
+		symlink := mdag.NodeWithData(symlinkData)
+		subdir := ft.EmptyDirNode()
+		raw := mdag.NewRawNode([]byte("raw"))
+		for _, nd := range []ipld.Node{file, symlink, subdir, raw} {
+			assert.NoError(t, roots.Add(ctx, nd))
+		}
+
+		dir := NewDirectory(ds)
+		for name, nd := range map[string]ipld.Node{"file": file, "link": symlink, "dir": subdir, "raw": raw} {
+			assert.NoError(t, dir.AddChild(ctx, name, nd))
+		}
+		fileSize, err := file.Size()
+		assert.NoError(t, err)
+		entries, err := ListStat(ctx, dir, roots)
+		assert.NoError(t, err)
+		assert.Equal(t, []EntryStat{
+			{DirEntry{"dir", subdir.Cid(), uint64(len(subdir.RawData())), ft.TDirectory}, 0, uint64(len(subdir.RawData())), os.ModeDir | ft.DefaultDirMode, time.Time{}},
+			{DirEntry{"file", file.Cid(), fileSize, ft.TFile}, 18, fileSize, ft.DefaultFileMode, mtime},
+			{DirEntry{"link", symlink.Cid(), uint64(len(symlink.RawData())), ft.TSymlink}, 9, uint64(len(symlink.RawData())), os.ModeSymlink | ft.DefaultSymlinkMode, time.Time{}},
+			{DirEntry{"raw", raw.Cid(), 3, ft.TRaw}, 3, 3, ft.DefaultFileMode, time.Time{}},
+		}, entries)
+
+		lost := mdag.NewRawNode([]byte("lost"))
+		assert.NoError(t, ds.Add(ctx, lost))
+		assert.NoError(t, dir.AddChild(ctx, "lost", lost))
+		_, err = ListStat(ctx, dir, roots)
+		assert.Error(t, err)
+
+		// The entries with recorded attributes are listed from them, their
+		// roots aren't fetched.
+		assert.NoError(t, ds.Add(ctx, subdir))
+		assert.NoError(t, SetEntryAttributes(ctx, dir, "lost", 0, mtime))
+		assert.NoError(t, SetEntryAttributes(ctx, dir, "dir", 0700, mtime))
+		entries, err = ListStat(ctx, dir, roots)
+		assert.NoError(t, err)
+		assert.Equal(t, EntryStat{DirEntry{"dir", subdir.Cid(), uint64(len(subdir.RawData())), ft.TDirectory}, 0, uint64(len(subdir.RawData())), os.ModeDir | 0700, mtime}, entries[0])
+		assert.Equal(t, EntryStat{DirEntry{"lost", lost.Cid(), 4, ft.TRaw}, 4, 4, ft.DefaultFileMode, mtime}, entries[3])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		add := func(nd ipld.Node) ipld.Node {
+			assert.NoError(t, ds.Add(ctx, nd))
+			return nd
+		}
+		symlink := func(target string) ipld.Node {
+			data, err := ft.SymlinkData(target)
+			assert.NoError(t, err)
+			return add(mdag.NodeWithData(data))
+		}
+		mkdir := func(entries map[string]ipld.Node) ipld.Node {
+			dir := NewDirectory(ds)
+			for name, nd := range entries {
+				assert.NoError(t, dir.AddChild(ctx, name, nd))
+			}
+			nd, err := dir.GetNode()
+			assert.NoError(t, err)
+			return add(nd)
+		}
+
+		file := add(mdag.NodeWithData(ft.FilePBData([]byte("data"), 4)))
+		c := mkdir(map[string]ipld.Node{"file": file, "up": symlink(".."), "loop": symlink("loop")})
+		b := mkdir(map[string]ipld.Node{"c": c, "abs": symlink("/a/b/c/file")})
+		root := mkdir(map[string]ipld.Node{
+			"a":     mkdir(map[string]ipld.Node{"b": b}),
+			"short": symlink("a/b/c"),
+		})
+
+		for p, expected := range map[string]ipld.Node{
+			"":                root,
+			"a/b/c/file":      file,
+			"/a//b/./c/file/": file,
+			"a/b/c/../c/file": file,
+			"../a/b":          b,
+			"short/file":      file,
+			"a/b/abs":         file,
+			"a/b/c/up/c/up/c": c,
+			"short/up/abs":    file,
+		} {
+			nd, err := Resolve(ctx, ds, root, p)
+			assert.NoError(t, err, p)
+			if err == nil {
+				assert.Equal(t, expected.Cid(), nd.Cid(), p)
+			}
+		}
+
+		_, err := Resolve(ctx, ds, root, "a/b/missing/file")
+		var nf *NotFoundError
+		assert.True(t, errors.As(err, &nf))
+		assert.Equal(t, &NotFoundError{Dir: "a/b", Name: "missing"}, nf)
+		assert.True(t, errors.Is(err, ErrNotFound))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+		_, err = Resolve(ctx, ds, root, "short/missing")
+		assert.Equal(t, &NotFoundError{Dir: "a/b/c", Name: "missing"}, err)
+
+		for _, p := range []string{"a/b/c/file/more", "a/b/c/file/../up"} {
+			_, err = Resolve(ctx, ds, root, p)
+			assert.True(t, errors.Is(err, ErrNotADir), p)
+		}
+		_, err = Resolve(ctx, ds, root, "short/loop")
+		assert.Equal(t, ErrTooManySymlinks, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	add := func(nd ipld.Node) ipld.Node {
+		assert.NoError(t, ds.Add(ctx, nd))
+		return nd
+	}
+	file := func(data string) ipld.Node {
+		return add(mdag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data)))))
+	}
+	mkdir := func(entries map[string]ipld.Node) ipld.Node {
+		dir := NewDirectory(ds)
+		for name, nd := range entries {
+			assert.NoError(t, dir.AddChild(ctx, name, nd))
+		}
+		nd, err := dir.GetNode()
+		assert.NoError(t, err)
+		return add(nd)
+	}
+	a, b, c, d := file("a"), file("b"), file("c"), file("d")
+	left := mkdir(map[string]ipld.Node{
+		"same": a, "only-left": b, "file": a,
+		"sub": mkdir(map[string]ipld.Node{"x": a, "y": b}),
+	})
+	right := mkdir(map[string]ipld.Node{
+		"same": a, "only-right": c, "file": d,
+		"sub": mkdir(map[string]ipld.Node{"y": c, "z": d}),
+	})
+
+	for _, tc := range []struct {
+		name     string
+		policy   ConflictPolicy
+		expected ipld.Node
+	}{
+		{"left", PreferLeft, mkdir(map[string]ipld.Node{
+			"same": a, "only-left": b, "only-right": c, "file": a,
+			"sub": mkdir(map[string]ipld.Node{"x": a, "y": b}),
+		})},
+		{"right", PreferRight, mkdir(map[string]ipld.Node{
+			"same": a, "only-left": b, "only-right": c, "file": d,
+			"sub": mkdir(map[string]ipld.Node{"y": c, "z": d}),
+		})},
+		{"recursive", MergeSubdirs(ds, PreferRight), mkdir(map[string]ipld.Node{
+			"same": a, "only-left": b, "only-right": c, "file": d,
+			"sub": mkdir(map[string]ipld.Node{"x": a, "y": c, "z": d}),
+		})},
+		{"drop", func(context.Context, string, ipld.Node, ipld.Node) (ipld.Node, error) {
+			return nil, nil
+		}, mkdir(map[string]ipld.Node{"same": a, "only-left": b, "only-right": c})},
+	} {
+		merged, err := Merge(ctx, ds, left, right, tc.policy)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected.Cid(), merged.Cid(), tc.name)
+		_, err = ds.Get(ctx, merged.Cid())
+		assert.NoError(t, err, tc.name)
+	}
+
+	_, err := Merge(ctx, ds, left, right, MergeSubdirs(ds, FailOnConflict))
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Contains(t, []string{"file", "sub/y"}, conflict.Path)
+
+	_, err = Merge(ctx, ds, left, a, PreferLeft)
+	assert.Equal(t, ErrNotADir, err)
+}
+
+func TestDiff(t *testing.T) {
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+
+	ctx := context.Background()
+	for _, sharded := range []bool{false, true} {
+		HAMTShardingSize = 0
+		if sharded {
+			HAMTShardingSize = 1
+		}
+		ds := mdtest.Mock()
+		add := func(nd ipld.Node) ipld.Node {
+			assert.NoError(t, ds.Add(ctx, nd))
+			return nd
+		}
+		file := func(data string) ipld.Node {
+			return add(mdag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data)))))
+		}
+		mkdir := func(entries map[string]ipld.Node) ipld.Node {
+			dir := NewDirectory(ds)
+			for name, nd := range entries {
+				assert.NoError(t, dir.AddChild(ctx, name, nd))
+			}
+			nd, err := dir.GetNode()
+			assert.NoError(t, err)
+			return add(nd)
+		}
+		a, b, c := file("a"), file("b"), file("c")
+		// Never stored: identical subtrees aren't fetched.
+		shared := ft.EmptyDirNode()
+		assert.NoError(t, shared.AddNodeLink("lost", a))
+
+		gone := mkdir(map[string]ipld.Node{"x": a})
+		swapped := mkdir(map[string]ipld.Node{"x": b})
+		before := mkdir(map[string]ipld.Node{
+			"shared": shared, "kept": a, "changed": a, "removed": b, "gone": gone, "swap": a,
+			"sub": mkdir(map[string]ipld.Node{"x": a, "y": b}),
+		})
+		after := mkdir(map[string]ipld.Node{
+			"shared": shared, "kept": a, "changed": c, "added": b, "swap": swapped,
+			"sub": mkdir(map[string]ipld.Node{"x": a, "y": c, "z": a}),
+		})
+
+		var changes []Change
+		assert.NoError(t, Diff(ctx, ds, before, after, func(c Change) error {
+			changes = append(changes, c)
+			return nil
+		}))
+		assert.Equal(t, []Change{
+			{Type: Add, Path: "added", After: b.Cid()},
+			{Type: Modify, Path: "changed", Before: a.Cid(), After: c.Cid()},
+			{Type: Remove, Path: "gone", Before: gone.Cid()},
+			{Type: Remove, Path: "removed", Before: b.Cid()},
+			{Type: Modify, Path: "sub/y", Before: b.Cid(), After: c.Cid()},
+			{Type: Add, Path: "sub/z", After: a.Cid()},
+			{Type: Modify, Path: "swap", Before: a.Cid(), After: swapped.Cid()},
+		}, changes)
+
+		assert.NoError(t, Diff(ctx, ds, before, before, func(c Change) error {
+			t.Fatalf("unexpected change %v", c)
+			return nil
+		}))
+	}
+}
@@ -0,0 +1,239 @@
+package io
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	format "github.com/TRON-US/go-unixfs"
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// DirectoryReader reads the entries of a directory one at a time, as they
+// are enumerated (see `Directory.EnumLinksAsync`), instead of loading all
+// of them at once (as `Directory.Links` does), so listings of very large
+// (sharded) directories can be streamed or paged. As with
+// `EnumLinksAsync`, the order of the entries isn't guaranteed. The reader
+// must be closed (or read to the end) to release the enumeration.
+type DirectoryReader struct {
+	cancel  context.CancelFunc
+	results <-chan format.LinkResult
+	link    *ipld.Link
+	err     error
+}
+
+// NewDirectoryReader returns a reader of the entries of `dir`.
+func NewDirectoryReader(ctx context.Context, dir Directory) *DirectoryReader {
+	ctx, cancel := context.WithCancel(ctx)
+	return &DirectoryReader{
+		cancel:  cancel,
+		results: dir.EnumLinksAsync(ctx),
+	}
+}
+
+// Next advances to the next entry, it returns false at the end of the
+// directory or on error (see `Err`).
+func (r *DirectoryReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	res, ok := <-r.results
+	if !ok {
+		r.link = nil
+		r.cancel()
+		return false
+	}
+	if res.Err != nil {
+		r.link = nil
+		r.err = res.Err
+		r.cancel()
+		return false
+	}
+	r.link = res.Link
+	return true
+}
+
+// Link returns the current entry.
+func (r *DirectoryReader) Link() *ipld.Link {
+	return r.link
+}
+
+// Err returns the error that stopped the enumeration, if any.
+func (r *DirectoryReader) Err() error {
+	return r.err
+}
+
+// ReadLinks returns (like `os.File.ReadDir`) the next `n` entries at most,
+// or all the remaining ones if `n` is not positive. At the end of the
+// directory it returns `io.EOF` if `n` is positive, along with no entries.
+func (r *DirectoryReader) ReadLinks(n int) ([]*ipld.Link, error) {
+	var links []*ipld.Link
+	for n <= 0 || len(links) < n {
+		if !r.Next() {
+			if r.err != nil {
+				return links, r.err
+			}
+			if n > 0 && len(links) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		links = append(links, r.link)
+	}
+	return links, nil
+}
+
+// Close stops the enumeration.
+func (r *DirectoryReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// entryBatch is the number of entries whose roots `ForEachEntry` fetches
+// at once.
+const entryBatch = 32
+
+// DirEntry is an entry of a directory listed by `ForEachEntry`.
+type DirEntry struct {
+	Name string
+	Cid  cid.Cid
+	// Size is the cumulative size the link declares for the DAG of the
+	// entry.
+	Size uint64
+	// Type is the unixfs type of the root of the entry, `TRaw` for a raw
+	// leaf.
+	Type pb.Data_DataType
+}
+
+// ForEachEntry calls `f` with the entries of `dir`, basic or sharded, read
+// with a `DirectoryReader` so only a batch of them is held in memory at a
+// time. The type of an entry is probed from its root, fetched from `ng`
+// (the roots of a batch are fetched concurrently), decoding only its type
+// (see `unixfs.NodeType`). The enumeration stops at the first error of `f`,
+// which is returned.
+func ForEachEntry(ctx context.Context, dir Directory, ng ipld.NodeGetter, f func(DirEntry) error) error {
+	return forEachEntryNode(ctx, dir, ng, nil, func(l *ipld.Link, nd ipld.Node) error {
+		typ, err := format.NodeType(nd)
+		if err != nil {
+			return err
+		}
+		return f(DirEntry{Name: l.Name, Cid: l.Cid, Size: l.Size, Type: typ})
+	})
+}
+
+// forEachEntryNode calls `f` with the entries of `dir` and their roots,
+// fetched from `ng` by batches. If `fetch` isn't nil only the roots of the
+// entries it returns true for are fetched, `f` is called with a nil root
+// for the others.
+func forEachEntryNode(ctx context.Context, dir Directory, ng ipld.NodeGetter, fetch func(*ipld.Link) bool, f func(*ipld.Link, ipld.Node) error) error {
+	r := NewDirectoryReader(ctx, dir)
+	defer r.Close()
+	ng = format.InlineGetter(ng)
+	for {
+		links, err := r.ReadLinks(entryBatch)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var cids []cid.Cid
+		for _, l := range links {
+			if fetch == nil || fetch(l) {
+				cids = append(cids, l.Cid)
+			}
+		}
+		promises := ipld.GetNodes(ctx, ng, cids)
+		for _, l := range links {
+			var nd ipld.Node
+			if fetch == nil || fetch(l) {
+				nd, err = promises[0].Get(ctx)
+				if err != nil {
+					return err
+				}
+				promises = promises[1:]
+			}
+			if err := f(l, nd); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EntryStat is an entry of a directory listed by `ListStat`.
+type EntryStat struct {
+	DirEntry
+	// FileSize is the logical size of the entry: the file size of files
+	// (wrapped by `TMetadata` nodes or not), the length of the target of
+	// symlinks and zero for directories (see `unixfs.FileInfo`).
+	FileSize uint64
+	// CumulativeSize is the size of the DAG of the entry computed from its
+	// root (see `ipld.Node.Size`), unlike `Size` which the link declares.
+	// For the entries listed from their recorded attributes, whose root
+	// isn't fetched, it's the size the link declares.
+	CumulativeSize uint64
+	// Mode and ModTime are the ones of `unixfs.FileInfo`, recorded in the
+	// root of the entry or in `dir` (see `SetEntryAttributes`).
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// ListStat returns the entries of `dir`, basic or sharded, sorted by name,
+// with their type, sizes and attributes, in a single enumeration of `dir`.
+// The entries with attributes recorded in `dir` (see `SetEntryAttributes`)
+// are listed from them, so both agree, the roots of the other ones are
+// fetched from `ng` by batches, concurrently (see `ForEachEntry`), and
+// only them.
+func ListStat(ctx context.Context, dir Directory, ng ipld.NodeGetter) ([]EntryStat, error) {
+	recorded, err := ListEntryAttributes(ctx, dir)
+	if err != nil && err != ErrNotADir {
+		return nil, err
+	}
+	var entries []EntryStat
+	fetch := func(l *ipld.Link) bool {
+		_, ok := recorded[l.Name]
+		return !ok
+	}
+	err = forEachEntryNode(ctx, dir, ng, fetch, func(l *ipld.Link, nd ipld.Node) error {
+		if attrs, ok := recorded[l.Name]; ok {
+			entries = append(entries, EntryStat{
+				DirEntry:       DirEntry{Name: l.Name, Cid: l.Cid, Size: l.Size, Type: attrs.Type},
+				FileSize:       attrs.Size,
+				CumulativeSize: l.Size,
+				Mode:           attrs.fileMode(),
+				ModTime:        attrs.ModTime,
+			})
+			return nil
+		}
+		typ, err := format.NodeType(nd)
+		if err != nil {
+			return err
+		}
+		fi, err := format.FileInfo(l.Name, nd)
+		if err != nil {
+			return err
+		}
+		size, err := nd.Size()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, EntryStat{
+			DirEntry:       DirEntry{Name: l.Name, Cid: l.Cid, Size: l.Size, Type: typ},
+			FileSize:       uint64(fi.Size()),
+			CumulativeSize: size,
+			Mode:           fi.Mode(),
+			ModTime:        fi.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
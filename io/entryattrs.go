@@ -0,0 +1,296 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	format "github.com/TRON-US/go-unixfs"
+	hamt "github.com/TRON-US/go-unixfs/hamt"
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// EntryXattrPrefix prefixes the names of the extended attributes of a
+// directory node recording the attributes of its entries (see
+// `SetEntryAttributes`), followed by the name of the entry.
+const EntryXattrPrefix = hamt.EntryXattrPrefix
+
+// ErrNoEntryAttributes is returned by `GetEntryAttributes` for an entry
+// without recorded attributes.
+var ErrNoEntryAttributes = errors.New("no attributes recorded for the entry")
+
+// EntryAttributes are the attributes of a directory entry recorded in the
+// directory itself, so listings don't have to fetch the entry.
+type EntryAttributes struct {
+	// Type is the unixfs type of the entry when its attributes were set.
+	Type pb.Data_DataType
+	// Size is the logical size of the entry when its attributes were set,
+	// as `unixfs.FileInfo` reports it.
+	Size    uint64
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// entryAttributesStore is implemented by the directories recording the
+// attributes of their entries, encoded by `encodeEntryAttributes`.
+type entryAttributesStore interface {
+	// setEntryAttributes records the attributes of the entry `name`, nil
+	// removes them.
+	setEntryAttributes(ctx context.Context, name string, value []byte) error
+	// entryAttributes returns the attributes of the entry `name`, nil if
+	// it has none.
+	entryAttributes(ctx context.Context, name string) ([]byte, error)
+	forEachEntryAttributes(ctx context.Context, f func(name string, value []byte) error) error
+}
+
+// entryAttributesSize is the size the attributes `value` of the entry
+// `name` add to the node holding them, for the `HAMTShardingSize` option.
+func entryAttributesSize(name string, value []byte) int {
+	if value == nil {
+		return 0
+	}
+	return len(EntryXattrPrefix) + len(name) + len(value)
+}
+
+// SetEntryAttributes records the mode and the modification time of the
+// entry `name` of `dir` (as the unixfs 1.5 fields) in `dir`, along with its
+// type and its logical size (as the file size of the record), in the
+// extended attribute `EntryXattrPrefix` + `name` of the node
+// holding the link of the entry: the node of a basic directory (the
+// attributes count towards `HAMTShardingSize`), the shard holding the link
+// in a sharded one (see `hamt.Shard.SetEntryAttributes`). It returns
+// `os.ErrNotExist` if `dir` has no entry `name`. The attributes of an entry
+// are dropped when it's removed or replaced (see `Directory.AddChild`), and
+// moved by `Rename`. The attributes of the node of the entry itself aren't
+// changed.
+func SetEntryAttributes(ctx context.Context, dir Directory, name string, mode os.FileMode, mtime time.Time) error {
+	child, err := dir.Find(ctx, name)
+	if err != nil {
+		return err
+	}
+	typ, err := format.NodeType(child)
+	if err != nil {
+		return err
+	}
+	fi, err := format.FileInfo(name, child)
+	if err != nil {
+		return err
+	}
+	return setEntryAttributes(ctx, dir, name, EntryAttributes{Type: typ, Size: uint64(fi.Size()), Mode: mode, ModTime: mtime})
+}
+
+func setEntryAttributes(ctx context.Context, dir Directory, name string, attrs EntryAttributes) error {
+	store, ok := dir.(entryAttributesStore)
+	if !ok {
+		return ErrNotADir
+	}
+	fsn := format.NewFSNode(attrs.Type)
+	fsn.UpdateFilesize(int64(attrs.Size))
+	fsn.SetMode(attrs.Mode)
+	fsn.SetModTime(attrs.ModTime)
+	value, err := fsn.GetBytes()
+	if err != nil {
+		return err
+	}
+	return store.setEntryAttributes(ctx, name, value)
+}
+
+// GetEntryAttributes returns the attributes recorded for the entry `name`
+// of `dir` (see `SetEntryAttributes`), `ErrNoEntryAttributes` if it has
+// none.
+func GetEntryAttributes(ctx context.Context, dir Directory, name string) (EntryAttributes, error) {
+	store, ok := dir.(entryAttributesStore)
+	if !ok {
+		return EntryAttributes{}, ErrNotADir
+	}
+	value, err := store.entryAttributes(ctx, name)
+	if err == os.ErrNotExist || err == nil && value == nil {
+		return EntryAttributes{}, ErrNoEntryAttributes
+	}
+	if err != nil {
+		return EntryAttributes{}, err
+	}
+	return decodeEntryAttributes(value)
+}
+
+func decodeEntryAttributes(value []byte) (EntryAttributes, error) {
+	fsn, err := format.FSNodeFromBytes(value)
+	if err != nil {
+		return EntryAttributes{}, err
+	}
+	// The size is recorded whatever the type, `FSNode.FileSize` only
+	// reads it for files.
+	pbdata, err := format.FromBytes(value)
+	if err != nil {
+		return EntryAttributes{}, err
+	}
+	return EntryAttributes{Type: fsn.Type(), Size: pbdata.GetFilesize(), Mode: fsn.Mode(), ModTime: fsn.ModTime()}, nil
+}
+
+// fileMode returns the mode `unixfs.FileInfo` reports for an entry with
+// the attributes `a`: the default one of its type if it has none, with the
+// type bits.
+func (a EntryAttributes) fileMode() os.FileMode {
+	mode, typeBits := format.DefaultFileMode, os.FileMode(0)
+	switch a.Type {
+	case format.TDirectory, format.THAMTShard:
+		mode, typeBits = format.DefaultDirMode, os.ModeDir
+	case format.TSymlink:
+		mode, typeBits = format.DefaultSymlinkMode, os.ModeSymlink
+	}
+	if a.Mode != 0 {
+		mode = a.Mode
+	}
+	return mode | typeBits
+}
+
+// ListEntryAttributes returns the attributes recorded for the entries of
+// `dir`, by name, reading only the nodes of `dir` (the root of a basic
+// directory, all the shards of a sharded one).
+func ListEntryAttributes(ctx context.Context, dir Directory) (map[string]EntryAttributes, error) {
+	store, ok := dir.(entryAttributesStore)
+	if !ok {
+		return nil, ErrNotADir
+	}
+	entries := make(map[string]EntryAttributes)
+	err := store.forEachEntryAttributes(ctx, func(name string, value []byte) error {
+		attrs, err := decodeEntryAttributes(value)
+		if err != nil {
+			return err
+		}
+		entries[name] = attrs
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RemoveEntryAttributes removes the attributes recorded for the entry
+// `name` of `dir`, if any.
+func RemoveEntryAttributes(ctx context.Context, dir Directory, name string) error {
+	store, ok := dir.(entryAttributesStore)
+	if !ok {
+		return ErrNotADir
+	}
+	err := store.setEntryAttributes(ctx, name, nil)
+	if err == os.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+// copyEntryAttributes records the attributes of the entries of `from` in
+// `to`, when switching implementations.
+func copyEntryAttributes(ctx context.Context, from, to entryAttributesStore) error {
+	return from.forEachEntryAttributes(ctx, func(name string, value []byte) error {
+		return to.setEntryAttributes(ctx, name, value)
+	})
+}
+
+func (d *BasicDirectory) setEntryAttributes(ctx context.Context, name string, value []byte) error {
+	if _, err := d.node.GetNodeLink(name); err != nil {
+		return os.ErrNotExist
+	}
+	old, err := d.entryAttributes(ctx, name)
+	if err != nil {
+		return err
+	}
+	d.estimatedSize += entryAttributesSize(name, value) - entryAttributesSize(name, old)
+	if value == nil {
+		if old == nil {
+			return nil
+		}
+		return format.RemoveXattr(d.node, EntryXattrPrefix+name)
+	}
+	return format.SetXattr(d.node, EntryXattrPrefix+name, value)
+}
+
+func (d *BasicDirectory) entryAttributes(_ context.Context, name string) ([]byte, error) {
+	value, err := format.GetXattr(d.node, EntryXattrPrefix+name)
+	if err == format.ErrNoXattr {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (d *BasicDirectory) forEachEntryAttributes(_ context.Context, f func(name string, value []byte) error) error {
+	names, err := format.ListXattrs(d.node)
+	if err != nil {
+		return err
+	}
+	for _, xattr := range names {
+		if !strings.HasPrefix(xattr, EntryXattrPrefix) {
+			continue
+		}
+		value, err := format.GetXattr(d.node, xattr)
+		if err != nil {
+			return err
+		}
+		if err := f(strings.TrimPrefix(xattr, EntryXattrPrefix), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *HAMTDirectory) setEntryAttributes(ctx context.Context, name string, value []byte) error {
+	old, err := d.shard.EntryAttributes(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := d.shard.SetEntryAttributes(ctx, name, value); err != nil {
+		return err
+	}
+	d.sizeChange += entryAttributesSize(name, value) - entryAttributesSize(name, old)
+	return nil
+}
+
+func (d *HAMTDirectory) entryAttributes(ctx context.Context, name string) ([]byte, error) {
+	return d.shard.EntryAttributes(ctx, name)
+}
+
+func (d *HAMTDirectory) forEachEntryAttributes(ctx context.Context, f func(name string, value []byte) error) error {
+	return d.shard.ForEachEntryAttributes(ctx, f)
+}
+
+// setEntryAttributes switches to a HAMTDirectory if the attributes make a
+// BasicDirectory go over `HAMTShardingSize`.
+func (d *DynamicDirectory) setEntryAttributes(ctx context.Context, name string, value []byte) error {
+	store, ok := d.Directory.(entryAttributesStore)
+	if !ok {
+		return ErrNotADir
+	}
+	if err := store.setEntryAttributes(ctx, name, value); err != nil {
+		return err
+	}
+	basicDir, ok := d.Directory.(*BasicDirectory)
+	if !ok || HAMTShardingSize == 0 || basicDir.estimatedSize < HAMTShardingSize {
+		return nil
+	}
+	hamtDir, err := basicDir.switchToSharding(ctx)
+	if err != nil {
+		return err
+	}
+	d.Directory = hamtDir
+	return nil
+}
+
+func (d *DynamicDirectory) entryAttributes(ctx context.Context, name string) ([]byte, error) {
+	store, ok := d.Directory.(entryAttributesStore)
+	if !ok {
+		return nil, ErrNotADir
+	}
+	return store.entryAttributes(ctx, name)
+}
+
+func (d *DynamicDirectory) forEachEntryAttributes(ctx context.Context, f func(name string, value []byte) error) error {
+	store, ok := d.Directory.(entryAttributesStore)
+	if !ok {
+		return ErrNotADir
+	}
+	return store.forEachEntryAttributes(ctx, f)
+}
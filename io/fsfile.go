@@ -0,0 +1,72 @@
+package io
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	ft "github.com/TRON-US/go-unixfs"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// File is a unixfs file opened as an `fs.File` (seekable, so also an
+// `io.ReadSeekCloser`), for the standard library code expecting one, e.g.,
+// the files opened by an `fs.FS` given to `http.FS` or `template.ParseFS`.
+type File struct {
+	*FileContent
+	info fileInfo
+}
+
+var (
+	_ fs.File           = (*File)(nil)
+	_ io.ReadSeekCloser = (*File)(nil)
+)
+
+// NewFile opens the file `n` under the name `name` (its base name is the
+// one of `Stat`), with the modification time `modTime` (see
+// `NewFileContent`).
+func NewFile(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, name string, modTime time.Time) (*File, error) {
+	fc, err := NewFileContent(ctx, n, serv, modTime)
+	if err != nil {
+		return nil, err
+	}
+	size, err := ft.SizeToOffset(fc.Size())
+	if err != nil {
+		return nil, err
+	}
+	mode := fs.FileMode(0444)
+	if fsn, err := ft.ExtractFSNode(n); err == nil && fsn.Mode() != 0 {
+		mode = fsn.Mode()
+	}
+	return &File{
+		FileContent: fc,
+		info:        fileInfo{name: path.Base(name), size: size, mode: mode, modTime: modTime, node: n},
+	}, nil
+}
+
+// Stat implements the `fs.File` interface, `Sys` returns the root node of
+// the file. The mode is the one recorded in the root node, read-only (0444)
+// if it has none.
+func (f *File) Stat() (fs.FileInfo, error) {
+	return &f.info, nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	node    ipld.Node
+}
+
+var _ fs.FileInfo = (*fileInfo)(nil)
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return false }
+func (fi *fileInfo) Sys() interface{}   { return fi.node }
@@ -0,0 +1,81 @@
+package io
+
+import (
+	"fmt"
+	"hash"
+	"io"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+// HashingReader reads a file (usually through a `DagReader`) computing
+// digests of its data on the way, so export tools can produce checksum
+// manifests without reading the files twice.
+type HashingReader struct {
+	r      io.Reader
+	names  []string
+	hashes []hash.Hash
+	// Writes to all the `hashes`.
+	sink io.Writer
+}
+
+// NewHashingReader returns a reader of `r` computing the digests of the
+// hash functions named (with their multihash names, e.g. "sha2-256" or
+// "blake2b-256").
+func NewHashingReader(r io.Reader, names ...string) (*HashingReader, error) {
+	hr := &HashingReader{r: r, names: names}
+	writers := make([]io.Writer, len(names))
+	for i, name := range names {
+		code, ok := mh.Names[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown hash function %q", name)
+		}
+		h, err := mh.GetHasher(code)
+		if err != nil {
+			return nil, err
+		}
+		hr.hashes = append(hr.hashes, h)
+		writers[i] = h
+	}
+	hr.sink = io.MultiWriter(writers...)
+	return hr, nil
+}
+
+// Read implements the `io.Reader` interface.
+func (hr *HashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.sink.Write(p[:n])
+	return n, err
+}
+
+// WriteTo implements the `io.WriterTo` interface, keeping the `WriteTo`
+// of the underlying reader (if any).
+func (hr *HashingReader) WriteTo(w io.Writer) (int64, error) {
+	wt, ok := hr.r.(io.WriterTo)
+	if !ok {
+		return io.Copy(w, struct{ io.Reader }{hr})
+	}
+	return wt.WriteTo(&hashingWriter{w: w, sink: hr.sink})
+}
+
+// Sum returns the digests of the data read so far, by name.
+func (hr *HashingReader) Sum() map[string][]byte {
+	sums := make(map[string][]byte, len(hr.names))
+	for i, name := range hr.names {
+		sums[name] = hr.hashes[i].Sum(nil)
+	}
+	return sums
+}
+
+// hashingWriter hashes the data written to `w`, only what was actually
+// written on short writes.
+type hashingWriter struct {
+	w    io.Writer
+	sink io.Writer
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.sink.Write(p[:n])
+	return n, err
+}
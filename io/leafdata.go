@@ -0,0 +1,84 @@
+package io
+
+import (
+	"github.com/TRON-US/go-unixfs"
+	pb "github.com/TRON-US/go-unixfs/pb"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// leafData returns the file data of a leaf like
+// `unixfs.ReadUnixFSNodeData` does, but without copying it out of the
+// node: decoding the protobuf message allocates a new buffer for the data
+// of every block read otherwise, a lot of garbage for a gateway serving
+// many streams. The returned data must not be modified.
+func leafData(node ipld.Node) ([]byte, error) {
+	if pn, ok := node.(*mdag.ProtoNode); ok {
+		if data, ok := scanLeafData(pn.Data()); ok {
+			return data, nil
+		}
+	}
+	// Raw leaves aren't copied, anything unexpected is left to the full
+	// decoder (to return the same errors).
+	return unixfs.ReadUnixFSNodeData(node)
+}
+
+// scanLeafData finds the `Data` field in the encoded unixfs message `b`,
+// it returns false unless the message is well formed and of a type holding
+// file data.
+func scanLeafData(b []byte) ([]byte, bool) {
+	var data []byte
+	var hasType bool
+	for len(b) > 0 {
+		key, n := proto.DecodeVarint(b)
+		if n == 0 {
+			return nil, false
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&7
+
+		switch wireType {
+		case proto.WireVarint:
+			v, n := proto.DecodeVarint(b)
+			if n == 0 {
+				return nil, false
+			}
+			b = b[n:]
+			if field == 1 {
+				switch pb.Data_DataType(v) {
+				case pb.Data_File, pb.Data_Raw, pb.Data_TokenMeta:
+					hasType = true
+				default:
+					return nil, false
+				}
+			}
+		case proto.WireBytes:
+			l, n := proto.DecodeVarint(b)
+			if n == 0 || l > uint64(len(b)-n) {
+				return nil, false
+			}
+			if field == 2 {
+				data = b[n : n+int(l)]
+			}
+			b = b[n+int(l):]
+		case proto.WireFixed64:
+			if len(b) < 8 {
+				return nil, false
+			}
+			b = b[8:]
+		case proto.WireFixed32:
+			if len(b) < 4 {
+				return nil, false
+			}
+			b = b[4:]
+		default:
+			return nil, false
+		}
+		if field == 1 && wireType != proto.WireVarint || field == 2 && wireType != proto.WireBytes {
+			return nil, false
+		}
+	}
+	return data, hasType
+}
@@ -0,0 +1,97 @@
+package io
+
+import (
+	"context"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Leaf is a leaf of a file DAG, visited by a `LeafIterator`.
+type Leaf struct {
+	Node ipld.Node
+	// Offset is the file offset of the data of the leaf, Length its
+	// length.
+	Offset uint64
+	Length uint64
+	// Data is the file data of the leaf, shared with the node (it must not
+	// be modified).
+	Data []byte
+}
+
+// LeafIterator visits the leaves of a file DAG in order, with their
+// offsets, so dedup tools, diffs or custom exporters don't have to
+// re-implement the traversal. The children are fetched in batches as a
+// `DagReader` does. It must be closed (or iterated to the end) to release
+// the requests in flight.
+type LeafIterator struct {
+	dr   *dagReader
+	leaf Leaf
+	err  error
+	done bool
+}
+
+// NewLeafIterator returns an iterator of the leaves of the file `n`, which
+// (like `NewDagReader`) can't be a directory or a symlink.
+func NewLeafIterator(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (*LeafIterator, error) {
+	r, err := NewDagReader(ctx, n, serv)
+	if err != nil {
+		return nil, err
+	}
+	return &LeafIterator{dr: r.(*dagReader)}, nil
+}
+
+// Next advances to the next leaf, it returns false after the last one or
+// on error (see `Err`).
+func (it *LeafIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	dr := it.dr
+	if uint64(dr.offset) < dr.size {
+		dr.ahead.want = dr.size - uint64(dr.offset)
+	}
+	found := false
+	err := dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
+		node := extractNode(visitedNode)
+		if len(node.Links()) > 0 {
+			return nil
+		}
+		data, err := leafData(node)
+		if err != nil {
+			return err
+		}
+		it.leaf = Leaf{Node: node, Offset: uint64(dr.offset), Length: uint64(len(data)), Data: data}
+		dr.offset += int64(len(data))
+		found = true
+		dr.dagWalker.Pause()
+		return nil
+	})
+	switch {
+	case err == ipld.EndOfDag:
+		it.done = true
+		dr.Close()
+	case err != nil:
+		it.err = err
+		dr.Close()
+	}
+	if !found {
+		it.leaf = Leaf{}
+	}
+	return found
+}
+
+// Leaf returns the current leaf.
+func (it *LeafIterator) Leaf() Leaf {
+	return it.leaf
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *LeafIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration.
+func (it *LeafIterator) Close() error {
+	it.done = true
+	return it.dr.Close()
+}
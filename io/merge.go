@@ -0,0 +1,138 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+
+	ft "github.com/TRON-US/go-unixfs"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ErrConflict is matched by the `*ConflictError`s of `FailOnConflict`.
+var ErrConflict = errors.New("conflicting directory entries")
+
+// ConflictError is returned by `Merge` with the `FailOnConflict` policy,
+// for the first entry found in both directories.
+type ConflictError struct {
+	// Path is the path of the entry from the merged roots.
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return ErrConflict.Error() + ": " + e.Path
+}
+
+// Is reports whether `target` is `ErrConflict`.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ConflictPolicy resolves the conflicts of `Merge`: the entry `path` (from
+// the merged roots) is in both directories with different contents, `left`
+// and `right`. It returns the node of the entry in the merged directory, or
+// nil to leave it out.
+type ConflictPolicy func(ctx context.Context, path string, left, right ipld.Node) (ipld.Node, error)
+
+// PreferLeft is a `ConflictPolicy` keeping the entries of the left
+// directory.
+func PreferLeft(_ context.Context, _ string, left, _ ipld.Node) (ipld.Node, error) {
+	return left, nil
+}
+
+// PreferRight is a `ConflictPolicy` keeping the entries of the right
+// directory.
+func PreferRight(_ context.Context, _ string, _, right ipld.Node) (ipld.Node, error) {
+	return right, nil
+}
+
+// FailOnConflict is a `ConflictPolicy` failing the merge with a
+// `*ConflictError`.
+func FailOnConflict(_ context.Context, p string, _, _ ipld.Node) (ipld.Node, error) {
+	return nil, &ConflictError{Path: p}
+}
+
+// MergeSubdirs returns a `ConflictPolicy` merging the subdirectories found
+// on both sides (stored in `dserv`) recursively, and resolving the other
+// conflicts (files, or a file and a directory) with `files`.
+func MergeSubdirs(dserv ipld.DAGService, files ConflictPolicy) ConflictPolicy {
+	var policy ConflictPolicy
+	policy = func(ctx context.Context, p string, left, right ipld.Node) (ipld.Node, error) {
+		if isDirNode(left) && isDirNode(right) {
+			return merge(ctx, dserv, left, right, policy, p)
+		}
+		return files(ctx, p, left, right)
+	}
+	return policy
+}
+
+func isDirNode(nd ipld.Node) bool {
+	typ, err := ft.NodeType(nd)
+	return err == nil && (typ == ft.TDirectory || typ == ft.THAMTShard)
+}
+
+// Merge returns the directory holding the entries of the directories
+// `left` and `right`, basic or sharded, adding its root to `dserv`. The
+// entries of the same name and CID on both sides are kept, the others in
+// both are resolved by `policy`. The merged directory has the attributes
+// (and the CID builder) of `left`.
+func Merge(ctx context.Context, dserv ipld.DAGService, left, right ipld.Node, policy ConflictPolicy) (ipld.Node, error) {
+	return merge(ctx, dserv, left, right, policy, "")
+}
+
+func merge(ctx context.Context, dserv ipld.DAGService, left, right ipld.Node, policy ConflictPolicy, p string) (ipld.Node, error) {
+	merged, err := NewDirectoryFromNode(dserv, left)
+	if err != nil {
+		return nil, err
+	}
+	rightDir, err := NewDirectoryFromNode(dserv, right)
+	if err != nil {
+		return nil, err
+	}
+	links, err := rightDir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		rightChild, err := l.GetNode(ctx, dserv)
+		if err != nil {
+			return nil, err
+		}
+		leftChild, err := merged.Find(ctx, l.Name)
+		switch {
+		case err == os.ErrNotExist:
+			if err := merged.AddChild(ctx, l.Name, rightChild); err != nil {
+				return nil, err
+			}
+			continue
+		case err != nil:
+			return nil, err
+		case leftChild.Cid() == l.Cid:
+			continue
+		}
+
+		resolved, err := policy(ctx, path.Join(p, l.Name), leftChild, rightChild)
+		if err != nil {
+			return nil, err
+		}
+		if resolved == nil {
+			err = merged.RemoveChild(ctx, l.Name)
+		} else if resolved.Cid() != leftChild.Cid() {
+			err = merged.AddChild(ctx, l.Name, resolved)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nd, err := merged.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
@@ -0,0 +1,263 @@
+package io
+
+import (
+	"context"
+
+	"github.com/TRON-US/go-unixfs"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// Default minimum number of child nodes requested in a single batch, the
+// same as `ipld.NavigableIPLDNode`.
+const minPreload = 10
+
+// readAhead is shared by a `dagReader` and the nodes of its walker to let
+// the nodes know how much data the read in progress still wants, so they
+// can request all the children covering it in a single batch.
+type readAhead struct {
+	// Context of the reader, the children are requested with it (not the
+	// context of the read in progress, only waited with) so closing the
+	// reader aborts all the requests in flight.
+	ctx  context.Context
+	want uint64
+	// Minimum number of children requested in a batch, adapted to the
+	// access pattern (see `access`) if `maxPrefetch` is set.
+	prefetch    int
+	maxPrefetch int
+	// Set by seeks, the next read doesn't continue the previous one.
+	seeked bool
+	// If not zero, the file offset children must start before to be
+	// requested (other than the one being visited), for readers of a
+	// section of the file.
+	limit uint64
+
+	onProgress func(ReadProgress)
+	progress   ReadProgress
+
+	// Verify the size of the children (see `DagReaderOptions.Verify`).
+	verify bool
+	// Set while seeking, to request one child at a time.
+	seeking bool
+}
+
+// access adapts the prefetch window at the start of a read (see
+// `DagReaderOptions.MaxPrefetch`).
+func (ra *readAhead) access() {
+	if ra.maxPrefetch == 0 {
+		return
+	}
+	if ra.seeked {
+		ra.seeked = false
+		ra.prefetch = 1
+		return
+	}
+	ra.prefetch *= 2
+	if ra.prefetch > ra.maxPrefetch {
+		ra.prefetch = ra.maxPrefetch
+	}
+}
+
+func (ra *readAhead) delivered(n uint64) {
+	if ra.onProgress == nil {
+		return
+	}
+	ra.progress.Delivered += n
+	ra.onProgress(ra.progress)
+}
+
+func (ra *readAhead) fetched(nd ipld.Node) {
+	if ra.onProgress == nil {
+		return
+	}
+	ra.progress.Blocks++
+	ra.progress.BlockBytes += uint64(len(nd.RawData()))
+	ra.onProgress(ra.progress)
+}
+
+// navigableNode implements `ipld.NavigableNode` like
+// `ipld.NavigableIPLDNode` (preloading children through node promises),
+// but sizing each batch of children to cover the data the reader still
+// wants according to the unixfs block sizes, and taking the internal nodes
+// already visited from the `offsetIndex` instead of fetching them again.
+type navigableNode struct {
+	*indexedNode
+	getter ipld.NodeGetter
+	ahead  *readAhead
+	index  *offsetIndex
+	// File offset of the data of the node, -1 if unknown (under a node
+	// without size hints).
+	offset int64
+
+	childCIDs     []cid.Cid
+	childPromises []*ipld.NodePromise
+}
+
+var _ ipld.NavigableNode = (*navigableNode)(nil)
+
+func newNavigableNode(node ipld.Node, offset int64, getter ipld.NodeGetter, ahead *readAhead, index *offsetIndex) *navigableNode {
+	links := node.Links()
+	nn := &navigableNode{
+		getter:        getter,
+		ahead:         ahead,
+		index:         index,
+		offset:        offset,
+		childCIDs:     make([]cid.Cid, len(links)),
+		childPromises: make([]*ipld.NodePromise, len(links)),
+	}
+	for i, l := range links {
+		nn.childCIDs[i] = l.Cid
+	}
+
+	if in, ok := index.lookup(node.Cid().KeyString()); ok {
+		nn.indexedNode = in
+		return nn
+	}
+	// Without (consistent) size hints batches keep the minimum size.
+	nn.indexedNode = index.get(node, blockSizes(node))
+	return nn
+}
+
+// blockSizes returns the sizes of the children of an internal node from
+// its unixfs block sizes, nil if it has none (or they are inconsistent).
+func blockSizes(node ipld.Node) []uint64 {
+	pn, ok := node.(*mdag.ProtoNode)
+	if !ok || len(pn.Links()) == 0 {
+		return nil
+	}
+	fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+	if err != nil || fsn.NumChildren() != len(pn.Links()) {
+		return nil
+	}
+	return fsn.BlockSizes()
+}
+
+// extractNode returns the IPLD node wrapped in a navigable node of the
+// walker (the replacement of `ipld.ExtractIPLDNode`).
+func extractNode(node ipld.NavigableNode) ipld.Node {
+	return node.(*navigableNode).node
+}
+
+// batchSize returns the number of children to request from `beg`.
+func (nn *navigableNode) batchSize(beg uint) uint {
+	if nn.ahead.seeking {
+		return 1
+	}
+	n := uint(nn.ahead.prefetch)
+	if nn.sizes == nil || nn.ahead.want == 0 {
+		return n
+	}
+	var covered uint64
+	var count uint
+	for i := beg; i < uint(len(nn.sizes)) && covered < nn.ahead.want; i++ {
+		covered += nn.sizes[i]
+		count++
+	}
+	if count > n {
+		n = count
+	}
+	return n
+}
+
+// FetchChild implements the `ipld.NavigableNode` interface.
+func (nn *navigableNode) FetchChild(ctx context.Context, childIndex uint) (ipld.NavigableNode, error) {
+	// The promises of preloaded children may be resolved already, don't
+	// let them hide a canceled read.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if in, ok := nn.index.lookup(nn.childCIDs[childIndex].KeyString()); ok {
+		// Internal node visited before, no need to fetch it again.
+		return nn.navigableChild(in.node, childIndex)
+	}
+
+	// If the following half batch isn't requested yet, request the next
+	// batch from the first missing child.
+	batch := nn.batchSize(childIndex)
+	for i := childIndex; i < childIndex+(batch+1)/2 && i < uint(len(nn.childPromises)); i++ {
+		if i > childIndex && nn.pastLimit(i) {
+			break
+		}
+		if nn.childPromises[i] == nil {
+			nn.preload(i, nn.batchSize(i))
+			break
+		}
+	}
+
+	child, err := nn.getPromiseValue(ctx, childIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	nn.ahead.fetched(child)
+	return nn.navigableChild(child, childIndex)
+}
+
+func (nn *navigableNode) navigableChild(child ipld.Node, childIndex uint) (*navigableNode, error) {
+	if nn.ahead.verify {
+		if nn.sizes == nil {
+			return nil, missingSizesError(nn.node)
+		}
+		if err := verifyNode(child, nn.sizes[childIndex]); err != nil {
+			return nil, err
+		}
+	}
+	offset := int64(-1)
+	if nn.offset >= 0 && nn.starts != nil {
+		offset = nn.offset + int64(nn.starts[childIndex])
+	}
+	return newNavigableNode(child, offset, nn.getter, nn.ahead, nn.index), nil
+}
+
+// pastLimit returns whether the child `i` may start past the limit of the
+// reader, and so must not be requested ahead of time.
+func (nn *navigableNode) pastLimit(i uint) bool {
+	if nn.ahead.limit == 0 {
+		return false
+	}
+	if nn.offset < 0 || nn.starts == nil {
+		return true
+	}
+	return uint64(nn.offset)+nn.starts[i] >= nn.ahead.limit
+}
+
+// preload requests `count` children from `beg` in a single batch, leaving
+// out the ones already in the index and the ones past the limit.
+func (nn *navigableNode) preload(beg, count uint) {
+	end := beg + count
+	if end > uint(len(nn.childCIDs)) {
+		end = uint(len(nn.childCIDs))
+	}
+	for end > beg+1 && nn.pastLimit(end-1) {
+		end--
+	}
+	var cids []cid.Cid
+	var indexes []uint
+	for i := beg; i < end; i++ {
+		if _, ok := nn.index.lookup(nn.childCIDs[i].KeyString()); !ok {
+			cids = append(cids, nn.childCIDs[i])
+			indexes = append(indexes, i)
+		}
+	}
+	for i, promise := range ipld.GetNodes(nn.ahead.ctx, nn.getter, cids) {
+		nn.childPromises[indexes[i]] = promise
+	}
+}
+
+func (nn *navigableNode) getPromiseValue(ctx context.Context, childIndex uint) (ipld.Node, error) {
+	value, err := nn.childPromises[childIndex].Get(ctx)
+	if err != nil && ctx.Err() != nil {
+		// Only waiting was canceled, keep the request in flight for the
+		// next read.
+		return nil, ctx.Err()
+	}
+	nn.childPromises[childIndex] = nil
+	return value, err
+}
+
+// ChildTotal implements the `ipld.NavigableNode` interface.
+func (nn *navigableNode) ChildTotal() uint {
+	return uint(len(nn.childCIDs))
+}
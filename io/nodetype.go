@@ -0,0 +1,38 @@
+package io
+
+import (
+	"fmt"
+
+	"github.com/TRON-US/go-unixfs"
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// NodeTypeError is returned by the readers with `TypedErrors` (see
+// `DagReaderOptions`) for unixfs nodes that aren't files, with their type so callers can branch on it. It matches
+// (with `errors.Is`) `ErrIsDir` for directories and HAMT shards,
+// `ErrCantReadSymlinks` for symlinks (see `SymlinkError`, which also
+// carries the target) and `unixfs.ErrUnrecognizedType` otherwise.
+type NodeTypeError struct {
+	Type pb.Data_DataType
+}
+
+func (e *NodeTypeError) Error() string {
+	switch e.Type {
+	case unixfs.TDirectory, unixfs.THAMTShard:
+		return fmt.Sprintf("%s (%s)", ErrIsDir, e.Type)
+	default:
+		return fmt.Sprintf("%s: %s", unixfs.ErrUnrecognizedType, e.Type)
+	}
+}
+
+// Is reports whether `target` is the sentinel error of the node type.
+func (e *NodeTypeError) Is(target error) bool {
+	switch e.Type {
+	case unixfs.TDirectory, unixfs.THAMTShard:
+		return target == ErrIsDir
+	case unixfs.TSymlink:
+		return target == ErrCantReadSymlinks
+	default:
+		return target == unixfs.ErrUnrecognizedType
+	}
+}
@@ -0,0 +1,89 @@
+package io
+
+import (
+	"sort"
+	"sync"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Maximum number of internal nodes kept by an `offsetIndex`, with the
+// default chunker and fanout it covers files of around 180GB (and takes
+// around 35MB).
+const maxIndexedNodes = 4096
+
+// offsetIndex keeps the internal nodes visited by a reader, along with the
+// offsets of their children, so seeking (backwards in particular, which
+// restarts the walk from the root) descends straight to the child covering
+// an offset at every level and doesn't fetch the intermediate nodes again.
+// It is shared by the readers cloned from the same one (see
+// `CloneDagReader`).
+type offsetIndex struct {
+	lk    sync.RWMutex
+	nodes map[string]*indexedNode
+}
+
+// indexedNode is an internal node of an `offsetIndex`.
+type indexedNode struct {
+	node ipld.Node
+	// Sizes of the children (from the unixfs block sizes) and offsets of
+	// their data relative to the node, nil without (consistent) size
+	// hints.
+	sizes  []uint64
+	starts []uint64
+}
+
+func newOffsetIndex() *offsetIndex {
+	return &offsetIndex{nodes: make(map[string]*indexedNode)}
+}
+
+// get returns the indexed node of `node`, indexing it if it is an internal
+// node (and there is room).
+func (idx *offsetIndex) get(node ipld.Node, sizes []uint64) *indexedNode {
+	key := node.Cid().KeyString()
+	if in, ok := idx.lookup(key); ok {
+		return in
+	}
+	in := &indexedNode{node: node, sizes: sizes}
+	if sizes != nil {
+		in.starts = make([]uint64, len(sizes))
+		var off uint64
+		for i, s := range sizes {
+			in.starts[i] = off
+			off += s
+		}
+	}
+	if len(node.Links()) == 0 {
+		return in
+	}
+	idx.lk.Lock()
+	defer idx.lk.Unlock()
+	if indexed, ok := idx.nodes[key]; ok {
+		return indexed
+	}
+	if len(idx.nodes) < maxIndexedNodes {
+		idx.nodes[key] = in
+	}
+	return in
+}
+
+// lookup returns the indexed node with the given key, if any.
+func (idx *offsetIndex) lookup(key string) (*indexedNode, bool) {
+	idx.lk.RLock()
+	defer idx.lk.RUnlock()
+	in, ok := idx.nodes[key]
+	return in, ok
+}
+
+// childAt returns the index of the child covering `offset` (relative to
+// the node) and the offset relative to that child. Past the end it returns
+// the last child, the offset is then past its end as well.
+func (in *indexedNode) childAt(offset uint64) (int, uint64) {
+	i := sort.Search(len(in.sizes), func(i int) bool {
+		return in.starts[i]+in.sizes[i] > offset
+	})
+	if i == len(in.sizes) {
+		i--
+	}
+	return i, offset - in.starts[i]
+}
@@ -0,0 +1,51 @@
+package io
+
+import (
+	"context"
+	"io"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// pipeBufferSize is the size of the reads of `Pipe`, small enough to
+// cover a single block of the usual chunk sizes.
+const pipeBufferSize = 32 * 1024
+
+// Pipe streams the file `n` into a pipe from a new goroutine, returning its
+// read end. The blocks are requested `maxBlocks` at a time (10 if zero, see
+// `DagReaderOptions.Prefetch`) as the data is written to the pipe, which
+// blocks until the consumer reads it, so a slow consumer (e.g., a throttled
+// HTTP client) throttles the fetching instead of the file being buffered
+// in memory. Closing the read end (or canceling `ctx`) stops the stream,
+// aborting the requests in flight; errors reading the file are returned by
+// the reads of the consumer.
+func Pipe(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, maxBlocks int) (*io.PipeReader, error) {
+	r, err := NewDagReaderWithOptions(ctx, n, serv, DagReaderOptions{Prefetch: maxBlocks})
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.Close()
+		// Not `io.Copy`, `WriteTo` would request all the blocks left.
+		buf := make([]byte, pipeBufferSize)
+		for {
+			n, err := r.CtxReadFull(ctx, buf)
+			if n > 0 {
+				if _, werr := pw.Write(buf[:n]); werr != nil {
+					// Closed by the consumer.
+					return
+				}
+			}
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr, nil
+}
@@ -0,0 +1,198 @@
+package io
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ErrInvalidPosition is returned by `PositionSaver.Restore` for tokens that
+// aren't positions of the file being read.
+var ErrInvalidPosition = errors.New("invalid position token")
+
+// positionVersion is the first byte of the position tokens, for the
+// tokens saved by other versions to be rejected instead of misread.
+const positionVersion = 1
+
+// encodePosition returns the token of the position `off` in the file of
+// root `root` (empty for buffered readers), with the CIDs of the internal
+// nodes down to the leaf at `off`.
+func encodePosition(root []byte, off uint64, path []cid.Cid) []byte {
+	token := []byte{positionVersion}
+	token = appendBytes(token, root)
+	token = appendUvarint(token, off)
+	token = appendUvarint(token, uint64(len(path)))
+	for _, c := range path {
+		token = appendBytes(token, c.Bytes())
+	}
+	return token
+}
+
+// decodePosition returns the fields of the token of a position in the file
+// of root `root`.
+func decodePosition(token, root []byte) (uint64, []cid.Cid, error) {
+	if len(token) == 0 || token[0] != positionVersion {
+		return 0, nil, ErrInvalidPosition
+	}
+	dec := tokenDecoder{buf: token[1:]}
+	tokenRoot := dec.bytes()
+	off := dec.uvarint()
+	count := dec.uvarint()
+	if count > uint64(len(dec.buf)) {
+		return 0, nil, ErrInvalidPosition
+	}
+	path := make([]cid.Cid, count)
+	for i := range path {
+		if dec.err == nil {
+			path[i], dec.err = cid.Cast(dec.bytes())
+		}
+	}
+	if dec.err != nil || len(dec.buf) > 0 || string(tokenRoot) != string(root) {
+		return 0, nil, ErrInvalidPosition
+	}
+	return off, path, nil
+}
+
+// savePosition returns the token of the position `off`, with the internal
+// nodes down to the leaf at `off` known from the index (nothing is fetched
+// to save a position).
+func (dr *dagReader) savePosition(off int64) []byte {
+	var path []cid.Cid
+	node := dr.rootNode
+	rel := uint64(off)
+	for {
+		in, ok := dr.index.lookup(node.Cid().KeyString())
+		if !ok || in.sizes == nil {
+			break
+		}
+		i, childOff := in.childAt(rel)
+		child, ok := dr.index.lookup(node.Links()[i].Cid.KeyString())
+		if !ok {
+			// A leaf (or not indexed).
+			break
+		}
+		path = append(path, child.node.Cid())
+		node, rel = child.node, childOff
+	}
+	return encodePosition(dr.rootNode.Cid().Bytes(), uint64(off), path)
+}
+
+// restorePosition returns the offset of the position `token`, after
+// fetching the internal nodes of its path in a single batch (into the
+// index), so the next read descends to the leaf without a round-trip per
+// level.
+func (dr *dagReader) restorePosition(token []byte) (int64, error) {
+	off, path, err := decodePosition(token, dr.rootNode.Cid().Bytes())
+	if err != nil {
+		return 0, err
+	}
+	if off > dr.size {
+		return 0, ErrInvalidPosition
+	}
+
+	ctx, cancel := context.WithCancel(dr.ctx)
+	defer cancel()
+	for opt := range dr.serv.GetMany(ctx, path) {
+		if opt.Err != nil {
+			return 0, opt.Err
+		}
+		dr.index.get(opt.Node, blockSizes(opt.Node))
+	}
+	if err := dr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return int64(off), nil
+}
+
+// Save implements the `PositionSaver` interface.
+func (dr *dagReader) Save() ([]byte, error) {
+	if err := dr.checkClosed(); err != nil {
+		return nil, err
+	}
+	return dr.savePosition(dr.offset), nil
+}
+
+// Restore implements the `PositionSaver` interface.
+func (dr *dagReader) Restore(token []byte) error {
+	if err := dr.checkClosed(); err != nil {
+		return err
+	}
+	off, err := dr.restorePosition(token)
+	if err != nil {
+		return err
+	}
+	_, err = dr.Seek(off, io.SeekStart)
+	return err
+}
+
+// Save implements the `PositionSaver` interface, the token holds the offset
+// in the file (not in the section).
+func (sr *sectionReader) Save() ([]byte, error) {
+	if err := sr.dr.checkClosed(); err != nil {
+		return nil, err
+	}
+	return sr.dr.savePosition(sr.base + sr.pos), nil
+}
+
+// Restore implements the `PositionSaver` interface, the position must be in
+// the section.
+func (sr *sectionReader) Restore(token []byte) error {
+	if err := sr.dr.checkClosed(); err != nil {
+		return err
+	}
+	off, err := sr.dr.restorePosition(token)
+	if err != nil {
+		return err
+	}
+	if off < sr.base || off-sr.base > sr.size {
+		return ErrInvalidPosition
+	}
+	sr.pos = off - sr.base
+	return nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendBytes(buf, b []byte) []byte {
+	return append(appendUvarint(buf, uint64(len(b))), b...)
+}
+
+// tokenDecoder reads the fields of a position token, the first error
+// stops it.
+type tokenDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *tokenDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidPosition
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *tokenDecoder) bytes() []byte {
+	l := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if l > uint64(len(d.buf)) {
+		d.err = ErrInvalidPosition
+		return nil
+	}
+	b := d.buf[:l]
+	d.buf = d.buf[l:]
+	return b
+}
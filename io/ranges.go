@@ -0,0 +1,160 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/TRON-US/go-unixfs"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Range is a byte range of a file.
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// ReadRanges reads the byte ranges of the file of `r` (e.g., the ones of an
+// HTTP multipart range request, or the column chunks of a parquet file)
+// in a single traversal of the DAG: the nodes shared by several ranges are
+// fetched once, and the children of a node needed by any of them are
+// requested in one batch. It returns the data of every range in order,
+// ranges are truncated to the end of the file and may overlap. Like
+// `ReadAt`, it doesn't use or move the reader position. Readers other than
+// the ones of this package are read range by range with `ReadAt` (by
+// seeking if they don't implement `io.ReaderAt`).
+func ReadRanges(ctx context.Context, r DagReader, ranges []Range) ([][]byte, error) {
+	base := int64(0)
+	size := int64(r.Size())
+	var dr *dagReader
+	switch r := r.(type) {
+	case *dagReader:
+		dr = r
+	case *sectionReader:
+		dr, base = r.dr, r.base
+	case *FileContent:
+		return ReadRanges(ctx, r.DagReader, ranges)
+	case *File:
+		return ReadRanges(ctx, r.DagReader, ranges)
+	}
+
+	out := make([][]byte, len(ranges))
+	var pieces []rangePiece
+	for i, rg := range ranges {
+		if rg.Offset < 0 || rg.Length < 0 {
+			return nil, errors.New("invalid range")
+		}
+		length := rg.Length
+		if rg.Offset >= size {
+			length = 0
+		} else if length > size-rg.Offset {
+			length = size - rg.Offset
+		}
+		out[i] = make([]byte, length)
+		if length > 0 {
+			pieces = append(pieces, rangePiece{off: uint64(base + rg.Offset), buf: out[i]})
+		}
+	}
+
+	if dr == nil {
+		for i, rg := range ranges {
+			if _, err := readFileAt(r, out[i], rg.Offset); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	if len(pieces) == 0 {
+		return out, nil
+	}
+	if err := readRanges(ctx, dr.serv, dr.rootNode, pieces, dr.ahead.verify); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// rangePiece is the part of a range under a node, `buf` is filled with the
+// data at the offset `off` relative to the node.
+type rangePiece struct {
+	off uint64
+	buf []byte
+}
+
+// readRanges reads the pieces of the file DAG under `node`, like `readAt`
+// does for a single one.
+func readRanges(ctx context.Context, serv ipld.NodeGetter, node ipld.Node, pieces []rangePiece, verify bool) error {
+	if len(node.Links()) == 0 {
+		data, err := leafData(node)
+		if err != nil {
+			return err
+		}
+		for _, p := range pieces {
+			if p.off > uint64(len(data)) || copy(p.buf, data[p.off:]) < len(p.buf) {
+				// Less data than the size hints.
+				return io.ErrUnexpectedEOF
+			}
+		}
+		return nil
+	}
+
+	fsNode, err := unixfs.ExtractFSNode(node)
+	if err != nil {
+		return err
+	}
+	if fsNode.NumChildren() != len(node.Links()) {
+		return ErrSeekNotSupported
+	}
+
+	// Split the pieces among the children they span. Children are taken in
+	// order, so the pieces of each of them are in the order of `pieces`.
+	var cids []cid.Cid
+	var sizes []uint64
+	var childPieces [][]rangePiece
+	var cur uint64
+	for i, bs := range fsNode.BlockSizes() {
+		var under []rangePiece
+		for _, p := range pieces {
+			beg, end := p.off, p.off+uint64(len(p.buf))
+			if beg < cur {
+				beg = cur
+			}
+			if end > cur+bs {
+				end = cur + bs
+			}
+			if beg < end {
+				under = append(under, rangePiece{
+					off: beg - cur,
+					buf: p.buf[beg-p.off : end-p.off],
+				})
+			}
+		}
+		if under != nil {
+			cids = append(cids, node.Links()[i].Cid)
+			sizes = append(sizes, bs)
+			childPieces = append(childPieces, under)
+		}
+		cur += bs
+	}
+
+	for i, promise := range ipld.GetNodes(ctx, serv, cids) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		child, err := promise.Get(ctx)
+		if err != nil {
+			return err
+		}
+		if verify {
+			if err := verifyNode(child, sizes[i]); err != nil {
+				return err
+			}
+		}
+		if err := readRanges(ctx, serv, child, childPieces[i], verify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package io
+
+import (
+	"context"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// ReadOnlyError is returned when a mutating path (any call that would end in
+// a DAGService write) is reached in read-only mode. It matches
+// `merkledag.ErrReadOnly` in `errors.Is` checks.
+type ReadOnlyError struct {
+	// Op is the operation that was refused, e.g. "Add" or "Truncate".
+	Op string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("unixfs: %s refused in read-only mode", e.Op)
+}
+
+// Is makes the error compatible with `merkledag.ErrReadOnly`.
+func (e *ReadOnlyError) Is(target error) bool {
+	return target == mdag.ErrReadOnly
+}
+
+// readOnlyDAGService forwards all the reads to the wrapped NodeGetter and
+// refuses any write with a `*ReadOnlyError`.
+type readOnlyDAGService struct {
+	ipld.NodeGetter
+}
+
+// NewReadOnlyDAGService wraps `ng` so that it can be handed to readers,
+// walkers, resolvers and directories while guaranteeing that no Add or
+// Remove ever reaches the underlying store, which is what you want when
+// pointing tooling at a production blockstore.
+func NewReadOnlyDAGService(ng ipld.NodeGetter) ipld.DAGService {
+	if ro, ok := ng.(*readOnlyDAGService); ok {
+		return ro
+	}
+	return &readOnlyDAGService{ng}
+}
+
+func (*readOnlyDAGService) Add(context.Context, ipld.Node) error {
+	return &ReadOnlyError{Op: "Add"}
+}
+
+func (*readOnlyDAGService) AddMany(context.Context, []ipld.Node) error {
+	return &ReadOnlyError{Op: "AddMany"}
+}
+
+func (*readOnlyDAGService) Remove(context.Context, cid.Cid) error {
+	return &ReadOnlyError{Op: "Remove"}
+}
+
+func (*readOnlyDAGService) RemoveMany(context.Context, []cid.Cid) error {
+	return &ReadOnlyError{Op: "RemoveMany"}
+}
@@ -165,7 +165,7 @@ func NewReedSolomonDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGet
 // Size returns the total size of the data from the decoded DAG structured file
 // using reed solomon algorithm.
 func (rsdr *ReedSolomonDagReader) Size() uint64 {
-	return uint64(rsdr.Len())
+	return uint64(rsdr.Reader.Size())
 }
 
 // Close has no effect since the underlying reader is a buffer.
@@ -2,6 +2,10 @@ package io
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 
 	ft "github.com/TRON-US/go-unixfs"
 	hamt "github.com/TRON-US/go-unixfs/hamt"
@@ -10,19 +14,48 @@ import (
 	ipld "github.com/ipfs/go-ipld-format"
 )
 
+// MaxSymlinks is the number of symlinks `Resolve` follows at most in a
+// path, as in POSIX systems.
+const MaxSymlinks = 40
+
+// Path resolution errors (see `NotFoundError`).
+var (
+	ErrNotFound        = errors.New("no such entry")
+	ErrTooManySymlinks = errors.New("too many levels of symbolic links")
+)
+
+// NotFoundError is returned by `Resolve` for a path with a missing entry.
+// It matches (with `errors.Is`) `ErrNotFound` and `os.ErrNotExist`.
+type NotFoundError struct {
+	// Dir is the path of the directory searched, as resolved (after
+	// following the symlinks), and Name the entry missing in it.
+	Dir  string
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: %q in /%s", ErrNotFound, e.Name, e.Dir)
+}
+
+// Is reports whether `target` is `ErrNotFound` or `os.ErrNotExist`.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound || target == os.ErrNotExist
+}
+
 // ResolveUnixfsOnce resolves a single hop of a path through a graph in a
 // unixfs context. This includes handling traversing sharded directories.
 func ResolveUnixfsOnce(ctx context.Context, ds ipld.NodeGetter, nd ipld.Node, names []string) (*ipld.Link, []string, error) {
 	pn, ok := nd.(*dag.ProtoNode)
 	if ok {
-		fsn, err := ft.FSNodeFromBytes(pn.Data())
+		// Only the type is needed, probed for every hop of the path.
+		typ, err := ft.DataType(pn.Data())
 		if err != nil {
 			// Not a unixfs node, use standard object traversal code
 			return nd.ResolveLink(names)
 		}
 
-		if fsn.Type() == ft.THAMTShard {
-			rods := dag.NewReadOnlyDagService(ds)
+		if typ == ft.THAMTShard {
+			rods := NewReadOnlyDAGService(ds)
 			s, err := hamt.NewHamtFromDag(rods, nd)
 			if err != nil {
 				return nil, nil, err
@@ -39,3 +72,71 @@ func ResolveUnixfsOnce(ctx context.Context, ds ipld.NodeGetter, nd ipld.Node, na
 
 	return nd.ResolveLink(names)
 }
+
+// Resolve returns the node at the path `p` (slash separated) under the
+// unixfs directory `root`, walking basic and sharded directories and
+// following symlinks, the last entry of the path included (as `os.Stat`
+// does): an absolute target is resolved from `root`, a relative one from
+// the directory of the symlink. Empty and "." segments are skipped and ".."
+// goes back to the parent directory (it stays at `root`). A missing entry
+// fails with a `*NotFoundError`, an entry that isn't a directory in the
+// middle of the path with `ErrNotADir` and more than `MaxSymlinks` symlinks
+// with `ErrTooManySymlinks`.
+func Resolve(ctx context.Context, ng ipld.NodeGetter, root ipld.Node, p string) (ipld.Node, error) {
+	ng = ft.InlineGetter(ng)
+	// The nodes walked from the root and their names.
+	nodes := []ipld.Node{root}
+	var names []string
+	segments := strings.Split(p, "/")
+	symlinks := 0
+	for len(segments) > 0 {
+		name := segments[0]
+		segments = segments[1:]
+		if name == "" || name == "." {
+			continue
+		}
+		dir := nodes[len(nodes)-1]
+		typ, err := ft.NodeType(dir)
+		if err != nil {
+			return nil, err
+		}
+		if typ != ft.TDirectory && typ != ft.THAMTShard {
+			return nil, fmt.Errorf("/%s: %w", strings.Join(names, "/"), ErrNotADir)
+		}
+		if name == ".." {
+			if len(names) > 0 {
+				nodes, names = nodes[:len(nodes)-1], names[:len(names)-1]
+			}
+			continue
+		}
+
+		lnk, _, err := ResolveUnixfsOnce(ctx, ng, dir, []string{name})
+		if err == dag.ErrLinkNotFound || err == os.ErrNotExist {
+			return nil, &NotFoundError{Dir: strings.Join(names, "/"), Name: name}
+		}
+		if err != nil {
+			return nil, err
+		}
+		child, err := lnk.GetNode(ctx, ng)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := ReadSymlink(child)
+		if err == ErrNotSymlink {
+			nodes, names = append(nodes, child), append(names, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if symlinks++; symlinks > MaxSymlinks {
+			return nil, ErrTooManySymlinks
+		}
+		if strings.HasPrefix(target, "/") {
+			nodes, names = nodes[:1], nil
+		}
+		segments = append(strings.Split(target, "/"), segments...)
+	}
+	return nodes[len(nodes)-1], nil
+}
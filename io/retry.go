@@ -0,0 +1,179 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// FetchError is returned by readers with a fetch policy (see
+// `DagReaderOptions.BlockTimeout` and `DagReaderOptions.Retries`) when a
+// block couldn't be fetched in any of the attempts, wrapping the error of
+// the last one (`context.DeadlineExceeded` if it timed out). It is also
+// returned by `OpenDagReader` when the root can't be fetched.
+type FetchError struct {
+	Cid      cid.Cid
+	Attempts int
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("fetching %s failed after %d attempts: %s", e.Cid, e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// retryGetter is a node getter enforcing a fetch policy: no block is waited
+// for longer than `timeout` (if set) and failed requests are retried up to
+// `retries` times, waiting `backoff` before the first retry and twice as
+// long before every following one.
+type retryGetter struct {
+	ipld.NodeGetter
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	stats   *readerStats
+}
+
+var _ ipld.NodeGetter = (*retryGetter)(nil)
+
+// wait sleeps before the retry following the attempt `attempt` (from 0).
+func (rg *retryGetter) wait(ctx context.Context, attempt int) error {
+	atomic.AddUint64(&rg.stats.retries, 1)
+	if rg.backoff <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(rg.backoff << uint(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get implements the `ipld.NodeGetter` interface.
+func (rg *retryGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	for attempt := 0; ; attempt++ {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if rg.timeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, rg.timeout)
+		}
+		nd, err := rg.NodeGetter.Get(actx, c)
+		cancel()
+		if err == nil {
+			return nd, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt == rg.retries {
+			return nil, &FetchError{Cid: c, Attempts: attempt + 1, Err: err}
+		}
+		if err := rg.wait(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// GetMany implements the `ipld.NodeGetter` interface, retrying only the
+// blocks missing after every attempt.
+func (rg *retryGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	// Buffered for all the nodes, so sending never blocks.
+	out := make(chan *ipld.NodeOption, len(keys))
+	go func() {
+		defer close(out)
+		pending := keys
+		for attempt := 0; ; attempt++ {
+			var err error
+			pending, err = rg.attempt(ctx, pending, out)
+			if len(pending) == 0 {
+				return
+			}
+			if ctx.Err() != nil {
+				out <- &ipld.NodeOption{Err: ctx.Err()}
+				return
+			}
+			if attempt == rg.retries {
+				out <- &ipld.NodeOption{Err: &FetchError{Cid: pending[0], Attempts: attempt + 1, Err: err}}
+				return
+			}
+			if err := rg.wait(ctx, attempt); err != nil {
+				out <- &ipld.NodeOption{Err: err}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// attempt requests the `keys` once, sending the nodes received to `out`
+// and returning the missing ones with the reason they are missing. The
+// attempt times out once no block arrived in `timeout`.
+func (rg *retryGetter) attempt(ctx context.Context, keys []cid.Cid, out chan<- *ipld.NodeOption) ([]cid.Cid, error) {
+	actx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := rg.NodeGetter.GetMany(actx, keys)
+
+	var timeout <-chan time.Time
+	var timer *time.Timer
+	if rg.timeout > 0 {
+		timer = time.NewTimer(rg.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	received := make(map[string]bool, len(keys))
+	var err error
+loop:
+	for {
+		select {
+		case opt, ok := <-results:
+			if !ok {
+				break loop
+			}
+			if opt.Err != nil {
+				err = opt.Err
+				continue
+			}
+			key := opt.Node.Cid().KeyString()
+			if !received[key] {
+				received[key] = true
+				out <- opt
+			}
+			if timer != nil {
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(rg.timeout)
+			}
+		case <-timeout:
+			err = context.DeadlineExceeded
+			// Let the canceled request finish on its own.
+			go func() {
+				for range results {
+				}
+			}()
+			break loop
+		}
+	}
+
+	var missing []cid.Cid
+	for _, c := range keys {
+		if !received[c.KeyString()] {
+			missing = append(missing, c)
+		}
+	}
+	if missing != nil && err == nil {
+		err = ipld.ErrNotFound
+	}
+	return missing, err
+}
@@ -0,0 +1,158 @@
+package io
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// FetchScheduler bounds the block requests in flight of the readers
+// attached to it (see `DagReaderOptions.Scheduler`) and serves their
+// requests in turn, a block of each reader with blocks waiting at a time,
+// so a reader of a huge file requesting hundreds of blocks doesn't starve
+// the small requests of the other readers sharing the DAGService. It is
+// safe to share between readers of different goroutines.
+type FetchScheduler struct {
+	maxInFlight int
+
+	lk       sync.Mutex
+	inFlight int
+	waiting  int
+	// Readers with blocks waiting, in turn, of `*fetchQueue`.
+	turns *list.List
+}
+
+// NewFetchScheduler returns a scheduler making up to `maxInFlight` (at
+// least one) block requests at a time.
+func NewFetchScheduler(maxInFlight int) *FetchScheduler {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &FetchScheduler{maxInFlight: maxInFlight, turns: list.New()}
+}
+
+// fetchQueue holds the blocks waiting of a reader, in the order they were
+// requested.
+type fetchQueue struct {
+	getter ipld.NodeGetter
+	blocks []scheduledBlock
+	// Element of the queue in `FetchScheduler.turns`, if waiting.
+	turn *list.Element
+}
+
+type scheduledBlock struct {
+	c   cid.Cid
+	req *scheduledRequest
+}
+
+// scheduledRequest is a `GetMany` call, its channel is closed once all
+// its blocks are done.
+type scheduledRequest struct {
+	ctx  context.Context
+	out  chan *ipld.NodeOption
+	left int
+}
+
+// enqueue queues the blocks of a request, starting fetchers up to the
+// limit.
+func (sc *FetchScheduler) enqueue(q *fetchQueue, req *scheduledRequest, keys []cid.Cid) {
+	sc.lk.Lock()
+	defer sc.lk.Unlock()
+	for _, c := range keys {
+		q.blocks = append(q.blocks, scheduledBlock{c: c, req: req})
+	}
+	sc.waiting += len(keys)
+	if q.turn == nil {
+		q.turn = sc.turns.PushBack(q)
+	}
+	for sc.inFlight < sc.maxInFlight && sc.inFlight < sc.waiting {
+		sc.inFlight++
+		go sc.fetch()
+	}
+}
+
+// next returns the block of the reader whose turn it is, moving it to the
+// end of the turns, false once no block is waiting (the fetcher calling it
+// then stops).
+func (sc *FetchScheduler) next() (*fetchQueue, scheduledBlock, bool) {
+	sc.lk.Lock()
+	defer sc.lk.Unlock()
+	e := sc.turns.Front()
+	if e == nil {
+		sc.inFlight--
+		return nil, scheduledBlock{}, false
+	}
+	q := e.Value.(*fetchQueue)
+	b := q.blocks[0]
+	q.blocks[0] = scheduledBlock{}
+	q.blocks = q.blocks[1:]
+	sc.waiting--
+	if len(q.blocks) == 0 {
+		sc.turns.Remove(e)
+		q.turn = nil
+	} else {
+		sc.turns.MoveToBack(e)
+	}
+	return q, b, true
+}
+
+// fetch requests the waiting blocks one at a time until there are none.
+func (sc *FetchScheduler) fetch() {
+	for {
+		q, b, ok := sc.next()
+		if !ok {
+			return
+		}
+		// The blocks of canceled requests are only dropped.
+		if err := b.req.ctx.Err(); err == nil {
+			nd, err := q.getter.Get(b.req.ctx, b.c)
+			b.req.out <- &ipld.NodeOption{Node: nd, Err: err}
+		}
+		sc.lk.Lock()
+		b.req.left--
+		done := b.req.left == 0
+		sc.lk.Unlock()
+		if done {
+			close(b.req.out)
+		}
+	}
+}
+
+// scheduledGetter is a node getter making the requests of a reader through
+// a `FetchScheduler`.
+type scheduledGetter struct {
+	ipld.NodeGetter
+	scheduler *FetchScheduler
+	queue     *fetchQueue
+}
+
+var _ ipld.NodeGetter = (*scheduledGetter)(nil)
+
+func newScheduledGetter(serv ipld.NodeGetter, sc *FetchScheduler) *scheduledGetter {
+	return &scheduledGetter{NodeGetter: serv, scheduler: sc, queue: &fetchQueue{getter: serv}}
+}
+
+// Get implements the `ipld.NodeGetter` interface.
+func (sg *scheduledGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	opt, ok := <-sg.GetMany(ctx, []cid.Cid{c})
+	if !ok {
+		// Dropped, the request was canceled.
+		return nil, ctx.Err()
+	}
+	return opt.Node, opt.Err
+}
+
+// GetMany implements the `ipld.NodeGetter` interface.
+func (sg *scheduledGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	// Buffered for all the nodes, so sending never blocks.
+	out := make(chan *ipld.NodeOption, len(keys))
+	if len(keys) == 0 {
+		close(out)
+		return out
+	}
+	sg.scheduler.enqueue(sg.queue, &scheduledRequest{ctx: ctx, out: out, left: len(keys)}, keys)
+	return out
+}
@@ -0,0 +1,106 @@
+package io
+
+import (
+	"context"
+	"sync/atomic"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ReaderStats are the counters of a reader (see `Stats`), to diagnose slow
+// streams and tune the prefetch settings.
+type ReaderStats struct {
+	// Blocks is the number of blocks the reader got (from its cache or the
+	// DAGService, the root node only if fetched by `OpenDagReader`, not
+	// the ones decoded from their inline CID) and BlockBytes their total
+	// size.
+	Blocks     uint64
+	BlockBytes uint64
+	// CacheHits is the number of those blocks found in the cache (see
+	// `DagReaderOptions.Cache`).
+	CacheHits uint64
+	// Retries is the number of block requests retried (see
+	// `DagReaderOptions.Retries`).
+	Retries uint64
+	// Delivered is the number of bytes of file data delivered (by reads,
+	// copies and reads at an offset).
+	Delivered uint64
+}
+
+// readerStats are the counters of a reader, updated atomically as they may
+// be read (and updated by clones) from other goroutines.
+type readerStats struct {
+	blocks     uint64
+	blockBytes uint64
+	cacheHits  uint64
+	retries    uint64
+	delivered  uint64
+}
+
+func (rs *readerStats) get() ReaderStats {
+	return ReaderStats{
+		Blocks:     atomic.LoadUint64(&rs.blocks),
+		BlockBytes: atomic.LoadUint64(&rs.blockBytes),
+		CacheHits:  atomic.LoadUint64(&rs.cacheHits),
+		Retries:    atomic.LoadUint64(&rs.retries),
+		Delivered:  atomic.LoadUint64(&rs.delivered),
+	}
+}
+
+func (rs *readerStats) got(nd ipld.Node) {
+	atomic.AddUint64(&rs.blocks, 1)
+	atomic.AddUint64(&rs.blockBytes, uint64(len(nd.RawData())))
+}
+
+// Stats returns the counters of a reader of this package (zero for other
+// readers), safe to call while it is read. Clones (see `CloneDagReader`)
+// share the counters of the reader they were cloned from.
+func Stats(r DagReader) ReaderStats {
+	switch r := r.(type) {
+	case *dagReader:
+		return r.stats.get()
+	case *sectionReader:
+		return r.dr.stats.get()
+	case *FileContent:
+		return Stats(r.DagReader)
+	case *File:
+		return Stats(r.DagReader)
+	default:
+		return ReaderStats{}
+	}
+}
+
+// statsGetter counts the blocks returned by the getters of a reader.
+type statsGetter struct {
+	ipld.NodeGetter
+	stats *readerStats
+}
+
+var _ ipld.NodeGetter = (*statsGetter)(nil)
+
+// Get implements the `ipld.NodeGetter` interface.
+func (sg *statsGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := sg.NodeGetter.Get(ctx, c)
+	if err == nil {
+		sg.stats.got(nd)
+	}
+	return nd, err
+}
+
+// GetMany implements the `ipld.NodeGetter` interface.
+func (sg *statsGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	results := sg.NodeGetter.GetMany(ctx, keys)
+	// Buffered for all the nodes, so sending never blocks.
+	out := make(chan *ipld.NodeOption, len(keys))
+	go func() {
+		defer close(out)
+		for opt := range results {
+			if opt.Err == nil {
+				sg.stats.got(opt.Node)
+			}
+			out <- opt
+		}
+	}()
+	return out
+}
@@ -0,0 +1,48 @@
+package io
+
+import (
+	"github.com/TRON-US/go-unixfs"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// ErrNotSymlink is returned by `ReadSymlink` for nodes that aren't
+// symlinks.
+var ErrNotSymlink = unixfs.ErrNotSymlink
+
+// SymlinkError is returned by the readers with `TypedErrors` (see
+// `DagReaderOptions`) when asked to read a symlink,
+// with the target of the link so the caller can follow it. It matches
+// `ErrCantReadSymlinks` with `errors.Is`, and a `*NodeTypeError` (of a
+// symlink) with `errors.As`.
+type SymlinkError struct {
+	Target string
+}
+
+func (e *SymlinkError) Error() string {
+	return ErrCantReadSymlinks.Error() + " (link to " + e.Target + ")"
+}
+
+// Is reports whether `target` is `ErrCantReadSymlinks`.
+func (e *SymlinkError) Is(target error) bool {
+	return target == ErrCantReadSymlinks
+}
+
+// As sets `target` to the `*NodeTypeError` of a symlink, if it is one.
+func (e *SymlinkError) As(target interface{}) bool {
+	nte, ok := target.(**NodeTypeError)
+	if ok {
+		*nte = &NodeTypeError{Type: unixfs.TSymlink}
+	}
+	return ok
+}
+
+// ReadSymlink returns the target of the unixfs symlink `nd`,
+// `ErrNotSymlink` if it is another kind of node.
+func ReadSymlink(nd ipld.Node) (string, error) {
+	pn, ok := nd.(*mdag.ProtoNode)
+	if !ok {
+		return "", ErrNotSymlink
+	}
+	return unixfs.SymlinkTarget(pn.Data())
+}
@@ -0,0 +1,108 @@
+package io
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TRON-US/go-unixfs"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// CorruptionError is returned by verified reads (see
+// `DagReaderOptions.Verify`) when the sizes declared in the DAG don't match
+// the data it holds.
+type CorruptionError struct {
+	// Cid is the offending node.
+	Cid cid.Cid
+	// Declared is the size of the node declared by its parent (or, for
+	// the root and internal nodes, its own file size) and Actual the size
+	// of the data it holds.
+	Declared uint64
+	Actual   uint64
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("unixfs: corrupted node %s: declares %d bytes, holds %d", e.Cid, e.Declared, e.Actual)
+}
+
+// dataSize returns the size of the file data under `nd`, the size of the
+// data of a leaf or, for internal nodes, the size of their data plus the
+// block sizes of their children, checking it matches their file size.
+func dataSize(nd ipld.Node) (uint64, error) {
+	if len(nd.Links()) == 0 {
+		data, err := leafData(nd)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(len(data)), nil
+	}
+
+	fsNode, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return 0, err
+	}
+	if fsNode.NumChildren() != len(nd.Links()) {
+		return 0, missingSizesError(nd)
+	}
+	size, err := fsNode.ChildrenSize()
+	if err != nil {
+		return 0, err
+	}
+	if size, err = unixfs.AddSizes(size, uint64(len(fsNode.Data()))); err != nil {
+		return 0, err
+	}
+	if size != fsNode.FileSize() {
+		return 0, &CorruptionError{Cid: nd.Cid(), Declared: fsNode.FileSize(), Actual: size}
+	}
+	return size, nil
+}
+
+// missingSizesError returns the `*CorruptionError` of the internal node
+// `nd` not declaring the sizes of all its children, its actual size being
+// the one its data and the sizes it declares add up to.
+func missingSizesError(nd ipld.Node) error {
+	fsNode, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return err
+	}
+	size, err := fsNode.ChildrenSize()
+	if err != nil {
+		return err
+	}
+	if size, err = unixfs.AddSizes(size, uint64(len(fsNode.Data()))); err != nil {
+		return err
+	}
+	return &CorruptionError{Cid: nd.Cid(), Declared: fsNode.FileSize(), Actual: size}
+}
+
+// verifyNode checks that `nd` holds the `declared` bytes of data.
+func verifyNode(nd ipld.Node, declared uint64) error {
+	size, err := dataSize(nd)
+	if err != nil {
+		return err
+	}
+	if size != declared {
+		return &CorruptionError{Cid: nd.Cid(), Declared: declared, Actual: size}
+	}
+	return nil
+}
+
+// VerifyChecksum reads the file under the `TMetadata` root `nd` and checks
+// its data matches the checksum of the metadata (see
+// `unixfs.Metadata.VerifyChecksum`), a `*unixfs.ChecksumError` otherwise.
+// It returns `unixfs.ErrNoChecksum` if the file has no checksum. The read
+// is verified as with `DagReaderOptions.Verify`, so a corrupted DAG is
+// reported with the offending node.
+func VerifyChecksum(ctx context.Context, nd ipld.Node, serv ipld.NodeGetter) error {
+	r, err := NewDagReaderWithOptions(ctx, nd, serv, DagReaderOptions{Verify: true})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	md := FileMetadata(r)
+	if md == nil {
+		return unixfs.ErrNoChecksum
+	}
+	return md.VerifyChecksum(r)
+}
@@ -0,0 +1,163 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// View is a read-only window over the data of a file (see `ViewAt`). A
+// window within a single leaf is the data of the leaf itself (in the
+// block cache, if the reader has one), not a copy, while a window spanning
+// several leaves is copied into a pooled buffer. Its bytes must not be
+// modified, nor used after `Release`.
+type View struct {
+	data []byte
+	// Pooled buffer of `data`, nil if it is the data of a leaf.
+	buf *[]byte
+}
+
+// Bytes returns the data of the view.
+func (v *View) Bytes() []byte {
+	return v.data
+}
+
+// Release returns the buffer of the view to the pool, the view and its
+// bytes must not be used anymore.
+func (v *View) Release() {
+	if v.buf != nil {
+		viewBuffers.Put(v.buf)
+		v.buf = nil
+	}
+	v.data = nil
+}
+
+// viewBuffers pools the buffers of the views spanning several leaves.
+var viewBuffers = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+func newPooledView(n int) *View {
+	buf := viewBuffers.Get().(*[]byte)
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	return &View{data: (*buf)[:n], buf: buf}
+}
+
+// ViewAt returns a view of `n` bytes of the file of `r` at `off` (fewer
+// along with `io.EOF` at the end of the file), for parsers consuming the
+// data in place (e.g., reading fixed-size records) without copying it out
+// of the blocks. Like `ReadAt`, it doesn't use or move the reader position
+// and is safe to call concurrently. The views of readers other than the
+// ones of this package are always read into pooled buffers with `ReadAt`
+// (by seeking if they don't implement `io.ReaderAt`).
+func ViewAt(ctx context.Context, r DagReader, off int64, n int) (*View, error) {
+	if off < 0 || n < 0 {
+		return nil, errors.New("invalid view")
+	}
+	var dr *dagReader
+	base := int64(0)
+	switch r := r.(type) {
+	case *dagReader:
+		dr = r
+	case *sectionReader:
+		dr, base = r.dr, r.base
+	case *FileContent:
+		return ViewAt(ctx, r.DagReader, off, n)
+	case *File:
+		return ViewAt(ctx, r.DagReader, off, n)
+	}
+
+	var err error
+	if size := int64(r.Size()); off >= size {
+		n, err = 0, io.EOF
+	} else if int64(n) > size-off {
+		n, err = int(size-off), io.EOF
+	}
+	if n == 0 {
+		return &View{}, err
+	}
+
+	if dr == nil {
+		v := newPooledView(n)
+		if _, rerr := readFileAt(r, v.data, off); rerr != nil && rerr != io.EOF {
+			v.Release()
+			return nil, rerr
+		}
+		return v, err
+	}
+
+	v, verr := dr.viewAt(ctx, uint64(base+off), n)
+	if verr != nil {
+		return nil, verr
+	}
+	atomic.AddUint64(&dr.stats.delivered, uint64(n))
+	return v, err
+}
+
+// viewAt returns a view of the `n` bytes at `off` (in the file), which
+// must be in the file.
+func (dr *dagReader) viewAt(ctx context.Context, off uint64, n int) (*View, error) {
+	leaf, leafOff, err := dr.leafAt(ctx, off)
+	if err != nil {
+		return nil, err
+	}
+	if leaf != nil {
+		data, err := leafData(leaf)
+		if err != nil {
+			return nil, err
+		}
+		if leafOff+uint64(n) <= uint64(len(data)) {
+			return &View{data: data[leafOff : leafOff+uint64(n)]}, nil
+		}
+	}
+
+	v := newPooledView(n)
+	read, err := readAt(ctx, dr.serv, dr.rootNode, v.data, off, dr.ahead.verify)
+	if err == nil && read < n {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		v.Release()
+		return nil, err
+	}
+	return v, nil
+}
+
+// leafAt returns the leaf covering `off` and the offset relative to it,
+// descending through the internal nodes of the index (indexing the ones
+// it fetches). It returns a nil leaf under nodes without size hints.
+func (dr *dagReader) leafAt(ctx context.Context, off uint64) (ipld.Node, uint64, error) {
+	node := dr.rootNode
+	for len(node.Links()) > 0 {
+		in, ok := dr.index.lookup(node.Cid().KeyString())
+		if !ok {
+			in = dr.index.get(node, blockSizes(node))
+		}
+		if in.sizes == nil {
+			return nil, 0, nil
+		}
+		i, childOff := in.childAt(off)
+		c := node.Links()[i].Cid
+		if child, ok := dr.index.lookup(c.KeyString()); ok {
+			node, off = child.node, childOff
+			continue
+		}
+		child, err := dr.serv.Get(ctx, c)
+		if err != nil {
+			return nil, 0, err
+		}
+		if dr.ahead.verify {
+			if err := verifyNode(child, in.sizes[i]); err != nil {
+				return nil, 0, err
+			}
+		}
+		node, off = child, childOff
+	}
+	return node, off, nil
+}
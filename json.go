@@ -0,0 +1,175 @@
+package unixfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// fsNodeJSON is the JSON encoding of an `FSNode`, for debugging: the
+// fields of the message as they are (unset ones are left out), the type by
+// name (the one of registered subtypes too) and the mode as POSIX bits in
+// octal.
+type fsNodeJSON struct {
+	Type       string            `json:"type"`
+	Data       []byte            `json:"data,omitempty"`
+	FileSize   *uint64           `json:"fileSize,omitempty"`
+	BlockSizes []uint64          `json:"blockSizes,omitempty"`
+	HashType   *uint64           `json:"hashType,omitempty"`
+	Fanout     *uint64           `json:"fanout,omitempty"`
+	Mode       string            `json:"mode,omitempty"`
+	ModTime    *time.Time        `json:"modTime,omitempty"`
+	Xattrs     map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// MarshalJSON implements the `json.Marshaler` interface, encoding the
+// fields of the node for inspection (e.g., with `jq`). The data is encoded
+// in base64 and the modification time in RFC 3339.
+func (n *FSNode) MarshalJSON() ([]byte, error) {
+	j := fsNodeJSON{
+		Type:       typeName(n.Type()),
+		Data:       n.format.Data,
+		FileSize:   n.format.Filesize,
+		BlockSizes: n.format.Blocksizes,
+		HashType:   n.format.HashType,
+		Fanout:     n.format.Fanout,
+	}
+	if n.format.Mode != nil {
+		j.Mode = fmt.Sprintf("%04o", n.format.GetMode())
+	}
+	if mtime := n.ModTime(); !mtime.IsZero() {
+		j.ModTime = &mtime
+	}
+	if len(n.format.Xattrs) > 0 {
+		j.Xattrs = make(map[string][]byte, len(n.format.Xattrs))
+		for _, x := range n.format.Xattrs {
+			j.Xattrs[x.GetName()] = x.Value
+		}
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON implements the `json.Unmarshaler` interface, decoding the
+// encoding of `MarshalJSON` (the empty data, block sizes and extended
+// attribute values are decoded as unset).
+func (n *FSNode) UnmarshalJSON(b []byte) error {
+	var j fsNodeJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	typ, ok := typeByName(j.Type)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownType, j.Type)
+	}
+	*n = *NewFSNode(typ)
+	n.format.Data = j.Data
+	n.format.Filesize = j.FileSize
+	n.format.Blocksizes = j.BlockSizes
+	n.format.HashType = j.HashType
+	n.format.Fanout = j.Fanout
+	if j.Mode != "" {
+		bits, err := strconv.ParseUint(j.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode %q: %w", j.Mode, err)
+		}
+		n.format.Mode = proto.Uint32(uint32(bits))
+	}
+	if j.ModTime != nil {
+		n.SetModTime(*j.ModTime)
+	}
+	for name, value := range j.Xattrs {
+		n.SetXattr(name, value)
+	}
+	return nil
+}
+
+// metadataJSON is the JSON encoding of a `Metadata`, its checksum in
+// base58.
+type metadataJSON struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Size     uint64 `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// MarshalJSON implements the `json.Marshaler` interface.
+func (m *Metadata) MarshalJSON() ([]byte, error) {
+	j := metadataJSON{MimeType: m.MimeType, Size: m.Size}
+	if len(m.Checksum) > 0 {
+		j.Checksum = m.Checksum.B58String()
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON implements the `json.Unmarshaler` interface.
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	var j metadataJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*m = Metadata{MimeType: j.MimeType, Size: j.Size}
+	if j.Checksum != "" {
+		sum, err := mh.FromB58String(j.Checksum)
+		if err != nil {
+			return fmt.Errorf("invalid checksum %q: %w", j.Checksum, err)
+		}
+		m.Checksum = sum
+	}
+	return nil
+}
+
+// NodeDump is the debugging view of a node returned by `DumpNode`, meant to
+// be encoded in JSON.
+type NodeDump struct {
+	Cid string `json:"cid"`
+	// BlockSize is the size of the encoded node.
+	BlockSize int        `json:"blockSize"`
+	Links     []LinkDump `json:"links,omitempty"`
+	// RawLeaf is set for raw leaves, which have no unixfs data.
+	RawLeaf bool `json:"rawLeaf,omitempty"`
+	// UnixFS is the unixfs data of protobuf nodes.
+	UnixFS *FSNode `json:"unixfs,omitempty"`
+	// Metadata is the decoded metadata of `TMetadata` nodes.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// LinkDump is a link of a `NodeDump`.
+type LinkDump struct {
+	Name string `json:"name,omitempty"`
+	Cid  string `json:"cid"`
+	// Size is the cumulative size the link declares for its DAG.
+	Size uint64 `json:"size"`
+}
+
+// DumpNode returns the debugging view of `nd`: its CID, its links and its
+// unixfs data, e.g., to print it with `json.MarshalIndent`.
+func DumpNode(nd ipld.Node) (*NodeDump, error) {
+	d := &NodeDump{Cid: nd.Cid().String(), BlockSize: len(nd.RawData())}
+	for _, l := range nd.Links() {
+		d.Links = append(d.Links, LinkDump{Name: l.Name, Cid: l.Cid.String(), Size: l.Size})
+	}
+	if IsRawLeaf(nd) {
+		d.RawLeaf = true
+		return d, nil
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, ErrUnrecognizedType
+	}
+	fsn, err := FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, withKey(err, nd.Cid())
+	}
+	d.UnixFS = fsn
+	if fsn.Type() == TMetadata {
+		if d.Metadata, err = MetadataFromBytes(pn.Data()); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
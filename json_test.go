@@ -0,0 +1,98 @@
+package unixfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestJSON(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	fsn.AddBlockSize(10)
+	fsn.AddBlockSize(20)
+	fsn.SetMode(0755 | os.ModeSetuid)
+	fsn.SetModTime(time.Unix(1600000000, 42))
+	fsn.SetXattr("user.b", []byte("2"))
+	fsn.SetXattr("user.a", []byte("1"))
+	expected, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(fsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"type":"File"`, `"fileSize":30`, `"blockSizes":[10,20]`, `"mode":"4755"`} {
+		if !strings.Contains(string(b), field) {
+			t.Fatalf("expected %s in %s", field, b)
+		}
+	}
+	decoded := new(FSNode)
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := decoded.GetBytes(); err != nil || !bytes.Equal(data, expected) {
+		t.Fatalf("expected %x, got %x (%v)", expected, data, err)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"Device"}`), decoded); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected %v, got %v", ErrUnknownType, err)
+	}
+
+	sum, err := mh.Sum([]byte("file"), DefaultChecksumType, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &Metadata{MimeType: "text/plain", Size: 4, Checksum: sum}
+	if b, err = json.Marshal(md); err != nil {
+		t.Fatal(err)
+	}
+	var decodedMd Metadata
+	if err := json.Unmarshal(b, &decodedMd); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decodedMd, md) {
+		t.Fatalf("expected %+v, got %+v", md, decodedMd)
+	}
+}
+
+func TestDumpNode(t *testing.T) {
+	leaf := dag.NewRawNode([]byte("leaf"))
+	file := dag.NodeWithData(FilePBData(nil, 4))
+	if err := file.AddNodeLink("", leaf); err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := WrapMetadata(file, &Metadata{MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := DumpNode(wrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Cid != wrapper.Cid().String() || len(d.Links) != 1 || d.Links[0].Cid != file.Cid().String() {
+		t.Fatalf("unexpected dump %+v", d)
+	}
+	if d.UnixFS.Type() != TMetadata || d.Metadata == nil || d.Metadata.MimeType != "text/plain" || d.Metadata.Size != 4 {
+		t.Fatalf("unexpected unixfs data %+v", d)
+	}
+	if _, err := json.Marshal(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err = DumpNode(leaf); err != nil || !d.RawLeaf || d.UnixFS != nil || d.BlockSize != 4 {
+		t.Fatalf("unexpected dump %+v (%v)", d, err)
+	}
+	if _, err := DumpNode(dag.NodeWithData([]byte("hello world"))); !errors.Is(err, ErrNotUnixFS) {
+		t.Fatalf("expected %v, got %v", ErrNotUnixFS, err)
+	}
+}
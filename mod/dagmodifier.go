@@ -9,6 +9,8 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"sync"
+	"time"
 
 	ft "github.com/TRON-US/go-unixfs"
 	"github.com/TRON-US/go-unixfs/importer/balanced"
@@ -33,6 +35,33 @@ var (
 // 2MB
 var writebufferSize = 1 << 21
 
+// wrBufPool recycles the write buffers across flushes so sustained write
+// workloads don't allocate a new (up to `writebufferSize`) buffer after
+// every `Sync`. The unixfs messages of the appended leaves are pooled by
+// the importers (see `unixfs.LeafPBData`), the leaves themselves aren't:
+// their data is owned by the nodes added to the DAGService. The rewritten
+// leaves are still encoded with `FSNode.GetBytes`, they may hold other
+// fields than the data.
+var wrBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getWrBuf returns an empty write buffer from the pool.
+func getWrBuf() *bytes.Buffer {
+	return wrBufPool.Get().(*bytes.Buffer)
+}
+
+// putWrBuf returns a consumed write buffer to the pool. Buffers that grew
+// well past the flush threshold (a single big `Write`) are dropped to avoid
+// pinning that memory.
+func putWrBuf(b *bytes.Buffer) {
+	if b.Cap() > 2*writebufferSize {
+		return
+	}
+	b.Reset()
+	wrBufPool.Put(b)
+}
+
 // DagModifier is the only struct licensed and able to correctly
 // perform surgery on a DAG 'file'
 // Dear god, please rename this to something more pleasant
@@ -53,6 +82,29 @@ type DagModifier struct {
 	BalancedFormat bool
 	Maxlinks       int
 
+	// ReadOnly refuses every path that would write to the DAGService
+	// (Write, WriteAt, Truncate and Seek past the end, which expands the
+	// file) with a `*uio.ReadOnlyError`, so the modifier can be safely used
+	// as a reader on top of a production store.
+	ReadOnly bool
+
+	// FlushPolicy decides when buffered writes are flushed to the DAG,
+	// if nil they are flushed once the buffer exceeds 2MB.
+	FlushPolicy FlushPolicy
+	dirtySince  time.Time
+
+	// metaRoot is the `TMetadata` node wrapping the edited file (if any),
+	// `curNode` is then the inner file and the wrapper is rebuilt on top of
+	// it by `GetNode`.
+	metaRoot *mdag.ProtoNode
+
+	// Journal, if set, records every root transition (see `Journal`).
+	Journal    Journal
+	journaling bool
+
+	// flushing is the pending `FlushAsync`, if any.
+	flushing *asyncFlush
+
 	read uio.DagReader
 }
 
@@ -82,6 +134,44 @@ func NewMetaDagModifierBalanced(mod *DagModifier, db *help.DagBuilderHelper, ove
 	}
 }
 
+// CreatePreallocated builds a new (balanced) file of `size` zero bytes made
+// of `blockSize` leaves and returns a modifier over it, in the manner of
+// fallocate. The shared zero blocks are built in one pass (see
+// `balanced.Preallocate`) instead of going through the write buffer, so
+// even very large files are created instantly. The leaf and CID options
+// (`Maxlinks`, `RawLeaves` and `CidBuilder`) are taken from `dbp`, whose
+// DAGService is used for the modifier too.
+func CreatePreallocated(ctx context.Context, dbp *help.DagBuilderParams, size, blockSize int64, spl chunker.SplitterGen) (*DagModifier, error) {
+	if size < 0 || blockSize <= 0 {
+		return nil, balanced.ErrInvalidBlockSize
+	}
+	maxlinks := dbp.Maxlinks
+	if maxlinks <= 0 {
+		maxlinks = help.DefaultLinksPerBlock
+	}
+	params := &help.DagBuilderParams{
+		Dagserv:    dbp.Dagserv,
+		Maxlinks:   maxlinks,
+		RawLeaves:  dbp.RawLeaves,
+		CidBuilder: dbp.CidBuilder,
+	}
+	db, err := params.New(chunker.NewSizeSplitter(bytes.NewReader(nil), blockSize))
+	if err != nil {
+		return nil, err
+	}
+	root, err := balanced.Preallocate(db, uint64(size), uint64(blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	dm, err := newDagModifier(ctx, root, dbp.Dagserv, spl, maxlinks, true, false)
+	if err != nil {
+		return nil, err
+	}
+	dm.RawLeaves = dbp.RawLeaves
+	return dm, nil
+}
+
 func newDagModifier(ctx context.Context, from ipld.Node, serv ipld.DAGService, spl chunker.SplitterGen, ml int, balanced bool, noMeta bool) (*DagModifier, error) {
 	if !noMeta {
 		switch from.(type) {
@@ -108,11 +198,17 @@ func newDagModifier(ctx context.Context, from ipld.Node, serv ipld.DAGService, s
 		maxlinks = ml
 	}
 	var copied ipld.Node
+	var metaRoot *mdag.ProtoNode
 	if !noMeta {
-		copied = from.Copy()
+		var err error
+		copied, metaRoot, err = unwrapMetadata(ctx, serv, from.Copy())
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &DagModifier{
 		curNode:        copied,
+		metaRoot:       metaRoot,
 		dagserv:        serv,
 		splitter:       spl,
 		ctx:            ctx,
@@ -123,16 +219,116 @@ func newDagModifier(ctx context.Context, from ipld.Node, serv ipld.DAGService, s
 	}, nil
 }
 
+// checkWritable returns a `*uio.ReadOnlyError` for `op` in read-only mode.
+func (dm *DagModifier) checkWritable(op string) error {
+	if dm.ReadOnly {
+		return &uio.ReadOnlyError{Op: op}
+	}
+	return nil
+}
+
+// unwrapMetadata returns the file wrapped by `nd` if it is a unixfs
+// `TMetadata` node, along with the wrapper. Any other node is returned
+// as is.
+func unwrapMetadata(ctx context.Context, serv ipld.NodeGetter, nd ipld.Node) (ipld.Node, *mdag.ProtoNode, error) {
+	pn, ok := nd.(*mdag.ProtoNode)
+	if !ok {
+		return nd, nil, nil
+	}
+	fsn, err := ft.FSNodeFromNode(pn)
+	if err != nil || fsn.Type() != ft.TMetadata {
+		return nd, nil, nil
+	}
+	if len(pn.Links()) == 0 {
+		return nil, nil, ft.ErrMalformedFileFormat
+	}
+	inner, err := pn.Links()[0].GetNode(ctx, serv)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch inner.(type) {
+	case *mdag.ProtoNode, *mdag.RawNode:
+		return inner.Copy(), pn, nil
+	default:
+		return nil, nil, ErrNotUnixfs
+	}
+}
+
+// rewrapMetadata points a copy of the metadata wrapper to the current file
+// node, updating its size, and adds it to the DAGService. The attributes
+// of the wrapper (mode, modification time and extended attributes) are
+// kept, its checksum is dropped as it covers the data before the edits
+// (recomputing it would read the whole file).
+func (dm *DagModifier) rewrapMetadata() (ipld.Node, error) {
+	fileSize, err := FileSize(dm.curNode)
+	if err != nil {
+		return nil, err
+	}
+
+	root := dm.metaRoot.Copy().(*mdag.ProtoNode)
+	fsn, err := ft.FSNodeFromBytes(root.Data())
+	if err != nil {
+		return nil, err
+	}
+	md, err := ft.MetadataFromBytes(root.Data())
+	if err != nil {
+		return nil, err
+	}
+	md.Checksum = nil
+	mdBytes, err := md.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	// `SetData` moves the file size by the change of the data length,
+	// the file size of the wrapper is the one of the wrapped file.
+	grown := int64(len(mdBytes) - len(fsn.Data()))
+	fsn.SetData(mdBytes)
+	fsn.UpdateFilesize(int64(fileSize) - int64(md.Size) - grown)
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	root.SetData(data)
+
+	links := root.Links()
+	lnk, err := ipld.MakeLink(dm.curNode)
+	if err != nil {
+		return nil, err
+	}
+	lnk.Name = links[0].Name
+	links[0] = lnk
+	root.SetLinks(links)
+
+	if err := dm.dagserv.Add(dm.ctx, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
 // WriteAt will modify a dag file in place
 func (dm *DagModifier) WriteAt(b []byte, offset int64) (int, error) {
+	if err := dm.checkWritable("WriteAt"); err != nil {
+		return 0, err
+	}
+	start, err := ft.OffsetToSize(offset)
+	if err != nil {
+		return 0, err
+	}
+	// The end of the write must be addressable too.
+	end, err := ft.AddSizes(start, uint64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := ft.SizeToOffset(end); err != nil {
+		return 0, err
+	}
 	// TODO: this is currently VERY inefficient
 	// each write that happens at an offset other than the current one causes a
 	// flush to disk, and dag rewrite
-	if offset == int64(dm.writeStart) && dm.wrBuf != nil {
-		// If we would overwrite the previous write
-		if len(b) >= dm.wrBuf.Len() {
-			dm.wrBuf.Reset()
-		}
+	if offset == int64(dm.writeStart) && dm.wrBuf != nil && len(b) >= dm.wrBuf.Len() {
+		// We would overwrite the whole previous write. A shorter one
+		// only overwrites its start, so it is synced first below.
+		dm.wrBuf.Reset()
 	} else if uint64(offset) != dm.curWrOff {
 		size, err := dm.Size()
 		if err != nil {
@@ -155,6 +351,23 @@ func (dm *DagModifier) WriteAt(b []byte, offset int64) (int, error) {
 	return dm.Write(b)
 }
 
+// WriteAtAndSync writes `b` at `offset` like `WriteAt`, then flushes the
+// modification regardless of the flush policy and returns the CID of the
+// resulting root (the metadata wrapper, if any, like `GetNode`). It suits
+// applications that publish a new CID after each discrete change, e.g. a
+// gateway handling range PUTs.
+func (dm *DagModifier) WriteAtAndSync(b []byte, offset int64) (int, cid.Cid, error) {
+	n, err := dm.WriteAt(b, offset)
+	if err != nil {
+		return n, cid.Undef, err
+	}
+	nd, err := dm.GetNode()
+	if err != nil {
+		return n, cid.Undef, err
+	}
+	return n, nd.Cid(), nil
+}
+
 // A reader that just returns zeros
 type zeroReader struct{}
 
@@ -168,6 +381,15 @@ func (zr zeroReader) Read(b []byte) (int, error) {
 // expandSparse grows the file with zero blocks of 4096
 // A small blocksize is chosen to aid in deduplication
 func (dm *DagModifier) expandSparse(size int64) error {
+	if err := dm.checkWritable("expand"); err != nil {
+		return err
+	}
+	return dm.journaled(func() error {
+		return dm.appendZeros(size)
+	})
+}
+
+func (dm *DagModifier) appendZeros(size int64) error {
 	r := io.LimitReader(zeroReader{}, size)
 	spl := chunker.NewSizeSplitter(r, 4096)
 	nnode, err := dm.appendData(dm.curNode, spl)
@@ -175,16 +397,24 @@ func (dm *DagModifier) expandSparse(size int64) error {
 		return err
 	}
 	err = dm.dagserv.Add(dm.ctx, nnode)
-	return err
+	if err != nil {
+		return err
+	}
+	dm.curNode = nnode
+	return nil
 }
 
 // Write continues writing to the dag at the current offset
 func (dm *DagModifier) Write(b []byte) (int, error) {
+	if err := dm.checkWritable("Write"); err != nil {
+		return 0, err
+	}
 	if dm.read != nil {
 		dm.read = nil
 	}
 	if dm.wrBuf == nil {
-		dm.wrBuf = new(bytes.Buffer)
+		dm.wrBuf = getWrBuf()
+		dm.dirtySince = time.Now()
 	}
 
 	n, err := dm.wrBuf.Write(b)
@@ -192,31 +422,44 @@ func (dm *DagModifier) Write(b []byte) (int, error) {
 		return n, err
 	}
 	dm.curWrOff += uint64(n)
-	if dm.wrBuf.Len() > writebufferSize {
-		err := dm.Sync()
-		if err != nil {
-			return n, err
-		}
+	if err := dm.autoFlush(); err != nil {
+		return n, err
 	}
 	return n, nil
 }
 
 // Size returns the Filesize of the node
 func (dm *DagModifier) Size() (int64, error) {
+	if err := dm.waitFlush(); err != nil {
+		return 0, err
+	}
 	fileSize, err := FileSize(dm.curNode)
 	if err != nil {
 		return 0, err
 	}
-	if dm.wrBuf != nil && int64(dm.wrBuf.Len())+int64(dm.writeStart) > int64(fileSize) {
-		return int64(dm.wrBuf.Len()) + int64(dm.writeStart), nil
+	if dm.wrBuf != nil {
+		end, err := ft.AddSizes(dm.writeStart, uint64(dm.wrBuf.Len()))
+		if err != nil {
+			return 0, err
+		}
+		if end > fileSize {
+			fileSize = end
+		}
 	}
-	return int64(fileSize), nil
+	return ft.SizeToOffset(fileSize)
 }
 
 func FileSize(n ipld.Node) (uint64, error) {
 	switch nd := n.(type) {
 	case *mdag.ProtoNode:
-		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if len(nd.Links()) == 0 {
+			fsn, err := leafFSNode(nd)
+			if err != nil {
+				return 0, err
+			}
+			return uint64(len(fsn.Data())), nil
+		}
+		fsn, err := ft.FSNodeFromNode(nd)
 		if err != nil {
 			return 0, err
 		}
@@ -228,13 +471,43 @@ func FileSize(n ipld.Node) (uint64, error) {
 	}
 }
 
+// leafFSNode decodes the unixfs data of a protobuf leaf normalizing
+// the variations produced by other importers: leaves without any data
+// (not even the unixfs framing) are read as empty `TFile` leaves and a
+// missing or wrong `Filesize` is set to the length of the data, so the
+// leaf can be edited regardless of its `TFile` or `TRaw` type.
+func leafFSNode(nd *mdag.ProtoNode) (*ft.FSNode, error) {
+	if len(nd.Data()) == 0 {
+		return ft.NewFSNode(ft.TFile), nil
+	}
+	fsn, err := ft.FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return nil, err
+	}
+	switch fsn.Type() {
+	case ft.TFile, ft.TRaw, ft.TTokenMeta:
+	default:
+		return nil, ErrNotUnixfs
+	}
+	if dataLen := uint64(len(fsn.Data())); fsn.FileSize() != dataLen {
+		fsn.UpdateFilesize(int64(dataLen) - int64(fsn.FileSize()))
+	}
+	return fsn, nil
+}
+
 // Sync writes changes to this dag to disk
 func (dm *DagModifier) Sync() error {
+	if err := dm.waitFlush(); err != nil {
+		return err
+	}
 	// No buffer? Nothing to do
 	if dm.wrBuf == nil {
 		return nil
 	}
+	return dm.journaled(dm.sync)
+}
 
+func (dm *DagModifier) sync() error {
 	// If we have an active reader, kill it
 	if dm.read != nil {
 		dm.read = nil
@@ -279,7 +552,9 @@ func (dm *DagModifier) Sync() error {
 	}
 
 	dm.writeStart += uint64(buflen)
+	putWrBuf(dm.wrBuf)
 	dm.wrBuf = nil
+	dm.dirtySince = time.Time{}
 
 	return nil
 }
@@ -291,7 +566,7 @@ func (dm *DagModifier) modifyDag(n ipld.Node, offset uint64) (cid.Cid, error) {
 	if len(n.Links()) == 0 {
 		switch nd0 := n.(type) {
 		case *mdag.ProtoNode:
-			fsn, err := ft.FSNodeFromBytes(nd0.Data())
+			fsn, err := leafFSNode(nd0)
 			if err != nil {
 				return cid.Cid{}, err
 			}
@@ -318,23 +593,17 @@ func (dm *DagModifier) modifyDag(n ipld.Node, offset uint64) (cid.Cid, error) {
 			return nd.Cid(), nil
 		case *mdag.RawNode:
 			origData := nd0.RawData()
+			// The new leaf owns its data so it can't come from a pool,
+			// copy the original data once and overwrite it in place.
 			bytes := make([]byte, len(origData))
-
-			// copy orig data up to offset
-			copy(bytes, origData[:offset])
+			copy(bytes, origData)
 
 			// copy in new data
-			n, err := dm.wrBuf.Read(bytes[offset:])
+			_, err := dm.wrBuf.Read(bytes[offset:])
 			if err != nil && err != io.EOF {
 				return cid.Cid{}, err
 			}
 
-			// copy remaining data
-			offsetPlusN := int(offset) + n
-			if offsetPlusN < len(origData) {
-				copy(bytes[offsetPlusN:], origData[offsetPlusN:])
-			}
-
 			nd, err := mdag.NewRawNodeWPrefix(bytes, nd0.Cid().Prefix())
 			if err != nil {
 				return cid.Cid{}, err
@@ -353,40 +622,44 @@ func (dm *DagModifier) modifyDag(n ipld.Node, offset uint64) (cid.Cid, error) {
 		return cid.Cid{}, ErrNotUnixfs
 	}
 
-	fsn, err := ft.FSNodeFromBytes(node.Data())
+	fsn, err := ft.FSNodeFromNode(node)
 	if err != nil {
 		return cid.Cid{}, err
 	}
 
-	var cur uint64
-	for i, bs := range fsn.BlockSizes() {
-		// We found the correct child to write into
-		if cur+bs > offset {
-			child, err := node.Links()[i].GetNode(dm.ctx, dm.dagserv)
-			if err != nil {
-				return cid.Cid{}, err
-			}
+	// The children from the one holding the offset are written into until
+	// the buffer is drained.
+	i, childOff, ok := fsn.ChildAt(offset)
+	for ; ok && i < fsn.NumChildren(); i, childOff = i+1, 0 {
+		if fsn.BlockSize(i) == 0 {
+			continue
+		}
+		child, err := node.Links()[i].GetNode(dm.ctx, dm.dagserv)
+		if err != nil {
+			return cid.Cid{}, err
+		}
 
-			k, err := dm.modifyDag(child, offset-cur)
-			if err != nil {
-				return cid.Cid{}, err
-			}
+		k, err := dm.modifyDag(child, childOff)
+		if err != nil {
+			return cid.Cid{}, err
+		}
 
-			node.Links()[i].Cid = k
+		// Replace the link rather than updating it, it may be shared
+		// with copies of the node (see `Clone`).
+		lnk := *node.Links()[i]
+		lnk.Cid = k
+		node.Links()[i] = &lnk
 
-			// Recache serialized node
-			_, err = node.EncodeProtobuf(true)
-			if err != nil {
-				return cid.Cid{}, err
-			}
+		// Recache serialized node
+		_, err = node.EncodeProtobuf(true)
+		if err != nil {
+			return cid.Cid{}, err
+		}
 
-			if dm.wrBuf.Len() == 0 {
-				// No more bytes to write!
-				break
-			}
-			offset = cur + bs
+		if dm.wrBuf.Len() == 0 {
+			// No more bytes to write!
+			break
 		}
-		cur += bs
 	}
 
 	err = dm.dagserv.Add(dm.ctx, node)
@@ -395,6 +668,10 @@ func (dm *DagModifier) modifyDag(n ipld.Node, offset uint64) (cid.Cid, error) {
 
 // appendData appends the blocks from the given chan to the end of this dag
 func (dm *DagModifier) appendData(nd ipld.Node, spl chunker.Splitter) (ipld.Node, error) {
+	nd, err := dm.promoteLeafRoot(nd)
+	if err != nil {
+		return nil, err
+	}
 	switch nd := nd.(type) {
 	case *mdag.ProtoNode, *mdag.RawNode:
 		dbp := &help.DagBuilderParams{
@@ -417,6 +694,73 @@ func (dm *DagModifier) appendData(nd ipld.Node, spl chunker.Splitter) (ipld.Node
 	}
 }
 
+// promoteLeafRoot turns a root that is a leaf holding data (raw or
+// protobuf, as produced by importers for single-block files) into an
+// internal node with that leaf as its only child, so that appended
+// blocks follow the data instead of being mixed with it. Empty leaves
+// are replaced by an empty file node with the modifier's prefix.
+//
+// This changes the CIDs of the files grown from a single protobuf leaf:
+// they used to keep the data of the leaf in their root, ahead of the
+// appended blocks, the root now only links to the leaf (which keeps its
+// CID) and the appended blocks, as the importers lay out files.
+func (dm *DagModifier) promoteLeafRoot(nd ipld.Node) (ipld.Node, error) {
+	if len(nd.Links()) > 0 {
+		return nd, nil
+	}
+
+	var size uint64
+	switch leaf := nd.(type) {
+	case *mdag.ProtoNode:
+		fsn, err := leafFSNode(leaf)
+		if err != nil {
+			return nil, err
+		}
+		if fsn.Type() == ft.TTokenMeta {
+			// Token metadata DAGs are extended in place, keep their CIDs.
+			return nd, nil
+		}
+		size = uint64(len(fsn.Data()))
+		if size > 0 {
+			b, err := fsn.GetBytes()
+			if err != nil {
+				return nil, err
+			}
+			pn := mdag.NodeWithData(b)
+			pn.SetCidBuilder(leaf.CidBuilder())
+			nd = pn
+		}
+	case *mdag.RawNode:
+		size = uint64(len(leaf.RawData()))
+	default:
+		return nil, ErrNotUnixfs
+	}
+
+	root := ft.EmptyFileNode()
+	root.SetCidBuilder(dm.Prefix)
+	if size == 0 {
+		return root, nil
+	}
+	if err := dm.dagserv.Add(dm.ctx, nd); err != nil {
+		return nil, err
+	}
+
+	fsn, err := ft.FSNodeFromBytes(root.Data())
+	if err != nil {
+		return nil, err
+	}
+	fsn.AddBlockSize(size)
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	root.SetData(b)
+	if err := root.AddNodeLink("", nd); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
 // Read data from this dag starting at the current offset
 func (dm *DagModifier) Read(b []byte) (int, error) {
 	err := dm.readPrep()
@@ -473,18 +817,45 @@ func (dm *DagModifier) CtxReadFull(ctx context.Context, b []byte) (int, error) {
 	return n, err
 }
 
-// GetNode gets the modified DAG Node
+// GetNode gets the modified DAG Node. If the original root was wrapped in
+// a unixfs Metadata node the returned node is the (updated) wrapper.
 func (dm *DagModifier) GetNode() (ipld.Node, error) {
 	err := dm.Sync()
 	if err != nil {
 		return nil, err
 	}
+	if dm.metaRoot != nil {
+		return dm.rewrapMetadata()
+	}
 	return dm.curNode.Copy(), nil
 }
 
+// Clone returns an independent modifier over the current state of the file
+// (including the buffered writes) sharing the DAG with `dm`: nodes are only
+// copied as either modifier rewrites them, so speculative edits can be
+// tried on the clone and simply dropped. The clone has no journal and
+// starts at the same offset.
+func (dm *DagModifier) Clone() (*DagModifier, error) {
+	if err := dm.waitFlush(); err != nil {
+		return nil, err
+	}
+
+	c := *dm
+	c.curNode = dm.curNode.Copy()
+	c.read = nil
+	c.readCancel = nil
+	c.Journal = nil
+	c.journaling = false
+	if dm.wrBuf != nil {
+		c.wrBuf = getWrBuf()
+		c.wrBuf.Write(dm.wrBuf.Bytes())
+	}
+	return &c, nil
+}
+
 // HasChanges returned whether or not there are unflushed changes to this dag
 func (dm *DagModifier) HasChanges() bool {
-	return dm.wrBuf != nil
+	return dm.wrBuf != nil || dm.flushing != nil
 }
 
 // Seek modifies the offset according to whence. See unixfs/io for valid whence
@@ -503,17 +874,30 @@ func (dm *DagModifier) Seek(offset int64, whence int) (int64, error) {
 	var newoffset uint64
 	switch whence {
 	case io.SeekCurrent:
-		newoffset = dm.curWrOff + uint64(offset)
+		newoffset, err = ft.AddOffset(dm.curWrOff, offset)
 	case io.SeekStart:
-		newoffset = uint64(offset)
+		newoffset, err = ft.OffsetToSize(offset)
 	case io.SeekEnd:
-		newoffset = uint64(fisize) - uint64(offset)
+		// Back from the end by `offset`.
+		if offset < 0 {
+			// Also right for `math.MinInt64`, negated to itself.
+			newoffset, err = ft.AddSizes(uint64(fisize), uint64(-offset))
+		} else {
+			newoffset, err = ft.AddOffset(uint64(fisize), -offset)
+		}
 	default:
 		return 0, ErrUnrecognizedWhence
 	}
+	if err != nil {
+		return 0, err
+	}
+	off, err := ft.SizeToOffset(newoffset)
+	if err != nil {
+		return 0, err
+	}
 
-	if int64(newoffset) > fisize {
-		if err := dm.expandSparse(int64(newoffset) - fisize); err != nil {
+	if off > fisize {
+		if err := dm.expandSparse(off - fisize); err != nil {
 			return 0, err
 		}
 	}
@@ -533,11 +917,22 @@ func (dm *DagModifier) Seek(offset int64, whence int) (int64, error) {
 // Truncate truncates the current Node to 'size' and replaces it with the
 // new one.
 func (dm *DagModifier) Truncate(size int64) error {
+	if err := dm.checkWritable("Truncate"); err != nil {
+		return err
+	}
 	err := dm.Sync()
 	if err != nil {
 		return err
 	}
+	return dm.journaled(func() error {
+		return dm.truncate(size)
+	})
+}
 
+func (dm *DagModifier) truncate(size int64) error {
+	if _, err := ft.OffsetToSize(size); err != nil {
+		return err
+	}
 	realSize, err := dm.Size()
 	if err != nil {
 		return err
@@ -571,11 +966,16 @@ func (dm *DagModifier) dagTruncate(ctx context.Context, n ipld.Node, size uint64
 		switch nd := n.(type) {
 		case *mdag.ProtoNode:
 			// TODO: this can likely be done without marshaling and remarshaling
-			fsn, err := ft.FSNodeFromBytes(nd.Data())
+			fsn, err := leafFSNode(nd)
 			if err != nil {
 				return nil, err
 			}
-			nd.SetData(ft.WrapData(fsn.Data()[:size]))
+			fsn.SetData(fsn.Data()[:size])
+			b, err := fsn.GetBytes()
+			if err != nil {
+				return nil, err
+			}
+			nd.SetData(b)
 			return nd, nil
 		case *mdag.RawNode:
 			return mdag.NewRawNodeWPrefix(nd.RawData()[:size], nd.Cid().Prefix())
@@ -594,11 +994,23 @@ func (dm *DagModifier) dagTruncate(ctx context.Context, n ipld.Node, size uint64
 	if err != nil {
 		return nil, err
 	}
+	// The children before the one to cut are kept as they are, found from
+	// the block sizes if they are consistent (without fetching them).
+	start := 0
+	var kept []uint64
+	if i, childOff, ok := ndata.ChildAt(size); ok && ndata.NumChildren() == len(nd.Links()) {
+		start, cur = i, size-childOff
+		kept = append(kept, ndata.BlockSizes()[:i]...)
+	}
 	// Reset the block sizes of the node to adjust them
 	// with the new values of the truncated children.
 	ndata.RemoveAllBlockSizes()
-	for i, lnk := range nd.Links() {
-		child, err := lnk.GetNode(ctx, dm.dagserv)
+	for _, bs := range kept {
+		ndata.AddBlockSize(bs)
+	}
+
+	for i := start; i < len(nd.Links()); i++ {
+		child, err := nd.Links()[i].GetNode(ctx, dm.dagserv)
 		if err != nil {
 			return nil, err
 		}
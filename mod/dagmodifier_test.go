@@ -3,18 +3,25 @@ package mod
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/TRON-US/go-unixfs/importer/trickle"
 	uio "github.com/TRON-US/go-unixfs/io"
+	pb "github.com/TRON-US/go-unixfs/pb"
 	testu "github.com/TRON-US/go-unixfs/test"
+	proto "github.com/gogo/protobuf/proto"
 	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
 
 	chunker "github.com/TRON-US/go-btfs-chunker"
 	"github.com/TRON-US/go-unixfs"
+	"github.com/TRON-US/go-unixfs/importer"
 	"github.com/TRON-US/go-unixfs/importer/balanced"
 	"github.com/TRON-US/go-unixfs/importer/helpers"
 	u "github.com/ipfs/go-ipfs-util"
@@ -460,7 +467,7 @@ func testDagTruncate(t *testing.T, opts testu.NodeOpts) {
 // if offset > curNode's size.
 func TestDagSync(t *testing.T) {
 	dserv := testu.GetDAGServ()
-	nd := dag.NodeWithData(unixfs.FilePBData(nil, 0))
+	nd := unixfs.EmptyFileNode()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -550,6 +557,58 @@ func testDagTruncateSameSize(t *testing.T, opts testu.NodeOpts) {
 	}
 }
 
+func TestDagTruncateExpand(t *testing.T) {
+	data := make([]byte, 100)
+	u.NewTimeSeededRand().Read(data)
+
+	// Single-leaf roots get a new root when expanded (see
+	// `promoteLeafRoot`), which the modifier goes on with.
+	for name, n := range map[string]ipld.Node{
+		"ProtoLeaf": dag.NodeWithData(unixfs.FilePBData(data, uint64(len(data)))),
+		"RawLeaf":   dag.NewRawNode(data),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			dserv := testu.GetDAGServ()
+			if err := dserv.Add(ctx, n); err != nil {
+				t.Fatal(err)
+			}
+			dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The expanded DAG is the one modified from then on.
+			if err := dagmod.Truncate(20000); err != nil {
+				t.Fatal(err)
+			}
+			if size, err := dagmod.Size(); err != nil || size != 20000 {
+				t.Fatalf("expected size 20000, got %d (err: %v)", size, err)
+			}
+			expected := make([]byte, 20000)
+			copy(expected, data)
+			expected = testModWriteAndVerifyWrapped(t, dagmod, expected, []byte("hello"), 15000)
+
+			nd, err := dagmod.GetNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd, err := uio.NewDagReader(ctx, nd, dserv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := testu.ArrComp(out, expected); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
 func TestSparseWrite(t *testing.T) {
 	runAllSubtests(t, testSparseWrite)
 }
@@ -705,6 +764,21 @@ func testInvalidSeek(t *testing.T, opts testu.NodeOpts) {
 	if err != ErrUnrecognizedWhence {
 		t.Fatal(err)
 	}
+
+	// Offsets are checked instead of wrapping around.
+	if _, err := dagmod.Seek(-1, io.SeekStart); err != unixfs.ErrNegativeOffset {
+		t.Fatalf("expected %v, got %v", unixfs.ErrNegativeOffset, err)
+	}
+	if _, err := dagmod.WriteAt([]byte{1}, -1); err != unixfs.ErrNegativeOffset {
+		t.Fatalf("expected %v, got %v", unixfs.ErrNegativeOffset, err)
+	}
+	var overflow *unixfs.SizeOverflowError
+	if _, err := dagmod.WriteAt([]byte{1}, math.MaxInt64); !errors.As(err, &overflow) {
+		t.Fatalf("expected a size overflow, got %v", err)
+	}
+	if err := dagmod.Truncate(-1); err != unixfs.ErrNegativeOffset {
+		t.Fatalf("expected %v, got %v", unixfs.ErrNegativeOffset, err)
+	}
 }
 
 func TestEndSeek(t *testing.T) {
@@ -866,6 +940,541 @@ func testCtxRead(t *testing.T, opts testu.NodeOpts) {
 	// because this is exacelly the same.
 }
 
+func TestCreatePreallocated(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	size := int64(1024 * 1024)
+	dagmod, err := CreatePreallocated(ctx, &helpers.DagBuilderParams{Dagserv: dserv}, size, 4096, testu.SizeSplitterGen(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := dagmod.Size(); err != nil || s != size {
+		t.Fatalf("expected size %d, got %d (err: %v)", size, s, err)
+	}
+
+	expected := make([]byte, size)
+	data := []byte("preallocated")
+	copy(expected[300000:], data)
+	if _, err := dagmod.WriteAt(data, 300000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(dagmod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreatePreallocated(ctx, &helpers.DagBuilderParams{Dagserv: dserv}, size, 0, testu.SizeSplitterGen(4096)); err != balanced.ErrInvalidBlockSize {
+		t.Fatalf("expected invalid block size error, got %v", err)
+	}
+}
+
+func TestMetadataWrappedRoot(t *testing.T) {
+	runAllSubtests(t, testMetadataWrappedRoot)
+}
+func testMetadataWrappedRoot(t *testing.T, opts testu.NodeOpts) {
+	dserv := testu.GetDAGServ()
+	b, n := testu.GetRandomNode(t, dserv, 5000, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mdata, err := unixfs.BytesForMetadata(&unixfs.Metadata{MimeType: "text/plain", Size: uint64(len(b))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper := dag.NodeWithData(mdata)
+	if err := wrapper.AddNodeLink("file", n); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, wrapper); err != nil {
+		t.Fatal(err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, wrapper, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ForceRawLeaves {
+		dagmod.RawLeaves = true
+	}
+
+	b = testModWriteAndVerifyWrapped(t, dagmod, b, []byte("hello world"), 4990)
+	if err := dagmod.Truncate(3000); err != nil {
+		t.Fatal(err)
+	}
+	b = b[:3000]
+
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		t.Fatal(dag.ErrNotProtobuf)
+	}
+	md, err := unixfs.MetadataFromBytes(pn.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.MimeType != "text/plain" {
+		t.Fatalf("expected mime type to survive, got %q", md.MimeType)
+	}
+	if md.Size != uint64(len(b)) {
+		t.Fatalf("expected wrapper size %d, got %d", len(b), md.Size)
+	}
+	if pn.Links()[0].Name != "file" {
+		t.Fatalf("expected link name to survive, got %q", pn.Links()[0].Name)
+	}
+
+	inner, err := pn.Links()[0].GetNode(ctx, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := uio.NewDagReader(ctx, inner, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrappedFileChecksum(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+	b := make([]byte, 5000)
+	u.NewTimeSeededRand().Read(b)
+	dbp := &helpers.DagBuilderParams{
+		Dagserv:      dserv,
+		Maxlinks:     helpers.DefaultLinksPerBlock,
+		ChecksumType: unixfs.DefaultChecksumType,
+	}
+	root, err := importer.BuildWrappedFile(dbp, chunker.NewSizeSplitter(bytes.NewReader(b), 512), &unixfs.Metadata{MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uio.VerifyChecksum(ctx, root, dserv); err != nil {
+		t.Fatal(err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, root, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = testModWriteAndVerifyWrapped(t, dagmod, b, []byte("hello world"), 100)
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The checksum of the original data is dropped, not left to make
+	// the edited file look corrupted.
+	if err := uio.VerifyChecksum(ctx, nd, dserv); err != unixfs.ErrNoChecksum {
+		t.Fatalf("expected %v, got %v", unixfs.ErrNoChecksum, err)
+	}
+	md, err := unixfs.MetadataFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.MimeType != "text/plain" || md.Size != uint64(len(b)) {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+}
+
+func TestWrappedFileAttributes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+	b := make([]byte, 5000)
+	u.NewTimeSeededRand().Read(b)
+	mtime := time.Unix(1600000000, 0)
+	dbp := &helpers.DagBuilderParams{
+		Dagserv:  dserv,
+		Maxlinks: helpers.DefaultLinksPerBlock,
+		Mode:     0755,
+		ModTime:  mtime,
+	}
+	root, err := importer.BuildWrappedFile(dbp, chunker.NewSizeSplitter(bytes.NewReader(b), 512), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := unixfs.FSNodeFromBytes(root.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn.SetXattr("user.origin", []byte("test"))
+	data, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.SetData(data)
+	if err := dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, root, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = testModWriteAndVerifyWrapped(t, dagmod, b, []byte("hello world"), 4995)
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err = unixfs.FSNodeFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Mode() != 0755 || !fsn.ModTime().Equal(mtime) {
+		t.Fatalf("expected the attributes of the wrapper to survive, got %v and %v", fsn.Mode(), fsn.ModTime())
+	}
+	if v, ok := fsn.Xattr("user.origin"); !ok || string(v) != "test" {
+		t.Fatalf("expected the extended attributes to survive, got %q", v)
+	}
+	md, err := unixfs.MetadataFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Size != uint64(len(b)) {
+		t.Fatalf("expected wrapper size %d, got %d", len(b), md.Size)
+	}
+}
+
+func testModWriteAndVerifyWrapped(t *testing.T, dm *DagModifier, orig, data []byte, offset int) []byte {
+	if _, err := dm.WriteAt(data, int64(offset)); err != nil {
+		t.Fatal(err)
+	}
+	if end := offset + len(data); end > len(orig) {
+		orig = append(orig, make([]byte, end-len(orig))...)
+	}
+	copy(orig[offset:], data)
+	return orig
+}
+
+func TestForeignLeaves(t *testing.T) {
+	data := make([]byte, 100)
+	u.NewTimeSeededRand().Read(data)
+
+	noSize, err := proto.Marshal(&pb.Data{Type: pb.Data_File.Enum(), Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, n := range map[string]ipld.Node{
+		"TRawLeaf":   dag.NodeWithData(unixfs.WrapData(data)),
+		"TFileLeaf":  dag.NodeWithData(unixfs.FilePBData(data, uint64(len(data)))),
+		"NoFilesize": dag.NodeWithData(noSize),
+		"RawNode":    dag.NewRawNode(data),
+		"EmptyData":  dag.NodeWithData(nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			dserv := testu.GetDAGServ()
+			if err := dserv.Add(ctx, n); err != nil {
+				t.Fatal(err)
+			}
+
+			orig := data
+			if name == "EmptyData" {
+				orig = nil
+			}
+			dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size, err := dagmod.Size(); err != nil || size != int64(len(orig)) {
+				t.Fatalf("expected size %d, got %d (err: %v)", len(orig), size, err)
+			}
+
+			expected := make([]byte, 255)
+			copy(expected, orig)
+			for _, off := range []int{20, 250, 50} {
+				expected = testModWriteAndVerifyWrapped(t, dagmod, expected, []byte("hello"), off)
+			}
+			if err := dagmod.Truncate(200); err != nil {
+				t.Fatal(err)
+			}
+			expected = expected[:200]
+
+			nd, err := dagmod.GetNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd, err := uio.NewDagReader(ctx, nd, dserv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := testu.ArrComp(out, expected); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAppendToLeafRoot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+	leaf := dag.NodeWithData(unixfs.FilePBData(bytes.Repeat([]byte("a"), 100), 100))
+	if err := dserv.Add(ctx, leaf); err != nil {
+		t.Fatal(err)
+	}
+	dagmod, err := NewDagModifier(ctx, leaf, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.Write(bytes.Repeat([]byte("b"), 600)); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The leaf is the first child of the new root, which holds no data
+	// (it used to keep the data of the leaf, see `promoteLeafRoot`).
+	fsn, err := unixfs.FSNodeFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fsn.Data()) != 0 || len(nd.Links()) != 3 || !nd.Links()[0].Cid.Equals(leaf.Cid()) {
+		t.Fatalf("expected the leaf as the first child of the root, got %d links and %d bytes of data", len(nd.Links()), len(fsn.Data()))
+	}
+	if !reflect.DeepEqual(fsn.BlockSizes(), []uint64{100, 512, 88}) {
+		t.Fatalf("unexpected block sizes %v", fsn.BlockSizes())
+	}
+	if expected := "QmZBPJLBr5yzEPymALDL93sTwvfPG8YmvjYvoXkYWqV6QJ"; nd.Cid().String() != expected {
+		t.Fatalf("expected root %s, got %s", expected, nd.Cid())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	runAllSubtests(t, testReadOnly)
+}
+func testReadOnly(t *testing.T, opts testu.NodeOpts) {
+	dserv := testu.GetDAGServ()
+	b, n := testu.GetRandomNode(t, dserv, 5000, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, uio.NewReadOnlyDAGService(dserv), testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod.ReadOnly = true
+
+	var roErr *uio.ReadOnlyError
+	if _, err := dagmod.WriteAt([]byte("foo"), 10); !errors.As(err, &roErr) {
+		t.Fatalf("expected read-only error from WriteAt, got %v", err)
+	}
+	if _, err := dagmod.Write([]byte("foo")); !errors.As(err, &roErr) {
+		t.Fatalf("expected read-only error from Write, got %v", err)
+	}
+	if err := dagmod.Truncate(100); !errors.As(err, &roErr) {
+		t.Fatalf("expected read-only error from Truncate, got %v", err)
+	}
+	if _, err := dagmod.Seek(10000, io.SeekStart); !errors.Is(err, dag.ErrReadOnly) {
+		t.Fatalf("expected read-only error seeking past the end, got %v", err)
+	}
+
+	if _, err := dagmod.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(dagmod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteAtAndSync(t *testing.T) {
+	runAllSubtests(t, testWriteAtAndSync)
+}
+func testWriteAtAndSync(t *testing.T, opts testu.NodeOpts) {
+	dserv := testu.GetDAGServ()
+	b, n := testu.GetRandomNode(t, dserv, 5000, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ForceRawLeaves {
+		dagmod.RawLeaves = true
+	}
+	dagmod.FlushPolicy = ManualFlushPolicy{}
+
+	for _, off := range []int{100, 4990, 7000} {
+		data := []byte("modified")
+		written, c, err := dagmod.WriteAtAndSync(data, int64(off))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != len(data) {
+			t.Fatalf("expected %d bytes written, got %d", len(data), written)
+		}
+		if dagmod.HasChanges() {
+			t.Fatal("changes left buffered")
+		}
+		if off > len(b) {
+			b = append(b, make([]byte, off-len(b))...)
+		}
+		if end := off + len(data); end > len(b) {
+			b = append(b, make([]byte, end-len(b))...)
+		}
+		copy(b[off:], data)
+
+		// The returned root is published, it must be readable on its own.
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd, err := uio.NewDagReader(ctx, nd, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testu.ArrComp(out, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	runAllSubtests(t, testClone)
+}
+func testClone(t *testing.T, opts testu.NodeOpts) {
+	dserv := testu.GetDAGServ()
+	b, n := testu.GetRandomNode(t, dserv, 5000, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ForceRawLeaves {
+		dagmod.RawLeaves = true
+	}
+	orig := testModWrite(t, 100, 600, b, dagmod, opts, false)
+
+	clone, err := dagmod.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloned := append([]byte(nil), orig...)
+	cloned = testModWrite(t, 1000, 3000, cloned, clone, opts, false)
+	if err := clone.Truncate(4500); err != nil {
+		t.Fatal(err)
+	}
+	cloned = cloned[:4500]
+	verifyNode(t, cloned, clone, opts, false)
+
+	// The original never sees the speculative edits.
+	verifyNode(t, orig, dagmod, opts, false)
+	orig = testModWrite(t, 4000, 2000, orig, dagmod, opts, false)
+	verifyNode(t, cloned, clone, opts, false)
+
+	// Buffered writes are carried over too.
+	if _, err := dagmod.WriteAt([]byte("buffered"), 2000); err != nil {
+		t.Fatal(err)
+	}
+	copy(orig[2000:], "buffered")
+	clone, err = dagmod.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyNode(t, orig, clone, opts, false)
+	verifyNode(t, orig, dagmod, opts, false)
+}
+
+func TestPooledWriteBuffers(t *testing.T) {
+	runAllSubtests(t, testPooledWriteBuffers)
+}
+func testPooledWriteBuffers(t *testing.T, opts testu.NodeOpts) {
+	// Buffers come back from the pool empty, even if returned unread.
+	buf := getWrBuf()
+	buf.WriteString("stale")
+	putWrBuf(buf)
+	if buf := getWrBuf(); buf.Len() != 0 {
+		t.Fatalf("got a buffer holding %q from the pool", buf.Bytes())
+	}
+
+	dserv := testu.GetDAGServ()
+	n := testu.GetEmptyNode(t, dserv, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod.RawLeaves = opts.RawLeavesUsed
+
+	// Every sync returns its write buffer to the pool and the next write
+	// takes it back: the nodes of the previous roots must not share it.
+	var roots []ipld.Node
+	var versions [][]byte
+	var expected []byte
+	for i := 0; i < 10; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 3000)
+		// Appended, then overwritten.
+		expected = testModWriteAndVerifyWrapped(t, dagmod, expected, data, len(expected))
+		if err := dagmod.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		expected = testModWriteAndVerifyWrapped(t, dagmod, expected, data[:100], 0)
+		if err := dagmod.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		nd, err := dagmod.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, nd)
+		versions = append(versions, append([]byte(nil), expected...))
+	}
+
+	for i, nd := range roots {
+		rd, err := uio.NewDagReader(ctx, nd, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testu.ArrComp(out, versions[i]); err != nil {
+			t.Fatalf("root %d: %s", i, err)
+		}
+	}
+}
+
 func BenchmarkDagmodWrite(b *testing.B) {
 	b.StopTimer()
 	dserv := testu.GetDAGServ()
@@ -1069,3 +1678,32 @@ func testBalancedMetaDagAppend(t *testing.T, opts testu.NodeOpts, userDataSize i
 		t.Fatalf("Returned cid value [%s] is not expected value [%s]", cs, ecid)
 	}
 }
+
+func BenchmarkDagmodSyncedWrites(b *testing.B) {
+	b.StopTimer()
+	dserv := testu.GetDAGServ()
+	n := testu.GetEmptyNode(b, dserv, testu.UseProtoBufLeaves)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wrsize := 64 * 1024
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(4096))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	buf := make([]byte, wrsize)
+	u.NewTimeSeededRand().Read(buf)
+	b.ReportAllocs()
+	b.SetBytes(int64(wrsize))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dagmod.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+		if err := dagmod.Sync(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package mod
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// ErrFileClosed is returned when using a closed File.
+var ErrFileClosed = errors.New("file is closed")
+
+// fileState is the state shared by all the handles of an open file.
+type fileState struct {
+	lk      sync.Mutex
+	dm      *DagModifier
+	onFlush func(ipld.Node) error
+
+	// timer flushes the buffered writes of a timed flush policy (see
+	// `TimedFlushPolicy`), timerErr is its error, reported by the next
+	// flush of the handles.
+	timer    *time.Timer
+	timerErr error
+}
+
+// File is an open file handle on top of a DagModifier, with its own
+// offset, as FUSE or SFTP backends need. Handles obtained with `Dup` share
+// the file contents (and the modifier) but not the offset. All the methods
+// are safe for concurrent use.
+type File struct {
+	state  *fileState
+	lk     sync.Mutex
+	offset int64
+	closed bool
+}
+
+var _ io.ReadWriteSeeker = (*File)(nil)
+var _ io.ReaderAt = (*File)(nil)
+var _ io.WriterAt = (*File)(nil)
+
+// NewFile returns a handle for the file edited by `dm`, which must not be
+// used directly afterwards. If `onFlush` is not nil it is called with the
+// new root of the file every time the handles are flushed or closed.
+func NewFile(dm *DagModifier, onFlush func(ipld.Node) error) *File {
+	return &File{
+		state: &fileState{
+			dm:      dm,
+			onFlush: onFlush,
+		},
+	}
+}
+
+// Dup returns a new handle on the same file, starting at offset zero.
+func (f *File) Dup() *File {
+	return &File{state: f.state}
+}
+
+// readAt reads from the file at `off`, returning `io.EOF` if the end of
+// the file is reached before filling `p`. The state lock must be held.
+func (s *fileState) readAt(p []byte, off int64) (int, error) {
+	size, err := s.dm.Size()
+	if err != nil {
+		return 0, err
+	}
+	if off >= size {
+		// Don't seek, that would expand the file.
+		return 0, io.EOF
+	}
+	short := false
+	if off+int64(len(p)) > size {
+		p = p[:size-off]
+		short = true
+	}
+
+	if _, err := s.dm.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := s.dm.CtxReadFull(s.dm.ctx, p)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	if err == nil && short {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Read implements the `io.Reader` interface.
+func (f *File) Read(p []byte) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	n, err := f.state.readAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements the `io.ReaderAt` interface, it doesn't use or modify
+// the offset of the handle.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	return f.state.readAt(p, off)
+}
+
+// Write implements the `io.Writer` interface.
+func (f *File) Write(p []byte) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	n, err := f.state.dm.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	f.state.armFlushTimer()
+	return n, err
+}
+
+// WriteAt implements the `io.WriterAt` interface, it doesn't use or modify
+// the offset of the handle.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	n, err := f.state.dm.WriteAt(p, off)
+	f.state.armFlushTimer()
+	return n, err
+}
+
+// armFlushTimer starts the timer flushing the buffered writes if the flush
+// policy is timed and it isn't running. The state lock must be held.
+func (s *fileState) armFlushTimer() {
+	if s.timer != nil || !s.dm.HasChanges() {
+		return
+	}
+	if after := s.dm.flushAfter(); after > 0 {
+		s.timer = time.AfterFunc(after, s.timedFlush)
+	}
+}
+
+// timedFlush flushes the buffered writes once they are old enough.
+func (s *fileState) timedFlush() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.timer = nil
+	dirtySince := s.dm.flushState().DirtySince
+	if dirtySince.IsZero() {
+		// Flushed in the meantime.
+		return
+	}
+	// The writes buffered since the last flush may be more recent than
+	// the one that armed the timer.
+	if wait := s.dm.flushAfter() - time.Since(dirtySince); wait > 0 {
+		s.timer = time.AfterFunc(wait, s.timedFlush)
+		return
+	}
+	s.timerErr = s.flush()
+}
+
+// Seek implements the `io.Seeker` interface. Seeking past the end of the
+// file is allowed, a write there fills the gap with zeros.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = f.offset
+	case io.SeekEnd:
+		f.state.lk.Lock()
+		size, err := f.state.dm.Size()
+		f.state.lk.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		base = size
+	default:
+		return 0, ErrUnrecognizedWhence
+	}
+	if base+offset < 0 {
+		return 0, ErrSeekFail
+	}
+	f.offset = base + offset
+	return f.offset, nil
+}
+
+// Size returns the current size of the file.
+func (f *File) Size() (int64, error) {
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	return f.state.dm.Size()
+}
+
+// Truncate changes the size of the file, the offset of the handles is not
+// modified.
+func (f *File) Truncate(size int64) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	return f.state.dm.Truncate(size)
+}
+
+// Flush writes the buffered changes of the file to the DAG and reports
+// the new root to the `onFlush` callback.
+func (f *File) Flush() error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	return f.flush()
+}
+
+func (f *File) flush() error {
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	if err := f.state.timerErr; err != nil {
+		f.state.timerErr = nil
+		return err
+	}
+	return f.state.flush()
+}
+
+// flush writes the buffered changes to the DAG and reports the new root.
+// The state lock must be held.
+func (s *fileState) flush() error {
+	nd, err := s.dm.GetNode()
+	if err != nil {
+		return err
+	}
+	if s.onFlush != nil {
+		return s.onFlush(nd)
+	}
+	return nil
+}
+
+// Node flushes the file and returns its current root.
+func (f *File) Node() (ipld.Node, error) {
+	f.state.lk.Lock()
+	defer f.state.lk.Unlock()
+	return f.state.dm.GetNode()
+}
+
+// Close flushes the file and releases the handle, other handles of the
+// file remain usable.
+func (f *File) Close() error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
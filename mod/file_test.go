@@ -0,0 +1,147 @@
+package mod
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestFileHandles(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	b, n := testu.GetRandomNode(t, dserv, 5000, testu.UseProtoBufLeaves)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flushed ipld.Node
+	f := NewFile(dagmod, func(nd ipld.Node) error {
+		flushed = nd
+		return nil
+	})
+	g := f.Dup()
+
+	// Independent offsets
+	if _, err := f.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	copy(b[1000:], "hello")
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(g, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(buf, b[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if off, _ := f.Seek(0, io.SeekCurrent); off != 1005 {
+		t.Fatalf("expected offset 1005, got %d", off)
+	}
+	if _, err := g.ReadAt(buf, 999); err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(buf, b[999:1009]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading at the end doesn't grow the file.
+	if _, err := g.Seek(10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := g.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF, got %d, %v", n, err)
+	}
+	if size, _ := f.Size(); size != int64(len(b)) {
+		t.Fatalf("expected size %d, got %d", len(b), size)
+	}
+
+	if err := g.Truncate(3000); err != nil {
+		t.Fatal(err)
+	}
+	b = b[:3000]
+	if _, err := g.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush on close
+	if _, err := f.WriteAt([]byte("world"), 2000); err != nil {
+		t.Fatal(err)
+	}
+	copy(b[2000:], "world")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(buf); err != ErrFileClosed {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+	if flushed == nil {
+		t.Fatal("expected Close to flush")
+	}
+	dr, err := NewDagModifier(ctx, flushed, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = io.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other handle is still open.
+	if _, err := g.ReadAt(buf, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileHandlesOverwrite(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves), dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFile(dagmod, nil)
+	g := f.Dup()
+
+	// The write of `g` overwrites the start of the one buffered by `f`.
+	if _, err := f.Write(bytes.Repeat([]byte("a"), 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Write(bytes.Repeat([]byte("b"), 10)); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := f.Size(); size != 100 {
+		t.Fatalf("expected size 100, got %d", size)
+	}
+	out := make([]byte, 100)
+	if _, err := f.ReadAt(out, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := append(bytes.Repeat([]byte("b"), 10), bytes.Repeat([]byte("a"), 90)...)
+	if err := testu.ArrComp(out, expected); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,295 @@
+package mod
+
+import (
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// FlushState describes the buffered (not yet flushed) writes of a
+// DagModifier when its FlushPolicy is consulted.
+type FlushState struct {
+	// Buffered is the number of bytes in the write buffer.
+	Buffered int
+	// Start is the file offset of the buffered data.
+	Start uint64
+	// DirtySince is the time of the first write since the last flush.
+	DirtySince time.Time
+}
+
+// FlushPolicy decides when the buffered writes of a DagModifier are
+// flushed (synced) to the DAG. It is consulted after every write, explicit
+// calls to `Sync` (and the operations that need a synced DAG, like reads,
+// seeks or `GetNode`) always flush regardless of the policy.
+type FlushPolicy interface {
+	ShouldFlush(FlushState) bool
+}
+
+// SizeFlushPolicy flushes once more than the given number of bytes have
+// been buffered. This is the default policy, with `writebufferSize` (2MB).
+type SizeFlushPolicy int
+
+// ShouldFlush implements the `FlushPolicy` interface.
+func (p SizeFlushPolicy) ShouldFlush(s FlushState) bool {
+	return s.Buffered > int(p)
+}
+
+// TimedFlushPolicy is a FlushPolicy that flushes the buffered writes once
+// they get old. A DagModifier is not safe for concurrent use, so it only
+// consults its policy on writes; the handles of a `File` also arm a timer
+// on the first buffered write and consult it when it fires, flushing idle
+// handles.
+type TimedFlushPolicy interface {
+	FlushPolicy
+	// FlushAfter returns the age of the buffered writes after which they
+	// should be flushed, zero if they can stay buffered indefinitely.
+	FlushAfter() time.Duration
+}
+
+// IntervalFlushPolicy flushes the buffered writes once they are older than
+// the given duration, bounding the data-loss window of long-lived handles
+// that write slowly (see `TimedFlushPolicy`). Combine it with a size bound
+// (see `AnyFlushPolicy`) to limit the buffer as well.
+type IntervalFlushPolicy time.Duration
+
+// ShouldFlush implements the `FlushPolicy` interface.
+func (p IntervalFlushPolicy) ShouldFlush(s FlushState) bool {
+	return !s.DirtySince.IsZero() && time.Since(s.DirtySince) >= time.Duration(p)
+}
+
+// FlushAfter implements the `TimedFlushPolicy` interface.
+func (p IntervalFlushPolicy) FlushAfter() time.Duration {
+	return time.Duration(p)
+}
+
+// ManualFlushPolicy never flushes on its own, writes are buffered until
+// `Sync` (or an operation that syncs) is called.
+type ManualFlushPolicy struct{}
+
+// ShouldFlush implements the `FlushPolicy` interface.
+func (ManualFlushPolicy) ShouldFlush(FlushState) bool {
+	return false
+}
+
+// PartialFlushPolicy is a FlushPolicy that can flush just the beginning of
+// the buffer, keeping the rest buffered.
+type PartialFlushPolicy interface {
+	FlushPolicy
+	// FlushLength returns the number of buffered bytes to flush once
+	// `ShouldFlush` returned true.
+	FlushLength(FlushState) int
+}
+
+// BlockAlignedFlushPolicy holds the buffered writes until they reach a
+// block boundary of the file (a multiple of BlockSize, which should match
+// the chunker size) and then flushes only up to the last boundary, so
+// sequential writes of any size end up writing each leaf exactly once
+// instead of rewriting it on every partial flush. If Timeout is set, the
+// whole buffer is flushed once it is older than that.
+type BlockAlignedFlushPolicy struct {
+	BlockSize int
+	Timeout   time.Duration
+}
+
+// aligned returns the length of the buffer up to its last block boundary.
+func (p BlockAlignedFlushPolicy) aligned(s FlushState) int {
+	if p.BlockSize <= 0 {
+		return s.Buffered
+	}
+	bs := uint64(p.BlockSize)
+	end := (s.Start + uint64(s.Buffered)) / bs * bs
+	if end <= s.Start {
+		return 0
+	}
+	return int(end - s.Start)
+}
+
+func (p BlockAlignedFlushPolicy) expired(s FlushState) bool {
+	return p.Timeout > 0 && IntervalFlushPolicy(p.Timeout).ShouldFlush(s)
+}
+
+// ShouldFlush implements the `FlushPolicy` interface.
+func (p BlockAlignedFlushPolicy) ShouldFlush(s FlushState) bool {
+	return p.expired(s) || p.aligned(s) > 0
+}
+
+// FlushLength implements the `PartialFlushPolicy` interface.
+func (p BlockAlignedFlushPolicy) FlushLength(s FlushState) int {
+	if p.expired(s) {
+		return s.Buffered
+	}
+	return p.aligned(s)
+}
+
+// FlushAfter implements the `TimedFlushPolicy` interface.
+func (p BlockAlignedFlushPolicy) FlushAfter() time.Duration {
+	return p.Timeout
+}
+
+// AnyFlushPolicy flushes when any of its policies would.
+type AnyFlushPolicy []FlushPolicy
+
+// ShouldFlush implements the `FlushPolicy` interface.
+func (p AnyFlushPolicy) ShouldFlush(s FlushState) bool {
+	for _, fp := range p {
+		if fp.ShouldFlush(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// FlushAfter implements the `TimedFlushPolicy` interface, it is the
+// shortest one of its timed policies.
+func (p AnyFlushPolicy) FlushAfter() time.Duration {
+	var after time.Duration
+	for _, fp := range p {
+		tp, ok := fp.(TimedFlushPolicy)
+		if !ok {
+			continue
+		}
+		if d := tp.FlushAfter(); d > 0 && (after == 0 || d < after) {
+			after = d
+		}
+	}
+	return after
+}
+
+// flushAfter returns the age after which the buffered writes should be
+// flushed by a timer, zero if the policy isn't timed.
+func (dm *DagModifier) flushAfter() time.Duration {
+	if tp, ok := dm.FlushPolicy.(TimedFlushPolicy); ok {
+		return tp.FlushAfter()
+	}
+	return 0
+}
+
+// flushState returns the current state of the write buffer.
+func (dm *DagModifier) flushState() FlushState {
+	return FlushState{
+		Buffered:   dm.wrBuf.Len(),
+		Start:      dm.writeStart,
+		DirtySince: dm.dirtySince,
+	}
+}
+
+// autoFlush consults the configured policy (or the default one) about the
+// current write buffer and flushes (all or part of) it accordingly.
+func (dm *DagModifier) autoFlush() error {
+	if dm.wrBuf == nil {
+		return nil
+	}
+	policy := dm.FlushPolicy
+	if policy == nil {
+		policy = SizeFlushPolicy(writebufferSize)
+	}
+	state := dm.flushState()
+	if !policy.ShouldFlush(state) {
+		return nil
+	}
+	if pp, ok := policy.(PartialFlushPolicy); ok {
+		return dm.syncPrefix(pp.FlushLength(state))
+	}
+	return dm.Sync()
+}
+
+// syncPrefix flushes the first `n` buffered bytes leaving the rest in the
+// write buffer.
+func (dm *DagModifier) syncPrefix(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if n >= dm.wrBuf.Len() {
+		return dm.Sync()
+	}
+
+	tail := getWrBuf()
+	tail.Write(dm.wrBuf.Bytes()[n:])
+	dm.wrBuf.Truncate(n)
+	dirtySince := dm.dirtySince
+	if err := dm.Sync(); err != nil {
+		putWrBuf(tail)
+		return err
+	}
+	dm.wrBuf = tail
+	dm.dirtySince = dirtySince
+	return nil
+}
+
+// FlushResult is the outcome of a `FlushAsync`.
+type FlushResult struct {
+	// Root is the CID of the new root (the metadata wrapper, if any, like
+	// `GetNode`).
+	Root cid.Cid
+	Err  error
+}
+
+// asyncFlush is a flush running in the background on a copy of the
+// modifier holding the detached write buffer.
+type asyncFlush struct {
+	done chan struct{}
+	fm   *DagModifier
+	err  error
+}
+
+// FlushAsync starts flushing the buffered writes in the background and
+// returns a channel that receives the result once they are persisted. The
+// modifier can keep buffering sequential writes in the meantime, so writers
+// can fill the next region while the previous one is written out. Any other
+// operation (reads, seeks, `Size`, `Sync`, the next flush...) first waits
+// for the pending flush, and fails with its error if it failed.
+func (dm *DagModifier) FlushAsync() <-chan FlushResult {
+	res := make(chan FlushResult, 1)
+	if err := dm.waitFlush(); err != nil {
+		res <- FlushResult{Err: err}
+		close(res)
+		return res
+	}
+
+	// If we have an active reader, kill it
+	if dm.read != nil {
+		dm.read = nil
+		dm.readCancel()
+	}
+
+	// The copy takes over the buffer (and the current root, which the
+	// flush modifies in place), the modifier starts a new buffer.
+	fm := *dm
+	f := &asyncFlush{done: make(chan struct{}), fm: &fm}
+	if dm.wrBuf != nil {
+		dm.writeStart += uint64(dm.wrBuf.Len())
+		dm.wrBuf = nil
+		dm.dirtySince = time.Time{}
+	}
+	dm.flushing = f
+
+	go func() {
+		defer close(res)
+		defer close(f.done)
+		var nd ipld.Node
+		nd, f.err = fm.GetNode()
+		if f.err != nil {
+			res <- FlushResult{Err: f.err}
+			return
+		}
+		res <- FlushResult{Root: nd.Cid()}
+	}()
+	return res
+}
+
+// waitFlush waits for the pending `FlushAsync` (if any) and takes its
+// result over.
+func (dm *DagModifier) waitFlush() error {
+	f := dm.flushing
+	if f == nil {
+		return nil
+	}
+	<-f.done
+	dm.flushing = nil
+	if f.err != nil {
+		return f.err
+	}
+	dm.curNode = f.fm.curNode
+	return nil
+}
@@ -0,0 +1,275 @@
+package mod
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	cid "github.com/ipfs/go-cid"
+	u "github.com/ipfs/go-ipfs-util"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestFlushPolicies(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newMod := func(policy FlushPolicy) *DagModifier {
+		n := testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves)
+		dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dagmod.FlushPolicy = policy
+		return dagmod
+	}
+	write := func(dm *DagModifier, size int) {
+		if _, err := dm.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Default policy
+	dm := newMod(nil)
+	write(dm, writebufferSize)
+	if !dm.HasChanges() {
+		t.Fatal("expected the default policy to buffer up to its limit")
+	}
+	write(dm, 1)
+	if dm.HasChanges() {
+		t.Fatal("expected the default policy to flush past its limit")
+	}
+
+	dm = newMod(SizeFlushPolicy(1000))
+	write(dm, 1000)
+	if !dm.HasChanges() {
+		t.Fatal("expected changes to be buffered")
+	}
+	write(dm, 1)
+	if dm.HasChanges() {
+		t.Fatal("expected size policy to flush")
+	}
+
+	dm = newMod(ManualFlushPolicy{})
+	write(dm, 2*writebufferSize)
+	if !dm.HasChanges() {
+		t.Fatal("expected manual policy to never flush")
+	}
+	if err := dm.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if dm.HasChanges() {
+		t.Fatal("expected Sync to flush")
+	}
+
+	dm = newMod(AnyFlushPolicy{IntervalFlushPolicy(10 * time.Millisecond), SizeFlushPolicy(writebufferSize)})
+	write(dm, 10)
+	if !dm.HasChanges() {
+		t.Fatal("expected changes to be buffered")
+	}
+	time.Sleep(20 * time.Millisecond)
+	write(dm, 10)
+	if dm.HasChanges() {
+		t.Fatal("expected interval policy to flush")
+	}
+	size, err := dm.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 20 {
+		t.Fatalf("expected size 20, got %d", size)
+	}
+}
+
+func TestBlockAlignedFlushPolicy(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves)
+	dm, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.FlushPolicy = BlockAlignedFlushPolicy{BlockSize: 512}
+
+	data := make([]byte, 10000)
+	u.NewTimeSeededRand().Read(data)
+	for off := 0; off < len(data); off += 300 {
+		end := off + 300
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := dm.Write(data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+		if dm.writeStart%512 != 0 || (dm.wrBuf != nil && dm.wrBuf.Len() >= 512) {
+			t.Fatalf("flush not aligned to blocks: start %d", dm.writeStart)
+		}
+		if dm.writeStart+uint64(bufLen(dm)) != uint64(end) {
+			t.Fatalf("lost buffered data at %d", end)
+		}
+	}
+
+	if _, err := dm.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// The timeout flushes the partial block too.
+	dm.FlushPolicy = BlockAlignedFlushPolicy{BlockSize: 512, Timeout: 10 * time.Millisecond}
+	if _, err := dm.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := dm.Write([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if dm.HasChanges() {
+		t.Fatal("expected the timeout to flush")
+	}
+}
+
+func TestFlushAsync(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves)
+	dm, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.FlushPolicy = ManualFlushPolicy{}
+
+	readRoot := func(c cid.Cid) []byte {
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd, err := uio.NewDagReader(ctx, nd, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	data := make([]byte, 20000)
+	u.NewTimeSeededRand().Read(data)
+	var futures []<-chan FlushResult
+	for off := 0; off < len(data); off += 5000 {
+		// Buffer the next region while the previous one is flushed.
+		if _, err := dm.Write(data[off : off+5000]); err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, dm.FlushAsync())
+	}
+	for i, f := range futures {
+		res := <-f
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if err := testu.ArrComp(readRoot(res.Root), data[:(i+1)*5000]); err != nil {
+			t.Fatalf("flush %d: %s", i, err)
+		}
+	}
+
+	if dm.HasChanges() {
+		if err := dm.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nd, err := dm.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(readRoot(nd.Cid()), data); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed flush is reported by the next operation too.
+	failing := &crashingDAGService{DAGService: dserv}
+	dm, err = NewDagModifier(ctx, nd, failing, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dm.WriteAt([]byte("foo"), 10); err != nil {
+		t.Fatal(err)
+	}
+	failing.crashed = true
+	f := dm.FlushAsync()
+	if _, err := dm.Size(); err != errCrash {
+		t.Fatalf("expected the flush error, got %v", err)
+	}
+	if res := <-f; res.Err != errCrash {
+		t.Fatalf("expected the flush error, got %v", res.Err)
+	}
+}
+
+func bufLen(dm *DagModifier) int {
+	if dm.wrBuf == nil {
+		return 0
+	}
+	return dm.wrBuf.Len()
+}
+
+func TestFileTimedFlush(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves)
+	dm, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.FlushPolicy = AnyFlushPolicy{IntervalFlushPolicy(10 * time.Millisecond), SizeFlushPolicy(writebufferSize)}
+	flushed := make(chan ipld.Node, 1)
+	f := NewFile(dm, func(nd ipld.Node) error {
+		flushed <- nd
+		return nil
+	})
+
+	// No further writes, the idle handle is flushed by its timer.
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	var nd ipld.Node
+	select {
+	case nd = <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the buffered write to be flushed")
+	}
+	rd, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello" {
+		t.Fatalf("expected the flushed file to hold the write, got %q", out)
+	}
+	f.state.lk.Lock()
+	changes := dm.HasChanges()
+	f.state.lk.Unlock()
+	if changes {
+		t.Fatal("expected no buffered changes after the timed flush")
+	}
+}
@@ -0,0 +1,232 @@
+package mod
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ErrJournalEmpty is returned when recovering from a journal that has no
+// records.
+var ErrJournalEmpty = errors.New("journal has no records")
+
+// Journal is a write-ahead log of the root transitions of a DagModifier.
+// `Begin` is called (and must be durable) before a flush, truncation or
+// expansion starts writing nodes from the root `from`, and `Commit` once it
+// has produced the root `to`. A crash in between leaves a transition that
+// was begun but never committed: the file is then recovered from the last
+// committed root, and the nodes written by the interrupted operation are
+// referenced by nothing and can be garbage collected.
+//
+// The roots journaled are the ones `GetNode` returns: for files wrapped in
+// a metadata node, the wrapper.
+type Journal interface {
+	Begin(from cid.Cid) error
+	Commit(from, to cid.Cid) error
+}
+
+// journaled runs `op`, which modifies `dm.curNode`, recording the
+// transition in the journal (if any). Nested calls are recorded as part of
+// the outermost one.
+func (dm *DagModifier) journaled(op func() error) error {
+	if dm.Journal == nil || dm.journaling {
+		return op()
+	}
+
+	from, err := dm.rootCid()
+	if err != nil {
+		return err
+	}
+	if err := dm.Journal.Begin(from); err != nil {
+		return err
+	}
+	dm.journaling = true
+	err = op()
+	dm.journaling = false
+	if err != nil {
+		// Left uncommitted, recovery discards it.
+		return err
+	}
+	to, err := dm.rootCid()
+	if err != nil {
+		return err
+	}
+	return dm.Journal.Commit(from, to)
+}
+
+// rootCid returns the CID of the root `GetNode` would return for the
+// current file node, adding the metadata wrapper (if any) to the
+// DAGService so the journaled root can be recovered.
+func (dm *DagModifier) rootCid() (cid.Cid, error) {
+	if dm.metaRoot == nil {
+		return dm.curNode.Cid(), nil
+	}
+	root, err := dm.rewrapMetadata()
+	if err != nil {
+		return cid.Undef, err
+	}
+	return root.Cid(), nil
+}
+
+// FileJournal is a Journal appending its records to a file, synced to disk
+// after each one.
+type FileJournal struct {
+	lk sync.Mutex
+	f  *os.File
+
+	root    cid.Cid
+	pending bool
+}
+
+var _ Journal = (*FileJournal)(nil)
+
+const (
+	journalBegin  = "begin"
+	journalCommit = "commit"
+)
+
+// OpenFileJournal opens (creating it if needed) the journal at `path` and
+// replays its records, see `Recover`. A truncated last record (missing its
+// trailing newline), from a crash while it was written, is ignored and
+// removed from the file so the next record isn't appended to it.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &FileJournal{f: f}
+
+	r := bufio.NewReader(f)
+	var end int64
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				if err := f.Truncate(end); err != nil {
+					f.Close()
+					return nil, err
+				}
+			}
+			return j, nil
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		end += int64(len(line))
+		if err := j.replay(line); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+}
+
+// replay applies a record to the state of the journal.
+func (j *FileJournal) replay(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	parse := func(i int) (cid.Cid, bool) {
+		if i >= len(fields) {
+			return cid.Undef, false
+		}
+		c, err := cid.Decode(fields[i])
+		return c, err == nil
+	}
+
+	switch fields[0] {
+	case journalBegin:
+		from, ok := parse(1)
+		if !ok {
+			// Torn record, the operation never started.
+			return nil
+		}
+		if !j.root.Defined() {
+			j.root = from
+		}
+		j.pending = true
+	case journalCommit:
+		to, ok := parse(2)
+		if !ok {
+			return nil
+		}
+		j.root = to
+		j.pending = false
+	default:
+		return fmt.Errorf("corrupt journal record %q", line)
+	}
+	return nil
+}
+
+func (j *FileJournal) append(fields ...string) error {
+	if _, err := j.f.WriteString(strings.Join(fields, " ") + "\n"); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Begin implements the `Journal` interface.
+func (j *FileJournal) Begin(from cid.Cid) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	if err := j.append(journalBegin, from.String()); err != nil {
+		return err
+	}
+	if !j.root.Defined() {
+		j.root = from
+	}
+	j.pending = true
+	return nil
+}
+
+// Commit implements the `Journal` interface.
+func (j *FileJournal) Commit(from, to cid.Cid) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	if err := j.append(journalCommit, from.String(), to.String()); err != nil {
+		return err
+	}
+	j.root = to
+	j.pending = false
+	return nil
+}
+
+// Recover returns the root to reopen the file from, the result of the last
+// committed transition (or the root the first one started from), and
+// whether a later transition was interrupted and has been discarded.
+func (j *FileJournal) Recover() (root cid.Cid, interrupted bool, err error) {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	if !j.root.Defined() {
+		return cid.Undef, false, ErrJournalEmpty
+	}
+	return j.root, j.pending, nil
+}
+
+// Checkpoint truncates the journal to a single committed record of the
+// current root, so it doesn't grow without bound. Any interrupted
+// transition is discarded.
+func (j *FileJournal) Checkpoint() error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	j.pending = false
+	if !j.root.Defined() {
+		return j.f.Sync()
+	}
+	return j.append(journalCommit, j.root.String(), j.root.String())
+}
+
+// Close closes the journal file.
+func (j *FileJournal) Close() error {
+	return j.f.Close()
+}
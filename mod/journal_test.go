@@ -0,0 +1,273 @@
+package mod
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ft "github.com/TRON-US/go-unixfs"
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+var errCrash = errors.New("crash")
+
+// crashingDAGService fails every Add once crashed is set.
+type crashingDAGService struct {
+	ipld.DAGService
+	crashed bool
+}
+
+func (ds *crashingDAGService) Add(ctx context.Context, nd ipld.Node) error {
+	if ds.crashed {
+		return errCrash
+	}
+	return ds.DAGService.Add(ctx, nd)
+}
+
+func TestFileJournal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := &crashingDAGService{DAGService: testu.GetDAGServ()}
+	_, n := testu.GetRandomNode(t, dserv, 5000, testu.UseProtoBufLeaves)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.Recover(); err != ErrJournalEmpty {
+		t.Fatalf("expected ErrJournalEmpty, got %v", err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod.Journal = j
+	if _, err := dagmod.WriteAt([]byte("journaled"), 100); err != nil {
+		t.Fatal(err)
+	}
+	// Truncating past the end expands the file, it is a single transition.
+	if err := dagmod.Truncate(6000); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Crash in the middle of a flush.
+	if _, err := dagmod.WriteAt([]byte("lost"), 10); err != nil {
+		t.Fatal(err)
+	}
+	dserv.crashed = true
+	if err := dagmod.Sync(); err != errCrash {
+		t.Fatalf("expected the crash, got %v", err)
+	}
+	j.Close()
+
+	j, err = OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	root, interrupted, err := j.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interrupted {
+		t.Fatal("expected an interrupted transition")
+	}
+	if !root.Equals(committed.Cid()) {
+		t.Fatalf("expected to recover %s, got %s", committed.Cid(), root)
+	}
+
+	// A torn record is ignored.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("commit " + root.String() + " Qm"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	check := func(expectInterrupted bool) {
+		j, err := OpenFileJournal(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		root, interrupted, err := j.Recover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interrupted != expectInterrupted || !root.Equals(committed.Cid()) {
+			t.Fatalf("expected %s (interrupted: %t), got %s (interrupted: %t)", committed.Cid(), expectInterrupted, root, interrupted)
+		}
+	}
+	check(true)
+
+	if err := j.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	check(false)
+}
+
+func TestFileJournalTornRecord(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := testu.GetDAGServ()
+	_, n := testu.GetRandomNode(t, dserv, 5000, testu.UseProtoBufLeaves)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod.Journal = j
+	if _, err := dagmod.WriteAt([]byte("first"), 100); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.WriteAt([]byte("second"), 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagmod.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// Crash in the middle of writing the keyword of the last commit.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := strings.LastIndex(string(data), journalCommit)
+	if err := os.Truncate(path, int64(last+len("comm"))); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, interrupted, err := j.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interrupted || !root.Equals(committed.Cid()) {
+		t.Fatalf("expected %s (interrupted), got %s (interrupted: %t)", committed.Cid(), root, interrupted)
+	}
+
+	// The torn record was dropped, the next one can be read back.
+	if err := j.Commit(root, n.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	j, err = OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	root, interrupted, err = j.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted || !root.Equals(n.Cid()) {
+		t.Fatalf("expected %s, got %s (interrupted: %t)", n.Cid(), root, interrupted)
+	}
+}
+
+func TestFileJournalWrapped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dserv := &crashingDAGService{DAGService: testu.GetDAGServ()}
+	b, n := testu.GetRandomNode(t, dserv, 5000, testu.UseProtoBufLeaves)
+	wrapper, err := ft.WrapMetadata(n, &ft.Metadata{MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, wrapper); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, wrapper, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagmod.Journal = j
+	b = testModWriteAndVerifyWrapped(t, dagmod, b, []byte("journaled"), 100)
+	if err := dagmod.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dagmod.WriteAt([]byte("lost"), 10); err != nil {
+		t.Fatal(err)
+	}
+	dserv.crashed = true
+	if err := dagmod.Sync(); err != errCrash {
+		t.Fatalf("expected the crash, got %v", err)
+	}
+	j.Close()
+
+	j, err = OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	root, _, err := j.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.Equals(committed.Cid()) {
+		t.Fatalf("expected to recover %s, got %s", committed.Cid(), root)
+	}
+
+	// The recovered root is the wrapper, not the file it wraps.
+	nd, err := dserv.Get(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, md, err := ft.UnwrapMetadata(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md == nil || md.MimeType != "text/plain" {
+		t.Fatalf("expected the metadata wrapper, got %+v", md)
+	}
+	rd, err := uio.NewDagReader(ctx, file, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, b); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package mod
+
+import (
+	"context"
+	"errors"
+
+	ft "github.com/TRON-US/go-unixfs"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// ErrOffsetOutOfRange is returned when an offset is not inside the file.
+var ErrOffsetOutOfRange = errors.New("offset is beyond the end of the file")
+
+// PathStep is one internal node on the way from the root of a file DAG to
+// the subtree covering an offset.
+type PathStep struct {
+	// Node is the internal node.
+	Node *mdag.ProtoNode
+	// Index is the index of the link (and block size) followed.
+	Index int
+	// Offset is the file offset where the child at Index starts.
+	Offset uint64
+}
+
+// Subtree is a node of a file DAG reached from its root, along with the
+// path that leads to it. It is what `SubtreeAt` returns, and what
+// `Replace` rebuilds the spine from.
+type Subtree struct {
+	// Path holds the internal nodes from the root (`Path[0]`) down to the
+	// parent of Node. It is empty when Node is the root itself.
+	Path []PathStep
+	// Node is the subtree covering the requested offset.
+	Node ipld.Node
+	// Offset is the file offset where Node starts.
+	Offset uint64
+}
+
+// SubtreeAt walks the file DAG under `root` towards the leaf covering the
+// byte `offset`, following at most `depth` links (all the way down to the
+// leaf if `depth` is negative), and returns the node reached along with
+// its path. It walks the DAG the way the writes of the `DagModifier` do,
+// and along with `Replace` it lets custom operations (like splicing
+// deduplicated subtrees or migrating part of a file) be written without a
+// `DagModifier`.
+func SubtreeAt(ctx context.Context, ng ipld.NodeGetter, root ipld.Node, offset uint64, depth int) (*Subtree, error) {
+	size, err := FileSize(root)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= size {
+		return nil, ErrOffsetOutOfRange
+	}
+
+	st := &Subtree{Node: root}
+	for depth != 0 && len(st.Node.Links()) > 0 {
+		pn, ok := st.Node.(*mdag.ProtoNode)
+		if !ok {
+			return nil, ErrNotUnixfs
+		}
+		fsn, err := ft.FSNodeFromNode(pn)
+		if err != nil {
+			return nil, err
+		}
+		if fsn.NumChildren() != len(pn.Links()) {
+			return nil, ft.ErrMalformedFileFormat
+		}
+
+		i, childOff, ok := fsn.ChildAt(offset - st.Offset)
+		if !ok {
+			return nil, ft.ErrMalformedFileFormat
+		}
+		cur := offset - childOff
+
+		child, err := pn.Links()[i].GetNode(ctx, ng)
+		if err != nil {
+			return nil, err
+		}
+		st.Path = append(st.Path, PathStep{Node: pn, Index: i, Offset: cur})
+		st.Node = child
+		st.Offset = cur
+		depth--
+	}
+	return st, nil
+}
+
+// Replace puts `nd` in place of the subtree, rebuilding (and adding to
+// `ds`) each node of the path with the new link and its block sizes and
+// file size fixed up, and returns the new root. `nd` is not added, it may
+// have a different size than the subtree it replaces. The Subtree itself
+// is not modified.
+func (st *Subtree) Replace(ctx context.Context, ds ipld.DAGService, nd ipld.Node) (ipld.Node, error) {
+	for i := len(st.Path) - 1; i >= 0; i-- {
+		step := st.Path[i]
+		size, err := FileSize(nd)
+		if err != nil {
+			return nil, err
+		}
+
+		parent := step.Node.Copy().(*mdag.ProtoNode)
+		fsn, err := ft.FSNodeFromBytes(parent.Data())
+		if err != nil {
+			return nil, err
+		}
+		fsn.SetBlockSize(step.Index, size)
+		data, err := fsn.GetBytes()
+		if err != nil {
+			return nil, err
+		}
+		parent.SetData(data)
+
+		lnk, err := ipld.MakeLink(nd)
+		if err != nil {
+			return nil, err
+		}
+		// The copy shares the links with the original node.
+		links := append([]*ipld.Link(nil), parent.Links()...)
+		lnk.Name = links[step.Index].Name
+		links[step.Index] = lnk
+		parent.SetLinks(links)
+
+		if err := ds.Add(ctx, parent); err != nil {
+			return nil, err
+		}
+		nd = parent
+	}
+	return nd, nil
+}
+
+// ReplaceChildAtOffset replaces the node found `depth` links below `root`
+// on the way to the leaf covering `offset` (see `SubtreeAt`) with `nd`, and
+// returns the new root.
+func ReplaceChildAtOffset(ctx context.Context, ds ipld.DAGService, root ipld.Node, offset uint64, depth int, nd ipld.Node) (ipld.Node, error) {
+	st, err := SubtreeAt(ctx, ds, root, offset, depth)
+	if err != nil {
+		return nil, err
+	}
+	return st.Replace(ctx, ds, nd)
+}
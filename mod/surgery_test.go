@@ -0,0 +1,107 @@
+package mod
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestSubtreeSurgery(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := testu.UseProtoBufLeaves
+	opts.MaxLinks = 3
+	opts.Balanced = true
+	data, root := testu.GetRandomNode(t, dserv, 5000, opts)
+
+	readAll := func(nd ipld.Node) []byte {
+		rd, err := uio.NewDagReader(ctx, nd, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// 500 byte leaves, the one covering 1234 starts at 1000.
+	st, err := SubtreeAt(ctx, dserv, root, 1234, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Offset != 1000 || len(st.Node.Links()) != 0 {
+		t.Fatalf("expected the leaf at 1000, got a node at %d with %d links", st.Offset, len(st.Node.Links()))
+	}
+	if len(st.Path) < 2 {
+		t.Fatalf("expected a deeper path, got %d steps", len(st.Path))
+	}
+	if st.Path[0].Node.Cid() != root.Cid() {
+		t.Fatal("path doesn't start at the root")
+	}
+
+	// Splice in a smaller leaf.
+	leaf := testu.GetNodeWithGivenData(t, dserv, []byte("spliced"), opts)
+	nroot, err := st.Replace(ctx, dserv, leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append(append([]byte(nil), data[:1000]...), "spliced"...), data[1500:]...)
+	if err := testu.ArrComp(readAll(nroot), expected); err != nil {
+		t.Fatal(err)
+	}
+	size, err := FileSize(nroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(expected)) {
+		t.Fatalf("expected file size %d, got %d", len(expected), size)
+	}
+	// The original DAG is untouched.
+	if err := testu.ArrComp(readAll(root), data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the first subtree of the root by one of the original leaves.
+	first, err := SubtreeAt(ctx, dserv, root, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nroot, err = ReplaceChildAtOffset(ctx, dserv, root, 0, 1, first.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := SubtreeAt(ctx, dserv, root, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topSize, err := FileSize(top.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append(append([]byte(nil), data[:500]...), data[topSize:]...)
+	if err := testu.ArrComp(readAll(nroot), expected); err != nil {
+		t.Fatal(err)
+	}
+
+	// Depth zero is the root itself.
+	st, err = SubtreeAt(ctx, dserv, root, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Path) != 0 || st.Node.Cid() != root.Cid() {
+		t.Fatal("expected the root")
+	}
+
+	if _, err := SubtreeAt(ctx, dserv, root, 5000, -1); err != ErrOffsetOutOfRange {
+		t.Fatalf("expected ErrOffsetOutOfRange, got %v", err)
+	}
+}
@@ -83,6 +83,9 @@ type Data struct {
 	Blocksizes           []uint64       `protobuf:"varint,4,rep,name=blocksizes" json:"blocksizes,omitempty"`
 	HashType             *uint64        `protobuf:"varint,5,opt,name=hashType" json:"hashType,omitempty"`
 	Fanout               *uint64        `protobuf:"varint,6,opt,name=fanout" json:"fanout,omitempty"`
+	Mode                 *uint32        `protobuf:"varint,7,opt,name=mode" json:"mode,omitempty"`
+	Mtime                *UnixTime      `protobuf:"bytes,8,opt,name=mtime" json:"mtime,omitempty"`
+	Xattrs               []*Xattr       `protobuf:"bytes,9,rep,name=xattrs" json:"xattrs,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
 	XXX_unrecognized     []byte         `json:"-"`
 	XXX_sizecache        int32          `json:"-"`
@@ -154,8 +157,30 @@ func (m *Data) GetFanout() uint64 {
 	return 0
 }
 
+func (m *Data) GetMode() uint32 {
+	if m != nil && m.Mode != nil {
+		return *m.Mode
+	}
+	return 0
+}
+
+func (m *Data) GetMtime() *UnixTime {
+	if m != nil {
+		return m.Mtime
+	}
+	return nil
+}
+
+func (m *Data) GetXattrs() []*Xattr {
+	if m != nil {
+		return m.Xattrs
+	}
+	return nil
+}
+
 type Metadata struct {
 	MimeType             *string  `protobuf:"bytes,1,opt,name=MimeType" json:"MimeType,omitempty"`
+	Checksum             []byte   `protobuf:"bytes,2,opt,name=Checksum" json:"Checksum,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -192,31 +217,140 @@ func (m *Metadata) GetMimeType() string {
 	return ""
 }
 
+func (m *Metadata) GetChecksum() []byte {
+	if m != nil {
+		return m.Checksum
+	}
+	return nil
+}
+
+type UnixTime struct {
+	Seconds               *int64   `protobuf:"varint,1,req,name=Seconds" json:"Seconds,omitempty"`
+	FractionalNanoseconds *uint32  `protobuf:"fixed32,2,opt,name=FractionalNanoseconds" json:"FractionalNanoseconds,omitempty"`
+	XXX_NoUnkeyedLiteral  struct{} `json:"-"`
+	XXX_unrecognized      []byte   `json:"-"`
+	XXX_sizecache         int32    `json:"-"`
+}
+
+func (m *UnixTime) Reset()         { *m = UnixTime{} }
+func (m *UnixTime) String() string { return proto.CompactTextString(m) }
+func (*UnixTime) ProtoMessage()    {}
+func (*UnixTime) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e2fd76cc44dfc7c3, []int{2}
+}
+func (m *UnixTime) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnixTime.Unmarshal(m, b)
+}
+func (m *UnixTime) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnixTime.Marshal(b, m, deterministic)
+}
+func (m *UnixTime) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnixTime.Merge(m, src)
+}
+func (m *UnixTime) XXX_Size() int {
+	return xxx_messageInfo_UnixTime.Size(m)
+}
+func (m *UnixTime) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnixTime.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnixTime proto.InternalMessageInfo
+
+func (m *UnixTime) GetSeconds() int64 {
+	if m != nil && m.Seconds != nil {
+		return *m.Seconds
+	}
+	return 0
+}
+
+func (m *UnixTime) GetFractionalNanoseconds() uint32 {
+	if m != nil && m.FractionalNanoseconds != nil {
+		return *m.FractionalNanoseconds
+	}
+	return 0
+}
+
+type Xattr struct {
+	Name                 *string  `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
+	Value                []byte   `protobuf:"bytes,2,opt,name=Value" json:"Value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Xattr) Reset()         { *m = Xattr{} }
+func (m *Xattr) String() string { return proto.CompactTextString(m) }
+func (*Xattr) ProtoMessage()    {}
+func (*Xattr) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e2fd76cc44dfc7c3, []int{3}
+}
+func (m *Xattr) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Xattr.Unmarshal(m, b)
+}
+func (m *Xattr) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Xattr.Marshal(b, m, deterministic)
+}
+func (m *Xattr) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Xattr.Merge(m, src)
+}
+func (m *Xattr) XXX_Size() int {
+	return xxx_messageInfo_Xattr.Size(m)
+}
+func (m *Xattr) XXX_DiscardUnknown() {
+	xxx_messageInfo_Xattr.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Xattr proto.InternalMessageInfo
+
+func (m *Xattr) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Xattr) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("unixfs.pb.Data_DataType", Data_DataType_name, Data_DataType_value)
 	proto.RegisterType((*Data)(nil), "unixfs.pb.Data")
 	proto.RegisterType((*Metadata)(nil), "unixfs.pb.Metadata")
+	proto.RegisterType((*UnixTime)(nil), "unixfs.pb.UnixTime")
+	proto.RegisterType((*Xattr)(nil), "unixfs.pb.Xattr")
 }
 
 func init() { proto.RegisterFile("unixfs.proto", fileDescriptor_e2fd76cc44dfc7c3) }
 
 var fileDescriptor_e2fd76cc44dfc7c3 = []byte{
-	// 260 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x90, 0xc1, 0x6a, 0x83, 0x30,
-	0x1c, 0xc6, 0xa7, 0xa6, 0xad, 0xfe, 0xe7, 0x46, 0xf8, 0x1f, 0x46, 0xd8, 0x61, 0x88, 0x87, 0x91,
-	0xc3, 0xf0, 0xb0, 0x37, 0x18, 0x94, 0xb1, 0x8b, 0x97, 0xd4, 0x17, 0x48, 0xdb, 0x88, 0x41, 0x6b,
-	0x8a, 0xa6, 0x6c, 0xee, 0x65, 0xf6, 0xaa, 0x23, 0x5a, 0xdd, 0x2e, 0x81, 0x5f, 0xbe, 0xef, 0x17,
-	0x3e, 0x02, 0xf1, 0xa5, 0xd5, 0x5f, 0x65, 0x9f, 0x9d, 0x3b, 0x63, 0x0d, 0x46, 0x33, 0xed, 0xd3,
-	0x1f, 0x1f, 0xc8, 0x56, 0x5a, 0x89, 0x2f, 0x40, 0x8a, 0xe1, 0xac, 0x98, 0x97, 0xf8, 0xfc, 0xfe,
-	0x95, 0x65, 0x4b, 0x25, 0x73, 0xf1, 0x78, 0xb8, 0x5c, 0x8c, 0x2d, 0xc4, 0xc9, 0x62, 0x7e, 0xe2,
-	0xf1, 0x58, 0x4c, 0x2f, 0x3c, 0x42, 0x58, 0xea, 0x46, 0xf5, 0xfa, 0x5b, 0xb1, 0x20, 0xf1, 0x38,
-	0x11, 0x0b, 0xe3, 0x13, 0xc0, 0xbe, 0x31, 0x87, 0xda, 0x41, 0xcf, 0x48, 0x12, 0x70, 0x22, 0xfe,
-	0xdd, 0x38, 0xb7, 0x92, 0x7d, 0x35, 0x2e, 0x58, 0x4d, 0xee, 0xcc, 0xf8, 0x00, 0xeb, 0x52, 0xb6,
-	0xe6, 0x62, 0xd9, 0x7a, 0x4c, 0xae, 0x94, 0x2a, 0x08, 0xe7, 0x55, 0xb8, 0x81, 0x40, 0xc8, 0x4f,
-	0x7a, 0x83, 0x77, 0x10, 0x6d, 0x75, 0xa7, 0x0e, 0xd6, 0x74, 0x03, 0xf5, 0x30, 0x04, 0xf2, 0xae,
-	0x1b, 0x45, 0x7d, 0x8c, 0x21, 0xcc, 0x95, 0x95, 0x47, 0x69, 0x25, 0x0d, 0xf0, 0x16, 0x36, 0xbb,
-	0xe1, 0xd4, 0xe8, 0xb6, 0xa6, 0xc4, 0x39, 0x1f, 0x6f, 0x79, 0xb1, 0xab, 0x64, 0x77, 0xa4, 0x2b,
-	0x87, 0x85, 0xa9, 0x55, 0xeb, 0xea, 0x74, 0x9d, 0x3e, 0xff, 0x89, 0x6e, 0x66, 0xae, 0x4f, 0xea,
-	0xfa, 0x51, 0x1e, 0x8f, 0xc4, 0xc2, 0xbf, 0x01, 0x00, 0x00, 0xff, 0xff, 0x66, 0x10, 0x1b, 0xd8,
-	0x63, 0x01, 0x00, 0x00,
+	// 396 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xcd, 0x8e, 0xd3, 0x30,
+	0x14, 0x85, 0x49, 0x93, 0x34, 0xc9, 0x6d, 0x07, 0x45, 0x97, 0x1f, 0x59, 0x2c, 0x50, 0x94, 0x95,
+	0x91, 0x50, 0x25, 0x2a, 0x5e, 0x00, 0x18, 0x8d, 0xd8, 0x74, 0x16, 0x6e, 0x41, 0x88, 0x9d, 0x27,
+	0x75, 0x55, 0xab, 0xb1, 0x5d, 0xc5, 0xae, 0x68, 0x79, 0x02, 0x1e, 0x1b, 0xd9, 0x49, 0x4a, 0x17,
+	0x6c, 0x22, 0x7f, 0x39, 0xe7, 0x58, 0xf7, 0xc7, 0x30, 0x3f, 0x69, 0x79, 0xde, 0xd9, 0xc5, 0xb1,
+	0x33, 0xce, 0x60, 0x31, 0xd2, 0x53, 0xfd, 0x27, 0x86, 0xe4, 0x9e, 0x3b, 0x8e, 0xef, 0x21, 0xd9,
+	0x5c, 0x8e, 0x82, 0x44, 0xd5, 0x84, 0x3e, 0x5f, 0x92, 0xc5, 0xd5, 0xb2, 0xf0, 0x72, 0xf8, 0x78,
+	0x9d, 0x05, 0x17, 0x62, 0x9f, 0x22, 0x93, 0x2a, 0xa2, 0x73, 0xd6, 0xdf, 0xf0, 0x06, 0xf2, 0x9d,
+	0x6c, 0x85, 0x95, 0xbf, 0x05, 0x89, 0xab, 0x88, 0x26, 0xec, 0xca, 0xf8, 0x16, 0xe0, 0xa9, 0x35,
+	0xcd, 0xc1, 0x83, 0x25, 0x49, 0x15, 0xd3, 0x84, 0xdd, 0xfc, 0xf1, 0xd9, 0x3d, 0xb7, 0xfb, 0x50,
+	0x41, 0xda, 0x67, 0x47, 0xc6, 0xd7, 0x30, 0xdd, 0x71, 0x6d, 0x4e, 0x8e, 0x4c, 0x83, 0x32, 0x90,
+	0xaf, 0x41, 0x99, 0xad, 0x20, 0x59, 0x15, 0xd1, 0x3b, 0x16, 0xce, 0xf8, 0x0e, 0x52, 0xe5, 0xa4,
+	0x12, 0x24, 0xaf, 0x22, 0x3a, 0x5b, 0xbe, 0xb8, 0x69, 0xe3, 0x9b, 0x96, 0xe7, 0x8d, 0x54, 0x82,
+	0xf5, 0x0e, 0xa4, 0x30, 0x3d, 0x73, 0xe7, 0x3a, 0x4b, 0x8a, 0x2a, 0xa6, 0xb3, 0x65, 0x79, 0xe3,
+	0xfd, 0xe1, 0x05, 0x36, 0xe8, 0xb5, 0x80, 0x7c, 0x6c, 0x1f, 0x33, 0x88, 0x19, 0xff, 0x55, 0x3e,
+	0xc3, 0x3b, 0x28, 0xee, 0x65, 0x27, 0x1a, 0x67, 0xba, 0x4b, 0x19, 0x61, 0x0e, 0xc9, 0x83, 0x6c,
+	0x45, 0x39, 0xc1, 0x39, 0xe4, 0x2b, 0xe1, 0xf8, 0x96, 0x3b, 0x5e, 0xc6, 0x38, 0x83, 0x6c, 0x7d,
+	0x51, 0xad, 0xd4, 0x87, 0x32, 0xf1, 0x99, 0xaf, 0x9f, 0x56, 0x9b, 0xf5, 0x9e, 0x77, 0xdb, 0x32,
+	0xf5, 0xb8, 0x31, 0x07, 0xa1, 0xbd, 0xbd, 0x9c, 0xd6, 0x9f, 0xff, 0x05, 0xfd, 0x3c, 0x56, 0x52,
+	0x89, 0x61, 0x23, 0x11, 0x2d, 0xd8, 0x95, 0xbd, 0xf6, 0x65, 0x2f, 0x9a, 0x83, 0x3d, 0xa9, 0x61,
+	0xfe, 0x57, 0xae, 0x7f, 0x42, 0x3e, 0xf6, 0x89, 0x04, 0xb2, 0xb5, 0x68, 0x8c, 0xde, 0xda, 0xb0,
+	0xd4, 0x98, 0x8d, 0x88, 0x1f, 0xe1, 0xd5, 0x43, 0xc7, 0x1b, 0x27, 0x8d, 0xe6, 0xed, 0x23, 0xd7,
+	0xc6, 0x0e, 0x3e, 0x7f, 0x5d, 0xc6, 0xfe, 0x2f, 0xd6, 0x1f, 0x20, 0x0d, 0x73, 0xf1, 0x83, 0x7f,
+	0xe4, 0xaa, 0x7f, 0x2a, 0x05, 0x0b, 0x67, 0x7c, 0x09, 0xe9, 0x77, 0xde, 0x9e, 0xc4, 0x50, 0x51,
+	0x0f, 0x7f, 0x07, 0x00, 0xfd, 0x26, 0xb7, 0xc0, 0x77, 0x02, 0x00, 0x00,
 }
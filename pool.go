@@ -0,0 +1,53 @@
+package unixfs
+
+import (
+	"sync"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// pooledData is a `pb.Data` message recycled by `dataPool`, holding the
+// storage of its scalar fields so setting them doesn't allocate either.
+type pooledData struct {
+	pb.Data
+	typ      pb.Data_DataType
+	filesize uint64
+}
+
+// dataPool recycles the messages encoded for every leaf (by the importers
+// and the appends of the `DagModifier`), so bulk imports only allocate the
+// encoded bytes of each block.
+var dataPool = sync.Pool{
+	New: func() interface{} { return new(pooledData) },
+}
+
+// getData returns a message of type `typ` from the pool.
+func getData(typ pb.Data_DataType) *pooledData {
+	d := dataPool.Get().(*pooledData)
+	d.typ = typ
+	d.Type = &d.typ
+	return d
+}
+
+func (d *pooledData) setFilesize(size uint64) {
+	d.filesize = size
+	d.Filesize = &d.filesize
+}
+
+// putData returns an encoded message to the pool, dropping its references
+// to the data of the caller.
+func putData(d *pooledData) {
+	d.Data = pb.Data{}
+	dataPool.Put(d)
+}
+
+// LeafPBData returns the unixfs data of a leaf of type `typ` holding
+// `data`, the bytes `NewFSNode(typ)` would encode once given the data
+// with `SetData`, without allocating a node.
+func LeafPBData(typ pb.Data_DataType, data []byte) ([]byte, error) {
+	d := getData(typ)
+	defer putData(d)
+	d.Data.Data = data
+	d.setFilesize(uint64(len(data)))
+	return marshalData(&d.Data)
+}
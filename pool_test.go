@@ -0,0 +1,44 @@
+package unixfs
+
+import (
+	"bytes"
+	"testing"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+func TestLeafPBData(t *testing.T) {
+	for _, typ := range []pb.Data_DataType{TFile, TRaw, TTokenMeta} {
+		for _, data := range [][]byte{nil, {}, []byte("leaf data")} {
+			fsn := NewFSNode(typ)
+			fsn.SetData(data)
+			expected, err := fsn.GetBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := LeafPBData(typ, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, expected) {
+				t.Fatalf("%s leaf of %q: expected %x, got %x", typ, data, expected, b)
+			}
+		}
+	}
+	// The pooled messages don't leak into the next encodings.
+	if !bytes.Equal(FilePBData(nil, 0), EmptyFileNode().Data()) {
+		t.Fatal("expected the empty file data")
+	}
+
+	if AuditMode() {
+		t.Skip("the audit decodes the messages")
+	}
+	data := make([]byte, 1024)
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, err := LeafPBData(TFile, data); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs > 1 {
+		t.Fatalf("expected only the encoded bytes to be allocated, got %v allocations", allocs)
+	}
+}
@@ -0,0 +1,186 @@
+package unixfs
+
+import (
+	"context"
+	"fmt"
+
+	proto "github.com/gogo/protobuf/proto"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// RepairSizes rewrites the file DAG under `nd` so the sizes it declares
+// match the data it holds, the inconsistencies reported by `Validate`
+// (e.g., left by older truncates): the file sizes and block sizes of its
+// nodes are recomputed from the leaves up, as is the size of the
+// `TMetadata` wrapper of the file. The rewritten nodes are added to `ds`
+// and the repaired root is returned, `nd` itself if it was consistent.
+// The nodes that can't be repaired (they aren't part of a file or can't
+// be decoded) fail with an error carrying their key.
+func RepairSizes(ctx context.Context, nd ipld.Node, ds ipld.DAGService) (ipld.Node, error) {
+	r := &repairer{ctx: ctx, ds: ds, done: make(map[cid.Cid]repaired)}
+	rep, err := r.repair(nd)
+	if err != nil {
+		return nil, err
+	}
+	return rep.node, nil
+}
+
+// repaired is a node once repaired and the size of the data under it.
+type repaired struct {
+	node ipld.Node
+	size uint64
+}
+
+type repairer struct {
+	ctx context.Context
+	ds  ipld.DAGService
+	// done memoizes the repaired subtrees, shared ones are walked once.
+	done map[cid.Cid]repaired
+}
+
+func (r *repairer) repair(nd ipld.Node) (repaired, error) {
+	if rep, ok := r.done[nd.Cid()]; ok {
+		return rep, nil
+	}
+	rep, err := r.repairNode(nd)
+	if err != nil {
+		return repaired{}, err
+	}
+	r.done[nd.Cid()] = rep
+	return rep, nil
+}
+
+func (r *repairer) repairNode(nd ipld.Node) (repaired, error) {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		if IsRawLeaf(nd) {
+			return repaired{node: nd, size: uint64(len(nd.RawData()))}, nil
+		}
+		return repaired{}, ErrUnrecognizedType
+	}
+	fsn, err := FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return repaired{}, withKey(err, nd.Cid())
+	}
+
+	switch fsn.Type() {
+	case TFile, TRaw, TTokenMeta:
+	case TMetadata:
+		return r.repairMetadata(pn, fsn)
+	default:
+		return repaired{}, fmt.Errorf("unixfs: node %s: can't repair %s node", nd.Cid(), fsn.Type())
+	}
+
+	links := pn.Links()
+	children, err := r.repairChildren(links)
+	if err != nil {
+		return repaired{}, err
+	}
+
+	changed := fsn.NumChildren() != len(links)
+	if changed {
+		fsn.RemoveAllBlockSizes()
+	}
+	size := uint64(len(fsn.Data()))
+	for i, child := range children {
+		if child.node.Cid() != links[i].Cid {
+			changed = true
+		}
+		if i >= fsn.NumChildren() {
+			fsn.AddBlockSize(child.size)
+		} else if fsn.BlockSize(i) != child.size {
+			fsn.SetBlockSize(i, child.size)
+			changed = true
+		}
+		if size, err = AddSizes(size, child.size); err != nil {
+			return repaired{}, fmt.Errorf("unixfs: node %s: %w", nd.Cid(), err)
+		}
+	}
+	if fsn.FileSize() != size {
+		fsn.format.Filesize = proto.Uint64(size)
+		changed = true
+	}
+	if !changed {
+		return repaired{node: nd, size: size}, nil
+	}
+
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return repaired{}, err
+	}
+	fixed, err := r.rewrite(pn, data, children)
+	if err != nil {
+		return repaired{}, err
+	}
+	return repaired{node: fixed, size: size}, nil
+}
+
+// repairMetadata repairs the file wrapped by a `TMetadata` node and sets
+// the size of the wrapper to the one of the file, keeping its attributes.
+func (r *repairer) repairMetadata(pn *dag.ProtoNode, fsn *FSNode) (repaired, error) {
+	links := pn.Links()
+	if len(links) == 0 {
+		return repaired{}, fmt.Errorf("unixfs: node %s: %w", pn.Cid(), ErrMalformedFileFormat)
+	}
+	children, err := r.repairChildren(links)
+	if err != nil {
+		return repaired{}, err
+	}
+	file := children[0]
+	if fsn.format.GetFilesize() == file.size && file.node.Cid() == links[0].Cid {
+		return repaired{node: pn, size: file.size}, nil
+	}
+
+	fsn.format.Filesize = proto.Uint64(file.size)
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return repaired{}, err
+	}
+	fixed, err := r.rewrite(pn, data, children)
+	if err != nil {
+		return repaired{}, err
+	}
+	return repaired{node: fixed, size: file.size}, nil
+}
+
+// repairChildren fetches and repairs the nodes of `links`.
+func (r *repairer) repairChildren(links []*ipld.Link) ([]repaired, error) {
+	cids := make([]cid.Cid, len(links))
+	for i, l := range links {
+		cids[i] = l.Cid
+	}
+	children := make([]repaired, len(links))
+	for i, promise := range ipld.GetNodes(r.ctx, r.ds, cids) {
+		child, err := promise.Get(r.ctx)
+		if err != nil {
+			return nil, err
+		}
+		if children[i], err = r.repair(child); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
+
+// rewrite adds a copy of `pn` (with its CID builder) holding `data` and
+// linking to the repaired `children` under the names of its links.
+func (r *repairer) rewrite(pn *dag.ProtoNode, data []byte, children []repaired) (ipld.Node, error) {
+	fixed := pn.Copy().(*dag.ProtoNode)
+	fixed.SetData(data)
+	links := make([]*ipld.Link, len(children))
+	for i, child := range children {
+		l, err := ipld.MakeLink(child.node)
+		if err != nil {
+			return nil, err
+		}
+		l.Name = pn.Links()[i].Name
+		links[i] = l
+	}
+	fixed.SetLinks(links)
+	if err := r.ds.Add(r.ctx, fixed); err != nil {
+		return nil, err
+	}
+	return fixed, nil
+}
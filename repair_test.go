@@ -0,0 +1,133 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestRepairSizes(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	add := func(nd ipld.Node) ipld.Node {
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	internal := func(sizes []uint64, children ...ipld.Node) ipld.Node {
+		fsn := NewFSNode(TFile)
+		for _, s := range sizes {
+			fsn.AddBlockSize(s)
+		}
+		b, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd := dag.NodeWithData(b)
+		for _, c := range children {
+			if err := nd.AddNodeLink("", c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return add(nd)
+	}
+	wrap := func(size uint64, nd ipld.Node) ipld.Node {
+		b, err := BytesForMetadata(&Metadata{MimeType: "text/plain", Size: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := dag.NodeWithData(b)
+		if err := w.AddNodeLink("", nd); err != nil {
+			t.Fatal(err)
+		}
+		return add(w)
+	}
+
+	hello := add(dag.NodeWithData(FilePBData([]byte("hello"), 5)))
+	world := add(dag.NewRawNode([]byte("world!")))
+	tail := add(dag.NodeWithData(FilePBData([]byte("tail"), 4)))
+	good := internal([]uint64{11, 4}, internal([]uint64{5, 6}, hello, world), tail)
+
+	badLeaf := add(dag.NodeWithData(FilePBData([]byte("hello"), 4)))
+	bad := internal([]uint64{12, 4}, internal([]uint64{5, 7}, badLeaf, world), tail)
+
+	for _, tc := range []struct {
+		name string
+		nd   ipld.Node
+		size int64
+	}{
+		{"Corrupted", bad, 15},
+		{"ChildCount", internal([]uint64{5}, hello, world), 11},
+		{"WrongMetadataSize", wrap(14, good), 15},
+		{"CorruptedMetadata", wrap(15, bad), 15},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fixed, err := RepairSizes(ctx, tc.nd, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fixed.Cid() == tc.nd.Cid() {
+				t.Fatal("expected the node to be rewritten")
+			}
+			findings, err := Validate(ctx, fixed, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(findings) != 0 {
+				t.Fatalf("expected no findings once repaired, got %v", findings)
+			}
+			fi, err := FileInfo("file", fixed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != tc.size {
+				t.Fatalf("expected a size of %d, got %d", tc.size, fi.Size())
+			}
+		})
+	}
+
+	for _, nd := range []ipld.Node{good, wrap(15, good), world} {
+		fixed, err := RepairSizes(ctx, nd, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixed.Cid() != nd.Cid() {
+			t.Fatalf("expected consistent node %s to be kept, got %s", nd.Cid(), fixed.Cid())
+		}
+	}
+
+	// The data and the link names are kept.
+	named := dag.NodeWithData(FilePBData(nil, 0))
+	if err := named.AddNodeLink("part", badLeaf); err != nil {
+		t.Fatal(err)
+	}
+	fixed, err := RepairSizes(ctx, add(named), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := fixed.Links()[0]; l.Name != "part" {
+		t.Fatalf("expected the link name to be kept, got %q", l.Name)
+	}
+	leaf, err := fixed.Links()[0].GetNode(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := FSNodeFromBytes(leaf.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fsn.Data(), []byte("hello")) || fsn.FileSize() != 5 {
+		t.Fatalf("unexpected repaired leaf %q of size %d", fsn.Data(), fsn.FileSize())
+	}
+
+	dir := add(EmptyDirNode())
+	if _, err := RepairSizes(ctx, internal([]uint64{0}, dir), ds); err == nil {
+		t.Fatal("expected directories not to be repaired")
+	}
+}
@@ -0,0 +1,311 @@
+// Package sidecar implements an optional convention to keep the file
+// attributes of a unixfs tree (mode, modification time, extended attributes
+// and ACLs) in a separate "sidecar" directory, for platforms or importers
+// that can't store them inline in the nodes.
+//
+// The sidecar is a unixfs directory (sharded once it grows) with one entry
+// per path of the tree, named after the hex-encoded SHA-256 of the path
+// (see `Key`), so deeply nested or unusual names don't matter and a lookup
+// never needs to walk the data tree. Each entry is a small unixfs file
+// holding the JSON-encoded `Record` of the path. Publishing the data root
+// along with the sidecar root is enough for any implementation following
+// the convention to restore the attributes, and `Materialize` does so while
+// exporting a tree to the local filesystem.
+package sidecar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ft "github.com/TRON-US/go-unixfs"
+	unixfile "github.com/TRON-US/go-unixfs/file"
+	uio "github.com/TRON-US/go-unixfs/io"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+// ErrKeyCollision is returned when a sidecar entry holds the attributes of
+// a different path than the one looked up.
+var ErrKeyCollision = errors.New("sidecar: entry belongs to a different path")
+
+// ErrSymlinkInPath is returned by `Apply` when the path of a record goes
+// through a symlink of the materialized tree, applying its attributes
+// would change a file that may be outside of it.
+var ErrSymlinkInPath = errors.New("sidecar: path goes through a symlink")
+
+// Attributes are the file attributes of a path, unset fields are left
+// alone when they are applied.
+type Attributes struct {
+	// Mode holds the permission bits of the path, along with the
+	// `os.ModeSetuid`, `os.ModeSetgid` and `os.ModeSticky` bits.
+	Mode *os.FileMode `json:"mode,omitempty"`
+	// ModTime is the modification time of the path.
+	ModTime *time.Time `json:"mtime,omitempty"`
+	// Xattrs are the extended attributes of the path by name.
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+	// ACL is the access control list of the path in the platform format,
+	// it is applied (on Linux) as the `system.posix_acl_access` attribute.
+	ACL []byte `json:"acl,omitempty"`
+}
+
+// Record is the content of a sidecar entry.
+type Record struct {
+	// Path is the cleaned path (see `Key`) the attributes belong to.
+	Path       string     `json:"path"`
+	Attributes Attributes `json:"attrs"`
+}
+
+// cleanPath returns the canonical form of a path relative to the root of
+// the tree: slash separated, without leading slash, "." for the root.
+func cleanPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// Key returns the name of the sidecar entry of the path `p`.
+func Key(p string) string {
+	sum := sha256.Sum256([]byte(cleanPath(p)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sidecar is a sidecar attributes tree being read or edited.
+type Sidecar struct {
+	ds  ipld.DAGService
+	dir uio.Directory
+}
+
+// New returns an empty sidecar.
+func New(ds ipld.DAGService) *Sidecar {
+	return &Sidecar{ds: ds, dir: uio.NewDirectory(ds)}
+}
+
+// Load opens the sidecar rooted at `nd`.
+func Load(ds ipld.DAGService, nd ipld.Node) (*Sidecar, error) {
+	dir, err := uio.NewDirectoryFromNode(ds, nd)
+	if err != nil {
+		return nil, err
+	}
+	return &Sidecar{ds: ds, dir: dir}, nil
+}
+
+// Set stores the attributes of the path `p`, replacing the previous ones.
+func (s *Sidecar) Set(ctx context.Context, p string, attrs *Attributes) error {
+	rec := Record{Path: cleanPath(p), Attributes: *attrs}
+	data, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+	nd := mdag.NodeWithData(ft.FilePBData(data, uint64(len(data))))
+	nd.SetCidBuilder(s.dir.GetCidBuilder())
+	if err := s.ds.Add(ctx, nd); err != nil {
+		return err
+	}
+	return s.dir.AddChild(ctx, Key(p), nd)
+}
+
+// Get returns the attributes of the path `p`, `os.ErrNotExist` if it has
+// none.
+func (s *Sidecar) Get(ctx context.Context, p string) (*Attributes, error) {
+	nd, err := s.dir.Find(ctx, Key(p))
+	if err != nil {
+		return nil, err
+	}
+	rec, err := decodeRecord(nd)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Path != cleanPath(p) {
+		return nil, ErrKeyCollision
+	}
+	return &rec.Attributes, nil
+}
+
+// Remove deletes the attributes of the path `p`, `os.ErrNotExist` if it
+// has none.
+func (s *Sidecar) Remove(ctx context.Context, p string) error {
+	return s.dir.RemoveChild(ctx, Key(p))
+}
+
+// ForEach calls `f` with every record of the sidecar, in no particular
+// order.
+func (s *Sidecar) ForEach(ctx context.Context, f func(*Record) error) error {
+	return s.dir.ForEachLink(ctx, func(lnk *ipld.Link) error {
+		nd, err := lnk.GetNode(ctx, s.ds)
+		if err != nil {
+			return err
+		}
+		rec, err := decodeRecord(nd)
+		if err != nil {
+			return err
+		}
+		return f(rec)
+	})
+}
+
+// GetNode returns the root of the sidecar.
+func (s *Sidecar) GetNode() (ipld.Node, error) {
+	return s.dir.GetNode()
+}
+
+func decodeRecord(nd ipld.Node) (*Record, error) {
+	pn, ok := nd.(*mdag.ProtoNode)
+	if !ok {
+		return nil, mdag.ErrNotProtobuf
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	rec := new(Record)
+	if err := json.Unmarshal(fsn.Data(), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// MaterializeOptions configure how attributes are applied to the local
+// filesystem.
+type MaterializeOptions struct {
+	// SetXattr sets an extended attribute of a local path. Extended
+	// attributes (and ACLs) are platform specific, they are skipped if it
+	// is nil.
+	SetXattr func(path, name string, value []byte) error
+}
+
+// aclXattr is the extended attribute ACLs are stored in on Linux.
+const aclXattr = "system.posix_acl_access"
+
+// Apply applies the attributes of the sidecar to the tree exported at
+// `dest`, deepest paths first so restricting the mode of a directory
+// doesn't prevent applying the attributes of its entries. Paths missing
+// from `dest` are skipped. The attributes of symlinks are not changed, as
+// most platforms can't (and `SetXattr` would change their targets), and
+// `ErrSymlinkInPath` is returned for paths whose parent directories
+// include a symlink.
+func (s *Sidecar) Apply(ctx context.Context, dest string, opts MaterializeOptions) error {
+	var recs []*Record
+	err := s.ForEach(ctx, func(rec *Record) error {
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		di, dj := strings.Count(recs[i].Path, "/"), strings.Count(recs[j].Path, "/")
+		if di != dj {
+			return di > dj
+		}
+		return recs[i].Path < recs[j].Path
+	})
+
+	for _, rec := range recs {
+		// Cleaned again, records may come from other implementations
+		// and must not point outside of `dest`.
+		rel := cleanPath(rec.Path)
+		if err := checkParents(dest, rel); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		p := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := applyAttributes(p, &rec.Attributes, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkParents makes sure none of the parent directories of the path `rel`
+// (relative to `dest`) is a symlink, `Chmod` and friends would follow it.
+func checkParents(dest, rel string) error {
+	parts := strings.Split(rel, "/")
+	p := dest
+	for _, part := range parts[:len(parts)-1] {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return ErrSymlinkInPath
+		}
+	}
+	return nil
+}
+
+func applyAttributes(p string, attrs *Attributes, opts MaterializeOptions) error {
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// `SetXattr` would follow the symlink, like `Chmod` and `Chtimes`.
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if opts.SetXattr != nil {
+		names := make([]string, 0, len(attrs.Xattrs))
+		for name := range attrs.Xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := opts.SetXattr(p, name, attrs.Xattrs[name]); err != nil {
+				return err
+			}
+		}
+		if attrs.ACL != nil {
+			if err := opts.SetXattr(p, aclXattr, attrs.ACL); err != nil {
+				return err
+			}
+		}
+	}
+
+	if attrs.ModTime != nil {
+		if err := os.Chtimes(p, *attrs.ModTime, *attrs.ModTime); err != nil {
+			return err
+		}
+	}
+	if attrs.Mode != nil {
+		if err := os.Chmod(p, *attrs.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Materialize exports the unixfs tree `root` to the local path `dest`
+// (which must not exist) with the attributes stored in its nodes (see
+// `unixfile.WriteTo`) and merges the attributes of the sidecar `sc` (if not
+// nil) over them.
+func Materialize(ctx context.Context, ds ipld.DAGService, root ipld.Node, sc *Sidecar, dest string, opts MaterializeOptions) error {
+	nd, err := unixfile.NewUnixfsFile(ctx, ds, root, unixfile.UnixfsFileOptions{})
+	if err != nil {
+		return err
+	}
+	if err := unixfile.WriteTo(nd, dest); err != nil {
+		return err
+	}
+	if sc == nil {
+		return nil
+	}
+	return sc.Apply(ctx, dest, opts)
+}
@@ -0,0 +1,239 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ft "github.com/TRON-US/go-unixfs"
+	uio "github.com/TRON-US/go-unixfs/io"
+	testu "github.com/TRON-US/go-unixfs/test"
+
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+func TestSidecar(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds := testu.GetDAGServ()
+
+	// dir/
+	//   sub/
+	//     file
+	//   link -> sub/file
+	file := testu.GetNodeWithGivenData(t, ds, []byte("content"), testu.UseProtoBufLeaves)
+	sub := uio.NewDirectory(ds)
+	if err := sub.AddChild(ctx, "file", file); err != nil {
+		t.Fatal(err)
+	}
+	subNd, err := sub.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, subNd); err != nil {
+		t.Fatal(err)
+	}
+	linkData, err := ft.SymlinkData("sub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := mdag.NodeWithData(linkData)
+	if err := ds.Add(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	dir := uio.NewDirectory(ds)
+	if err := dir.AddChild(ctx, "sub", subNd); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddChild(ctx, "link", link); err != nil {
+		t.Fatal(err)
+	}
+	root, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	fileMode, subMode := os.FileMode(0600), os.FileMode(0750)
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	sc := New(ds)
+	attrs := &Attributes{
+		Mode:    &fileMode,
+		ModTime: &mtime,
+		Xattrs:  map[string][]byte{"user.origin": []byte("test")},
+		ACL:     []byte{1, 2, 3},
+	}
+	if err := sc.Set(ctx, "/sub//file", attrs); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Set(ctx, "sub", &Attributes{Mode: &subMode, ModTime: &mtime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Set(ctx, "link", &Attributes{Mode: &fileMode, ModTime: &mtime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Set(ctx, "missing", &Attributes{Mode: &fileMode}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Remove(ctx, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Get(ctx, "missing"); err != os.ErrNotExist {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	scRoot, err := sc.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, scRoot); err != nil {
+		t.Fatal(err)
+	}
+	sc, err = Load(ds, scRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sc.Get(ctx, "sub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Mode != fileMode || !got.ModTime.Equal(mtime) || !bytes.Equal(got.Xattrs["user.origin"], []byte("test")) || !bytes.Equal(got.ACL, attrs.ACL) {
+		t.Fatalf("attributes not preserved: %+v", got)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	xattrs := make(map[string]string)
+	opts := MaterializeOptions{
+		SetXattr: func(p, name string, value []byte) error {
+			rel, err := filepath.Rel(dest, p)
+			if err != nil {
+				return err
+			}
+			xattrs[filepath.ToSlash(rel)+":"+name] = string(value)
+			return nil
+		},
+	}
+	if err := Materialize(ctx, ds, root, sc, dest, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(p string, mode os.FileMode) {
+		fi, err := os.Stat(filepath.Join(dest, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%s: expected mode %s, got %s", p, mode, fi.Mode().Perm())
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected mtime %s, got %s", p, mtime, fi.ModTime())
+		}
+	}
+	check("sub/file", fileMode)
+	check("sub", subMode)
+	if fi, err := os.Lstat(filepath.Join(dest, "link")); err != nil || fi.ModTime().Equal(mtime) {
+		t.Errorf("symlink attributes should not be applied (%v)", err)
+	}
+	if xattrs["sub/file:user.origin"] != "test" || xattrs["sub/file:"+aclXattr] != "\x01\x02\x03" {
+		t.Errorf("extended attributes not applied: %v", xattrs)
+	}
+}
+
+func TestApplySymlinkedParent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds := testu.GetDAGServ()
+
+	// dest/
+	//   link -> ../outside
+	// outside/
+	//   x
+	tmp := t.TempDir()
+	dest, outside := filepath.Join(tmp, "dest"), filepath.Join(tmp, "outside")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(outside, "x")
+	if err := os.WriteFile(target, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "outside"), filepath.Join(dest, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	mode := os.FileMode(0600)
+	sc := New(ds)
+	if err := sc.Set(ctx, "link/x", &Attributes{Mode: &mode, Xattrs: map[string][]byte{"user.origin": []byte("test")}}); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := 0
+	opts := MaterializeOptions{
+		SetXattr: func(p, name string, value []byte) error {
+			xattrs++
+			return nil
+		},
+	}
+	if err := sc.Apply(ctx, dest, opts); err != ErrSymlinkInPath {
+		t.Fatalf("expected ErrSymlinkInPath, got %v", err)
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 || xattrs != 0 {
+		t.Fatalf("attributes applied through a symlink: mode %s, %d xattrs", fi.Mode().Perm(), xattrs)
+	}
+}
+
+func TestApplySymlink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds := testu.GetDAGServ()
+
+	// dest/
+	//   link -> ../x
+	// x
+	tmp := t.TempDir()
+	dest, target := filepath.Join(tmp, "dest"), filepath.Join(tmp, "x")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "x"), filepath.Join(dest, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	mode := os.FileMode(0600)
+	sc := New(ds)
+	attrs := &Attributes{Mode: &mode, Xattrs: map[string][]byte{"user.origin": []byte("test")}, ACL: []byte{1, 2, 3}}
+	if err := sc.Set(ctx, "link", attrs); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := 0
+	opts := MaterializeOptions{
+		SetXattr: func(p, name string, value []byte) error {
+			xattrs++
+			return nil
+		},
+	}
+	if err := sc.Apply(ctx, dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 || xattrs != 0 {
+		t.Fatalf("attributes applied through a symlink: mode %s, %d xattrs", fi.Mode().Perm(), xattrs)
+	}
+}
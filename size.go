@@ -0,0 +1,85 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ErrNegativeOffset is returned for a negative file offset.
+var ErrNegativeOffset = errors.New("negative file offset")
+
+// SizeOverflowError is returned when a computation on file sizes or offsets
+// overflows the 64 bits unsigned sizes of the format, or when a size doesn't
+// fit in the 64 bits signed offsets of the `io` interfaces. Files over 8 EiB
+// can be stored and read sequentially, but only their first 8 EiB can be
+// addressed through those interfaces.
+type SizeOverflowError struct {
+	// Op is the operation that overflowed, "add" or "offset" (a size
+	// converted to an offset), and A and B its operands.
+	Op   string
+	A, B uint64
+}
+
+func (e *SizeOverflowError) Error() string {
+	if e.Op == "offset" {
+		return fmt.Sprintf("unixfs: size %d doesn't fit in a file offset", e.A)
+	}
+	return fmt.Sprintf("unixfs: size overflow in %s of %d and %d", e.Op, e.A, e.B)
+}
+
+// AddSizes returns `a + b`, a `*SizeOverflowError` if it overflows.
+func AddSizes(a, b uint64) (uint64, error) {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return 0, &SizeOverflowError{Op: "add", A: a, B: b}
+	}
+	return sum, nil
+}
+
+// SumSizes returns the sum of `sizes`, a `*SizeOverflowError` if it
+// overflows.
+func SumSizes(sizes []uint64) (uint64, error) {
+	var sum uint64
+	for _, s := range sizes {
+		var err error
+		if sum, err = AddSizes(sum, s); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// SizeToOffset converts the size (or position) `size` to an offset of the
+// `io` interfaces, a `*SizeOverflowError` if it doesn't fit.
+func SizeToOffset(size uint64) (int64, error) {
+	if size > math.MaxInt64 {
+		return 0, &SizeOverflowError{Op: "offset", A: size}
+	}
+	return int64(size), nil
+}
+
+// OffsetToSize converts the offset `off` of the `io` interfaces to a
+// position in a file, `ErrNegativeOffset` if it is negative.
+func OffsetToSize(off int64) (uint64, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	return uint64(off), nil
+}
+
+// AddOffset returns the position `pos` moved by `delta` (a relative seek),
+// `ErrNegativeOffset` if it moves before the start of the file and a
+// `*SizeOverflowError` if it overflows.
+func AddOffset(pos uint64, delta int64) (uint64, error) {
+	if delta >= 0 {
+		return AddSizes(pos, uint64(delta))
+	}
+	// Negated as an unsigned, `-math.MinInt64` doesn't fit in an int64.
+	back := uint64(-(delta + 1)) + 1
+	if back > pos {
+		return 0, ErrNegativeOffset
+	}
+	return pos - back, nil
+}
@@ -0,0 +1,59 @@
+package unixfs
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSizeArithmetic(t *testing.T) {
+	var overflow *SizeOverflowError
+
+	if s, err := AddSizes(math.MaxUint64-1, 1); err != nil || s != math.MaxUint64 {
+		t.Fatalf("expected %d, got %d (%v)", uint64(math.MaxUint64), s, err)
+	}
+	if _, err := AddSizes(math.MaxUint64, 1); !errors.As(err, &overflow) || overflow.Op != "add" {
+		t.Fatalf("expected an add overflow, got %v", err)
+	}
+	if _, err := SumSizes([]uint64{1 << 63, 1 << 62, 1 << 62}); !errors.As(err, &overflow) {
+		t.Fatalf("expected an overflow, got %v", err)
+	}
+
+	// Files over 8 EiB: valid sizes, but not offsets.
+	if _, err := SizeToOffset(math.MaxInt64 + 1); !errors.As(err, &overflow) || overflow.Op != "offset" {
+		t.Fatalf("expected an offset overflow, got %v", err)
+	}
+	if _, err := OffsetToSize(-1); err != ErrNegativeOffset {
+		t.Fatalf("expected %v, got %v", ErrNegativeOffset, err)
+	}
+
+	for _, tc := range []struct {
+		pos   uint64
+		delta int64
+		want  uint64
+		err   bool
+	}{
+		{10, -10, 0, false},
+		{10, -11, 0, true},
+		{math.MaxUint64, math.MinInt64, math.MaxUint64 - 1<<63, false},
+		{1 << 62, math.MinInt64, 0, true},
+		{math.MaxUint64 - 5, 5, math.MaxUint64, false},
+		{math.MaxUint64 - 5, 6, 0, true},
+	} {
+		got, err := AddOffset(tc.pos, tc.delta)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("AddOffset(%d, %d): expected %d (error %t), got %d (%v)", tc.pos, tc.delta, tc.want, tc.err, got, err)
+		}
+	}
+
+	// The children past 2^64 are out of reach, they don't wrap around.
+	fsn := NewFSNode(TFile)
+	fsn.AddBlockSize(math.MaxUint64)
+	fsn.AddBlockSize(10)
+	if i, off, ok := fsn.ChildAt(math.MaxUint64 - 1); !ok || i != 0 || off != math.MaxUint64-1 {
+		t.Fatalf("expected the first child, got %d at %d (%t)", i, off, ok)
+	}
+	if _, _, ok := fsn.ChildAt(math.MaxUint64); ok {
+		t.Fatal("expected no child past 2^64")
+	}
+}
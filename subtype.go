@@ -0,0 +1,142 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	pb "github.com/TRON-US/go-unixfs/pb"
+)
+
+// MinSubtypeCode is the lowest type code of the application-defined
+// subtypes, the ones below are reserved for the types of the format.
+const MinSubtypeCode pb.Data_DataType = 1 << 10
+
+// Subtype registration errors.
+var (
+	ErrInvalidSubtype    = errors.New("invalid unixfs subtype")
+	ErrSubtypeRegistered = errors.New("unixfs subtype already registered")
+)
+
+// Subtype is an application-defined type of unixfs data (e.g., an index of
+// thumbnails), so domain formats can live in unixfs trees: its nodes are
+// decoded like the ones of the types of the format, their `Data` holding
+// the value encoded by the subtype.
+type Subtype struct {
+	// Code is the type code of the nodes of the subtype, at least
+	// `MinSubtypeCode`.
+	Code pb.Data_DataType
+	// Name is the name of the type, as in the JSON encoding of the nodes.
+	Name string
+	// Encode returns the `Data` of a node holding `v`, and Decode the value
+	// held by the `Data` of a node.
+	Encode func(v interface{}) ([]byte, error)
+	Decode func(data []byte) (interface{}, error)
+}
+
+var subtypes = struct {
+	sync.RWMutex
+	byCode map[pb.Data_DataType]Subtype
+	byName map[string]Subtype
+}{
+	byCode: make(map[pb.Data_DataType]Subtype),
+	byName: make(map[string]Subtype),
+}
+
+// RegisterSubtype registers `st`, usually from the `init` function of the
+// package defining it. It fails with `ErrInvalidSubtype` if its code is
+// below `MinSubtypeCode`, if it has no name (or the one of a type of the
+// format) or no callbacks, and with `ErrSubtypeRegistered` if its code or
+// name is already taken.
+func RegisterSubtype(st Subtype) error {
+	_, builtin := pb.Data_DataType_value[st.Name]
+	if st.Code < MinSubtypeCode || st.Name == "" || builtin || st.Encode == nil || st.Decode == nil {
+		return fmt.Errorf("%w: %q (%d)", ErrInvalidSubtype, st.Name, st.Code)
+	}
+
+	subtypes.Lock()
+	defer subtypes.Unlock()
+	_, codeTaken := subtypes.byCode[st.Code]
+	_, nameTaken := subtypes.byName[st.Name]
+	if codeTaken || nameTaken {
+		return fmt.Errorf("%w: %q (%d)", ErrSubtypeRegistered, st.Name, st.Code)
+	}
+	subtypes.byCode[st.Code] = st
+	subtypes.byName[st.Name] = st
+	return nil
+}
+
+// UnregisterSubtype removes the subtype of code `code`, its nodes fail to
+// decode with `ErrUnknownType` again.
+func UnregisterSubtype(code pb.Data_DataType) {
+	subtypes.Lock()
+	defer subtypes.Unlock()
+	if st, ok := subtypes.byCode[code]; ok {
+		delete(subtypes.byCode, code)
+		delete(subtypes.byName, st.Name)
+	}
+}
+
+// LookupSubtype returns the subtype registered with the code `code`.
+func LookupSubtype(code pb.Data_DataType) (Subtype, bool) {
+	subtypes.RLock()
+	defer subtypes.RUnlock()
+	st, ok := subtypes.byCode[code]
+	return st, ok
+}
+
+// knownType returns whether `typ` is a type of the format or a registered
+// subtype.
+func knownType(typ pb.Data_DataType) bool {
+	if _, ok := pb.Data_DataType_name[int32(typ)]; ok {
+		return true
+	}
+	_, ok := LookupSubtype(typ)
+	return ok
+}
+
+// typeName returns the name of the type or subtype `typ`.
+func typeName(typ pb.Data_DataType) string {
+	if st, ok := LookupSubtype(typ); ok {
+		return st.Name
+	}
+	return typ.String()
+}
+
+// typeByName returns the type or subtype named `name`.
+func typeByName(name string) (pb.Data_DataType, bool) {
+	if typ, ok := pb.Data_DataType_value[name]; ok {
+		return pb.Data_DataType(typ), true
+	}
+	subtypes.RLock()
+	defer subtypes.RUnlock()
+	st, ok := subtypes.byName[name]
+	return st.Code, ok
+}
+
+// NewSubtypeNode returns a node of the registered subtype `code` holding
+// `v` in its `Data` (the node has no file size, it isn't file data).
+func NewSubtypeNode(code pb.Data_DataType, v interface{}) (*FSNode, error) {
+	st, ok := LookupSubtype(code)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownType, code)
+	}
+	data, err := st.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	n := NewFSNode(code)
+	n.format.Data = data
+	return n, nil
+}
+
+// SubtypeValue returns the value held by a node of a registered subtype,
+// decoded by the subtype, and `ErrUnknownType` for the nodes of the other
+// types.
+func (n *FSNode) SubtypeValue() (interface{}, error) {
+	st, ok := LookupSubtype(n.Type())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, n.Type())
+	}
+	return st.Decode(n.Data())
+}
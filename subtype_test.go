@@ -0,0 +1,115 @@
+package unixfs
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestSubtype(t *testing.T) {
+	const code = MinSubtypeCode + 7
+	st := Subtype{
+		Code: code,
+		Name: "ThumbnailIndex",
+		Encode: func(v interface{}) ([]byte, error) {
+			names, ok := v.([]string)
+			if !ok {
+				return nil, errors.New("not a list of names")
+			}
+			return []byte(strings.Join(names, "\n")), nil
+		},
+		Decode: func(data []byte) (interface{}, error) {
+			return strings.Split(string(data), "\n"), nil
+		},
+	}
+
+	encoded, err := NewFSNode(code).GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FSNodeFromBytes(encoded); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected an unregistered subtype to fail with %v, got %v", ErrUnknownType, err)
+	}
+
+	if err := RegisterSubtype(st); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterSubtype(code)
+	for _, invalid := range []Subtype{
+		{Code: TFile, Name: "Mine", Encode: st.Encode, Decode: st.Decode},
+		{Code: code + 1, Name: "File", Encode: st.Encode, Decode: st.Decode},
+		{Code: code + 1, Name: "Mine"},
+	} {
+		if err := RegisterSubtype(invalid); !errors.Is(err, ErrInvalidSubtype) {
+			t.Fatalf("expected %v, got %v", ErrInvalidSubtype, err)
+		}
+	}
+	for _, taken := range []Subtype{
+		{Code: code, Name: "Other", Encode: st.Encode, Decode: st.Decode},
+		{Code: code + 1, Name: st.Name, Encode: st.Encode, Decode: st.Decode},
+	} {
+		if err := RegisterSubtype(taken); !errors.Is(err, ErrSubtypeRegistered) {
+			t.Fatalf("expected %v, got %v", ErrSubtypeRegistered, err)
+		}
+	}
+
+	fsn, err := NewSubtypeNode(code, []string{"a.jpg", "b.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := dag.NodeWithData(b)
+	if typ, err := NodeType(nd); err != nil || typ != code {
+		t.Fatalf("expected type %d, got %d (%v)", code, typ, err)
+	}
+	decoded, err := ExtractFSNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := decoded.SubtypeValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := v.([]string); len(names) != 2 || names[1] != "b.jpg" {
+		t.Fatalf("unexpected value %v", v)
+	}
+
+	j, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(j), `"type":"ThumbnailIndex"`) {
+		t.Fatalf("expected the subtype name in %s", j)
+	}
+	fromJSON := new(FSNode)
+	if err := json.Unmarshal(j, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if fromJSON.Type() != code {
+		t.Fatalf("expected type %d, got %d", code, fromJSON.Type())
+	}
+
+	if _, err := NewFSNode(TFile).SubtypeValue(); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected %v, got %v", ErrUnknownType, err)
+	}
+	if _, err := NewSubtypeNode(code+1, nil); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected %v, got %v", ErrUnknownType, err)
+	}
+	if _, err := NewSubtypeNode(code, 42); err == nil {
+		t.Fatal("expected the encoding error")
+	}
+
+	UnregisterSubtype(code)
+	if _, ok := LookupSubtype(code); ok {
+		t.Fatal("expected the subtype to be unregistered")
+	}
+	if _, err := DataType(b); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected %v, got %v", ErrUnknownType, err)
+	}
+}
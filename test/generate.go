@@ -0,0 +1,180 @@
+package testu
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	ft "github.com/TRON-US/go-unixfs"
+	balanced "github.com/TRON-US/go-unixfs/importer/balanced"
+	h "github.com/TRON-US/go-unixfs/importer/helpers"
+	trickle "github.com/TRON-US/go-unixfs/importer/trickle"
+
+	chunker "github.com/TRON-US/go-btfs-chunker"
+	cid "github.com/ipfs/go-cid"
+	u "github.com/ipfs/go-ipfs-util"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// SeededData returns `size` pseudo-random bytes, always the same ones for
+// the same `seed`.
+func SeededData(seed, size int64) []byte {
+	buf := make([]byte, size)
+	u.NewSeededRand(seed).Read(buf)
+	return buf
+}
+
+// FileShape describes a reproducible file DAG: the same shape always
+// produces the same content and the same CIDs, so benchmarks and tests
+// (here and downstream) can compare versions on identical trees.
+type FileShape struct {
+	// Size is the size of the file. If zero, it is the size of a full
+	// balanced tree of Depth levels of links (LeafSize * Fanout^Depth):
+	// a shape can't set both.
+	Size  int64
+	Depth int
+	// LeafSize is the chunk size, `chunker.DefaultBlockSize` if zero.
+	LeafSize int64
+	// Fanout is the maximum number of links per node,
+	// `h.DefaultLinksPerBlock` if zero.
+	Fanout int
+	// Seed seeds the content of the file.
+	Seed int64
+
+	Trickle    bool
+	RawLeaves  bool
+	CidBuilder cid.Builder
+}
+
+func (s FileShape) withDefaults() FileShape {
+	if s.LeafSize <= 0 {
+		s.LeafSize = chunker.DefaultBlockSize
+	}
+	if s.Fanout <= 0 {
+		s.Fanout = h.DefaultLinksPerBlock
+	}
+	if s.Size == 0 {
+		s.Size = s.LeafSize
+		for i := 0; i < s.Depth; i++ {
+			s.Size *= int64(s.Fanout)
+		}
+	}
+	return s
+}
+
+// Build adds the file to `ds`, returning its content and root.
+func (s FileShape) Build(ds ipld.DAGService) ([]byte, ipld.Node, error) {
+	if s.Size != 0 && s.Depth != 0 {
+		return nil, nil, fmt.Errorf("file shape sets both Size (%d) and Depth (%d)", s.Size, s.Depth)
+	}
+	s = s.withDefaults()
+	data := SeededData(s.Seed, s.Size)
+	dbp := h.DagBuilderParams{
+		Dagserv:    ds,
+		Maxlinks:   s.Fanout,
+		RawLeaves:  s.RawLeaves,
+		CidBuilder: s.CidBuilder,
+	}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), s.LeafSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	var nd ipld.Node
+	if s.Trickle {
+		nd, err = trickle.Layout(db)
+	} else {
+		nd, err = balanced.Layout(db)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, nd, nil
+}
+
+// GenerateFile is `FileShape.Build` failing the test on error.
+func GenerateFile(t testing.TB, ds ipld.DAGService, shape FileShape) ([]byte, ipld.Node) {
+	data, nd, err := shape.Build(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, nd
+}
+
+// DirShape describes a reproducible directory tree: every directory has
+// Files files (named "file-N") and, up to Depth levels, Fanout
+// subdirectories (named "dir-N"). Directories are plain, not sharded.
+type DirShape struct {
+	Depth  int
+	Fanout int
+	Files  int
+	// File is the shape of every file, each of them is seeded with its
+	// own seed derived from it.
+	File FileShape
+}
+
+// Build adds the directory tree to `ds`, returning its root and the
+// content of its files by path.
+func (s DirShape) Build(ds ipld.DAGService) (ipld.Node, map[string][]byte, error) {
+	g := &dirGenerator{ds: ds, shape: s, seed: s.File.Seed, files: make(map[string][]byte)}
+	nd, err := g.build("", s.Depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nd, g.files, nil
+}
+
+type dirGenerator struct {
+	ds    ipld.DAGService
+	shape DirShape
+	seed  int64
+	files map[string][]byte
+}
+
+func (g *dirGenerator) build(dirPath string, depth int) (ipld.Node, error) {
+	dir := ft.EmptyDirNode()
+	if g.shape.File.CidBuilder != nil {
+		dir.SetCidBuilder(g.shape.File.CidBuilder)
+	}
+
+	for i := 0; i < g.shape.Files; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		shape := g.shape.File
+		shape.Seed = g.seed
+		g.seed++
+		data, nd, err := shape.Build(g.ds)
+		if err != nil {
+			return nil, err
+		}
+		if err := dir.AddNodeLink(name, nd); err != nil {
+			return nil, err
+		}
+		g.files[dirPath+name] = data
+	}
+	if depth > 0 {
+		for i := 0; i < g.shape.Fanout; i++ {
+			name := fmt.Sprintf("dir-%d", i)
+			nd, err := g.build(dirPath+name+"/", depth-1)
+			if err != nil {
+				return nil, err
+			}
+			if err := dir.AddNodeLink(name, nd); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := g.ds.Add(context.Background(), dir); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+// GenerateDirectory is `DirShape.Build` failing the test on error.
+func GenerateDirectory(t testing.TB, ds ipld.DAGService, shape DirShape) (ipld.Node, map[string][]byte) {
+	nd, files, err := shape.Build(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd, files
+}
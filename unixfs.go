@@ -7,9 +7,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"time"
 
 	proto "github.com/gogo/protobuf/proto"
+	bitfield "github.com/ipfs/go-bitfield"
+	cid "github.com/ipfs/go-cid"
 	dag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
 
 	pb "github.com/TRON-US/go-unixfs/pb"
 	ipld "github.com/ipfs/go-ipld-format"
@@ -40,14 +46,17 @@ var (
 	ErrNotMetadataRoot      = errors.New("expected token metadata protobuf dag node")
 	ErrUnexpectedLinks      = errors.New("expected more than two links under the given dag node")
 	ErrMetadataAccessDenied = errors.New("Token metadata can not be accessed by default. Use --meta option.")
+	ErrNoXattr              = errors.New("no such extended attribute")
+	ErrNotSymlink           = errors.New("this dag node is not a symlink")
+	ErrNotShard             = errors.New("node was not a dir shard")
 )
 
-// FromBytes unmarshals a byte slice as protobuf Data.
+// FromBytes unmarshals a byte slice as protobuf Data, a `*DecodeError` if
+// it isn't valid unixfs data.
 // Deprecated: Use `FSNodeFromBytes` instead to avoid direct manipulation of `pb.Data`.
 func FromBytes(data []byte) (*pb.Data, error) {
 	pbdata := new(pb.Data)
-	err := proto.Unmarshal(data, pbdata)
-	if err != nil {
+	if err := decodeData(data, pbdata); err != nil {
 		return nil, err
 	}
 	return pbdata, nil
@@ -56,13 +65,12 @@ func FromBytes(data []byte) (*pb.Data, error) {
 // FilePBData creates a protobuf File with the given
 // byte slice and returns the marshaled protobuf bytes representing it.
 func FilePBData(data []byte, totalsize uint64) []byte {
-	pbfile := new(pb.Data)
-	typ := pb.Data_File
-	pbfile.Type = &typ
-	pbfile.Data = data
-	pbfile.Filesize = proto.Uint64(totalsize)
+	pbfile := getData(pb.Data_File)
+	defer putData(pbfile)
+	pbfile.Data.Data = data
+	pbfile.setFilesize(totalsize)
 
-	data, err := proto.Marshal(pbfile)
+	data, err := marshalData(&pbfile.Data)
 	if err != nil {
 		// This really shouldnt happen, i promise
 		// The only failure case for marshal is if required fields
@@ -80,7 +88,7 @@ func FolderPBData() []byte {
 	typ := pb.Data_Directory
 	pbfile.Type = &typ
 
-	data, err := proto.Marshal(pbfile)
+	data, err := marshalData(pbfile)
 	if err != nil {
 		//this really shouldnt happen, i promise
 		panic(err)
@@ -90,13 +98,12 @@ func FolderPBData() []byte {
 
 // WrapData marshals raw bytes into a `Data_Raw` type protobuf message.
 func WrapData(b []byte) []byte {
-	pbdata := new(pb.Data)
-	typ := pb.Data_Raw
-	pbdata.Data = b
-	pbdata.Type = &typ
-	pbdata.Filesize = proto.Uint64(uint64(len(b)))
+	pbdata := getData(pb.Data_Raw)
+	defer putData(pbdata)
+	pbdata.Data.Data = b
+	pbdata.setFilesize(uint64(len(b)))
 
-	out, err := proto.Marshal(pbdata)
+	out, err := marshalData(&pbdata.Data)
 	if err != nil {
 		// This shouldnt happen. seriously.
 		panic(err)
@@ -112,7 +119,7 @@ func SymlinkData(path string) ([]byte, error) {
 	pbdata.Data = []byte(path)
 	pbdata.Type = &typ
 
-	out, err := proto.Marshal(pbdata)
+	out, err := marshalData(pbdata)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +127,21 @@ func SymlinkData(path string) ([]byte, error) {
 	return out, nil
 }
 
-// HAMTShardData return a `Data_HAMTShard` protobuf message
+// SymlinkTarget returns the target of the symlink encoded in `data` (see
+// `SymlinkData`), `ErrNotSymlink` if it encodes another kind of node.
+func SymlinkTarget(data []byte) (string, error) {
+	pbdata, err := FromBytes(data)
+	if err != nil {
+		return "", err
+	}
+	if pbdata.GetType() != pb.Data_Symlink {
+		return "", ErrNotSymlink
+	}
+	return string(pbdata.GetData()), nil
+}
+
+// HAMTShardData returns a `Data_HAMTShard` protobuf message, `data` holds
+// the bitfield of the used slots of the shard (see `FSNode.ShardBitfield`).
 func HAMTShardData(data []byte, fanout uint64, hashType uint64) ([]byte, error) {
 	pbdata := new(pb.Data)
 	typ := pb.Data_HAMTShard
@@ -129,7 +150,7 @@ func HAMTShardData(data []byte, fanout uint64, hashType uint64) ([]byte, error)
 	pbdata.Data = data
 	pbdata.Fanout = proto.Uint64(fanout)
 
-	out, err := proto.Marshal(pbdata)
+	out, err := marshalData(pbdata)
 	if err != nil {
 		return nil, err
 	}
@@ -137,7 +158,8 @@ func HAMTShardData(data []byte, fanout uint64, hashType uint64) ([]byte, error)
 	return out, nil
 }
 
-// UnwrapData unmarshals a protobuf messages and returns the contents.
+// UnwrapData unmarshals a protobuf messages and returns the contents (the
+// data of a file or a `Data_Raw` leaf, the inverse of `WrapData`).
 func UnwrapData(data []byte) ([]byte, error) {
 	pbdata := new(pb.Data)
 	err := proto.Unmarshal(data, pbdata)
@@ -164,7 +186,15 @@ func size(pbdata *pb.Data) (uint64, error) {
 	switch pbdata.GetType() {
 	case pb.Data_Directory, pb.Data_HAMTShard:
 		return 0, errors.New("can't get data size of directory")
-	case pb.Data_File, pb.Data_Raw, pb.Data_TokenMeta:
+	case pb.Data_Raw:
+		// Some importers leave out the size of raw leaves, it is the
+		// length of their data (internal nodes of the `trickle` layout
+		// may be raw too, they always have it).
+		if pbdata.Filesize == nil {
+			return uint64(len(pbdata.GetData())), nil
+		}
+		return pbdata.GetFilesize(), nil
+	case pb.Data_File, pb.Data_TokenMeta:
 		return pbdata.GetFilesize(), nil
 	case pb.Data_Symlink:
 		return uint64(len(pbdata.GetData())), nil
@@ -182,13 +212,18 @@ type FSNode struct {
 
 	// UnixFS format defined as a protocol buffers message.
 	format pb.Data
+
+	// Offsets of the child blocks in the data under the node followed by
+	// their total size, computed by `ChildAt` and reset by the methods
+	// changing the block sizes.
+	starts []uint64
 }
 
-// FSNodeFromBytes unmarshal a protobuf message onto an FSNode.
+// FSNodeFromBytes unmarshal a protobuf message onto an FSNode, a
+// `*DecodeError` if it isn't valid unixfs data.
 func FSNodeFromBytes(b []byte) (*FSNode, error) {
 	n := new(FSNode)
-	err := proto.Unmarshal(b, &n.format)
-	if err != nil {
+	if err := decodeData(b, &n.format); err != nil {
 		return nil, err
 	}
 
@@ -227,16 +262,38 @@ func (n *FSNode) Fanout() uint64 {
 	return n.format.GetFanout()
 }
 
+// ShardBitfield returns the bitfield of a `THAMTShard` node, with the bit
+// of each of its `Fanout` slots holding an entry or a child shard set (see
+// `HAMTShardData`), `ErrNotShard` for other nodes.
+func (n *FSNode) ShardBitfield() (bitfield.Bitfield, error) {
+	if n.Type() != THAMTShard {
+		return nil, ErrNotShard
+	}
+	return bitfield.FromBytes(int(n.Fanout()), n.Data())
+}
+
 // AddBlockSize adds the size of the next child block of this node
 func (n *FSNode) AddBlockSize(s uint64) {
 	n.UpdateFilesize(int64(s))
 	n.format.Blocksizes = append(n.format.Blocksizes, s)
+	n.starts = nil
+}
+
+// InsertBlockSize inserts the size of a new child block at index `i`,
+// shifting the following ones, and updates the file size accordingly.
+func (n *FSNode) InsertBlockSize(i int, s uint64) {
+	n.UpdateFilesize(int64(s))
+	n.format.Blocksizes = append(n.format.Blocksizes, 0)
+	copy(n.format.Blocksizes[i+1:], n.format.Blocksizes[i:])
+	n.format.Blocksizes[i] = s
+	n.starts = nil
 }
 
 // RemoveBlockSize removes the given child block's size.
 func (n *FSNode) RemoveBlockSize(i int) {
 	n.UpdateFilesize(-int64(n.format.Blocksizes[i]))
 	n.format.Blocksizes = append(n.format.Blocksizes[:i], n.format.Blocksizes[i+1:]...)
+	n.starts = nil
 }
 
 // BlockSize returns the block size indexed by `i`.
@@ -245,20 +302,108 @@ func (n *FSNode) BlockSize(i int) uint64 {
 	return n.format.Blocksizes[i]
 }
 
+// SetBlockSize replaces the size of the child block indexed by `i`,
+// updating the file size accordingly.
+func (n *FSNode) SetBlockSize(i int, s uint64) {
+	n.UpdateFilesize(int64(s) - int64(n.format.Blocksizes[i]))
+	n.format.Blocksizes[i] = s
+	n.starts = nil
+}
+
 // BlockSizes gets blocksizes of format
 func (n *FSNode) BlockSizes() []uint64 {
 	return n.format.GetBlocksizes()
 }
 
+// ForEachBlock calls `f` with the index, offset (in the data of the
+// children, see `ChildAt`) and size of each child block of the node, in
+// order, until it returns false.
+func (n *FSNode) ForEachBlock(f func(index int, offset, size uint64) bool) {
+	var offset uint64
+	for i, bs := range n.format.Blocksizes {
+		if !f(i, offset, bs) {
+			return
+		}
+		// Wraps around past 2^64, `ChildrenSize` reports it.
+		offset += bs
+	}
+}
+
+// ChildrenSize returns the total size the node declares for its children,
+// the sum of its block sizes (a `*SizeOverflowError` if it overflows). It is
+// the file size of the node but for its own data, if any.
+func (n *FSNode) ChildrenSize() (uint64, error) {
+	return SumSizes(n.format.Blocksizes)
+}
+
+// HasFileSize returns whether the node declares its file size, the `TRaw`
+// leaves of some older importers don't (their size is the length of their
+// data) and directories and symlinks usually don't either.
+func (n *FSNode) HasFileSize() bool {
+	return n.format.Filesize != nil
+}
+
 // RemoveAllBlockSizes removes all the child block sizes of this node.
 func (n *FSNode) RemoveAllBlockSizes() {
 	n.format.Blocksizes = []uint64{}
 	n.format.Filesize = proto.Uint64(uint64(len(n.Data())))
+	n.starts = nil
+}
+
+// ChildAt returns the index of the child block holding the byte at
+// `offset` in the data of the children of the node (its own data, if any,
+// isn't counted) along with the offset of that byte in the child, looked
+// up by binary search over the block sizes (summed once per node). Empty
+// children are skipped. `ok` is false if `offset` is past the children (or
+// past 2^64, the children after that can't be addressed).
+func (n *FSNode) ChildAt(offset uint64) (index int, childOffset uint64, ok bool) {
+	starts := n.blockStarts()
+	// The first start past `offset`, the one of the next child.
+	next := sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+	if next == len(starts) {
+		return 0, 0, false
+	}
+	return next - 1, offset - starts[next-1], true
+}
+
+func (n *FSNode) blockStarts() []uint64 {
+	if n.starts == nil {
+		starts := make([]uint64, 1, len(n.format.Blocksizes)+1)
+		for i, bs := range n.format.Blocksizes {
+			next, err := AddSizes(starts[i], bs)
+			if err != nil {
+				break
+			}
+			starts = append(starts, next)
+		}
+		n.starts = starts
+	}
+	return n.starts
 }
 
 // GetBytes marshals this node as a protobuf message.
 func (n *FSNode) GetBytes() ([]byte, error) {
-	return proto.Marshal(&n.format)
+	return marshalData(&n.format)
+}
+
+// CanonicalBytes marshals this node in its canonical encoding, which only
+// depends on the contents of the node as returned by its accessors, not on
+// how it was built or decoded: two nodes with the same contents always
+// produce the same bytes (and so the same CIDs), across versions of this
+// package. `GetBytes` instead encodes the fields as they are, which
+// preserves the bytes of decoded nodes but lets equivalent nodes differ.
+//
+// In the canonical encoding the fields are in field number order, empty
+// data, block sizes and extended attribute values are left out, the file
+// size is present for the types of files (and only if not zero for
+// directories, symlinks and HAMT shards), the hash type and fanout only
+// for HAMT shards (or if not zero), the mode only if not zero and the
+// fractional nanoseconds of the modification time only if not zero.
+// Extended attributes are sorted by name, only the first one of a
+// duplicated name is kept. Unknown fields are kept as they are, after the
+// known ones.
+func (n *FSNode) CanonicalBytes() ([]byte, error) {
+	return marshalData(canonicalData(&n.format))
 }
 
 // FileSize returns the size of the file.
@@ -299,6 +444,224 @@ func (n *FSNode) UpdateFilesize(filesizeDiff int64) {
 		int64(n.format.GetFilesize()) + filesizeDiff))
 }
 
+// ModTime returns the modification time of the node, the zero time if it
+// has none.
+func (n *FSNode) ModTime() time.Time {
+	mtime := n.format.GetMtime()
+	if mtime == nil {
+		return time.Time{}
+	}
+	return time.Unix(mtime.GetSeconds(), int64(mtime.GetFractionalNanoseconds()))
+}
+
+// SetModTime sets the modification time of the node (with nanosecond
+// precision), the zero time removes it.
+func (n *FSNode) SetModTime(t time.Time) {
+	if t.IsZero() {
+		n.format.Mtime = nil
+		return
+	}
+	n.format.Mtime = &pb.UnixTime{Seconds: proto.Int64(t.Unix())}
+	// Left out when zero, as the specification requires.
+	if nsec := uint32(t.Nanosecond()); nsec != 0 {
+		n.format.Mtime.FractionalNanoseconds = proto.Uint32(nsec)
+	}
+}
+
+// DataWithModTime returns the unixfs `data` of a node with the modification
+// time `t` (see `FSNode.SetModTime`).
+func DataWithModTime(data []byte, t time.Time) ([]byte, error) {
+	fsn, err := FSNodeFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	fsn.SetModTime(t)
+	return fsn.GetBytes()
+}
+
+// POSIX bits of the special modes stored along with the permissions.
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+)
+
+// Mode returns the permission bits of the node along with its
+// `os.ModeSetuid`, `os.ModeSetgid` and `os.ModeSticky` bits, zero if it has
+// no mode.
+func (n *FSNode) Mode() os.FileMode {
+	bits := n.format.GetMode()
+	m := os.FileMode(bits) & os.ModePerm
+	if bits&modeSetuid != 0 {
+		m |= os.ModeSetuid
+	}
+	if bits&modeSetgid != 0 {
+		m |= os.ModeSetgid
+	}
+	if bits&modeSticky != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// SetMode sets the mode of the node, stored as POSIX bits. Only the
+// permission, setuid, setgid and sticky bits of `m` are kept (the type of
+// the node is given by its unixfs type), a zero mode removes it.
+func (n *FSNode) SetMode(m os.FileMode) {
+	bits := uint32(m & os.ModePerm)
+	if m&os.ModeSetuid != 0 {
+		bits |= modeSetuid
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= modeSetgid
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= modeSticky
+	}
+	if bits == 0 {
+		n.format.Mode = nil
+		return
+	}
+	n.format.Mode = proto.Uint32(bits)
+}
+
+// DataWithMode returns the unixfs `data` of a node with the mode `m` (see
+// `FSNode.SetMode`).
+func DataWithMode(data []byte, m os.FileMode) ([]byte, error) {
+	fsn, err := FSNodeFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	fsn.SetMode(m)
+	return fsn.GetBytes()
+}
+
+// Xattr returns the value of the extended attribute `name` of the node.
+func (n *FSNode) Xattr(name string) ([]byte, bool) {
+	xattrs := n.format.Xattrs
+	i := sort.Search(len(xattrs), func(i int) bool { return xattrs[i].GetName() >= name })
+	if i == len(xattrs) || xattrs[i].GetName() != name {
+		return nil, false
+	}
+	return xattrs[i].Value, true
+}
+
+// SetXattr sets the extended attribute `name` of the node. The attributes
+// are kept sorted by name, so the encoding of a node doesn't depend on the
+// order they were set in.
+func (n *FSNode) SetXattr(name string, value []byte) {
+	xattrs := n.format.Xattrs
+	i := sort.Search(len(xattrs), func(i int) bool { return xattrs[i].GetName() >= name })
+	if i < len(xattrs) && xattrs[i].GetName() == name {
+		xattrs[i].Value = value
+		return
+	}
+	xattrs = append(xattrs, nil)
+	copy(xattrs[i+1:], xattrs[i:])
+	xattrs[i] = &pb.Xattr{Name: proto.String(name), Value: value}
+	n.format.Xattrs = xattrs
+}
+
+// RemoveXattr removes the extended attribute `name` of the node, returning
+// whether it had it.
+func (n *FSNode) RemoveXattr(name string) bool {
+	xattrs := n.format.Xattrs
+	i := sort.Search(len(xattrs), func(i int) bool { return xattrs[i].GetName() >= name })
+	if i == len(xattrs) || xattrs[i].GetName() != name {
+		return false
+	}
+	n.format.Xattrs = append(xattrs[:i], xattrs[i+1:]...)
+	if len(n.format.Xattrs) == 0 {
+		n.format.Xattrs = nil
+	}
+	return true
+}
+
+// Xattrs returns the names of the extended attributes of the node, sorted.
+func (n *FSNode) Xattrs() []string {
+	names := make([]string, len(n.format.Xattrs))
+	for i, xattr := range n.format.Xattrs {
+		names[i] = xattr.GetName()
+	}
+	return names
+}
+
+// CopyAttributes replaces the file attributes of the node (modification
+// time, mode and extended attributes) with the ones of `from`.
+func (n *FSNode) CopyAttributes(from *FSNode) {
+	n.format.Mtime = from.format.Mtime
+	n.format.Mode = from.format.Mode
+	n.format.Xattrs = nil
+	for _, xattr := range from.format.Xattrs {
+		n.format.Xattrs = append(n.format.Xattrs, &pb.Xattr{Name: xattr.Name, Value: xattr.Value})
+	}
+}
+
+// GetXattr returns the value of the extended attribute `name` of the file
+// or directory `nd`, `ErrNoXattr` if it has none (raw nodes never have
+// any).
+func GetXattr(nd ipld.Node, name string) ([]byte, error) {
+	if _, ok := nd.(*dag.RawNode); ok {
+		return nil, ErrNoXattr
+	}
+	fsn, err := ExtractFSNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := fsn.Xattr(name)
+	if !ok {
+		return nil, ErrNoXattr
+	}
+	return value, nil
+}
+
+// SetXattr sets the extended attribute `name` of the file or directory
+// `nd` (see `FSNode.SetXattr`), changing its CID.
+func SetXattr(nd *dag.ProtoNode, name string, value []byte) error {
+	fsn, err := FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return err
+	}
+	fsn.SetXattr(name, value)
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return err
+	}
+	nd.SetData(data)
+	return nil
+}
+
+// RemoveXattr removes the extended attribute `name` of the file or
+// directory `nd`, `ErrNoXattr` if it has none.
+func RemoveXattr(nd *dag.ProtoNode, name string) error {
+	fsn, err := FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return err
+	}
+	if !fsn.RemoveXattr(name) {
+		return ErrNoXattr
+	}
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return err
+	}
+	nd.SetData(data)
+	return nil
+}
+
+// ListXattrs returns the names of the extended attributes of the file or
+// directory `nd`, sorted.
+func ListXattrs(nd ipld.Node) ([]string, error) {
+	if _, ok := nd.(*dag.RawNode); ok {
+		return nil, nil
+	}
+	fsn, err := ExtractFSNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.Xattrs(), nil
+}
+
 // Type retrieves the `Type` field from the internal `format`.
 func (n *FSNode) Type() pb.Data_DataType {
 	return n.format.GetType()
@@ -318,13 +681,16 @@ func (n *FSNode) IsDir() bool {
 type Metadata struct {
 	MimeType string
 	Size     uint64
+	// Checksum, if set, is the multihash of the whole file data (see
+	// `FileChecksum`), checked by `VerifyChecksum`.
+	Checksum mh.Multihash
 }
 
 // MetadataFromBytes Unmarshals a protobuf Data message into Metadata.
 // The provided slice should have been encoded with BytesForMetadata().
 func MetadataFromBytes(b []byte) (*Metadata, error) {
 	pbd := new(pb.Data)
-	err := proto.Unmarshal(b, pbd)
+	err := decodeData(b, pbd)
 	if err != nil {
 		return nil, err
 	}
@@ -339,6 +705,8 @@ func MetadataFromBytes(b []byte) (*Metadata, error) {
 	}
 	md := new(Metadata)
 	md.MimeType = pbm.GetMimeType()
+	md.Size = pbd.GetFilesize()
+	md.Checksum = pbm.GetChecksum()
 	return md, nil
 }
 
@@ -346,6 +714,7 @@ func MetadataFromBytes(b []byte) (*Metadata, error) {
 func (m *Metadata) Bytes() ([]byte, error) {
 	pbm := new(pb.Metadata)
 	pbm.MimeType = &m.MimeType
+	pbm.Checksum = m.Checksum
 	return proto.Marshal(pbm)
 }
 
@@ -363,19 +732,53 @@ func BytesForMetadata(m *Metadata) ([]byte, error) {
 	}
 
 	pbd.Data = mdd
-	return proto.Marshal(pbd)
+	return marshalData(pbd)
 }
 
-// EmptyDirNode creates an empty folder Protonode.
+// EmptyDirNode creates an empty folder Protonode. With the default CID
+// builder its CID is always QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn,
+// the one of every empty directory (the one `io.NewDirectory` starts from),
+// so empty directories should always be built with it. A new node is
+// returned by every call, it can be edited.
 func EmptyDirNode() *dag.ProtoNode {
 	return dag.NodeWithData(FolderPBData())
 }
 
-// EmptyFileNode creates an empty file Protonode.
+// EmptyFileNode creates an empty file Protonode. With the default CID
+// builder its CID is always QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH,
+// the one the importers produce for empty files without raw leaves. A new
+// node is returned by every call, it can be edited.
 func EmptyFileNode() *dag.ProtoNode {
 	return dag.NodeWithData(FilePBData(nil, 0))
 }
 
+// RawPBNode returns a new protobuf leaf of type `TRaw` holding `b` (see
+// `WrapData`), the leaves of the importers not using raw nodes.
+func RawPBNode(b []byte) *dag.ProtoNode {
+	return dag.NodeWithData(WrapData(b))
+}
+
+// SymlinkNode returns a new symlink node pointing to `target`, ready to be
+// added to a directory.
+func SymlinkNode(target string) (*dag.ProtoNode, error) {
+	data, err := SymlinkData(target)
+	if err != nil {
+		return nil, err
+	}
+	return dag.NodeWithData(data), nil
+}
+
+// IsRawLeaf returns whether `node` is a raw leaf, a block with the raw
+// codec holding just file data. Besides `dag.RawNode`, it accepts the
+// nodes other decoders (or DAG services) return for raw blocks, so DAGs
+// imported elsewhere with raw leaves are readable.
+func IsRawLeaf(node ipld.Node) bool {
+	if _, ok := node.(*dag.RawNode); ok {
+		return true
+	}
+	return node.Cid().Prefix().Codec == cid.Raw && len(node.Links()) == 0
+}
+
 // ReadUnixFSNodeData extracts the UnixFS data from an IPLD node.
 // Raw nodes are (also) processed because they are used as leaf
 // nodes containing (only) UnixFS data.
@@ -385,7 +788,7 @@ func ReadUnixFSNodeData(node ipld.Node) (data []byte, err error) {
 	case *dag.ProtoNode:
 		fsNode, err := FSNodeFromBytes(node.Data())
 		if err != nil {
-			return nil, fmt.Errorf("incorrectly formatted protobuf: %s", err)
+			return nil, withKey(err, node.Cid())
 		}
 
 		switch fsNode.Type() {
@@ -404,6 +807,9 @@ func ReadUnixFSNodeData(node ipld.Node) (data []byte, err error) {
 		return node.RawData(), nil
 
 	default:
+		if IsRawLeaf(node) {
+			return node.RawData(), nil
+		}
 		return nil, ErrUnrecognizedType
 		// TODO: To avoid rewriting the error message, but a different error from
 		// `unixfs.ErrUnrecognizedType` should be used (defining it in the
@@ -421,7 +827,7 @@ func ExtractFSNode(node ipld.Node) (*FSNode, error) {
 
 	fsNode, err := FSNodeFromBytes(protoNode.Data())
 	if err != nil {
-		return nil, err
+		return nil, withKey(err, protoNode.Cid())
 	}
 
 	return fsNode, nil
@@ -2,11 +2,18 @@ package unixfs
 
 import (
 	"bytes"
+	"math"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	proto "github.com/gogo/protobuf/proto"
 
 	pb "github.com/TRON-US/go-unixfs/pb"
+
+	bitfield "github.com/ipfs/go-bitfield"
+	dag "github.com/ipfs/go-merkledag"
 )
 
 func TestFSNode(t *testing.T) {
@@ -50,6 +57,278 @@ func TestFSNode(t *testing.T) {
 	if nfsn.FileSize() != (100*15)+128 {
 		t.Fatal("fsNode FileSize calculations incorrect")
 	}
+
+	// Edit the block sizes in place.
+	nfsn.InsertBlockSize(0, 10)
+	nfsn.InsertBlockSize(16, 20)
+	nfsn.InsertBlockSize(8, 30)
+	nfsn.SetBlockSize(1, 50)
+	nfsn.RemoveBlockSize(2)
+	if nfsn.NumChildren() != 17 {
+		t.Fatalf("expected 17 children, got %d", nfsn.NumChildren())
+	}
+	if nfsn.BlockSize(0) != 10 || nfsn.BlockSize(7) != 30 || nfsn.BlockSize(16) != 20 || nfsn.BlockSize(1) != 50 {
+		t.Fatalf("unexpected block sizes %v", nfsn.BlockSizes())
+	}
+	if nfsn.FileSize() != 10+50+100*13+30+20+128 {
+		t.Fatalf("unexpected file size %d", nfsn.FileSize())
+	}
+}
+
+func TestChildAt(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	for _, bs := range []uint64{10, 0, 5, 20} {
+		fsn.AddBlockSize(bs)
+	}
+
+	for _, tc := range []struct {
+		offset   uint64
+		index    int
+		childOff uint64
+		ok       bool
+	}{
+		{0, 0, 0, true},
+		{9, 0, 9, true},
+		{10, 2, 0, true},
+		{14, 2, 4, true},
+		{15, 3, 0, true},
+		{34, 3, 19, true},
+		{35, 0, 0, false},
+	} {
+		index, childOff, ok := fsn.ChildAt(tc.offset)
+		if index != tc.index || childOff != tc.childOff || ok != tc.ok {
+			t.Errorf("offset %d: expected (%d, %d, %t), got (%d, %d, %t)",
+				tc.offset, tc.index, tc.childOff, tc.ok, index, childOff, ok)
+		}
+	}
+
+	// The lookup follows the changes of the block sizes.
+	fsn.InsertBlockSize(0, 3)
+	if index, childOff, _ := fsn.ChildAt(10); index != 1 || childOff != 7 {
+		t.Fatalf("expected child 1 at 7, got %d at %d", index, childOff)
+	}
+	fsn.RemoveAllBlockSizes()
+	if _, _, ok := fsn.ChildAt(0); ok {
+		t.Fatal("expected no child without block sizes")
+	}
+}
+
+func TestForEachBlock(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	fsn.SetData([]byte("own"))
+	for _, bs := range []uint64{10, 0, 5} {
+		fsn.AddBlockSize(bs)
+	}
+
+	var got [][3]uint64
+	fsn.ForEachBlock(func(index int, offset, size uint64) bool {
+		got = append(got, [3]uint64{uint64(index), offset, size})
+		return true
+	})
+	if expected := [][3]uint64{{0, 0, 10}, {1, 10, 0}, {2, 10, 5}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected blocks %v, got %v", expected, got)
+	}
+	visited := 0
+	fsn.ForEachBlock(func(int, uint64, uint64) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("expected the iteration to stop, visited %d blocks", visited)
+	}
+
+	if size, err := fsn.ChildrenSize(); err != nil || size != 15 || fsn.FileSize() != 18 {
+		t.Fatalf("unexpected sizes %d (%v) and %d", size, err, fsn.FileSize())
+	}
+	fsn.AddBlockSize(math.MaxUint64)
+	if _, err := fsn.ChildrenSize(); err == nil {
+		t.Fatal("expected the overflow to be reported")
+	}
+
+	if !fsn.HasFileSize() {
+		t.Fatal("expected a file size")
+	}
+	dir, err := FSNodeFromBytes(FolderPBData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.HasFileSize() {
+		t.Fatal("expected no declared file size")
+	}
+}
+
+func TestModTime(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	if !fsn.ModTime().IsZero() {
+		t.Fatal("new node has a modification time")
+	}
+
+	for _, mtime := range []time.Time{time.Unix(1600000000, 0), time.Unix(-86400, 123456789)} {
+		fsn.SetModTime(mtime)
+		b, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfsn, err := FSNodeFromBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !nfsn.ModTime().Equal(mtime) {
+			t.Fatalf("expected %v, got %v", mtime, nfsn.ModTime())
+		}
+	}
+
+	// Removing the modification time restores the original encoding.
+	want, err := NewFSNode(TFile).GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTime, err := DataWithModTime(want, time.Unix(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := DataWithModTime(withTime, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatal("removing the modification time changed the encoding")
+	}
+}
+
+func TestMode(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	if fsn.Mode() != 0 {
+		t.Fatal("new node has a mode")
+	}
+
+	for _, m := range []os.FileMode{0755, 0600 | os.ModeSetuid | os.ModeSetgid, 0777 | os.ModeSticky} {
+		fsn.SetMode(m)
+		b, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfsn, err := FSNodeFromBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nfsn.Mode() != m {
+			t.Fatalf("expected %v, got %v", m, nfsn.Mode())
+		}
+	}
+	// Stored as POSIX bits, the type bits are left out.
+	fsn.SetMode(os.ModeDir | os.ModeSetuid | 0750)
+	if got := fsn.format.GetMode(); got != 04750 {
+		t.Fatalf("expected 04750, got %o", got)
+	}
+	fsn.SetMode(os.ModeDir)
+	if fsn.format.Mode != nil {
+		t.Fatal("mode without permissions not removed")
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	a := NewFSNode(TFile)
+	a.SetXattr("user.b", []byte("2"))
+	a.SetXattr("user.a", []byte("1"))
+	b := NewFSNode(TFile)
+	b.SetXattr("user.a", []byte("1"))
+	b.SetXattr("user.b", []byte("old"))
+	b.SetXattr("user.b", []byte("2"))
+	ab, err := a.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb, err := b.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ab, bb) {
+		t.Fatal("the encoding depends on the order the attributes were set in")
+	}
+
+	nd := EmptyFileNode()
+	nd.SetData(ab)
+	names, err := ListXattrs(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "user.a" || names[1] != "user.b" {
+		t.Fatalf("unexpected attributes %v", names)
+	}
+	if err := SetXattr(nd, "security.selinux", []byte("system_u:object_r:etc_t:s0")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := GetXattr(nd, "security.selinux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "system_u:object_r:etc_t:s0" {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if err := RemoveXattr(nd, "user.a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveXattr(nd, "user.a"); err != ErrNoXattr {
+		t.Fatalf("expected ErrNoXattr, got %v", err)
+	}
+	if _, err := GetXattr(nd, "user.a"); err != ErrNoXattr {
+		t.Fatalf("expected ErrNoXattr, got %v", err)
+	}
+	if _, err := GetXattr(dag.NewRawNode([]byte("raw")), "user.a"); err != ErrNoXattr {
+		t.Fatalf("expected ErrNoXattr for a raw node, got %v", err)
+	}
+}
+
+func TestFSNodeFromNode(t *testing.T) {
+	fsn := NewFSNode(TFile)
+	fsn.AddBlockSize(100)
+	fsn.AddBlockSize(200)
+	data, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := dag.NodeWithData(data)
+
+	a, err := FSNodeFromNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := FSNodeFromNode(dag.NodeWithData(append([]byte(nil), data...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || a.FileSize() != 300 || b.FileSize() != 300 {
+		t.Fatal("expected copies of the same decoded node for the same data")
+	}
+	// The copies are owned by the callers, editing one doesn't change the
+	// memoized node.
+	a.SetBlockSize(0, 1000)
+	if b.FileSize() != 300 || b.BlockSize(0) != 100 {
+		t.Fatal("editing a copy changed another one")
+	}
+	if a, err = FSNodeFromNode(nd); err != nil || a.FileSize() != 300 {
+		t.Fatalf("editing a copy changed the memoized node: %v", err)
+	}
+
+	// An edited node isn't taken for its previous version.
+	fsn.SetBlockSize(1, 50)
+	data, err = fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd.SetData(data)
+	c, err := FSNodeFromNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FileSize() != 150 || a.FileSize() != 300 {
+		t.Fatalf("unexpected sizes %d and %d", c.FileSize(), a.FileSize())
+	}
+
+	if _, err := FSNodeFromNode(dag.NodeWithData([]byte("garbage"))); err == nil {
+		t.Fatal("expected an error for malformed data")
+	}
 }
 
 func TestPBdataTools(t *testing.T) {
@@ -125,6 +404,40 @@ func TestPBdataTools(t *testing.T) {
 	}
 }
 
+func TestRawData(t *testing.T) {
+	nd := RawPBNode([]byte("raw leaf"))
+	data, err := UnwrapData(nd.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "raw leaf" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	if size, err := DataSize(nd.Data()); err != nil || size != 8 {
+		t.Fatalf("expected size 8, got %d (%v)", size, err)
+	}
+
+	// Without the file size, as written by other importers.
+	typ := pb.Data_Raw
+	b, err := proto.Marshal(&pb.Data{Type: &typ, Data: []byte("abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := DataSize(b); err != nil || size != 3 {
+		t.Fatalf("expected size 3, got %d (%v)", size, err)
+	}
+	fsn, err := FSNodeFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.FileSize() != 3 {
+		t.Fatalf("expected file size 3, got %d", fsn.FileSize())
+	}
+	if data, err := ReadUnixFSNodeData(dag.NodeWithData(b)); err != nil || string(data) != "abc" {
+		t.Fatalf("unexpected data %q (%v)", data, err)
+	}
+}
+
 func TestSymlinkFilesize(t *testing.T) {
 	path := "/ipfs/adad123123/meowgie.gif"
 	sym, err := SymlinkData(path)
@@ -140,6 +453,57 @@ func TestSymlinkFilesize(t *testing.T) {
 	}
 }
 
+func TestSymlinkNode(t *testing.T) {
+	nd, err := SymlinkNode("../target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := SymlinkTarget(nd.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../target" {
+		t.Fatalf("expected ../target, got %q", target)
+	}
+	if _, err := SymlinkTarget(FolderPBData()); err != ErrNotSymlink {
+		t.Fatalf("expected ErrNotSymlink, got %v", err)
+	}
+	if _, err := SymlinkTarget([]byte("garbage")); err == nil {
+		t.Fatal("expected an error for malformed data")
+	}
+}
+
+func TestShardBitfield(t *testing.T) {
+	bf, err := bitfield.NewBitfield(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf.SetBit(3)
+	bf.SetBit(200)
+	data, err := HAMTShardData(bf.Bytes(), 256, 0x22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := FSNodeFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != THAMTShard || fsn.Fanout() != 256 || fsn.HashType() != 0x22 {
+		t.Fatalf("unexpected shard %v fanout %d hash %x", fsn.Type(), fsn.Fanout(), fsn.HashType())
+	}
+	got, err := fsn.ShardBitfield()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Ones() != 2 || !got.Bit(3) || !got.Bit(200) {
+		t.Fatal("unexpected bitfield")
+	}
+
+	if _, err := NewFSNode(TDirectory).ShardBitfield(); err != ErrNotShard {
+		t.Fatalf("expected ErrNotShard, got %v", err)
+	}
+}
+
 func TestMetadata(t *testing.T) {
 	meta := &Metadata{
 		MimeType: "audio/aiff",
@@ -162,12 +526,43 @@ func TestMetadata(t *testing.T) {
 	}
 
 	mimeAiff := meta.MimeType == "audio/aiff"
-	if !mimeAiff {
+	if !mimeAiff || meta.Size != 12345 {
 		t.Fatal("Metadata does not Marshal and Unmarshal properly!")
 	}
 
 }
 
+func TestEmptyNodes(t *testing.T) {
+	for _, tc := range []struct {
+		nd  *dag.ProtoNode
+		typ pb.Data_DataType
+		cid string
+	}{
+		{EmptyFileNode(), TFile, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{EmptyDirNode(), TDirectory, "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"},
+	} {
+		if tc.nd.Cid().String() != tc.cid {
+			t.Errorf("expected the empty %s CID %s, got %s", tc.typ, tc.cid, tc.nd.Cid())
+		}
+		fsn, err := FSNodeFromBytes(tc.nd.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsn.Type() != tc.typ || fsn.FileSize() != 0 || len(fsn.Data()) != 0 || len(tc.nd.Links()) != 0 {
+			t.Errorf("unexpected empty %s node %v", tc.typ, fsn)
+		}
+	}
+
+	// Every call returns a new node.
+	nd := EmptyDirNode()
+	if err := nd.AddNodeLink("file", EmptyFileNode()); err != nil {
+		t.Fatal(err)
+	}
+	if len(EmptyDirNode().Links()) != 0 {
+		t.Fatal("editing an empty node changed the next ones")
+	}
+}
+
 func TestIsDir(t *testing.T) {
 	prepares := map[pb.Data_DataType]bool{
 		TDirectory: true,
@@ -0,0 +1,208 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/TRON-US/go-unixfs/events"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// FindingKind is the kind of inconsistency of a `Finding`.
+type FindingKind int
+
+const (
+	// FileSizeMismatch is a node whose file size isn't the size of its
+	// data plus the block sizes of its children (the length of its data
+	// for a leaf), or a `TMetadata` wrapper whose size isn't the one of
+	// the file it wraps.
+	FileSizeMismatch FindingKind = iota
+	// BlockSizeMismatch is a child whose size isn't the block size its
+	// parent declares for it.
+	BlockSizeMismatch
+	// ChildCountMismatch is a node with a different number of block sizes
+	// than links, its children can't be checked.
+	ChildCountMismatch
+	// Malformed is a node that can't be decoded or isn't part of a file
+	// (a directory or a symlink), its children can't be checked.
+	Malformed
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case FileSizeMismatch:
+		return "file size mismatch"
+	case BlockSizeMismatch:
+		return "block size mismatch"
+	case ChildCountMismatch:
+		return "child count mismatch"
+	case Malformed:
+		return "malformed node"
+	default:
+		return fmt.Sprintf("FindingKind(%d)", int(k))
+	}
+}
+
+// Finding is an inconsistency found by `Validate`.
+type Finding struct {
+	Kind FindingKind
+	// Cid is the offending node and Path the indexes of the links leading
+	// to it from the root.
+	Cid  cid.Cid
+	Path []int
+	// Declared and Actual are the mismatching sizes (or counts).
+	Declared uint64
+	Actual   uint64
+	// Err is the decoding error of a `Malformed` node, if any.
+	Err error
+}
+
+func (f Finding) String() string {
+	if f.Kind == Malformed && f.Err != nil {
+		return fmt.Sprintf("%s at %v (%s): %s", f.Kind, f.Path, f.Cid, f.Err)
+	}
+	return fmt.Sprintf("%s at %v (%s): declares %d, has %d", f.Kind, f.Path, f.Cid, f.Declared, f.Actual)
+}
+
+// Validate walks the whole file DAG under `nd`, fetching its nodes from
+// `ng`, and returns the inconsistencies between the sizes it declares and
+// the data it holds, nil if there are none. An error is only returned if a
+// node can't be fetched (or `ctx` is done), along with the findings so far.
+func Validate(ctx context.Context, nd ipld.Node, ng ipld.NodeGetter) ([]Finding, error) {
+	return ValidateWithOptions(ctx, nd, ng, ValidateOptions{})
+}
+
+// ValidateOptions are the options of `ValidateWithOptions`.
+type ValidateOptions struct {
+	// Events, if set, receives an `events.OpVerify` event for every node
+	// checked, with the size of its block, and for every finding, with
+	// the finding as the error.
+	Events events.Emitter
+}
+
+// ValidateWithOptions is `Validate` with options.
+func ValidateWithOptions(ctx context.Context, nd ipld.Node, ng ipld.NodeGetter, opts ValidateOptions) ([]Finding, error) {
+	v := &validator{ctx: ctx, ng: ng, events: opts.Events}
+	_, _, err := v.validate(nd, nil)
+	return v.findings, err
+}
+
+type validator struct {
+	ctx      context.Context
+	ng       ipld.NodeGetter
+	events   events.Emitter
+	findings []Finding
+}
+
+func (v *validator) report(f Finding, nd ipld.Node, path []int) {
+	f.Cid = nd.Cid()
+	f.Path = make([]int, len(path))
+	copy(f.Path, path)
+	v.findings = append(v.findings, f)
+	events.Emit(v.events, events.Event{Operation: events.OpVerify, Cid: f.Cid, Err: errors.New(f.String())})
+}
+
+// validate checks the node `nd` at `path` and its children, returning
+// the size of the data under it, or false if it can't be known.
+func (v *validator) validate(nd ipld.Node, path []int) (uint64, bool, error) {
+	events.Emit(v.events, events.Event{Operation: events.OpVerify, Cid: nd.Cid(), Bytes: uint64(len(nd.RawData()))})
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		if IsRawLeaf(nd) {
+			return uint64(len(nd.RawData())), true, nil
+		}
+		v.report(Finding{Kind: Malformed, Err: ErrUnrecognizedType}, nd, path)
+		return 0, false, nil
+	}
+	fsn, err := FSNodeFromBytes(pn.Data())
+	if err != nil {
+		v.report(Finding{Kind: Malformed, Err: withKey(err, nd.Cid())}, nd, path)
+		return 0, false, nil
+	}
+
+	switch fsn.Type() {
+	case TFile, TRaw, TTokenMeta:
+	case TMetadata:
+		return v.validateMetadata(pn, path)
+	default:
+		v.report(Finding{Kind: Malformed, Err: fmt.Errorf("unexpected %s node", fsn.Type())}, nd, path)
+		return 0, false, nil
+	}
+
+	declared, err := fsn.ChildrenSize()
+	if err == nil {
+		declared, err = AddSizes(declared, uint64(len(fsn.Data())))
+	}
+	if err != nil {
+		v.report(Finding{Kind: Malformed, Err: err}, nd, path)
+		return 0, false, nil
+	}
+	if fsn.FileSize() != declared {
+		v.report(Finding{Kind: FileSizeMismatch, Declared: fsn.FileSize(), Actual: declared}, nd, path)
+	}
+	links := pn.Links()
+	if len(links) == 0 {
+		return declared, true, nil
+	}
+	if fsn.NumChildren() != len(links) {
+		v.report(Finding{Kind: ChildCountMismatch, Declared: uint64(fsn.NumChildren()), Actual: uint64(len(links))}, nd, path)
+		return 0, false, nil
+	}
+
+	cids := make([]cid.Cid, len(links))
+	for i, l := range links {
+		cids[i] = l.Cid
+	}
+	actual, known := uint64(len(fsn.Data())), true
+	for i, promise := range ipld.GetNodes(v.ctx, v.ng, cids) {
+		child, err := promise.Get(v.ctx)
+		if err != nil {
+			return 0, false, err
+		}
+		size, ok, err := v.validate(child, append(path, i))
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			known = false
+			continue
+		}
+		if size != fsn.BlockSize(i) {
+			v.report(Finding{Kind: BlockSizeMismatch, Declared: fsn.BlockSize(i), Actual: size}, child, append(path, i))
+		}
+		if actual, err = AddSizes(actual, size); err != nil {
+			v.report(Finding{Kind: Malformed, Err: err}, nd, path)
+			return 0, false, nil
+		}
+	}
+	return actual, known, nil
+}
+
+// validateMetadata checks a `TMetadata` wrapper and the file it wraps.
+func (v *validator) validateMetadata(pn *dag.ProtoNode, path []int) (uint64, bool, error) {
+	md, err := MetadataFromBytes(pn.Data())
+	if err != nil {
+		v.report(Finding{Kind: Malformed, Err: err}, pn, path)
+		return 0, false, nil
+	}
+	if len(pn.Links()) == 0 {
+		v.report(Finding{Kind: Malformed, Err: ErrMalformedFileFormat}, pn, path)
+		return 0, false, nil
+	}
+	child, err := pn.Links()[0].GetNode(v.ctx, v.ng)
+	if err != nil {
+		return 0, false, err
+	}
+	size, ok, err := v.validate(child, append(path, 0))
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	if md.Size != size {
+		v.report(Finding{Kind: FileSizeMismatch, Declared: md.Size, Actual: size}, pn, path)
+	}
+	return size, true, nil
+}
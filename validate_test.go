@@ -0,0 +1,134 @@
+package unixfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/TRON-US/go-unixfs/events"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	add := func(nd ipld.Node) ipld.Node {
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	// internal returns a file node over `children` declaring `sizes`.
+	internal := func(sizes []uint64, children ...ipld.Node) ipld.Node {
+		fsn := NewFSNode(TFile)
+		for _, s := range sizes {
+			fsn.AddBlockSize(s)
+		}
+		b, err := fsn.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd := dag.NodeWithData(b)
+		for _, c := range children {
+			if err := nd.AddNodeLink("", c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return add(nd)
+	}
+	wrap := func(size uint64, nd ipld.Node) ipld.Node {
+		b, err := BytesForMetadata(&Metadata{MimeType: "text/plain", Size: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := dag.NodeWithData(b)
+		if err := w.AddNodeLink("", nd); err != nil {
+			t.Fatal(err)
+		}
+		return add(w)
+	}
+
+	hello := add(dag.NodeWithData(FilePBData([]byte("hello"), 5)))
+	world := add(dag.NewRawNode([]byte("world!")))
+	tail := add(dag.NodeWithData(FilePBData([]byte("tail"), 4)))
+	good := internal([]uint64{11, 4}, internal([]uint64{5, 6}, hello, world), tail)
+
+	badLeaf := add(dag.NodeWithData(FilePBData([]byte("hello"), 4)))
+	badBlockSize := internal([]uint64{5, 7}, badLeaf, world)
+	bad := internal([]uint64{12, 4}, badBlockSize, tail)
+
+	for _, tc := range []struct {
+		name     string
+		nd       ipld.Node
+		findings []Finding
+	}{
+		{"Consistent", good, nil},
+		{"Metadata", wrap(15, good), nil},
+		{"RawLeaf", world, nil},
+		{"Corrupted", bad, []Finding{
+			{Kind: FileSizeMismatch, Cid: badLeaf.Cid(), Path: []int{0, 0}, Declared: 4, Actual: 5},
+			{Kind: BlockSizeMismatch, Cid: world.Cid(), Path: []int{0, 1}, Declared: 7, Actual: 6},
+			{Kind: BlockSizeMismatch, Cid: badBlockSize.Cid(), Path: []int{0}, Declared: 12, Actual: 11},
+		}},
+		{"WrongMetadataSize", wrap(14, good), []Finding{
+			{Kind: FileSizeMismatch, Cid: wrap(14, good).Cid(), Path: []int{}, Declared: 14, Actual: 15},
+		}},
+		{"ChildCount", internal([]uint64{5}, hello, world), []Finding{
+			{Kind: ChildCountMismatch, Cid: internal([]uint64{5}, hello, world).Cid(), Path: []int{}, Declared: 1, Actual: 2},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			evCh := make(chan events.Event, 100)
+			findings, err := ValidateWithOptions(ctx, tc.nd, ds, ValidateOptions{Events: events.ChanEmitter(evCh)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(findings, tc.findings) {
+				t.Fatalf("expected findings %v, got %v", tc.findings, findings)
+			}
+
+			// An event for the root, and one for every finding.
+			close(evCh)
+			var checked, reported []events.Event
+			for e := range evCh {
+				if e.Operation != events.OpVerify {
+					t.Fatalf("unexpected event %+v", e)
+				}
+				if e.Err != nil {
+					reported = append(reported, e)
+				} else {
+					checked = append(checked, e)
+				}
+			}
+			if len(checked) == 0 || !checked[0].Cid.Equals(tc.nd.Cid()) || checked[0].Bytes != uint64(len(tc.nd.RawData())) {
+				t.Fatalf("expected an event for the root first, got %+v", checked)
+			}
+			if len(reported) != len(findings) {
+				t.Fatalf("expected %d findings reported, got %+v", len(findings), reported)
+			}
+			for i, e := range reported {
+				if !e.Cid.Equals(findings[i].Cid) || e.Err.Error() != findings[i].String() {
+					t.Fatalf("expected %v reported, got %+v", findings[i], e)
+				}
+			}
+		})
+	}
+
+	dir := add(EmptyDirNode())
+	findings, err := Validate(ctx, internal([]uint64{0}, dir), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Kind != Malformed || !reflect.DeepEqual(findings[0].Path, []int{0}) {
+		t.Fatalf("expected the directory to be reported, got %v", findings)
+	}
+
+	missing := dag.NodeWithData(FilePBData([]byte("lost"), 4))
+	if _, err := Validate(ctx, internal([]uint64{4}, missing), ds); err == nil {
+		t.Fatal("expected missing nodes to fail the validation")
+	}
+}